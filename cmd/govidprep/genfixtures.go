@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/melody-ding/go-vidprep/internal/fixtures"
+)
+
+// runGenFixtures implements the gen-fixtures subcommand, which writes a tar
+// of synthetic test-pattern clips
+func runGenFixtures(args []string) {
+	fs := flag.NewFlagSet("gen-fixtures", flag.ExitOnError)
+	out := fs.String("out", "fixtures.tar", "Path of the .tar archive to write")
+	count := fs.Int("count", 4, "Number of clips to generate")
+	duration := fs.Float64("duration", 3, "Duration of each clip in seconds")
+	fps := fs.Int("fps", 24, "Frame rate of each clip")
+	size := fs.String("size", "320x240", "Frame size of each clip (e.g. 320x240)")
+	codec := fs.String("codec", "libx264", "ffmpeg video encoder (e.g. libx264, libx265, mpeg4, libvpx-vp9)")
+	pattern := fs.String("pattern", "testsrc2", "Source pattern (testsrc2, smptebars, color)")
+	audio := fs.Bool("audio", false, "Add a sine tone audio track to each clip")
+	fs.Parse(args)
+
+	opts := fixtures.Options{
+		Count:    *count,
+		Duration: *duration,
+		FPS:      *fps,
+		Size:     *size,
+		Codec:    *codec,
+		Pattern:  fixtures.Pattern(*pattern),
+		Audio:    *audio,
+	}
+	if err := fixtures.Generate(*out, opts); err != nil {
+		fmt.Printf("Error generating fixtures: %v\n", err)
+		return
+	}
+	fmt.Printf("Wrote %d synthetic clips to %s\n", *count, *out)
+}
@@ -4,71 +4,840 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/melody-ding/go-vidprep/internal/annotations"
+	"github.com/melody-ding/go-vidprep/internal/checkpoint"
+	"github.com/melody-ding/go-vidprep/internal/dataset"
+	"github.com/melody-ding/go-vidprep/internal/dedup"
+	"github.com/melody-ding/go-vidprep/internal/embedding"
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+	"github.com/melody-ding/go-vidprep/internal/parquet"
 	"github.com/melody-ding/go-vidprep/internal/processor"
 	"github.com/melody-ding/go-vidprep/internal/sharding"
+	"github.com/melody-ding/go-vidprep/internal/shuffle"
+	"github.com/melody-ding/go-vidprep/internal/stats"
 	"github.com/melody-ding/go-vidprep/internal/tar_reader"
+	"github.com/melody-ding/go-vidprep/internal/types"
+	"github.com/melody-ding/go-vidprep/internal/zarr"
 )
 
 func main() {
-	tarPath := flag.String("tar", "", "Path to input .tar archive")
+	// Dispatch subcommands; without one, or with process, flags configure
+	// a processing run
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "process":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "gen-fixtures":
+			runGenFixtures(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "npy-info":
+			runNpyInfo(os.Args[2:])
+			return
+		case "version":
+			runVersion(os.Args[2:])
+			return
+		}
+	}
+
+	var tarPatterns stringList
+	flag.Var(&tarPatterns, "tar", "Input .tar archive or video: a path, glob or brace pattern (data-{0000..0099}.tar), s3:// or gs:// URI, http(s) URL, or - for stdin; repeat for several, which prefixes clip keys with the archive name")
+	inputDir := flag.String("input-dir", "", "Directory tree of video clips to process instead of a tar archive")
+	followSymlinks := flag.Bool("follow-symlinks", false, "Descend into symlinked directories of -input-dir, skipping links that form cycles")
+	maxDepth := flag.Int("max-depth", 0, "Read at most this many directory levels of -input-dir (0 = unlimited)")
+	datasetLayout := flag.String("dataset", "", "Read -input-dir as a dataset in this layout, labelling clips by class: folders (class-per-directory), ucf101, hmdb51 or kinetics")
+	datasetSplit := flag.String("dataset-split", "", "Official split of -dataset to read: a UCF101 split list, a glob of HMDB51 split files or a Kinetics annotation CSV")
+	datasetSubset := flag.String("dataset-subset", "", "Subset of the -dataset-split to read: train (default) or test for HMDB51, or the split column value of a Kinetics CSV")
+	manifestPath := flag.String("manifest", "", "CSV or JSONL manifest listing the videos to process, with optional per-clip label, caption, start and end")
+	urlList := flag.String("url-list", "", "Text file of video URLs (with optional sha256/md5 checksums) to download and process")
+	downloadWorkers := flag.Int("download-workers", 8, "Number of concurrent downloads for -url-list and -ytdlp-list")
+	ytdlpList := flag.String("ytdlp-list", "", "Text file of YouTube video IDs or video page URLs to download with yt-dlp and process")
+	ytdlpMaxHeight := flag.Int("ytdlp-max-height", 0, "Download the best format at or below this height with -ytdlp-list (0 = best available)")
+	extensions := flag.String("extensions", strings.Join(tar_reader.DefaultExtensions, ","), "Comma-separated video file extensions to read from the input")
+	pathKeys := flag.Bool("path-keys", false, "Key clips by their path within the archive or directory (e.g. a/clip) instead of their base name")
+	duplicateKeys := flag.String("duplicate-keys", tar_reader.DuplicateError, "What to do when two clips have the same key (error, suffix to rename with _2, _3, ...)")
+	include := flag.String("include", "", "Only process clips whose key matches this regular expression (e.g. ^kinetics/train/)")
+	exclude := flag.String("exclude", "", "Skip clips whose key matches this regular expression")
+	maxClips := flag.Int("max-clips", 0, "Stop after reading this many clips, e.g. for a pilot run (0 = all)")
+	sampleFraction := flag.Float64("sample-fraction", 0, "Process a random fraction of the clips, chosen by -seed (e.g. 0.01 for a 1% pilot run; 0 = all)")
+	dedupFlag := flag.Bool("dedup", false, "Skip clips whose raw bytes duplicate an earlier clip, recording decisions in dedup_report.jsonl in the output directory")
+	shuffleClips := flag.Bool("shuffle", false, "Process and shard clips in a random order chosen by -seed instead of input order (not with -stream)")
+	tarIndexDir := flag.String("tar-index-dir", defaultTarIndexDir(), "Directory caching entry indexes of local uncompressed tar archives so later runs seek to the clips they need (empty to disable)")
+	stream := flag.Bool("stream", false, "Hand clips to workers as they are read instead of loading the whole input first, bounding memory to a few clips")
 	outputDir := flag.String("out", "output", "Directory to save extracted frames")
 	fps := flag.Int("fps", 8, "Target frames per second")
 	size := flag.String("size", "256x256", "Resize videos to this resolution (e.g. 256x256)")
-	format := flag.String("format", "jpg", "Output format (jpg, npy)")
+	format := flag.String("format", "jpg", "Output format (jpg, png, npy, npz, pt)")
+	pixFmt := flag.String("pix-fmt", "", "Sample layout of npy chunks: rgb24, bgr24, gray, yuv420p or rgb48 (default rgb24, or rgb48 with -bit-depth 16)")
+	colorMatrix := flag.String("color-matrix", "", "Force the YUV matrix of the source when converting it: bt601 or bt709 (default: the source's tag)")
+	colorRange := flag.String("color-range", "", "Force the YUV range of the source when converting it: limited or full (default: the source's tag)")
+	jpegQuality := flag.Int("jpeg-quality", 0, "Quality scale of jpg frames (ffmpeg -q:v): 2 (best, largest) to 31 (worst, smallest); 0 = encoder default")
+	preview := flag.String("preview", "", "Write a low-res animated preview of each chunk: gif or webp (default: none)")
+	previewWidth := flag.Int("preview-width", 160, "Width in pixels of chunk previews")
+	audio := flag.String("audio", "", "Write the audio aligned to each chunk as mono wav or flac (default: none)")
+	audioRate := flag.Int("audio-rate", 16000, "Sample rate in Hz of chunk audio")
+	audioOnly := flag.Bool("audio-only", false, "Skip frames and write each chunk's audio as a mono float32 waveform array (npy, npz or pt)")
+	videoStream := flag.Int("video-stream", 0, "Index of the video stream to chunk, among the video streams of multi-camera or stereo sources")
+	allStreams := flag.Bool("all-streams", false, "Chunk every video stream as its own synchronized chunk set, keyed <key>/stream_<index>")
+	bitDepth := flag.Int("bit-depth", 8, "Output bit depth per channel (8, or 16 for png/npy)")
+	motion := flag.Bool("motion", false, "Record per-chunk motion statistics (mean absolute frame difference, percentage of static frames) in metadata")
+	staticThreshold := flag.Float64("static-threshold", 0.01, "Mean absolute difference from the previous frame, on a 0-1 scale, below which a frame counts as static")
+	qualityMetrics := flag.Bool("quality-metrics", false, "Compute per-chunk PSNR/SSIM against the source and store them in metadata")
+	vmaf := flag.Bool("vmaf", false, "Compute a per-chunk VMAF score (requires ffmpeg built with libvmaf) and store it in metadata")
+	minFrames := flag.Int("min-frames", 0, "Skip clips yielding fewer frames than this at -fps before extracting them, e.g. -frames to skip clips too short for one chunk (0 = off)")
+	minDuration := flag.Float64("min-duration", 0, "Skip clips shorter than this many seconds before extracting them (0 = off)")
+	precheck := flag.Bool("precheck", false, "Probe each clip before processing and skip empty, truncated or undecodable files with a logged reason")
+	autoRotate := flag.Bool("autorotate", true, "Rotate video with a rotation flag (e.g. phone video shot in portrait) upright (use -autorotate=false to keep frames as encoded)")
+	interpolate := flag.Bool("interpolate", false, "Reach -fps by synthesizing intermediate frames with motion interpolation (minterpolate) instead of duplicating frames; slow")
+	deinterlace := flag.String("deinterlace", "", "Deinterlace with yadif: on (every clip) or auto (clips ffprobe reports as interlaced)")
+	autoCropLimit := flag.Int("autocrop-limit", 24, "Brightness (1-255) below which -autocrop counts pixels as black; raise it for noisy or compressed bars")
+	denoise := flag.String("denoise", "", "Denoise frames, e.g. low-light footage: hqdn3d (fast) or nlmeans (slower, higher quality)")
+	denoiseStrength := flag.Float64("denoise-strength", 0, "Strength of -denoise: hqdn3d luma spatial strength (default 4) or nlmeans s (default 1); 0 = filter default")
+	autoCrop := flag.Bool("autocrop", false, "Detect and crop letterbox/pillarbox black bars before scaling")
+	decimate := flag.Bool("decimate", false, "Drop consecutive near-identical frames (mpdecimate) before chunking")
+	silence := flag.String("silence", "", "Detect chunks with silent audio and flag or drop them (flag, drop)")
+	silenceThreshold := flag.Float64("silence-threshold", -50, "Noise level in dB below which audio counts as silent")
+	sceneSplit := flag.Bool("scene-split", false, "Split each clip into shots at scene changes and chunk every shot separately")
+	sceneThreshold := flag.Float64("scene-threshold", 0.3, "Scene score (0-1) above which a frame starts a new shot with -scene-split; lower splits more")
+	spansPath := flag.String("spans", "", "JSON or CSV file of per-clip annotation spans (start, end, label); only annotated spans are processed")
+	denseLabelsPath := flag.String("dense-labels", "", "JSON file of per-second/per-frame labels to align with each chunk")
+	uniformFrames := flag.Int("uniform-frames", 0, "Sample this many frames spread evenly over each whole clip as its single sample, instead of chunking at -fps (0 = off)")
+	timestampsPath := flag.String("timestamps", "", "JSON or CSV file of per-clip frame timestamps; each listed clip's frames at those times become one sample")
+	boxesPath := flag.String("boxes", "", "JSON file of per-clip bounding boxes to crop to (smoothed) before scaling")
+	boxSmoothing := flag.Int("box-smoothing", 5, "Number of consecutive boxes averaged to smooth the crop window")
+	debug := flag.Bool("debug", false, "Write each clip's ffmpeg command lines and stderr to ffmpeg.log and include stderr in errors")
+	debugOverlay := flag.Bool("debug-overlay", false, "Burn the clip key, frame index and timestamp into each output frame")
+	chunkDigits := flag.Int("chunk-digits", 5, "Zero-padded width of chunk numbers")
+	chunkStart := flag.Int("chunk-start", 0, "Number of each clip's first chunk")
+	framePattern := flag.String("frame-pattern", "frame_%06d", "printf-style frame file name within a chunk, without extension")
+	frameStart := flag.Int("frame-start", 1, "Number of the first frame within each chunk")
+	crop := flag.String("crop", "", "Fit frames to -size by cropping instead of scaling the full frame: center (resize the shorter side, then center crop) or random (crop at an offset chosen by -seed and the clip key)")
+	var transformSpecs stringList
+	flag.Var(&transformSpecs, "transform", "Registered transform to apply after the built-in ones, as name or name=params (e.g. boxblur=2); repeat to chain: "+strings.Join(processor.RegisteredTransforms(), ", "))
+	vfExtra := flag.String("vf-extra", "", "ffmpeg filter chain appended after the built-in transforms (e.g. eq=contrast=1.1,unsharp)")
+	emitFlipped := flag.Bool("emit-flipped", false, "Also write a horizontally mirrored copy of each chunk as a sibling sample with a _flip suffix")
+	multiCrop := flag.String("multi-crop", "", "Emit evaluation crops of each chunk as sibling samples (three, ten)")
+	augCopies := flag.Int("aug-copies", 0, "Emit this many randomly augmented copies (crop, zoom, flip, color jitter) of each chunk as sibling samples")
+	chunkSeconds := flag.Float64("chunk-seconds", 0, "Chunk length in seconds, overriding -frames with the frame count at -fps, e.g. 2.0 (0 = use -frames)")
+	randomChunks := flag.Int("random-chunks", 0, "Extract this many chunks per clip at random (seeded) offsets instead of chunking it exhaustively (0 = off)")
+	maxChunks := flag.Int("max-chunks-per-clip", 0, "Cap the number of chunks a single clip contributes, so long videos don't dominate (0 = no cap)")
+	maxChunksUniform := flag.Bool("max-chunks-uniform", false, "With -max-chunks-per-clip, keep chunks spread evenly over the clip instead of the first ones")
+	stride := flag.Int("stride", 0, "Frames between the starts of consecutive chunks; below -frames chunks overlap, e.g. -frames 16 -stride 8 (0 = -frames)")
+	chunkJitter := flag.Bool("chunk-jitter", false, "Start each clip's first chunk at a random (seeded) frame offset instead of frame 0")
+	metadataFormat := flag.String("metadata-format", "json", "Serialization of chunk metadata files (json, msgpack, cbor)")
+	keyframeAlign := flag.Bool("keyframe-align", false, "Start each chunk at a source keyframe for faster decoding, discarding the frames in between")
+	seed := flag.Int64("seed", 0, "Seed for random choices such as chunk jitter, augmentation, clip sampling and shuffling, and the shard shuffle buffer")
 	targetFrames := flag.Int("frames", 16, "Target number of frames per clip (will pad or trim as needed)")
+	memoryLimitMB := flag.Int("memory-limit-mb", 0, "Pause workers while process memory is above this many MB (0 = no limit)")
+	computeStatsFlag := flag.Bool("compute-stats", false, "Compute per-channel mean/std over the produced chunks and write them to dataset.json")
+	statsMaxChunks := flag.Int("stats-max-chunks", 0, "Sample at most this many chunks when computing statistics (0 = all)")
+	normalize := flag.Bool("normalize", false, "Write npy chunks as float32 normalized by -mean/-std, or by the statistics in <out>/dataset.json")
+	dtype := flag.String("dtype", "", "Sample type of npy chunks: float32 for samples scaled to 0-1, or normalized with -normalize (default: unsigned integers of -bit-depth)")
+	layout := flag.String("layout", "thwc", "Axis order of npy chunks: thwc (frames, height, width, channels) or tchw (channels-first, as PyTorch video models expect)")
+	mean := flag.String("mean", "", "Comma-separated per-channel mean for -normalize (e.g. 0.485,0.456,0.406)")
+	std := flag.String("std", "", "Comma-separated per-channel std for -normalize (e.g. 0.229,0.224,0.225)")
 	workers := flag.Int("workers", runtime.NumCPU(), "Number of parallel workers (default: number of CPU cores)")
 	shardSize := flag.Int("shard-size", 1000, "Number of chunks per shard")
+	embedCmd := flag.String("embed-cmd", "", "Shell command computing each npy, npz or pt chunk's embedding: reads the chunk on stdin (key in $VIDPREP_KEY) and prints a JSON array of numbers, stored as <chunk>.emb.npy")
+	embedURL := flag.String("embed-url", "", "HTTP endpoint computing each npy, npz or pt chunk's embedding: receives the chunk as a POST body and responds with a JSON array of numbers, stored as <chunk>.emb.npy")
 	shardDir := flag.String("shard-dir", "", "Output directory for WebDataset shards")
+	parquetDir := flag.String("parquet-dir", "", "Output directory for Parquet files of npy or npz chunks, one row per chunk")
+	parquetRows := flag.Int("parquet-rows", 1000, "Number of chunks per Parquet file")
+	zarrDir := flag.String("zarr-dir", "", "Output directory for a Zarr v3 array holding all npy or npz chunks")
+	shuffleBuffer := flag.Int("shuffle-buffer", 0, "Mix samples through a seeded shuffle buffer of this many samples before packing shards (0 = key order)")
+	resume := flag.Bool("resume", false, "Resume an interrupted run, skipping clips already processed and keeping complete shards")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: govidprep [process] [flags] [video or archive...]")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	// Positional arguments are inputs like -tar, e.g. a few loose videos
+	tarPatterns, err := inputPatterns(tarPatterns, flag.Args())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
 	// Validate format
 	outputFormat := processor.OutputFormat(*format)
 	switch outputFormat {
-	case processor.FormatJPEG, processor.FormatNPY:
+	case processor.FormatJPEG, processor.FormatPNG, processor.FormatNPY, processor.FormatNPZ, processor.FormatPT:
 		// Valid format
 	default:
-		fmt.Printf("Error: unsupported format %s. Supported formats are: jpg, npy\n", *format)
+		fmt.Printf("Error: unsupported format %s. Supported formats are: jpg, png, npy, npz, pt\n", *format)
+		return
+	}
+	if *parquetDir != "" {
+		if outputFormat != processor.FormatNPY && outputFormat != processor.FormatNPZ {
+			fmt.Printf("Error: -parquet-dir needs npy or npz output\n")
+			return
+		}
+		if metaformat.Format(*metadataFormat) != metaformat.JSON {
+			fmt.Printf("Error: -parquet-dir needs json metadata\n")
+			return
+		}
+	}
+	if *zarrDir != "" && outputFormat != processor.FormatNPY && outputFormat != processor.FormatNPZ {
+		fmt.Printf("Error: -zarr-dir needs npy or npz output\n")
+		return
+	}
+	// Statistics are computed over uint8/uint16 channels-last frames
+	if *computeStatsFlag && (*normalize || *audioOnly || processor.DType(*dtype) == processor.DTypeFloat32 || processor.Layout(*layout) == processor.LayoutTCHW) {
+		fmt.Printf("Error: -compute-stats needs integer channels-last frames, so it can't be combined with -normalize, -dtype float32, -layout tchw or -audio-only\n")
+		return
+	}
+	if *embedCmd != "" || *embedURL != "" {
+		if *embedCmd != "" && *embedURL != "" {
+			fmt.Printf("Error: -embed-cmd and -embed-url can't be combined\n")
+			return
+		}
+		if outputFormat != processor.FormatNPY && outputFormat != processor.FormatNPZ && outputFormat != processor.FormatPT {
+			fmt.Printf("Error: -embed-cmd and -embed-url need npy, npz or pt output\n")
+			return
+		}
+	}
+	// A zero threshold would select the default rather than apply as given
+	if *silenceThreshold >= 0 {
+		fmt.Printf("Error: -silence-threshold must be below 0 dB\n")
+		return
+	}
+	if *autoCropLimit == 0 {
+		fmt.Printf("Error: -autocrop-limit must be between 1 and 255\n")
+		return
+	}
+	if *sceneThreshold == 0 {
+		fmt.Printf("Error: -scene-threshold must be above 0\n")
+		return
+	}
+	if *staticThreshold == 0 {
+		fmt.Printf("Error: -static-threshold must be above 0\n")
+		return
+	}
+
+	opts := processor.Options{
+		OutputDir:          *outputDir,
+		FPS:                *fps,
+		Size:               *size,
+		Format:             outputFormat,
+		TargetFrames:       *targetFrames,
+		ChunkSeconds:       *chunkSeconds,
+		BitDepth:           *bitDepth,
+		PixelFormat:        processor.PixelFormat(*pixFmt),
+		JPEGQuality:        *jpegQuality,
+		DType:              processor.DType(*dtype),
+		Layout:             processor.Layout(*layout),
+		Preview:            processor.PreviewFormat(*preview),
+		PreviewWidth:       *previewWidth,
+		Audio:              processor.AudioFormat(*audio),
+		AudioSampleRate:    *audioRate,
+		AudioOnly:          *audioOnly,
+		VideoStream:        *videoStream,
+		AllStreams:         *allStreams,
+		ColorMatrix:        processor.ColorMatrix(*colorMatrix),
+		ColorRange:         processor.ColorRange(*colorRange),
+		MotionStats:        *motion,
+		StaticThreshold:    *staticThreshold,
+		QualityMetrics:     *qualityMetrics,
+		VMAF:               *vmaf,
+		Precheck:           *precheck,
+		MinFrames:          *minFrames,
+		MinDuration:        *minDuration,
+		NoAutoRotate:       !*autoRotate,
+		Interpolate:        *interpolate,
+		Deinterlace:        processor.DeinterlaceMode(*deinterlace),
+		Denoise:            *denoise,
+		DenoiseStrength:    *denoiseStrength,
+		AutoCrop:           *autoCrop,
+		AutoCropLimit:      *autoCropLimit,
+		Decimate:           *decimate,
+		Silence:            processor.SilenceMode(*silence),
+		SilenceThresholdDB: *silenceThreshold,
+		SceneSplit:         *sceneSplit,
+		SceneThreshold:     *sceneThreshold,
+		Debug:              *debug,
+		DebugOverlay:       *debugOverlay,
+		MemoryLimit:        uint64(*memoryLimitMB) << 20,
+		ChunkDigits:        *chunkDigits,
+		ChunkStart:         *chunkStart,
+		FramePattern:       *framePattern,
+		FrameOffset:        *frameStart - 1,
+		Crop:               processor.CropMode(*crop),
+		ExtraFilters:       strings.TrimSpace(*vfExtra),
+		EmitFlipped:        *emitFlipped,
+		MultiCrop:          processor.MultiCropMode(*multiCrop),
+		ChunkJitter:        *chunkJitter,
+		Stride:             *stride,
+		MaxChunks:          *maxChunks,
+		RandomChunks:       *randomChunks,
+		MaxChunksUniform:   *maxChunksUniform,
+		Seed:               *seed,
+		BoxSmoothing:       *boxSmoothing,
+		KeyframeAlign:      *keyframeAlign,
+		UniformFrames:      *uniformFrames,
+		MetadataFormat:     metaformat.Format(*metadataFormat),
+		AugCopies:          *augCopies,
+	}
+	if *normalize {
+		norm, err := loadNormalization(*mean, *std, *outputDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		opts.Normalize = norm
+	}
+	for _, spec := range transformSpecs {
+		t, err := processor.ParseTransform(spec)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		opts.Transforms = append(opts.Transforms, t)
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if countSet(len(tarPatterns) > 0, *inputDir != "", *manifestPath != "", *urlList != "", *ytdlpList != "") > 1 {
+		fmt.Println("Error: specify only one of -tar, -input-dir, -manifest, -url-list and -ytdlp-list")
+		return
+	}
+	readOpts := tar_reader.Options{
+		Extensions:     strings.Split(*extensions, ","),
+		PathKeys:       *pathKeys,
+		Duplicates:     *duplicateKeys,
+		MaxClips:       *maxClips,
+		SampleFraction: *sampleFraction,
+		Seed:           *seed,
+		IndexDir:       *tarIndexDir,
+		FollowSymlinks: *followSymlinks,
+		MaxDepth:       *maxDepth,
+		OnDuplicate: func(key, renamed, path string) {
+			fmt.Printf("Warning: duplicate clip key %s for %s, renamed to %s\n", key, path, renamed)
+		},
+	}
+	if readOpts.Include, err = compileFilter("include", *include); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if readOpts.Exclude, err = compileFilter("exclude", *exclude); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	if err := readOpts.Validate(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	tarPaths, err := tar_reader.ExpandTarPaths(tarPatterns, readOpts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	inputs := tarPaths
+	if *inputDir != "" {
+		inputs = []string{*inputDir}
+	}
+	var manifest []tar_reader.ManifestEntry
+	if *datasetLayout != "" {
+		if *inputDir == "" {
+			fmt.Println("Error: -dataset needs the dataset root as -input-dir")
+			return
+		}
+		if firstMissing(inputs) == "" {
+			dataset := tar_reader.Dataset{Layout: *datasetLayout, Root: *inputDir, Split: *datasetSplit, Subset: *datasetSubset}
+			if manifest, err = tar_reader.LoadDataset(dataset, readOpts); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+	}
+	if *manifestPath != "" {
+		inputs = []string{*manifestPath}
+		if firstMissing(inputs) == "" {
+			if manifest, err = tar_reader.LoadManifest(*manifestPath); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+	}
+	var urls []tar_reader.URLEntry
+	if *urlList != "" {
+		inputs = []string{*urlList}
+		if firstMissing(inputs) == "" {
+			if urls, err = tar_reader.LoadURLList(*urlList); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+	}
+	var videoIDs []string
+	ytdlp := tar_reader.YTDLP{MaxHeight: *ytdlpMaxHeight, Workers: *downloadWorkers}
+	if *ytdlpList != "" {
+		inputs = []string{*ytdlpList}
+		if firstMissing(inputs) == "" {
+			if videoIDs, err = tar_reader.LoadVideoIDs(*ytdlpList); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+	}
+
+	// A tar stream on stdin is consumed as it arrives rather than buffered
+	for _, path := range tarPaths {
+		if path == tar_reader.Stdin {
+			*stream = true
+		}
+	}
+	if *shuffleClips && *stream && len(inputs) > 0 {
+		fmt.Printf("Error: -shuffle reads the whole input before processing and cannot be used with -stream or stdin input\n")
 		return
 	}
 
-	// Check if tar file exists before processing
-	if *tarPath != "" {
-		if _, err := os.Stat(*tarPath); err == nil {
-			// Process the tar file
-			clips, err := tar_reader.ExtractClipsFromTar(*tarPath)
+	// Check if the inputs exist before processing
+	if len(inputs) > 0 {
+		if missing := firstMissing(inputs); missing == "" {
+			annots, err := loadAnnotations(*spansPath, *denseLabelsPath, *timestampsPath, *boxesPath)
 			if err != nil {
-				fmt.Printf("Error extracting tar: %v\n", err)
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+
+			// Log finished clips so an interrupted run can be resumed
+			// without redoing them
+			if err := os.MkdirAll(*outputDir, 0755); err != nil {
+				fmt.Printf("Error creating output directory: %v\n", err)
 				return
 			}
+			processed, err := checkpoint.Open(filepath.Join(*outputDir, checkpoint.File), *resume)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			defer processed.Close()
+			if processed.Len() > 0 {
+				fmt.Printf("Resuming: skipping %d clips already processed\n", processed.Len())
+			}
+			readOpts.Skip = processed.Done
+			opts.OnResult = func(result processor.ClipResult) {
+				if result.Status == processor.ClipFailed {
+					return
+				}
+				if result.Status == processor.ClipSkipped {
+					fmt.Printf("Skipping %s: %v\n", result.Key, result.Err)
+				}
+				if err := processed.Record(result.Key); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+
+			// Hash each clip's bytes to skip exact duplicates
+			var index *dedup.Index
+			if *dedupFlag {
+				index, err = dedup.Open(filepath.Join(*outputDir, dedup.ReportFile), *resume)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					return
+				}
+				defer index.Close()
+			}
 
-			fmt.Printf("Processing %d clips using %d workers...\n", len(clips), *workers)
+			var results []processor.ClipResult
+			var skipped, duplicates int
+			// admit attaches annotations to a clip read from the input,
+			// reporting false for duplicates and clips without annotated spans
+			admit := func(clip types.Clip) (types.Clip, bool) {
+				if index != nil {
+					decision, err := index.Check(clip.Key, clip.RawData)
+					if err != nil {
+						fmt.Printf("Warning: %v\n", err)
+					}
+					if decision.Duplicate() {
+						duplicates++
+						return clip, false
+					}
+				}
+				clip, ok := annots.apply(clip)
+				if !ok {
+					skipped++
+				}
+				return clip, ok
+			}
 			startTime := time.Now()
-			if err := processor.ProcessClips(clips, *outputDir, *fps, *size, outputFormat, *targetFrames, *workers); err != nil {
+			if *stream {
+				// Hand clips to workers as they are read, skipping clips
+				// without annotated spans
+				fmt.Printf("Streaming clips from %s using %d workers...\n", strings.Join(inputs, ", "), *workers)
+				read := make(chan types.Clip)
+				annotated := make(chan types.Clip)
+				readErr := make(chan error, 1)
+				go func() {
+					if manifest != nil {
+						readErr <- tar_reader.StreamClipsFromManifest(manifest, readOpts, read)
+					} else if *inputDir != "" {
+						readErr <- tar_reader.StreamClipsFromDir(*inputDir, readOpts, read)
+					} else if urls != nil {
+						readErr <- tar_reader.StreamClipsFromURLs(urls, *downloadWorkers, readOpts, read)
+					} else if videoIDs != nil {
+						readErr <- tar_reader.StreamClipsWithYTDLP(videoIDs, ytdlp, readOpts, read)
+					} else {
+						readErr <- tar_reader.StreamClipsFromTars(tarPaths, readOpts, read)
+					}
+				}()
+				go func() {
+					for clip := range read {
+						if clip, ok := admit(clip); ok {
+							annotated <- clip
+						}
+					}
+					close(annotated)
+				}()
+				results, err = processor.ProcessClipStream(annotated, opts, *workers)
+				if inputErr := <-readErr; inputErr != nil && !reportDownloadError(inputErr) {
+					printSummary(results, skipped, duplicates)
+					fmt.Printf("Error reading input: %v\n", inputErr)
+					return
+				}
+			} else {
+				// Read the clips from the tar file, directory or manifest
+				var clips []types.Clip
+				if manifest != nil {
+					clips, err = tar_reader.ExtractClipsFromManifest(manifest, readOpts)
+				} else if *inputDir != "" {
+					clips, err = tar_reader.ExtractClipsFromDir(*inputDir, readOpts)
+				} else if urls != nil {
+					fmt.Printf("Downloading %d videos using %d workers...\n", len(urls), *downloadWorkers)
+					clips, err = tar_reader.ExtractClipsFromURLs(urls, *downloadWorkers, readOpts)
+				} else if videoIDs != nil {
+					fmt.Printf("Downloading %d videos with yt-dlp using %d workers...\n", len(videoIDs), *downloadWorkers)
+					clips, err = tar_reader.ExtractClipsWithYTDLP(videoIDs, ytdlp, readOpts)
+				} else {
+					clips, err = tar_reader.ExtractClipsFromTars(tarPaths, readOpts)
+				}
+				if err != nil && !reportDownloadError(err) {
+					fmt.Printf("Error reading input: %v\n", err)
+					return
+				}
+
+				// Attach annotations, skipping duplicates and clips without
+				// annotated spans
+				var annotated []types.Clip
+				for _, clip := range clips {
+					if clip, ok := admit(clip); ok {
+						annotated = append(annotated, clip)
+					}
+				}
+				clips = annotated
+
+				// Process clips in a seeded order rather than input order,
+				// e.g. when the source archive is sorted by class
+				if *shuffleClips {
+					shuffle.Sort(len(clips), *seed, func(i int) string {
+						return clips[i].Key
+					}, func(i, j int) {
+						clips[i], clips[j] = clips[j], clips[i]
+					})
+				}
+
+				fmt.Printf("Processing %d clips using %d workers...\n", len(clips), *workers)
+				results, err = processor.ProcessClipsWithOptions(clips, opts, *workers)
+			}
+			printSummary(results, skipped, duplicates)
+			if err != nil {
 				fmt.Printf("Error processing clips: %v\n", err)
 				return
 			}
 			duration := time.Since(startTime)
 			fmt.Printf("Processed clips successfully in %v!\n", duration)
+
+			// Compute normalization statistics over the produced chunks
+			if *computeStatsFlag {
+				if err := computeStats(*outputDir, stats.Options{MaxChunks: *statsMaxChunks}); err != nil {
+					fmt.Printf("Error computing statistics: %v\n", err)
+					return
+				}
+			}
 		} else {
-			fmt.Printf("Skipping clip processing as input file %s does not exist\n", *tarPath)
+			fmt.Printf("Skipping clip processing as input %s does not exist\n", missing)
 		}
 	} else {
 		fmt.Printf("Skipping clip processing as no input file specified\n")
 	}
 
+	// Compute chunk embeddings, before sharding so shards include them
+	if *embedCmd != "" || *embedURL != "" {
+		embedOpts := embedding.Options{
+			Format:  outputFormat,
+			Command: *embedCmd,
+			URL:     *embedURL,
+			Workers: *workers,
+			Resume:  *resume,
+		}
+		if err := embedding.WriteEmbeddings(*outputDir, embedOpts); err != nil {
+			fmt.Printf("Error computing embeddings: %v\n", err)
+			return
+		}
+		fmt.Printf("Computed embeddings successfully!\n")
+	}
+
 	// Create WebDataset shards if shard directory is specified
 	if *shardDir != "" {
 		if err := os.MkdirAll(*shardDir, 0755); err != nil {
 			fmt.Printf("Error creating shard directory: %v\n", err)
 			return
 		}
-		if err := sharding.CreateWebDatasetShards(*outputDir, *shardDir, *shardSize, outputFormat); err != nil {
+		shardOpts := sharding.Options{
+			ShardSize:     *shardSize,
+			Format:        outputFormat,
+			Resume:        *resume,
+			ShuffleBuffer: *shuffleBuffer,
+			ShuffleClips:  *shuffleClips,
+			Seed:          *seed,
+		}
+		if err := sharding.CreateWebDatasetShardsWithOptions(*outputDir, *shardDir, shardOpts); err != nil {
 			fmt.Printf("Error creating WebDataset shards: %v\n", err)
 			return
 		}
 		fmt.Printf("Created WebDataset shards successfully!\n")
 	}
+
+	// Write Parquet files if a Parquet directory is specified
+	if *parquetDir != "" {
+		if err := os.MkdirAll(*parquetDir, 0755); err != nil {
+			fmt.Printf("Error creating Parquet directory: %v\n", err)
+			return
+		}
+		parquetOpts := parquet.Options{
+			RowsPerFile: *parquetRows,
+			Format:      outputFormat,
+		}
+		if err := parquet.WriteChunks(*outputDir, *parquetDir, parquetOpts); err != nil {
+			fmt.Printf("Error writing Parquet files: %v\n", err)
+			return
+		}
+		fmt.Printf("Wrote Parquet files successfully!\n")
+	}
+
+	// Write a Zarr array if a Zarr directory is specified
+	if *zarrDir != "" {
+		if err := os.MkdirAll(*zarrDir, 0755); err != nil {
+			fmt.Printf("Error creating Zarr directory: %v\n", err)
+			return
+		}
+		if err := zarr.WriteChunks(*outputDir, *zarrDir, zarr.Options{Format: outputFormat}); err != nil {
+			fmt.Printf("Error writing Zarr array: %v\n", err)
+			return
+		}
+		fmt.Printf("Wrote Zarr array successfully!\n")
+	}
+}
+
+// stringList is a flag.Value collecting the values of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// inputPatterns returns the -tar patterns followed by the positional inputs.
+// flag stops parsing at the first positional argument, so a flag after it
+// would silently be taken as an input; it is rejected instead. "-" alone is
+// stdin.
+func inputPatterns(tarPatterns, args []string) ([]string, error) {
+	for _, arg := range args {
+		if arg != tar_reader.Stdin && strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("flag %s after the first input; flags must come before inputs", arg)
+		}
+	}
+	return append(tarPatterns, args...), nil
+}
+
+// firstMissing returns the first local path of paths that does not exist, or
+// "" if all do; stdin and remote URIs are not checked
+func firstMissing(paths []string) string {
+	for _, path := range paths {
+		if path == tar_reader.Stdin || tar_reader.IsRemote(path) {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// reportDownloadError prints the failed URLs of a *tar_reader.DownloadError,
+// after which processing continues with the downloaded clips, and reports
+// whether err was one
+func reportDownloadError(err error) bool {
+	downloadErr, ok := err.(*tar_reader.DownloadError)
+	if !ok {
+		return false
+	}
+	fmt.Printf("Warning: %d of %d downloads failed:\n", len(downloadErr.Failures), downloadErr.Total)
+	for _, failure := range downloadErr.Failures {
+		fmt.Printf("  %s: %v\n", failure.URL, failure.Err)
+	}
+	return true
+}
+
+// compileFilter compiles the regular expression of a key filter flag, or
+// returns nil if it is empty
+func compileFilter(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -%s pattern: %v", name, err)
+	}
+	return re, nil
+}
+
+// defaultTarIndexDir returns the tar index cache directory under the user's
+// cache directory, or "" to disable the cache if there is none
+func defaultTarIndexDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "govidprep", "tar-index")
+}
+
+// countSet returns how many of flags are true
+func countSet(flags ...bool) int {
+	n := 0
+	for _, set := range flags {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// clipAnnotations holds the per-clip annotations loaded from the annotation
+// flags; nil maps are not applied
+type clipAnnotations struct {
+	spans       map[string][]types.Span
+	denseLabels map[string]*types.DenseLabels
+	timestamps  map[string][]float64
+	boxes       map[string][]types.Box
+}
+
+// loadAnnotations loads the annotation files given by the non-empty paths
+func loadAnnotations(spansPath, denseLabelsPath, timestampsPath, boxesPath string) (clipAnnotations, error) {
+	var a clipAnnotations
+	var err error
+	if spansPath != "" {
+		if a.spans, err = annotations.LoadSpans(spansPath); err != nil {
+			return a, fmt.Errorf("error loading annotation spans: %v", err)
+		}
+		if a.spans == nil {
+			a.spans = map[string][]types.Span{}
+		}
+	}
+	if denseLabelsPath != "" {
+		if a.denseLabels, err = annotations.LoadDenseLabels(denseLabelsPath); err != nil {
+			return a, fmt.Errorf("error loading dense labels: %v", err)
+		}
+	}
+	if timestampsPath != "" {
+		if a.timestamps, err = annotations.LoadTimestamps(timestampsPath); err != nil {
+			return a, fmt.Errorf("error loading timestamps: %v", err)
+		}
+	}
+	if boxesPath != "" {
+		if a.boxes, err = annotations.LoadBoxes(boxesPath); err != nil {
+			return a, fmt.Errorf("error loading bounding boxes: %v", err)
+		}
+	}
+	return a, nil
+}
+
+// apply attaches the annotations to a clip. With spans loaded, only footage
+// inside the clip's spans is processed, and clips without spans are skipped
+// (ok is false).
+func (a clipAnnotations) apply(clip types.Clip) (types.Clip, bool) {
+	clips := []types.Clip{clip}
+	if a.spans != nil {
+		if clips = annotations.ApplySpans(clips, a.spans); len(clips) == 0 {
+			return clip, false
+		}
+	}
+	if a.denseLabels != nil {
+		annotations.ApplyDenseLabels(clips, a.denseLabels)
+	}
+	if a.timestamps != nil {
+		annotations.ApplyTimestamps(clips, a.timestamps)
+	}
+	if a.boxes != nil {
+		annotations.ApplyBoxes(clips, a.boxes)
+	}
+	return clips[0], true
+}
+
+// printSummary prints the clip, chunk and discard counts of a run
+func printSummary(results []processor.ClipResult, skipped, duplicates int) {
+	summary := processor.Summarize(results)
+	ok := summary.Clips - summary.Failed - summary.Empty - summary.Skipped - summary.TooShort
+	fmt.Printf("Clips: %d processed, %d failed, %d discarded with no chunks, %d skipped as corrupt, %d skipped as too short, %d skipped as duplicates, %d skipped without spans\n",
+		ok, summary.Failed, summary.Empty, summary.Skipped, summary.TooShort, duplicates, skipped)
+	discarded := summary.FramesDiscarded
+	fmt.Printf("Chunks: %d written; frames discarded: %d (%d chunk remainders, %d silent, %d decimated)\n",
+		summary.Chunks, discarded.Total(), discarded.Remainder, discarded.Silent, discarded.Decimated)
+}
+
+// loadNormalization returns the normalization given by the mean and std
+// flags, or the statistics recorded in the dataset manifest of dir
+func loadNormalization(mean, std, dir string) (*types.Normalization, error) {
+	if mean != "" || std != "" {
+		meanValues, err := parseFloats(mean)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -mean: %v", err)
+		}
+		stdValues, err := parseFloats(std)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -std: %v", err)
+		}
+		return &types.Normalization{Mean: meanValues, Std: stdValues}, nil
+	}
+
+	manifest, err := dataset.LoadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Stats == nil {
+		return nil, fmt.Errorf("no statistics in %s; run govidprep stats or pass -mean and -std", filepath.Join(dir, dataset.ManifestFile))
+	}
+	return &types.Normalization{Mean: manifest.Stats.Mean, Std: manifest.Stats.Std}, nil
+}
+
+// parseFloats parses a comma-separated list of numbers
+func parseFloats(list string) ([]float64, error) {
+	var values []float64
+	for _, field := range strings.Split(list, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInputPatterns(t *testing.T) {
+	tests := []struct {
+		name    string
+		tar     []string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"tar only", []string{"a.tar"}, nil, []string{"a.tar"}, false},
+		{"positional only", nil, []string{"clip1.mp4", "clip2.mkv"}, []string{"clip1.mp4", "clip2.mkv"}, false},
+		{"tar and positional", []string{"a.tar", "b.tar"}, []string{"clip1.mp4"}, []string{"a.tar", "b.tar", "clip1.mp4"}, false},
+		{"stdin", []string{"a.tar"}, []string{"-"}, []string{"a.tar", "-"}, false},
+		{"flag after input", nil, []string{"a.tar", "-out", "output"}, nil, true},
+		{"double-dash flag after input", []string{"a.tar"}, []string{"clip1.mp4", "--workers=2"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inputPatterns(tt.tar, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inputPatterns() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputPatterns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+)
+
+// runNpyInfo implements the npy-info subcommand, which prints the header and
+// basic value statistics of NumPy chunk files
+func runNpyInfo(args []string) {
+	fs := flag.NewFlagSet("npy-info", flag.ExitOnError)
+	channels := fs.Int("channels", 3, "Size of the trailing channel dimension to report statistics per channel (1 = all values together)")
+	noStats := fs.Bool("no-stats", false, "Print only the header, without reading the array data")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: govidprep npy-info [flags] file.npy|file.npz...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	failed := false
+	for i, path := range fs.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := printNpyInfo(path, *channels, !*noStats); err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printNpyInfo prints the header of a NumPy file, or of the frames array of
+// an .npz chunk, and, if withStats is set, per-channel min/max/mean/std of
+// its values
+func printNpyInfo(path string, channels int, withStats bool) error {
+	reader, err := numpy.OpenFrames(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h := reader.Header
+	order := "C"
+	if h.FortranOrder {
+		order = "Fortran"
+	}
+	dims := make([]string, len(h.Shape))
+	for i, dim := range h.Shape {
+		dims[i] = fmt.Sprint(dim)
+	}
+
+	fmt.Println(path)
+	fmt.Printf("  version:  %s\n", h.Version)
+	fmt.Printf("  dtype:    %s\n", h.DType)
+	fmt.Printf("  shape:    (%s)\n", strings.Join(dims, ", "))
+	fmt.Printf("  order:    %s\n", order)
+	fmt.Printf("  elements: %d\n", h.Len())
+	if !withStats {
+		return nil
+	}
+
+	summaries, err := reader.Summarize(channels)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for i, s := range summaries {
+		name := "all"
+		if len(summaries) > 1 {
+			name = fmt.Sprintf("channel %d", i)
+		}
+		fmt.Printf("  %-10s min=%g max=%g mean=%.4f std=%.4f\n", name+":", s.Min, s.Max, s.Mean, s.Std)
+		count += s.Count
+	}
+	if count != h.Len() {
+		fmt.Printf("  warning:  data holds %d of %d elements (file truncated?)\n", count, h.Len())
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/melody-ding/go-vidprep/internal/dataset"
+	"github.com/melody-ding/go-vidprep/internal/stats"
+)
+
+// runStats implements the stats subcommand, which computes normalization
+// statistics over an existing output directory
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dir := fs.String("dir", "output", "Directory of processed chunks")
+	maxChunks := fs.Int("max-chunks", 0, "Sample at most this many chunks at random (0 = all)")
+	seed := fs.Int64("seed", 0, "Seed for chunk sampling")
+	fs.Parse(args)
+
+	if err := computeStats(*dir, stats.Options{MaxChunks: *maxChunks, Seed: *seed}); err != nil {
+		fmt.Printf("Error computing statistics: %v\n", err)
+	}
+}
+
+// computeStats computes per-channel mean/std over the chunks in dir and
+// records them in the dataset manifest
+func computeStats(dir string, opts stats.Options) error {
+	channelStats, err := stats.Compute(dir, opts)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := dataset.LoadManifest(dir)
+	if err != nil {
+		return err
+	}
+	manifest.Stats = &channelStats
+	if err := manifest.Save(dir); err != nil {
+		return err
+	}
+
+	fmt.Printf("Computed statistics over %d chunks (%d pixels): mean=%.4f std=%.4f\n",
+		channelStats.Chunks, channelStats.Pixels, channelStats.Mean, channelStats.Std)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/melody-ding/go-vidprep/internal/schema"
+)
+
+// maxReportedProblems caps the number of schema violations printed
+const maxReportedProblems = 50
+
+// runValidate implements the validate subcommand, which checks an output
+// directory or shard set against the bundled JSON Schemas and exits with
+// status 1 if any file violates them
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	dir := fs.String("dir", "", "Output directory of processed chunks to validate")
+	shardDir := fs.String("shard-dir", "", "Directory of WebDataset shards to validate")
+	printSchema := fs.String("print-schema", "", "Print a bundled JSON Schema (clip_metadata, dataset) and exit")
+	fs.Parse(args)
+
+	if *printSchema != "" {
+		source, err := schema.Source(*printSchema)
+		if err != nil {
+			fmt.Printf("Error: unknown schema %s\n", *printSchema)
+			os.Exit(1)
+		}
+		os.Stdout.Write(source)
+		return
+	}
+	if *dir == "" && *shardDir == "" {
+		fmt.Println("Error: specify -dir and/or -shard-dir")
+		os.Exit(1)
+	}
+
+	ok := true
+	if *dir != "" {
+		report, err := schema.ValidateDir(*dir)
+		ok = printValidation(*dir, report, err) && ok
+	}
+	if *shardDir != "" {
+		report, err := schema.ValidateShards(*shardDir)
+		ok = printValidation(*shardDir, report, err) && ok
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// printValidation prints a validation report and reports whether it passed
+func printValidation(path string, report *schema.Report, err error) bool {
+	if err != nil {
+		fmt.Printf("Error validating %s: %v\n", path, err)
+		return false
+	}
+	for i, problem := range report.Problems {
+		if i == maxReportedProblems {
+			fmt.Printf("... and %d more\n", len(report.Problems)-i)
+			break
+		}
+		fmt.Println(problem)
+	}
+	fmt.Printf("%s: %d files validated, %d problems\n", path, report.Files, len(report.Problems))
+	return len(report.Problems) == 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/buildinfo"
+)
+
+// runVersion implements the version subcommand, which prints the build and
+// ffmpeg environment for bug reports and provenance records
+func runVersion(args []string) {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	fs.Parse(args)
+
+	report := struct {
+		buildinfo.Info
+		Environment buildinfo.Environment `json:"environment"`
+	}{buildinfo.Read(), buildinfo.ProbeEnvironment()}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Printf("Error marshaling version report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+		return
+	}
+
+	commit := report.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if report.Modified {
+		commit += " (modified)"
+	}
+	fmt.Printf("govidprep %s\n", report.Version)
+	fmt.Printf("  commit:    %s\n", commit)
+	fmt.Printf("  go:        %s %s\n", report.GoVersion, report.Platform)
+	fmt.Printf("  ffmpeg:    %s\n", orNotFound(report.Environment.FFmpegVersion))
+	fmt.Printf("  ffprobe:   %s\n", orNotFound(report.Environment.FFprobeVersion))
+	fmt.Printf("  hwaccels:  %s\n", strings.Join(report.Environment.HWAccels, ", "))
+	fmt.Printf("  encoders:  %s\n", strings.Join(report.Environment.Encoders, ", "))
+}
+
+// orNotFound returns version, or "not found" if it is empty
+func orNotFound(version string) string {
+	if version == "" {
+		return "not found"
+	}
+	return version
+}
@@ -3,8 +3,13 @@ module github.com/melody-ding/go-vidprep
 go 1.24.3
 
 require (
-	github.com/aws/aws-sdk-go v1.38.20 // indirect
+	github.com/aws/aws-sdk-go v1.38.20
+	github.com/u2takey/ffmpeg-go v0.5.0
+	golang.org/x/oauth2 v0.30.0
+)
+
+require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
-	github.com/u2takey/ffmpeg-go v0.5.0 // indirect
 	github.com/u2takey/go-utils v0.3.1 // indirect
 )
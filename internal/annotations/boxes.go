@@ -0,0 +1,45 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// LoadBoxes reads per-clip bounding boxes from a JSON file mapping clip keys
+// to boxes in source pixel coordinates, each at time t seconds:
+//
+//	{"video1": [{"t": 0.0, "x": 120, "y": 40, "w": 200, "h": 360}]}
+//
+// A clip with a single box is cropped to that box throughout.
+func LoadBoxes(path string) (map[string][]types.Box, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading boxes: %v", err)
+	}
+
+	var boxes map[string][]types.Box
+	if err := json.Unmarshal(data, &boxes); err != nil {
+		return nil, fmt.Errorf("error parsing boxes: %v", err)
+	}
+
+	for key, clipBoxes := range boxes {
+		for _, box := range clipBoxes {
+			if box.W <= 0 || box.H <= 0 || box.X < 0 || box.Y < 0 {
+				return nil, fmt.Errorf("invalid box for %s at %gs: %+v", key, box.T, box)
+			}
+		}
+		sort.Slice(clipBoxes, func(i, j int) bool { return clipBoxes[i].T < clipBoxes[j].T })
+	}
+	return boxes, nil
+}
+
+// ApplyBoxes attaches bounding boxes to clips by key
+func ApplyBoxes(clips []types.Clip, boxes map[string][]types.Box) {
+	for i := range clips {
+		clips[i].Boxes = boxes[clips[i].Key]
+	}
+}
@@ -0,0 +1,36 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+func TestLoadBoxes(t *testing.T) {
+	path := writeTempFile(t, "boxes.json", `{"video1": [
+		{"t": 1.0, "x": 10, "y": 20, "w": 30, "h": 40},
+		{"t": 0.0, "x": 0, "y": 0, "w": 30, "h": 40}
+	]}`)
+	boxes, err := LoadBoxes(path)
+	if err != nil {
+		t.Fatalf("LoadBoxes() error = %v", err)
+	}
+	got := boxes["video1"]
+	if len(got) != 2 || got[0].T != 0 || got[1].T != 1 {
+		t.Errorf("LoadBoxes() = %v, want boxes sorted by time", got)
+	}
+
+	if _, err := LoadBoxes(writeTempFile(t, "bad.json", `{"video1": [{"t": 0, "x": 0, "y": 0, "w": 0, "h": 40}]}`)); err == nil {
+		t.Error("LoadBoxes() accepted a box with zero width")
+	}
+}
+
+func TestApplyBoxes(t *testing.T) {
+	clips := []types.Clip{{Key: "boxed"}, {Key: "unboxed"}}
+	boxes := map[string][]types.Box{"boxed": {{W: 10, H: 10}}}
+
+	ApplyBoxes(clips, boxes)
+	if len(clips[0].Boxes) != 1 || clips[1].Boxes != nil {
+		t.Errorf("ApplyBoxes() = %v, want boxes only on the boxed clip", clips)
+	}
+}
@@ -0,0 +1,41 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// LoadDenseLabels reads dense per-clip labels from a JSON file mapping clip
+// keys to a label sequence sampled at a fixed rate:
+//
+//	{"video1": {"fps": 1, "labels": ["walk", "walk", "run"]}}
+//
+// Use fps 1 for per-second labels or the source frame rate for per-frame labels.
+func LoadDenseLabels(path string) (map[string]*types.DenseLabels, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dense labels: %v", err)
+	}
+
+	var labels map[string]*types.DenseLabels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("error parsing dense labels: %v", err)
+	}
+
+	for key, l := range labels {
+		if l == nil || l.FPS <= 0 {
+			return nil, fmt.Errorf("dense labels for %s must have a positive fps", key)
+		}
+	}
+	return labels, nil
+}
+
+// ApplyDenseLabels attaches dense labels to clips by key
+func ApplyDenseLabels(clips []types.Clip, labels map[string]*types.DenseLabels) {
+	for i := range clips {
+		clips[i].DenseLabels = labels[clips[i].Key]
+	}
+}
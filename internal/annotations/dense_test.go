@@ -0,0 +1,45 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+func TestLoadDenseLabels(t *testing.T) {
+	path := writeTempFile(t, "labels.json", `{"video1": {"fps": 2, "labels": ["walk", "walk", "run"]}}`)
+	labels, err := LoadDenseLabels(path)
+	if err != nil {
+		t.Fatalf("LoadDenseLabels() error = %v", err)
+	}
+
+	tests := []struct {
+		t    float64
+		want string
+	}{
+		{0, "walk"},
+		{0.9, "walk"},
+		{1.0, "run"},
+		{1.5, ""},
+		{-1, ""},
+	}
+	for _, tt := range tests {
+		if got := labels["video1"].At(tt.t); got != tt.want {
+			t.Errorf("At(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+
+	if _, err := LoadDenseLabels(writeTempFile(t, "bad.json", `{"video1": {"labels": ["walk"]}}`)); err == nil {
+		t.Error("LoadDenseLabels() accepted labels without fps")
+	}
+}
+
+func TestApplyDenseLabels(t *testing.T) {
+	clips := []types.Clip{{Key: "labeled"}, {Key: "unlabeled"}}
+	labels := map[string]*types.DenseLabels{"labeled": {FPS: 1, Labels: []string{"a"}}}
+
+	ApplyDenseLabels(clips, labels)
+	if clips[0].DenseLabels == nil || clips[1].DenseLabels != nil {
+		t.Errorf("ApplyDenseLabels() = %v, want labels only on the labeled clip", clips)
+	}
+}
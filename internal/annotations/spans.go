@@ -0,0 +1,117 @@
+package annotations
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// LoadSpans reads per-clip annotation spans from a JSON or CSV file.
+//
+// JSON files map clip keys to span lists:
+//
+//	{"video1": [{"start": 1.0, "end": 4.5, "label": "jump"}]}
+//
+// CSV files have one span per row with the columns key,start,end[,label] and
+// an optional header row.
+func LoadSpans(path string) (map[string][]types.Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening annotations: %v", err)
+	}
+	defer f.Close()
+
+	var spans map[string][]types.Span
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		spans, err = parseJSONSpans(f)
+	case ".csv":
+		spans, err = parseCSVSpans(f)
+	default:
+		return nil, fmt.Errorf("unsupported annotations format: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for key, clipSpans := range spans {
+		for _, span := range clipSpans {
+			if span.Start < 0 || span.End <= span.Start {
+				return nil, fmt.Errorf("invalid span for %s: start %v, end %v", key, span.Start, span.End)
+			}
+		}
+	}
+	return spans, nil
+}
+
+// parseJSONSpans parses a JSON object mapping clip keys to span lists
+func parseJSONSpans(r io.Reader) (map[string][]types.Span, error) {
+	var spans map[string][]types.Span
+	if err := json.NewDecoder(r).Decode(&spans); err != nil {
+		return nil, fmt.Errorf("error parsing annotations: %v", err)
+	}
+	return spans, nil
+}
+
+// parseCSVSpans parses key,start,end[,label] rows
+func parseCSVSpans(r io.Reader) (map[string][]types.Span, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	spans := make(map[string][]types.Span)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing annotations: %v", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("annotations line %d: expected key,start,end[,label]", line)
+		}
+
+		start, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			// Allow a header row
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("annotations line %d: invalid start %q", line, record[1])
+		}
+		end, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("annotations line %d: invalid end %q", line, record[2])
+		}
+
+		span := types.Span{Start: start, End: end}
+		if len(record) > 3 {
+			span.Label = strings.TrimSpace(record[3])
+		}
+		key := strings.TrimSpace(record[0])
+		spans[key] = append(spans[key], span)
+	}
+	return spans, nil
+}
+
+// ApplySpans attaches annotation spans to clips by key. Clips without any
+// spans are unlabeled footage and are dropped.
+func ApplySpans(clips []types.Clip, spans map[string][]types.Span) []types.Clip {
+	var annotated []types.Clip
+	for _, clip := range clips {
+		clipSpans, ok := spans[clip.Key]
+		if !ok || len(clipSpans) == 0 {
+			continue
+		}
+		clip.Spans = clipSpans
+		annotated = append(annotated, clip)
+	}
+	return annotated
+}
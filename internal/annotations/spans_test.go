@@ -0,0 +1,91 @@
+package annotations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+func writeTempFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSpans(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    map[string][]types.Span
+		wantErr bool
+	}{
+		{
+			name:    "json",
+			file:    "spans.json",
+			content: `{"video1": [{"start": 1.0, "end": 4.5, "label": "jump"}]}`,
+			want:    map[string][]types.Span{"video1": {{Start: 1.0, End: 4.5, Label: "jump"}}},
+		},
+		{
+			name:    "csv with header",
+			file:    "spans.csv",
+			content: "key,start,end,label\nvideo1,1.0,4.5,jump\nvideo1,10,14,run\nvideo2,0,2\n",
+			want: map[string][]types.Span{
+				"video1": {{Start: 1.0, End: 4.5, Label: "jump"}, {Start: 10, End: 14, Label: "run"}},
+				"video2": {{Start: 0, End: 2}},
+			},
+		},
+		{
+			name:    "end before start",
+			file:    "spans.csv",
+			content: "video1,5,4\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "spans.txt",
+			content: "video1,1,2\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadSpans(writeTempFile(t, tt.file, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadSpans() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadSpans() = %v, want %v", got, tt.want)
+			}
+			for key, spans := range tt.want {
+				if len(got[key]) != len(spans) {
+					t.Errorf("LoadSpans()[%s] = %v, want %v", key, got[key], spans)
+					continue
+				}
+				for i := range spans {
+					if got[key][i] != spans[i] {
+						t.Errorf("LoadSpans()[%s][%d] = %v, want %v", key, i, got[key][i], spans[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestApplySpans(t *testing.T) {
+	clips := []types.Clip{{Key: "labeled"}, {Key: "unlabeled"}}
+	spans := map[string][]types.Span{"labeled": {{Start: 0, End: 1}}}
+
+	got := ApplySpans(clips, spans)
+	if len(got) != 1 || got[0].Key != "labeled" || len(got[0].Spans) != 1 {
+		t.Errorf("ApplySpans() = %v, want only the labeled clip with its span", got)
+	}
+}
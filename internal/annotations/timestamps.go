@@ -0,0 +1,92 @@
+package annotations
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// LoadTimestamps reads per-clip frame timestamps, in seconds, from a JSON
+// or CSV file. Each clip's frames are extracted at exactly these times, in
+// the given order, as a single sample.
+//
+// JSON files map clip keys to timestamp lists:
+//
+//	{"video1": [0.5, 2.0, 7.25]}
+//
+// CSV files have one timestamp per row with the columns key,timestamp and an
+// optional header row.
+func LoadTimestamps(path string) (map[string][]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening timestamps: %v", err)
+	}
+	defer f.Close()
+
+	var timestamps map[string][]float64
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.NewDecoder(f).Decode(&timestamps); err != nil {
+			return nil, fmt.Errorf("error parsing timestamps: %v", err)
+		}
+	case ".csv":
+		timestamps, err = parseCSVTimestamps(f)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported timestamps format: %s", path)
+	}
+
+	for key, clipTimestamps := range timestamps {
+		for _, t := range clipTimestamps {
+			if t < 0 {
+				return nil, fmt.Errorf("invalid timestamp for %s: %v", key, t)
+			}
+		}
+	}
+	return timestamps, nil
+}
+
+// parseCSVTimestamps parses key,timestamp rows
+func parseCSVTimestamps(r io.Reader) (map[string][]float64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+
+	timestamps := make(map[string][]float64)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing timestamps: %v", err)
+		}
+
+		t, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			// Allow a header row
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("timestamps line %d: invalid timestamp %q", line, record[1])
+		}
+		key := strings.TrimSpace(record[0])
+		timestamps[key] = append(timestamps[key], t)
+	}
+	return timestamps, nil
+}
+
+// ApplyTimestamps attaches frame timestamps to clips by key
+func ApplyTimestamps(clips []types.Clip, timestamps map[string][]float64) {
+	for i := range clips {
+		clips[i].Timestamps = timestamps[clips[i].Key]
+	}
+}
@@ -0,0 +1,43 @@
+package annotations
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+func TestLoadTimestamps(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"json", "ts.json", `{"video1": [2.5, 0.5, 2.5]}`, "[2.5 0.5 2.5]", false},
+		{"csv with header", "ts.csv", "key,timestamp\nvideo1,2.5\nvideo1,0.5\n", "[2.5 0.5]", false},
+		{"negative", "ts.json", `{"video1": [-1]}`, "", true},
+		{"bad csv", "ts.csv", "video1,1\nvideo1,x\n", "", true},
+		{"unsupported", "ts.txt", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamps, err := LoadTimestamps(writeTempFile(t, tt.file, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadTimestamps() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && fmt.Sprint(timestamps["video1"]) != tt.want {
+				t.Errorf("LoadTimestamps() = %v, want %s", timestamps["video1"], tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTimestamps(t *testing.T) {
+	clips := []types.Clip{{Key: "listed"}, {Key: "unlisted"}}
+	ApplyTimestamps(clips, map[string][]float64{"listed": {1, 2}})
+	if len(clips[0].Timestamps) != 2 || clips[1].Timestamps != nil {
+		t.Errorf("ApplyTimestamps() = %v, want timestamps only on the listed clip", clips)
+	}
+}
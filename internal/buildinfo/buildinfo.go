@@ -0,0 +1,131 @@
+// Package buildinfo reports the version of govidprep and the ffmpeg
+// environment it runs in, for bug reports and provenance records.
+package buildinfo
+
+import (
+	"bufio"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Version is the release version of govidprep. Release builds set it with
+//
+//	go build -ldflags "-X github.com/melody-ding/go-vidprep/internal/buildinfo.Version=v1.2.3"
+var Version = "dev"
+
+// Info describes the govidprep binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Environment describes the ffmpeg installation found on the PATH. Version
+// fields are empty when the binary could not be run.
+type Environment struct {
+	FFmpegVersion  string   `json:"ffmpeg_version"`
+	FFprobeVersion string   `json:"ffprobe_version"`
+	HWAccels       []string `json:"hwaccels"`
+	Encoders       []string `json:"encoders"`
+}
+
+// Read returns the version of the running binary, taking the commit from the
+// VCS information embedded by the Go toolchain when available
+func Read() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+		if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+	}
+	return info
+}
+
+// ProbeEnvironment runs ffmpeg and ffprobe to detect their versions, the
+// hardware acceleration methods and the video encoders they support
+func ProbeEnvironment() Environment {
+	var env Environment
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-version").Output(); err == nil {
+		env.FFmpegVersion = parseVersion(string(out))
+	}
+	if out, err := exec.Command("ffprobe", "-hide_banner", "-version").Output(); err == nil {
+		env.FFprobeVersion = parseVersion(string(out))
+	}
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-hwaccels").Output(); err == nil {
+		env.HWAccels = parseHWAccels(string(out))
+	}
+	if out, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output(); err == nil {
+		env.Encoders = parseVideoEncoders(string(out))
+	}
+	return env
+}
+
+// parseVersion extracts the version from the first line of `ffmpeg -version`
+// output, e.g. "ffmpeg version 6.1.1-3ubuntu5 Copyright ..."
+func parseVersion(output string) string {
+	line, _, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "version" {
+			return fields[i+1]
+		}
+	}
+	return strings.TrimSpace(line)
+}
+
+// parseHWAccels lists the methods printed by `ffmpeg -hwaccels`, which
+// follow a "Hardware acceleration methods:" heading one per line
+func parseHWAccels(output string) []string {
+	var methods []string
+	inList := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "Hardware acceleration methods"):
+			inList = true
+		case inList && line != "":
+			methods = append(methods, line)
+		}
+	}
+	return methods
+}
+
+// parseVideoEncoders lists the video encoders printed by `ffmpeg -encoders`.
+// Entries follow a " ------" separator as "<flags> <name> <description>",
+// where flags starting with V mark video encoders.
+func parseVideoEncoders(output string) []string {
+	var encoders []string
+	inList := false
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !inList {
+			inList = strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 && strings.HasPrefix(fields[0], "V") {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
@@ -0,0 +1,47 @@
+package buildinfo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc 13\n", "6.1.1-3ubuntu5"},
+		{"ffprobe version n7.0 Copyright (c) 2007-2024\n", "n7.0"},
+		{"custom build\n", "custom build"},
+	}
+
+	for _, tt := range tests {
+		if got := parseVersion(tt.output); got != tt.want {
+			t.Errorf("parseVersion(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestParseHWAccels(t *testing.T) {
+	output := "Hardware acceleration methods:\nvdpau\ncuda\nvaapi\n\n"
+	want := []string{"vdpau", "cuda", "vaapi"}
+	if got := parseHWAccels(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHWAccels() = %v, want %v", got, want)
+	}
+}
+
+func TestParseVideoEncoders(t *testing.T) {
+	output := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ A....D aac                  AAC (Advanced Audio Coding)
+ V....D png                  PNG (Portable Network Graphics) image
+`
+	want := []string{"libx264", "h264_nvenc", "png"}
+	if got := parseVideoEncoders(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseVideoEncoders() = %v, want %v", got, want)
+	}
+}
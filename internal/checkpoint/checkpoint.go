@@ -0,0 +1,105 @@
+package checkpoint
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// File is the name of the processed-keys log in the output directory
+const File = "processed_keys.log"
+
+// Log is an append-only log of processed clip keys, one per line, that lets
+// an interrupted run skip the clips it already finished
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]bool
+}
+
+// Open opens the log at path. With resume, the keys already in the log are
+// loaded and new keys are appended; otherwise the log is started afresh.
+// A partial last line left by a crash is ignored.
+func Open(path string, resume bool) (*Log, error) {
+	l := &Log{done: make(map[string]bool)}
+	if resume {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading processed keys: %v", err)
+		}
+		content := string(data)
+		// Only newline-terminated lines were fully written
+		if i := strings.LastIndexByte(content, '\n'); i >= 0 {
+			content = content[:i]
+		} else {
+			content = ""
+		}
+		for _, key := range strings.Split(content, "\n") {
+			if key != "" {
+				l.done[key] = true
+			}
+		}
+	}
+
+	// Rewrite the complete lines, replacing the log atomically, so appends
+	// never follow a partial one
+	keys := make([]string, 0, len(l.done))
+	for key := range l.done {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var content strings.Builder
+	for _, key := range keys {
+		content.WriteString(key + "\n")
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content.String()), 0644); err != nil {
+		return nil, fmt.Errorf("error writing processed keys log: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("error writing processed keys log: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening processed keys log: %v", err)
+	}
+	l.f = f
+	return l, nil
+}
+
+// Done reports whether key was processed by a previous run
+func (l *Log) Done(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.done[key]
+}
+
+// Len returns the number of keys in the log
+func (l *Log) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.done)
+}
+
+// Record appends key to the log and syncs it to disk, so that it survives the
+// process being killed. It is safe for concurrent use.
+func (l *Log) Record(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := fmt.Fprintln(l.f, key); err != nil {
+		return fmt.Errorf("error recording processed key: %v", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("error recording processed key: %v", err)
+	}
+	l.done[key] = true
+	return nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,73 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), File)
+
+	l, err := Open(path, true)
+	if err != nil {
+		t.Fatalf("Open() without a log error = %v", err)
+	}
+	for _, key := range []string{"video1", "part-0001/video2"} {
+		if err := l.Record(key); err != nil {
+			t.Fatalf("Record(%s) error = %v", key, err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a key
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("vid")
+	f.Close()
+
+	l, err = Open(path, true)
+	if err != nil {
+		t.Fatalf("Open() with resume error = %v", err)
+	}
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"video1", true},
+		{"part-0001/video2", true},
+		{"vid", false},
+		{"video3", false},
+	}
+	for _, tt := range tests {
+		if got := l.Done(tt.key); got != tt.want {
+			t.Errorf("Done(%s) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+	if err := l.Record("video3"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "part-0001/video2\nvideo1\nvideo3\n"; string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+
+	// Without resume the log starts afresh
+	l, err = Open(path, false)
+	if err != nil {
+		t.Fatalf("Open() without resume error = %v", err)
+	}
+	defer l.Close()
+	if l.Len() != 0 || l.Done("video1") {
+		t.Errorf("Open() without resume kept %d keys, want 0", l.Len())
+	}
+}
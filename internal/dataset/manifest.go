@@ -0,0 +1,45 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// ManifestFile is the name of the dataset manifest in the output directory
+const ManifestFile = "dataset.json"
+
+// Manifest describes a processed dataset as a whole
+type Manifest struct {
+	Stats *types.ChannelStats `json:"stats,omitempty"`
+}
+
+// LoadManifest reads the manifest of the dataset in dir, returning an empty
+// manifest if there is none yet
+func LoadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading dataset manifest: %v", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing dataset manifest: %v", err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest to dir
+func (m *Manifest) Save(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling dataset manifest: %v", err)
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFile), data, 0644)
+}
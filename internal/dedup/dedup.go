@@ -0,0 +1,126 @@
+// Package dedup detects clips whose raw bytes are identical to an earlier
+// clip, such as re-uploads in scraped datasets, and records its decisions in
+// a report.
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ReportFile is the name of the dedup report in the output directory
+const ReportFile = "dedup_report.jsonl"
+
+// Decision records whether a clip was kept or skipped as a duplicate
+type Decision struct {
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+	// DuplicateOf is the key of the earlier clip with the same content, or
+	// empty if the clip was kept
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// Duplicate reports whether the clip was skipped as a duplicate
+func (d Decision) Duplicate() bool {
+	return d.DuplicateOf != ""
+}
+
+// Index tracks the content hashes of the clips kept so far and appends a
+// line to the report for each decision
+type Index struct {
+	mu sync.Mutex
+	f  *os.File
+	// kept maps a content hash to the key of the clip kept for it
+	kept map[string]string
+	// decided holds the decisions already in the report, by key
+	decided map[string]Decision
+}
+
+// Open opens the report at path. With resume, the decisions already in the
+// report are loaded, so clips kept by a previous run still count and
+// decisions are not repeated; otherwise the report is started afresh. A
+// partial last line left by a crash is dropped.
+func Open(path string, resume bool) (*Index, error) {
+	x := &Index{kept: make(map[string]string), decided: make(map[string]Decision)}
+	var content []byte
+	if resume {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading dedup report: %v", err)
+		}
+		// Only newline-terminated lines were fully written
+		content = data[:bytes.LastIndexByte(data, '\n')+1]
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for line := 1; scanner.Scan(); line++ {
+			var d Decision
+			if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+				return nil, fmt.Errorf("error reading dedup report line %d: %v", line, err)
+			}
+			x.add(d)
+		}
+	}
+
+	// Rewrite the complete lines so appends never follow a partial one
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return nil, fmt.Errorf("error writing dedup report: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("error writing dedup report: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dedup report: %v", err)
+	}
+	x.f = f
+	return x, nil
+}
+
+// add records a decision in the index
+func (x *Index) add(d Decision) {
+	if !d.Duplicate() {
+		if _, ok := x.kept[d.SHA256]; !ok {
+			x.kept[d.SHA256] = d.Key
+		}
+	}
+	x.decided[d.Key] = d
+}
+
+// Check hashes the raw bytes of the clip with the given key and decides
+// whether it duplicates a clip kept earlier, recording the decision in the
+// report. A clip seen again under the same key, e.g. one read again after
+// an interrupted run, is not its own duplicate. It is safe for concurrent
+// use.
+func (x *Index) Check(key string, data []byte) (Decision, error) {
+	sum := sha256.Sum256(data)
+	d := Decision{Key: key, SHA256: hex.EncodeToString(sum[:])}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if other, ok := x.kept[d.SHA256]; ok && other != key {
+		d.DuplicateOf = other
+	}
+	if prev, ok := x.decided[key]; ok && prev == d {
+		return d, nil
+	}
+	line, err := json.Marshal(d)
+	if err != nil {
+		return d, err
+	}
+	if _, err := x.f.Write(append(line, '\n')); err != nil {
+		return d, fmt.Errorf("error writing dedup report: %v", err)
+	}
+	x.add(d)
+	return d, nil
+}
+
+// Close closes the report file
+func (x *Index) Close() error {
+	return x.f.Close()
+}
@@ -0,0 +1,77 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ReportFile)
+
+	x, err := Open(path, true)
+	if err != nil {
+		t.Fatalf("Open() without a report error = %v", err)
+	}
+	tests := []struct {
+		key         string
+		data        string
+		duplicateOf string
+	}{
+		{"a", "video one", ""},
+		{"b", "video two", ""},
+		{"c", "video one", "a"},
+		{"a", "video one", ""},
+	}
+	for _, tt := range tests {
+		d, err := x.Check(tt.key, []byte(tt.data))
+		if err != nil {
+			t.Fatalf("Check(%s) error = %v", tt.key, err)
+		}
+		if d.DuplicateOf != tt.duplicateOf || d.Duplicate() != (tt.duplicateOf != "") {
+			t.Errorf("Check(%s) = %+v, want duplicate of %q", tt.key, d, tt.duplicateOf)
+		}
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a decision
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"key":"d"`)
+	f.Close()
+
+	// A resumed run still knows the kept clips and doesn't repeat decisions
+	x, err = Open(path, true)
+	if err != nil {
+		t.Fatalf("Open() with resume error = %v", err)
+	}
+	if d, err := x.Check("d", []byte("video two")); err != nil || d.DuplicateOf != "b" {
+		t.Errorf("Check(d) after resume = %+v, %v, want duplicate of b", d, err)
+	}
+	if _, err := x.Check("c", []byte("video one")); err != nil {
+		t.Fatal(err)
+	}
+	x.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("report has %d lines, want 4:\n%s", lines, data)
+	}
+
+	// Without resume the report starts afresh
+	x, err = Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer x.Close()
+	if d, _ := x.Check("c", []byte("video one")); d.Duplicate() {
+		t.Errorf("Check(c) in a fresh report = %+v, want kept", d)
+	}
+}
@@ -0,0 +1,287 @@
+// Package embedding computes an embedding vector for each processed chunk
+// with an external command or HTTP endpoint, such as a video encoder served
+// next to the pipeline, and writes it next to the chunk, so a dataset can be
+// deduplicated or indexed for retrieval without reading frames again.
+package embedding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+const (
+	// maxPostRetries is the number of consecutive failed requests after
+	// which embedding a chunk gives up
+	maxPostRetries = 5
+)
+
+var (
+	// postRetryDelay is the wait before the first retry, doubled on each
+	// consecutive failure; replaced in tests
+	postRetryDelay = time.Second
+	// client sends embedding requests, bounding how long a stalled
+	// endpoint can hold a worker
+	client = &http.Client{Timeout: 5 * time.Minute}
+)
+
+// Options configures how chunk embeddings are computed
+type Options struct {
+	// Format is the format of the processed chunks, npy, npz or pt
+	Format processor.OutputFormat
+	// Command is run with sh -c for each chunk, with the chunk file on
+	// stdin, its path in VIDPREP_CHUNK and its key in VIDPREP_KEY, and
+	// prints the embedding as a JSON array of numbers
+	Command string
+	// URL receives each chunk file as the body of a POST request, with its
+	// key in the X-Chunk-Key header, and responds with the embedding as a
+	// JSON array of numbers. Only one of Command and URL is set.
+	URL string
+	// Workers is the number of chunks embedded concurrently
+	Workers int
+	// Resume keeps embeddings written by a previous run
+	Resume bool
+}
+
+// Path returns the path of the embedding of the chunk file at chunkPath
+func Path(chunkPath string) string {
+	return strings.TrimSuffix(chunkPath, filepath.Ext(chunkPath)) + types.EmbeddingSuffix
+}
+
+// WriteEmbeddings computes the embedding of every npy, npz or pt chunk under
+// dir and writes it next to the chunk as a 1-D float32 npy file named
+// <chunk>.emb.npy. All embeddings must have the same length.
+func WriteEmbeddings(dir string, opts Options) error {
+	if opts.Format != processor.FormatNPY && opts.Format != processor.FormatNPZ && opts.Format != processor.FormatPT {
+		return fmt.Errorf("%w: embeddings need npy, npz or pt chunks, got %s", processor.ErrUnsupportedFormat, opts.Format)
+	}
+	if (opts.Command == "") == (opts.URL == "") {
+		return fmt.Errorf("exactly one of an embedding command and URL is required")
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	chunks, err := types.FindChunkFiles(dir, "."+string(opts.Format))
+	if err != nil {
+		return fmt.Errorf("error finding chunks: %v", err)
+	}
+
+	// Embed chunks concurrently; errors and the embedding length shared by
+	// all chunks are tracked under mu
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var errs []error
+	dim := 0
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				err := func() error {
+					vector, err := embed(dir, chunk, opts)
+					if err != nil {
+						return err
+					}
+					mu.Lock()
+					if dim == 0 {
+						dim = len(vector)
+					}
+					want := dim
+					mu.Unlock()
+					if len(vector) != want {
+						return fmt.Errorf("embedding has %d values, want %d like the other chunks", len(vector), want)
+					}
+					return writeVector(Path(chunk), vector)
+				}()
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("chunk %s: %w", chunkKey(dir, chunk), err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		// Keep embeddings written by a previous run, as long as they match
+		// the others' length, e.g. unless the model changed in between
+		if opts.Resume {
+			n, err := vectorLength(Path(chunk))
+			if err == nil {
+				mu.Lock()
+				if dim == 0 {
+					dim = n
+				}
+				if n != dim {
+					errs = append(errs, fmt.Errorf("chunk %s: existing embedding has %d values, want %d like the other chunks; rerun without -resume to replace it", chunkKey(dir, chunk), n, dim))
+				}
+				mu.Unlock()
+				continue
+			}
+			if !os.IsNotExist(err) {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("chunk %s: %w", chunkKey(dir, chunk), err))
+				mu.Unlock()
+				continue
+			}
+		}
+		jobs <- chunk
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("encountered %d errors: %w", len(errs), errors.Join(errs...))
+	}
+	return nil
+}
+
+// chunkKey returns the key of a chunk: its path relative to dir, with
+// forward slashes and without its extension
+func chunkKey(dir, chunk string) string {
+	rel, err := filepath.Rel(dir, chunk)
+	if err != nil {
+		rel = chunk
+	}
+	return filepath.ToSlash(strings.TrimSuffix(rel, filepath.Ext(rel)))
+}
+
+// embed runs the embedding command or request for a chunk and returns the
+// embedding it responds with
+func embed(dir, chunk string, opts Options) ([]float64, error) {
+	data, err := os.ReadFile(chunk)
+	if err != nil {
+		return nil, fmt.Errorf("error reading chunk: %v", err)
+	}
+	key := chunkKey(dir, chunk)
+
+	var out []byte
+	if opts.Command != "" {
+		out, err = runCommand(opts.Command, chunk, key, data)
+	} else {
+		out, err = post(opts.URL, key, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseVector(out)
+}
+
+// runCommand runs the embedding command with the chunk on stdin and returns
+// its output
+func runCommand(command, chunk, key string, data []byte) ([]byte, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Env = append(os.Environ(), "VIDPREP_CHUNK="+chunk, "VIDPREP_KEY="+key)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("embedding command failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("embedding command failed: %v", err)
+	}
+	return out, nil
+}
+
+// post sends the chunk to the embedding endpoint and returns the response
+// body. Connection failures, timeouts, rate limiting and server errors are
+// retried with exponential backoff.
+func post(url, key string, data []byte) ([]byte, error) {
+	for failures := 0; ; failures++ {
+		body, transient, err := postOnce(url, key, data)
+		if err == nil || !transient || failures >= maxPostRetries {
+			return body, err
+		}
+		time.Sleep(postRetryDelay << failures)
+	}
+}
+
+// postOnce sends one embedding request, reporting whether a failure may
+// succeed when retried
+func postOnce(url, key string, data []byte) ([]byte, bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating embedding request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Chunk-Key", key)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("error requesting embedding: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("error reading embedding response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		transient := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, transient, fmt.Errorf("embedding request failed with status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, false, nil
+}
+
+// parseVector decodes an embedding from a JSON array of numbers
+func parseVector(data []byte) ([]float64, error) {
+	var vector []float64
+	if err := json.Unmarshal(data, &vector); err != nil {
+		return nil, fmt.Errorf("error parsing embedding, want a JSON array of numbers: %v", err)
+	}
+	if len(vector) == 0 {
+		return nil, fmt.Errorf("embedding is empty")
+	}
+	return vector, nil
+}
+
+// vectorLength returns the length of the embedding stored at path
+func vectorLength(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	r, err := numpy.NewReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	if len(r.Header.Shape) != 1 {
+		return 0, fmt.Errorf("existing embedding has shape %v, want a 1-D vector", r.Header.Shape)
+	}
+	return r.Header.Shape[0], nil
+}
+
+// writeVector writes an embedding to path as a 1-D float32 npy file
+func writeVector(path string, vector []float64) error {
+	data := make([]byte, 0, len(vector)*4)
+	for _, v := range vector {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(v)))
+	}
+	w, err := numpy.NewWriter(path)
+	if err != nil {
+		return fmt.Errorf("error creating embedding file: %v", err)
+	}
+	if err := w.WriteDType(data, []int{len(vector)}, numpy.Float32); err != nil {
+		w.Close()
+		return fmt.Errorf("error writing embedding: %v", err)
+	}
+	return w.Close()
+}
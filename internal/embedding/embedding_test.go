@@ -0,0 +1,217 @@
+package embedding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+)
+
+// createChunks writes n small npy chunks of clip video1 under dir
+func createChunks(t *testing.T, dir string, n int) {
+	clipDir := filepath.Join(dir, "video1")
+	if err := os.MkdirAll(clipDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		w, err := numpy.NewWriter(filepath.Join(clipDir, fmt.Sprintf("chunk_%05d.npy", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write([]byte{byte(i), 0, 0}, []int{1, 1, 1, 3}); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+	}
+}
+
+// readVector reads a 1-D float32 embedding file
+func readVector(t *testing.T, path string) []float32 {
+	r, err := numpy.NewReader(path)
+	if err != nil {
+		t.Fatalf("error reading embedding: %v", err)
+	}
+	defer r.Close()
+	if r.Header.DType != numpy.Float32 || len(r.Header.Shape) != 1 {
+		t.Fatalf("embedding dtype = %s, shape = %v, want %s, 1-D", r.Header.DType, r.Header.Shape, numpy.Float32)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vector := make([]float32, r.Header.Shape[0])
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vector
+}
+
+func TestWriteEmbeddingsCommand(t *testing.T) {
+	dir := t.TempDir()
+	createChunks(t, dir, 2)
+
+	// The command embeds each chunk as its size in bytes and its key length
+	opts := Options{
+		Format:  processor.FormatNPY,
+		Command: `echo "[$(wc -c), ${#VIDPREP_KEY}]"`,
+	}
+	if err := WriteEmbeddings(dir, opts); err != nil {
+		t.Fatalf("WriteEmbeddings() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		chunk := filepath.Join(dir, "video1", fmt.Sprintf("chunk_%05d.npy", i))
+		info, err := os.Stat(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := readVector(t, Path(chunk))
+		want := []float32{float32(info.Size()), float32(len("video1/chunk_00000"))}
+		if !slices.Equal(got, want) {
+			t.Errorf("embedding of chunk %d = %v, want %v", i, got, want)
+		}
+	}
+
+	// A second run only embeds chunks without an embedding, which are not
+	// themselves taken as chunks
+	opts.Resume = true
+	opts.Command = "exit 1"
+	if err := WriteEmbeddings(dir, opts); err != nil {
+		t.Errorf("WriteEmbeddings() with all chunks embedded error = %v", err)
+	}
+
+	// New embeddings must match the length of those kept, e.g. after the
+	// model changed between runs
+	if err := os.Remove(filepath.Join(dir, "video1", "chunk_00001.emb.npy")); err != nil {
+		t.Fatal(err)
+	}
+	opts.Command = "echo [1, 2, 3]"
+	if err := WriteEmbeddings(dir, opts); err == nil {
+		t.Error("WriteEmbeddings() with a longer embedding than the kept ones succeeded, want error")
+	}
+	opts.Command = "echo [1, 2]"
+	if err := WriteEmbeddings(dir, opts); err != nil {
+		t.Errorf("WriteEmbeddings() with a matching embedding error = %v", err)
+	}
+}
+
+func TestWriteEmbeddingsResumeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	createChunks(t, dir, 2)
+	for i, vector := range [][]float64{{1, 2}, {1, 2, 3}} {
+		if err := writeVector(filepath.Join(dir, "video1", fmt.Sprintf("chunk_%05d.emb.npy", i)), vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{Format: processor.FormatNPY, Command: "echo [1, 2]", Resume: true}
+	if err := WriteEmbeddings(dir, opts); err == nil {
+		t.Error("WriteEmbeddings() keeping embeddings of different lengths succeeded, want error")
+	}
+}
+
+func TestWriteEmbeddingsURL(t *testing.T) {
+	dir := t.TempDir()
+	createChunks(t, dir, 3)
+
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-Chunk-Key"))
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "[%d, 0.5]", body[len(body)-3])
+	}))
+	defer server.Close()
+
+	if err := WriteEmbeddings(dir, Options{Format: processor.FormatNPY, URL: server.URL, Workers: 1}); err != nil {
+		t.Fatalf("WriteEmbeddings() error = %v", err)
+	}
+	wantKeys := []string{"video1/chunk_00000", "video1/chunk_00001", "video1/chunk_00002"}
+	if !slices.Equal(keys, wantKeys) {
+		t.Errorf("requested keys = %v, want %v", keys, wantKeys)
+	}
+	got := readVector(t, filepath.Join(dir, "video1", "chunk_00002.emb.npy"))
+	if want := []float32{2, 0.5}; !slices.Equal(got, want) {
+		t.Errorf("embedding = %v, want %v", got, want)
+	}
+}
+
+func TestWriteEmbeddingsURLRetries(t *testing.T) {
+	dir := t.TempDir()
+	createChunks(t, dir, 1)
+
+	// The endpoint is overloaded on its first request and then rejects
+	// chunks of any other clip
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case requests.Add(1) == 1:
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		case r.Header.Get("X-Chunk-Key") != "video1/chunk_00000":
+			http.Error(w, "unknown clip", http.StatusBadRequest)
+		default:
+			fmt.Fprint(w, "[1, 2]")
+		}
+	}))
+	defer server.Close()
+
+	savedDelay := postRetryDelay
+	postRetryDelay = 0
+	t.Cleanup(func() { postRetryDelay = savedDelay })
+
+	if err := WriteEmbeddings(dir, Options{Format: processor.FormatNPY, URL: server.URL}); err != nil {
+		t.Fatalf("WriteEmbeddings() error = %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("endpoint received %d requests, want 2", got)
+	}
+
+	// Client errors are not retried
+	requests.Store(1)
+	if _, err := post(server.URL, "video2/chunk_00000", nil); err == nil {
+		t.Error("post() of an unknown clip succeeded, want error")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("endpoint received %d requests for a rejected chunk, want 1", got-1)
+	}
+}
+
+func TestWriteEmbeddingsErrors(t *testing.T) {
+	dir := t.TempDir()
+	createChunks(t, dir, 2)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"failing command", Options{Format: processor.FormatNPY, Command: "echo oops >&2; exit 1"}},
+		{"not a vector", Options{Format: processor.FormatNPY, Command: `echo '{"embedding": [1]}'`}},
+		{"empty vector", Options{Format: processor.FormatNPY, Command: "echo []"}},
+		{"mismatched lengths", Options{Format: processor.FormatNPY, Command: `[ "$VIDPREP_KEY" = video1/chunk_00000 ] && echo [1] || echo [1,2]`}},
+		{"command and URL", Options{Format: processor.FormatNPY, Command: "echo [1]", URL: "http://localhost"}},
+		{"neither command nor URL", Options{Format: processor.FormatNPY}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := WriteEmbeddings(dir, tt.opts); err == nil {
+				t.Error("WriteEmbeddings() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestWriteEmbeddingsUnsupportedFormat(t *testing.T) {
+	err := WriteEmbeddings(t.TempDir(), Options{Format: processor.FormatJPEG, Command: "echo [1]"})
+	if !errors.Is(err, processor.ErrUnsupportedFormat) {
+		t.Errorf("WriteEmbeddings() error = %v, want %v", err, processor.ErrUnsupportedFormat)
+	}
+}
@@ -0,0 +1,152 @@
+package fixtures
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// Pattern selects the synthetic source used for generated clips
+type Pattern string
+
+const (
+	// PatternTestSrc is ffmpeg's moving test pattern with a frame counter
+	PatternTestSrc Pattern = "testsrc2"
+	// PatternBars is a static SMPTE color bar pattern
+	PatternBars Pattern = "smptebars"
+	// PatternColor is a solid color that differs between clips
+	PatternColor Pattern = "color"
+)
+
+// colors are cycled through by PatternColor clips
+var colors = []string{"red", "green", "blue", "yellow", "cyan", "magenta", "white", "gray"}
+
+// Options configures the synthetic clips written by Generate
+type Options struct {
+	// Count is the number of clips in the tar
+	Count int
+	// Duration is the length of each clip in seconds
+	Duration float64
+	FPS      int
+	// Size is the frame size as WIDTHxHEIGHT
+	Size string
+	// Codec is the ffmpeg video encoder, e.g. libx264, libx265, mpeg4
+	Codec   string
+	Pattern Pattern
+	// Audio adds a sine tone audio track to each clip
+	Audio bool
+}
+
+// Validate checks that the options describe clips that can be generated
+func (o Options) Validate() error {
+	if o.Count <= 0 {
+		return fmt.Errorf("clip count must be positive, got %d", o.Count)
+	}
+	if o.Duration <= 0 {
+		return fmt.Errorf("duration must be positive, got %g", o.Duration)
+	}
+	if o.FPS <= 0 {
+		return fmt.Errorf("fps must be positive, got %d", o.FPS)
+	}
+	switch o.Pattern {
+	case PatternTestSrc, PatternBars, PatternColor:
+	default:
+		return fmt.Errorf("unsupported pattern: %s", o.Pattern)
+	}
+	return nil
+}
+
+// sourceFilter returns the lavfi source description for the i-th clip
+func sourceFilter(i int, opts Options) string {
+	params := fmt.Sprintf("s=%s:r=%d:d=%g", opts.Size, opts.FPS, opts.Duration)
+	if opts.Pattern == PatternColor {
+		return fmt.Sprintf("color=c=%s:%s", colors[i%len(colors)], params)
+	}
+	return fmt.Sprintf("%s=%s", opts.Pattern, params)
+}
+
+// clipName returns the tar entry name of the i-th clip
+func clipName(i int) string {
+	return fmt.Sprintf("clip_%05d.mp4", i)
+}
+
+// Generate writes a tar of synthetic .mp4 clips to tarPath
+func Generate(tarPath string, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "govidprep-fixtures-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tarFile, err := os.Create(tarPath)
+	if err != nil {
+		return fmt.Errorf("error creating tar file: %v", err)
+	}
+	defer tarFile.Close()
+
+	tw := tar.NewWriter(tarFile)
+	defer tw.Close()
+
+	for i := 0; i < opts.Count; i++ {
+		clipPath := filepath.Join(tempDir, clipName(i))
+		if err := encodeClip(i, clipPath, opts); err != nil {
+			return err
+		}
+		if err := addFile(tw, clipPath, clipName(i)); err != nil {
+			return err
+		}
+		os.Remove(clipPath)
+	}
+
+	return tw.Close()
+}
+
+// encodeClip encodes the i-th synthetic clip to path
+func encodeClip(i int, path string, opts Options) error {
+	streams := []*ffmpeg.Stream{ffmpeg.Input(sourceFilter(i, opts), ffmpeg.KwArgs{"f": "lavfi"})}
+	kwargs := ffmpeg.KwArgs{
+		"c:v":     opts.Codec,
+		"pix_fmt": "yuv420p",
+	}
+	if opts.Audio {
+		tone := fmt.Sprintf("sine=frequency=%d:duration=%g", 220*(i%4+1), opts.Duration)
+		streams = append(streams, ffmpeg.Input(tone, ffmpeg.KwArgs{"f": "lavfi"}))
+		kwargs["c:a"] = "aac"
+	}
+
+	err := ffmpeg.Output(streams, path, kwargs).
+		OverWriteOutput().
+		Run()
+	if err != nil {
+		return fmt.Errorf("error encoding clip %d: %v", i, err)
+	}
+	return nil
+}
+
+// addFile copies the file at path into the tar under name
+func addFile(tw *tar.Writer, path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading clip %s: %v", name, err)
+	}
+
+	header := &tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing tar header: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing clip %s: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package fixtures
+
+import "testing"
+
+func TestSourceFilter(t *testing.T) {
+	opts := Options{Duration: 2, FPS: 8, Size: "64x48"}
+	tests := []struct {
+		pattern Pattern
+		i       int
+		want    string
+	}{
+		{PatternTestSrc, 0, "testsrc2=s=64x48:r=8:d=2"},
+		{PatternBars, 3, "smptebars=s=64x48:r=8:d=2"},
+		{PatternColor, 0, "color=c=red:s=64x48:r=8:d=2"},
+		{PatternColor, 9, "color=c=green:s=64x48:r=8:d=2"},
+	}
+
+	for _, tt := range tests {
+		opts.Pattern = tt.pattern
+		if got := sourceFilter(tt.i, opts); got != tt.want {
+			t.Errorf("sourceFilter(%d) with %s = %s, want %s", tt.i, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	valid := Options{Count: 1, Duration: 1, FPS: 8, Size: "64x64", Codec: "libx264", Pattern: PatternTestSrc}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+
+	invalid := valid
+	invalid.Pattern = "noise"
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate() accepted an unsupported pattern")
+	}
+}
@@ -0,0 +1,95 @@
+package metaformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+)
+
+// encodeCBOR writes a JSON-decoded value as CBOR. Map keys are sorted in
+// RFC 8949 deterministic order (shorter keys first, then bytewise).
+func encodeCBOR(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			if i >= 0 {
+				cborHeader(buf, cborUnsigned, uint64(i))
+			} else {
+				cborHeader(buf, cborNegative, uint64(-1-i))
+			}
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid number %s: %v", v, err)
+		}
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		cborHeader(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		cborHeader(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		cborHeader(buf, cborMap, uint64(len(v)))
+		keys := sortedKeys(v)
+		sort.SliceStable(keys, func(i, j int) bool { return len(keys[i]) < len(keys[j]) })
+		for _, k := range keys {
+			if err := encodeCBOR(buf, k); err != nil {
+				return err
+			}
+			if err := encodeCBOR(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported cbor value of type %T", value)
+	}
+	return nil
+}
+
+// cborHeader writes the initial byte of a data item of the given major type
+// followed by its argument in the shortest encoding
+func cborHeader(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
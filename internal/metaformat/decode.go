@@ -0,0 +1,244 @@
+package metaformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ToJSON converts metadata encoded in format f to compact JSON, so it can be
+// checked with the same tools as JSON metadata. JSON input is returned as is.
+// The binary decoders accept the types Marshal writes: nil, booleans,
+// integers, floats, text strings, arrays and maps with string keys.
+func ToJSON(data []byte, f Format) ([]byte, error) {
+	if f == "" || f == JSON {
+		return data, nil
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := bytes.NewReader(data)
+	var value any
+	var err error
+	if f == MsgPack {
+		value, err = decodeMsgPack(r)
+	} else {
+		value, err = decodeCBOR(r)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", f, err)
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("error decoding %s: %d trailing bytes", f, r.Len())
+	}
+	return json.Marshal(value)
+}
+
+// readN reads n bytes, failing rather than allocating if fewer are left
+func readN(r *bytes.Reader, n uint64) ([]byte, error) {
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+// readUint reads a big-endian unsigned integer of size bytes
+func readUint(r *bytes.Reader, size int) (uint64, error) {
+	buf, err := readN(r, uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, b := range buf {
+		u = u<<8 | uint64(b)
+	}
+	return u, nil
+}
+
+// decodeMsgPack reads one MessagePack value
+func decodeMsgPack(r *bytes.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	case b&0xf0 == 0x80:
+		return decodeMsgPackMap(r, uint64(b&0x0f))
+	case b&0xf0 == 0x90:
+		return decodeMsgPackArray(r, uint64(b&0x0f))
+	case b&0xe0 == 0xa0:
+		return decodeMsgPackString(r, uint64(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xca:
+		u, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUint(r, 8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readUint(r, 1<<(b-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		u, err := readUint(r, size)
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := readUint(r, 1<<(b-0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readUint(r, 2<<(b-0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readUint(r, 2<<(b-0xde))
+		if err != nil {
+			return nil, err
+		}
+		return decodeMsgPackMap(r, n)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", b)
+}
+
+func decodeMsgPackString(r *bytes.Reader, n uint64) (any, error) {
+	buf, err := readN(r, n)
+	return string(buf), err
+}
+
+func decodeMsgPackArray(r *bytes.Reader, n uint64) (any, error) {
+	// Every element takes at least one byte
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	items := make([]any, n)
+	for i := range items {
+		item, err := decodeMsgPack(r)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+func decodeMsgPackMap(r *bytes.Reader, n uint64) (any, error) {
+	m := make(map[string]any)
+	for i := uint64(0); i < n; i++ {
+		key, err := decodeMsgPack(r)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("unsupported msgpack map key of type %T", key)
+		}
+		if m[k], err = decodeMsgPack(r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// decodeCBOR reads one CBOR data item
+func decodeCBOR(r *bytes.Reader) (any, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := b>>5, b&0x1f
+
+	// Simple values and floats carry no length argument
+	if major == 7 {
+		switch b {
+		case 0xf4:
+			return false, nil
+		case 0xf5:
+			return true, nil
+		case 0xf6:
+			return nil, nil
+		case 0xfa:
+			u, err := readUint(r, 4)
+			return float64(math.Float32frombits(uint32(u))), err
+		case 0xfb:
+			u, err := readUint(r, 8)
+			return math.Float64frombits(u), err
+		}
+		return nil, fmt.Errorf("unsupported cbor simple value 0x%02x", b)
+	}
+
+	arg := uint64(info)
+	switch {
+	case info >= 24 && info <= 27:
+		if arg, err = readUint(r, 1<<(info-24)); err != nil {
+			return nil, err
+		}
+	case info > 27:
+		return nil, fmt.Errorf("unsupported cbor length 0x%02x", b)
+	}
+
+	switch major {
+	case cborUnsigned:
+		return arg, nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor integer out of range")
+		}
+		return -1 - int64(arg), nil
+	case cborText:
+		buf, err := readN(r, arg)
+		return string(buf), err
+	case cborArray:
+		if arg > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		items := make([]any, arg)
+		for i := range items {
+			if items[i], err = decodeCBOR(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case cborMap:
+		m := make(map[string]any)
+		for i := uint64(0); i < arg; i++ {
+			key, err := decodeCBOR(r)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported cbor map key of type %T", key)
+			}
+			if m[k], err = decodeCBOR(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported cbor major type %d", major)
+}
@@ -0,0 +1,100 @@
+// Package metaformat serializes chunk metadata as JSON, MessagePack or CBOR.
+//
+// MessagePack and CBOR output is derived from the value's JSON encoding, so
+// struct tags and omitempty apply unchanged. Map keys are written in sorted
+// order, making the output deterministic.
+package metaformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Format is a metadata serialization format
+type Format string
+
+const (
+	JSON    Format = "json"
+	MsgPack Format = "msgpack"
+	CBOR    Format = "cbor"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{JSON, MsgPack, CBOR}
+
+// Validate checks that the format is supported. The empty format is JSON.
+func (f Format) Validate() error {
+	switch f {
+	case "", JSON, MsgPack, CBOR:
+		return nil
+	}
+	return fmt.Errorf("unsupported metadata format: %s", f)
+}
+
+// Ext returns the file extension of the format, without the dot. It is also
+// the WebDataset extension loaders use to pick a decoder.
+func (f Format) Ext() string {
+	if f == "" {
+		return string(JSON)
+	}
+	return string(f)
+}
+
+// Marshal encodes v in the given format. JSON output is indented for
+// readability; the binary formats are compact.
+func Marshal(v any, f Format) ([]byte, error) {
+	if f == "" || f == JSON {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Round-trip through JSON to get the value as plain maps, slices and numbers
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if f == MsgPack {
+		err = encodeMsgPack(&buf, value)
+	} else {
+		err = encodeCBOR(&buf, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FindFile looks for a metadata file named base plus the extension of any
+// supported format and returns its path and format
+func FindFile(base string) (string, Format, bool) {
+	for _, f := range Formats {
+		path := base + "." + f.Ext()
+		if _, err := os.Stat(path); err == nil {
+			return path, f, true
+		}
+	}
+	return "", "", false
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
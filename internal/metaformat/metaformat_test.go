@@ -0,0 +1,100 @@
+package metaformat
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	value := map[string]any{
+		"d":  "x",
+		"a":  1,
+		"bb": []any{true, nil},
+		"c":  -1.5,
+		"e":  300,
+		"f":  -100,
+	}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{MsgPack, "86" + "a161" + "01" + "a2626292c3c0" + "a163" + "cbbff8000000000000" + "a164a178" + "a165cd012c" + "a166d09c"},
+		{CBOR, "a6" + "616101" + "6163fbbff8000000000000" + "61646178" + "6165" + "19012c" + "6166" + "3863" + "62626282f5f6"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			got, err := Marshal(value, tt.format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("Marshal() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Marshal(value, "xml"); err == nil {
+		t.Error("Marshal() accepted an unsupported format")
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	value := map[string]any{
+		"key":    "video1/chunk_00000",
+		"fps":    8,
+		"size":   []int{224, 224},
+		"offset": -70000,
+		"big":    int64(1) << 40,
+		"score":  0.25,
+		"flags":  []any{true, false, nil},
+		"text":   strings.Repeat("x", 300),
+		"nested": map[string]any{"a": -1, "b": 255},
+	}
+	want, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []Format{MsgPack, CBOR} {
+		t.Run(string(f), func(t *testing.T) {
+			data, err := Marshal(value, f)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			got, err := ToJSON(data, f)
+			if err != nil {
+				t.Fatalf("ToJSON() error = %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("ToJSON() = %s, want %s", got, want)
+			}
+
+			if _, err := ToJSON(data[:len(data)-1], f); err == nil {
+				t.Error("ToJSON() of truncated data succeeded, want error")
+			}
+			if _, err := ToJSON(append(data, 0), f); err == nil {
+				t.Error("ToJSON() with trailing data succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestFindFile(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "metadata")
+	if _, _, ok := FindFile(base); ok {
+		t.Error("FindFile() found a file in an empty directory")
+	}
+	if err := os.WriteFile(base+".cbor", []byte{0xa0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, format, ok := FindFile(base)
+	if !ok || path != base+".cbor" || format != CBOR {
+		t.Errorf("FindFile() = %s, %s, %v, want %s.cbor, cbor, true", path, format, ok, base)
+	}
+}
@@ -0,0 +1,123 @@
+package metaformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// encodeMsgPack writes a JSON-decoded value as MessagePack
+func encodeMsgPack(buf *bytes.Buffer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			msgPackInt(buf, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid number %s: %v", v, err)
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(v)
+	case []any:
+		msgPackHeader(buf, len(v), 0x90, 0xdc)
+		for _, item := range v {
+			if err := encodeMsgPack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		msgPackHeader(buf, len(v), 0x80, 0xde)
+		for _, k := range sortedKeys(v) {
+			if err := encodeMsgPack(buf, k); err != nil {
+				return err
+			}
+			if err := encodeMsgPack(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported msgpack value of type %T", value)
+	}
+	return nil
+}
+
+// msgPackInt writes an integer in its smallest MessagePack encoding
+func msgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i < 128:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(i))
+	case i > 0:
+		u := uint64(i)
+		switch {
+		case u <= math.MaxUint8:
+			buf.Write([]byte{0xcc, byte(u)})
+		case u <= math.MaxUint16:
+			buf.WriteByte(0xcd)
+			binary.Write(buf, binary.BigEndian, uint16(u))
+		case u <= math.MaxUint32:
+			buf.WriteByte(0xce)
+			binary.Write(buf, binary.BigEndian, uint32(u))
+		default:
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, u)
+		}
+	default:
+		switch {
+		case i >= math.MinInt8:
+			buf.Write([]byte{0xd0, byte(i)})
+		case i >= math.MinInt16:
+			buf.WriteByte(0xd1)
+			binary.Write(buf, binary.BigEndian, int16(i))
+		case i >= math.MinInt32:
+			buf.WriteByte(0xd2)
+			binary.Write(buf, binary.BigEndian, int32(i))
+		default:
+			buf.WriteByte(0xd3)
+			binary.Write(buf, binary.BigEndian, i)
+		}
+	}
+}
+
+// msgPackHeader writes an array or map header: the fix type for fewer than 16
+// elements, otherwise the 16- or 32-bit type that follows base16
+func msgPackHeader(buf *bytes.Buffer, n int, fix, base16 byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(base16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(base16 + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,100 @@
+package numpy
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Array is a named array stored in a NumPy archive (.npz)
+type Array struct {
+	Name  string
+	Data  []byte
+	Shape []int
+	DType DType
+}
+
+// WriteNPZ writes arrays to a zip-compressed NumPy archive, as
+// numpy.savez_compressed does: each array is a deflated <name>.npy entry.
+// The data must already be encoded in the byte order described by DType.
+func WriteNPZ(path string, arrays ...Array) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating npz file: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, a := range arrays {
+		header, err := createHeader(a.Shape, a.DType)
+		if err != nil {
+			return fmt.Errorf("error creating numpy header: %v", err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: a.Name + ".npy", Method: zip.Deflate})
+		if err != nil {
+			return fmt.Errorf("error writing npz entry %s: %v", a.Name, err)
+		}
+		if _, err := w.Write(header); err != nil {
+			return fmt.Errorf("error writing npz entry %s: %v", a.Name, err)
+		}
+		if _, err := w.Write(a.Data); err != nil {
+			return fmt.Errorf("error writing npz entry %s: %v", a.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error writing npz file: %v", err)
+	}
+	return file.Close()
+}
+
+// NewNPZReader opens the array stored as name in a NumPy archive (.npz) and
+// reads its header. The array data can then be streamed with Read.
+func NewNPZReader(path, name string) (*Reader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening npz file: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != name+".npy" {
+			continue
+		}
+		entry, err := f.Open()
+		if err != nil {
+			zr.Close()
+			return nil, fmt.Errorf("error opening npz entry %s: %v", name, err)
+		}
+		r := bufio.NewReader(entry)
+		header, err := readHeader(r)
+		if err != nil {
+			entry.Close()
+			zr.Close()
+			return nil, err
+		}
+		return &Reader{file: npzEntry{entry, zr}, r: r, Header: header}, nil
+	}
+	zr.Close()
+	return nil, fmt.Errorf("no array %s in %s", name, path)
+}
+
+// OpenFrames opens the frames of a chunk: the frames array of an .npz
+// chunk, or the array of any other NumPy file
+func OpenFrames(path string) (*Reader, error) {
+	if filepath.Ext(path) == ".npz" {
+		return NewNPZReader(path, "frames")
+	}
+	return NewReader(path)
+}
+
+// npzEntry closes an open archive entry together with its archive
+type npzEntry struct {
+	entry   io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (e npzEntry) Close() error {
+	e.entry.Close()
+	return e.archive.Close()
+}
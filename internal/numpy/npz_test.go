@@ -0,0 +1,76 @@
+package numpy
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNPZ(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunk.npz")
+	frames := []byte{1, 2, 3, 4, 5, 6}
+	metadata := []byte(`{"key":"a"}`)
+	err := WriteNPZ(path,
+		Array{Name: "frames", Data: frames, Shape: []int{2, 1, 1, 3}, DType: Uint8},
+		Array{Name: "metadata", Data: metadata, Shape: []int{len(metadata)}, DType: Uint8},
+	)
+	if err != nil {
+		t.Fatalf("WriteNPZ() error = %v", err)
+	}
+
+	// Entries are deflated like numpy.savez_compressed
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if f.Method != zip.Deflate {
+			t.Errorf("entry %s method = %d, want deflate", f.Name, f.Method)
+		}
+	}
+	zr.Close()
+
+	tests := []struct {
+		name  string
+		shape []int
+		data  []byte
+	}{
+		{"frames", []int{2, 1, 1, 3}, frames},
+		{"metadata", []int{len(metadata)}, metadata},
+	}
+	for _, tt := range tests {
+		reader, err := NewNPZReader(path, tt.name)
+		if err != nil {
+			t.Fatalf("NewNPZReader(%s) error = %v", tt.name, err)
+		}
+		if h := reader.Header; h.DType != Uint8 || len(h.Shape) != len(tt.shape) || h.Len() != len(tt.data) {
+			t.Errorf("%s header = %+v, want <u1 with shape %v", tt.name, h, tt.shape)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("%s data = %v, want %v", tt.name, got, tt.data)
+		}
+	}
+
+	if _, err := NewNPZReader(path, "labels"); err == nil {
+		t.Error("NewNPZReader() of a missing array succeeded")
+	}
+}
+
+func TestCreateHeaderOneDimension(t *testing.T) {
+	header, err := createHeader([]int{5}, Uint8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NumPy parses the shape as a Python tuple
+	if !strings.Contains(string(header), "'shape': (5,)") {
+		t.Errorf("header = %q, want shape (5,)", header)
+	}
+}
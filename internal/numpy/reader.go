@@ -0,0 +1,149 @@
+package numpy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	descrPattern   = regexp.MustCompile(`'descr':\s*'([^']*)'`)
+	fortranPattern = regexp.MustCompile(`'fortran_order':\s*(True|False)`)
+	shapePattern   = regexp.MustCompile(`'shape':\s*\(([^)]*)\)`)
+)
+
+// Header describes the array stored in a NumPy (.npy) file
+type Header struct {
+	Version      string // file format version, e.g. "1.0"
+	DType        DType
+	FortranOrder bool
+	Shape        []int
+}
+
+// Len returns the number of elements in the array
+func (h Header) Len() int {
+	n := 1
+	for _, dim := range h.Shape {
+		n *= dim
+	}
+	return n
+}
+
+// ItemSize returns the size in bytes of one element, or 0 for an unknown dtype
+func (h Header) ItemSize() int {
+	if len(h.DType) < 3 {
+		return 0
+	}
+	size, err := strconv.Atoi(string(h.DType[2:]))
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// Reader reads arrays from NumPy (.npy) files
+type Reader struct {
+	file   io.Closer
+	r      *bufio.Reader
+	Header Header
+}
+
+// NewReader opens a NumPy file and reads its header. The array data can then
+// be streamed with Read.
+func NewReader(filepath string) (*Reader, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening npy file: %v", err)
+	}
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &Reader{file: file, r: r, Header: header}, nil
+}
+
+// Read reads array data, implementing io.Reader
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Close closes the underlying file or archive
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// readHeader reads the magic string, version and header dictionary of a NumPy file
+func readHeader(r io.Reader) (Header, error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return Header{}, fmt.Errorf("error reading npy magic: %v", err)
+	}
+	if !bytes.Equal(prefix[:6], []byte{0x93, 'N', 'U', 'M', 'P', 'Y'}) {
+		return Header{}, fmt.Errorf("not a npy file")
+	}
+
+	// Version 1.0 uses a 2-byte header length, later versions 4 bytes
+	var headerLen int
+	switch prefix[6] {
+	case 1:
+		var n uint16
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return Header{}, fmt.Errorf("error reading npy header length: %v", err)
+		}
+		headerLen = int(n)
+	case 2, 3:
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return Header{}, fmt.Errorf("error reading npy header length: %v", err)
+		}
+		headerLen = int(n)
+	default:
+		return Header{}, fmt.Errorf("unsupported npy version %d.%d", prefix[6], prefix[7])
+	}
+
+	dict := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, dict); err != nil {
+		return Header{}, fmt.Errorf("error reading npy header: %v", err)
+	}
+	header, err := parseHeader(string(dict))
+	if err != nil {
+		return Header{}, err
+	}
+	header.Version = fmt.Sprintf("%d.%d", prefix[6], prefix[7])
+	return header, nil
+}
+
+// parseHeader parses the Python dict literal of a NumPy header
+func parseHeader(dict string) (Header, error) {
+	descr := descrPattern.FindStringSubmatch(dict)
+	shape := shapePattern.FindStringSubmatch(dict)
+	if descr == nil || shape == nil {
+		return Header{}, fmt.Errorf("invalid npy header: %s", strings.TrimSpace(dict))
+	}
+
+	header := Header{DType: DType(descr[1])}
+	if fortran := fortranPattern.FindStringSubmatch(dict); fortran != nil {
+		header.FortranOrder = fortran[1] == "True"
+	}
+	for _, dim := range strings.Split(shape[1], ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" {
+			continue
+		}
+		n, err := strconv.Atoi(dim)
+		if err != nil {
+			return Header{}, fmt.Errorf("invalid npy shape: %s", shape[1])
+		}
+		header.Shape = append(header.Shape, n)
+	}
+	return header, nil
+}
@@ -0,0 +1,122 @@
+package numpy
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.npy")
+	writer, err := NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0}
+	if err := writer.WriteDType(data, []int{2, 1, 3}, Uint16); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	reader, err := NewReader(path)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	defer reader.Close()
+
+	h := reader.Header
+	if h.DType != Uint16 || h.FortranOrder || len(h.Shape) != 3 || h.Shape[0] != 2 || h.Shape[1] != 1 || h.Shape[2] != 3 {
+		t.Errorf("Header = %+v, want <u2 with shape (2, 1, 3)", h)
+	}
+	if h.Version != "1.0" {
+		t.Errorf("Version = %q, want 1.0", h.Version)
+	}
+	if h.Len() != 6 || h.ItemSize() != 2 {
+		t.Errorf("Len() = %d, ItemSize() = %d, want 6 and 2", h.Len(), h.ItemSize())
+	}
+
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data = %v, want %v", got, data)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		dict    string
+		want    []int
+		wantErr bool
+	}{
+		{"{'descr': '<f4', 'fortran_order': False, 'shape': (3,), }", []int{3}, false},
+		{"{'descr': '|u1', 'fortran_order': False, 'shape': (), }", nil, false},
+		{"{'fortran_order': False}", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHeader(tt.dict)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHeader(%q) error = %v, wantErr %v", tt.dict, err, tt.wantErr)
+			continue
+		}
+		if len(got.Shape) != len(tt.want) {
+			t.Errorf("parseHeader(%q) shape = %v, want %v", tt.dict, got.Shape, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name     string
+		shape    []int
+		channels int
+		want     []Summary
+	}{
+		{"channels last", []int{2, 3}, 3, []Summary{
+			{Count: 2, Min: 1, Max: 4, Mean: 2.5, Std: 1.5},
+			{Count: 2, Min: 2, Max: 5, Mean: 3.5, Std: 1.5},
+			{Count: 2, Min: 3, Max: 6, Mean: 4.5, Std: 1.5},
+		}},
+		{"no channel dimension", []int{3, 2}, 3, []Summary{
+			{Count: 6, Min: 1, Max: 6, Mean: 3.5, Std: 1.707825127659933},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.npy")
+			writer, err := NewWriter(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Write([]byte{1, 2, 3, 4, 5, 6}, tt.shape); err != nil {
+				t.Fatal(err)
+			}
+			writer.Close()
+
+			reader, err := NewReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			got, err := reader.Summarize(tt.channels)
+			if err != nil {
+				t.Fatalf("Summarize() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Summarize() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].Count != tt.want[i].Count || got[i].Min != tt.want[i].Min || got[i].Max != tt.want[i].Max ||
+					math.Abs(got[i].Mean-tt.want[i].Mean) > 1e-9 || math.Abs(got[i].Std-tt.want[i].Std) > 1e-9 {
+					t.Errorf("Summarize()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
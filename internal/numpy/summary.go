@@ -0,0 +1,89 @@
+package numpy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Summary holds basic statistics of the values of one channel
+type Summary struct {
+	Count int
+	Min   float64
+	Max   float64
+	Mean  float64
+	Std   float64
+}
+
+// Summarize reads the remaining array data and returns statistics of its
+// values. If the last dimension has channels elements the array is treated as
+// channels-last and one Summary is returned per channel; otherwise a single
+// Summary covers all values. Only little-endian uint8, uint16 and float32
+// arrays are supported.
+func (r *Reader) Summarize(channels int) ([]Summary, error) {
+	h := r.Header
+	decode, err := decoder(h.DType)
+	if err != nil {
+		return nil, err
+	}
+	if channels < 1 || len(h.Shape) == 0 || h.Shape[len(h.Shape)-1] != channels || h.FortranOrder {
+		channels = 1
+	}
+
+	itemSize := h.ItemSize()
+	sums := make([]float64, channels)
+	squares := make([]float64, channels)
+	summaries := make([]Summary, channels)
+	for c := range summaries {
+		summaries[c].Min = math.Inf(1)
+		summaries[c].Max = math.Inf(-1)
+	}
+
+	buf := make([]byte, 4096*channels*itemSize)
+	index := 0
+	for {
+		n, err := io.ReadFull(r, buf)
+		for i := 0; i+itemSize <= n; i += itemSize {
+			v := decode(buf[i : i+itemSize])
+			s := &summaries[index%channels]
+			s.Count++
+			s.Min = math.Min(s.Min, v)
+			s.Max = math.Max(s.Max, v)
+			sums[index%channels] += v
+			squares[index%channels] += v * v
+			index++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading npy data: %v", err)
+		}
+	}
+
+	for c := range summaries {
+		s := &summaries[c]
+		if s.Count == 0 {
+			s.Min, s.Max = 0, 0
+			continue
+		}
+		s.Mean = sums[c] / float64(s.Count)
+		s.Std = math.Sqrt(math.Max(squares[c]/float64(s.Count)-s.Mean*s.Mean, 0))
+	}
+	return summaries, nil
+}
+
+// decoder returns a function converting one element of dtype to a float64
+func decoder(dtype DType) (func([]byte) float64, error) {
+	switch dtype {
+	case Uint8, "|u1":
+		return func(b []byte) float64 { return float64(b[0]) }, nil
+	case Uint16:
+		return func(b []byte) float64 { return float64(binary.LittleEndian.Uint16(b)) }, nil
+	case Float32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported dtype %s", dtype)
+	}
+}
@@ -7,6 +7,16 @@ import (
 	"os"
 )
 
+// DType is a NumPy array-protocol type string
+type DType string
+
+const (
+	Uint8   DType = "<u1"
+	Uint16  DType = "<u2"
+	Int32   DType = "<i4"
+	Float32 DType = "<f4"
+)
+
 // Writer handles writing data to NumPy (.npy) files
 type Writer struct {
 	file *os.File
@@ -26,10 +36,16 @@ func (w *Writer) Close() error {
 	return w.file.Close()
 }
 
-// Write writes data to the NumPy file with the given shape
+// Write writes uint8 data to the NumPy file with the given shape
 func (w *Writer) Write(data []byte, shape []int) error {
+	return w.WriteDType(data, shape, Uint8)
+}
+
+// WriteDType writes data to the NumPy file with the given shape and dtype.
+// The data must already be encoded in the byte order described by dtype.
+func (w *Writer) WriteDType(data []byte, shape []int, dtype DType) error {
 	// Create and write the header
-	header, err := createHeader(shape)
+	header, err := createHeader(shape, dtype)
 	if err != nil {
 		return fmt.Errorf("error creating numpy header: %v", err)
 	}
@@ -46,17 +62,21 @@ func (w *Writer) Write(data []byte, shape []int) error {
 	return nil
 }
 
-// createHeader creates a NumPy array header with the given shape
-func createHeader(shape []int) ([]byte, error) {
+// createHeader creates a NumPy array header with the given shape and dtype
+func createHeader(shape []int, dtype DType) ([]byte, error) {
 	// Create the dictionary string
 	var shapeStr bytes.Buffer
-	shapeStr.WriteString("{'descr': '<u1', 'fortran_order': False, 'shape': (")
+	shapeStr.WriteString(fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (", dtype))
 	for i, s := range shape {
 		shapeStr.WriteString(fmt.Sprintf("%d", s))
 		if i < len(shape)-1 {
 			shapeStr.WriteString(", ")
 		}
 	}
+	// A one-element Python tuple needs a trailing comma
+	if len(shape) == 1 {
+		shapeStr.WriteString(",")
+	}
 	shapeStr.WriteString(")}")
 
 	dictBytes := shapeStr.Bytes()
@@ -2,6 +2,7 @@ package numpy
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -108,3 +109,42 @@ func TestWriterWithDifferentShapes(t *testing.T) {
 		})
 	}
 }
+
+func TestWriterDType(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "test-*.npy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	writer, err := NewWriter(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two little-endian uint16 samples
+	data := []byte{0xff, 0x03, 0x00, 0x04}
+	if err := writer.WriteDType(data, []int{2}, Uint16); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	fileData, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(fileData), "'descr': '<u2'") {
+		t.Error("Header does not declare uint16 dtype")
+	}
+
+	// Header must be aligned to 16 bytes and followed by the data
+	headerLen := len(fileData) - len(data)
+	if headerLen%16 != 0 {
+		t.Errorf("Header length %d is not a multiple of 16", headerLen)
+	}
+	if string(fileData[headerLen:]) != string(data) {
+		t.Error("Data does not follow the header")
+	}
+}
@@ -0,0 +1,134 @@
+package parquet
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// Options configures how processed chunks are written to Parquet files
+type Options struct {
+	// RowsPerFile is the number of chunks per Parquet file
+	RowsPerFile int
+	// Format is the format of the processed chunks, npy or npz
+	Format processor.OutputFormat
+}
+
+// WriteChunks writes the npy or npz chunks under inputDir, in key order, to
+// Parquet files named part-XXXXX.parquet in outputDir, one row per chunk.
+// Chunk metadata must be JSON.
+func WriteChunks(inputDir, outputDir string, opts Options) error {
+	if opts.Format != processor.FormatNPY && opts.Format != processor.FormatNPZ {
+		return fmt.Errorf("%w: parquet output needs npy or npz chunks, got %s", processor.ErrUnsupportedFormat, opts.Format)
+	}
+	if opts.RowsPerFile <= 0 {
+		return fmt.Errorf("invalid rows per parquet file: %d", opts.RowsPerFile)
+	}
+
+	chunks, err := types.FindChunkFiles(inputDir, "."+string(opts.Format))
+	if err != nil {
+		return fmt.Errorf("error finding chunks: %v", err)
+	}
+
+	for start := 0; start < len(chunks); start += opts.RowsPerFile {
+		end := min(start+opts.RowsPerFile, len(chunks))
+		path := filepath.Join(outputDir, fmt.Sprintf("part-%05d.parquet", start/opts.RowsPerFile))
+		if err := writeFile(path, inputDir, chunks[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes chunks to one Parquet file
+func writeFile(path, inputDir string, chunks []string) error {
+	w, err := NewWriter(path)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		row, err := readChunk(inputDir, chunk)
+		if err != nil {
+			w.Close()
+			return err
+		}
+		if err := w.Write(row); err != nil {
+			w.Close()
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// readChunk reads the frames and metadata of an npy chunk and its metadata
+// file, or of an npz chunk
+func readChunk(inputDir, chunk string) (Row, error) {
+	rel, err := filepath.Rel(inputDir, chunk)
+	if err != nil {
+		rel = chunk
+	}
+	base := strings.TrimSuffix(chunk, filepath.Ext(chunk))
+	row := Row{Key: strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))}
+
+	reader, err := numpy.OpenFrames(chunk)
+	var metadata []byte
+	if err == nil {
+		if filepath.Ext(chunk) == ".npz" {
+			metadata, err = readNPZMetadata(chunk)
+		} else {
+			metadata, err = readMetadataFile(base)
+		}
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+	if err != nil {
+		return Row{}, fmt.Errorf("error reading chunk %s: %v", chunk, err)
+	}
+
+	row.Frames, err = io.ReadAll(reader)
+	if err != nil {
+		return Row{}, fmt.Errorf("error reading chunk %s: %v", chunk, err)
+	}
+	row.DType = string(reader.Header.DType)
+	row.Shape = reader.Header.Shape
+	row.Metadata = string(metadata)
+	return row, nil
+}
+
+// readMetadataFile reads the JSON metadata file of an npy chunk
+func readMetadataFile(base string) ([]byte, error) {
+	path, format, ok := metaformat.FindFile(base + "_metadata")
+	if !ok {
+		return nil, fmt.Errorf("no metadata file")
+	}
+	if format != metaformat.JSON {
+		return nil, fmt.Errorf("parquet output needs json metadata, got %s", format)
+	}
+	return os.ReadFile(path)
+}
+
+// readNPZMetadata reads the metadata array of an npz chunk, which must hold
+// a JSON document
+func readNPZMetadata(chunk string) ([]byte, error) {
+	reader, err := numpy.NewNPZReader(chunk, "metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	metadata, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) == 0 || metadata[0] != '{' {
+		return nil, fmt.Errorf("parquet output needs json metadata")
+	}
+	return metadata, nil
+}
@@ -0,0 +1,95 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol field types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes structs in the Thrift compact protocol, which
+// Parquet uses for its page headers and file metadata
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last holds the last field ID of each open struct; field IDs are
+	// written as deltas from it
+	last []int16
+}
+
+// begin opens a struct: the top-level struct, a list element, or the value
+// of a field written with structField
+func (w *thriftWriter) begin() {
+	w.last = append(w.last, 0)
+}
+
+// end closes the innermost open struct
+func (w *thriftWriter) end() {
+	w.buf.WriteByte(0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+// zigzag maps signed integers to unsigned ones with small absolute values
+// kept small
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(zigzag(v))
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.strValue(s)
+}
+
+func (w *thriftWriter) strValue(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// structField starts a struct-valued field; close it with end
+func (w *thriftWriter) structField(id int16) {
+	w.field(id, thriftStruct)
+	w.begin()
+}
+
+// list writes the header of a list field of n elements of typ, which
+// follow as bare values
+func (w *thriftWriter) list(id int16, typ byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | typ)
+		return
+	}
+	w.buf.WriteByte(0xf0 | typ)
+	w.varint(uint64(n))
+}
@@ -0,0 +1,312 @@
+// Package parquet writes processed chunks to Parquet files with one row per
+// chunk, so a dataset can be queried and filtered with tools such as DuckDB
+// or Spark. Only the fixed chunk schema is supported; values are written
+// PLAIN-encoded and uncompressed.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// magic starts and ends every Parquet file
+const magic = "PAR1"
+
+// maxRowGroupBytes is the size of frame data buffered before a row group is
+// written
+const maxRowGroupBytes = 128 << 20
+
+// Physical types, field repetitions, converted types and encodings of the
+// Parquet format
+const (
+	typeInt32     = 1
+	typeByteArray = 6
+
+	repetitionRequired = 0
+	repetitionRepeated = 2
+
+	convertedUTF8 = 0
+	convertedList = 3
+
+	encodingPlain = 0
+	encodingRLE   = 3
+)
+
+// Row is one chunk: its key, the raw bytes of its frames array with their
+// NumPy dtype and shape, and its JSON metadata
+type Row struct {
+	Key      string
+	Frames   []byte
+	DType    string
+	Shape    []int
+	Metadata string
+}
+
+// column describes a leaf column of the chunk schema
+type column struct {
+	path []string
+	typ  int32
+}
+
+// columns are the leaf columns of the chunk schema, in file order
+var columns = []column{
+	{[]string{"key"}, typeByteArray},
+	{[]string{"frames"}, typeByteArray},
+	{[]string{"dtype"}, typeByteArray},
+	{[]string{"shape", "list", "element"}, typeInt32},
+	{[]string{"metadata"}, typeByteArray},
+}
+
+// columnChunk records where a column chunk of a row group was written
+type columnChunk struct {
+	offset    int64
+	size      int64
+	numValues int
+}
+
+// rowGroup records a written row group
+type rowGroup struct {
+	chunks  []columnChunk
+	numRows int
+}
+
+// Writer writes rows to a Parquet file, buffering them into row groups
+type Writer struct {
+	file      *os.File
+	offset    int64
+	rows      []Row
+	size      int
+	rowGroups []rowGroup
+	numRows   int
+}
+
+// NewWriter creates a Parquet file at path
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating parquet file: %v", err)
+	}
+	w := &Writer{file: file}
+	if err := w.write([]byte(magic)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write adds a row, writing a row group once enough frame data is buffered
+func (w *Writer) Write(row Row) error {
+	w.rows = append(w.rows, row)
+	w.size += len(row.Frames)
+	if w.size >= maxRowGroupBytes {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the buffered rows and the file footer and closes the file
+func (w *Writer) Close() error {
+	defer w.file.Close()
+	if err := w.flush(); err != nil {
+		return err
+	}
+	footer := w.fileMetadata()
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	if err := w.write([]byte(magic)); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.file.Write(data)
+	w.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("error writing parquet file: %v", err)
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group, one data page per column
+func (w *Writer) flush() error {
+	if len(w.rows) == 0 {
+		return nil
+	}
+	group := rowGroup{numRows: len(w.rows)}
+	for i := range columns {
+		page, numValues := w.columnPage(i)
+		header := pageHeader(len(page), numValues)
+		chunk := columnChunk{offset: w.offset, size: int64(len(header) + len(page)), numValues: numValues}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(page); err != nil {
+			return err
+		}
+		group.chunks = append(group.chunks, chunk)
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.numRows += len(w.rows)
+	w.rows, w.size = nil, 0
+	return nil
+}
+
+// columnPage returns the data page of the buffered rows' values of a
+// column and the number of values in it
+func (w *Writer) columnPage(col int) ([]byte, int) {
+	var values bytes.Buffer
+	if columns[col].path[0] == "shape" {
+		// Every row has a non-empty shape, so each element is defined and
+		// only the first of each row starts a new list
+		var rep []level
+		numValues := 0
+		for _, row := range w.rows {
+			rep = append(rep, level{0, 1})
+			if len(row.Shape) > 1 {
+				rep = append(rep, level{1, len(row.Shape) - 1})
+			}
+			numValues += len(row.Shape)
+			for _, dim := range row.Shape {
+				values.Write(binary.LittleEndian.AppendUint32(nil, uint32(dim)))
+			}
+		}
+		var page bytes.Buffer
+		page.Write(encodeLevels(rep))
+		page.Write(encodeLevels([]level{{1, numValues}}))
+		page.Write(values.Bytes())
+		return page.Bytes(), numValues
+	}
+
+	for _, row := range w.rows {
+		var value []byte
+		switch columns[col].path[0] {
+		case "key":
+			value = []byte(row.Key)
+		case "frames":
+			value = row.Frames
+		case "dtype":
+			value = []byte(row.DType)
+		case "metadata":
+			value = []byte(row.Metadata)
+		}
+		values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(value))))
+		values.Write(value)
+	}
+	return values.Bytes(), len(w.rows)
+}
+
+// level is a run of count repetition or definition levels of value
+type level struct {
+	value int
+	count int
+}
+
+// encodeLevels encodes runs of levels with a bit width of 1 in the RLE
+// hybrid encoding, prefixed by their length as data pages require
+func encodeLevels(runs []level) []byte {
+	var buf bytes.Buffer
+	for _, run := range runs {
+		buf.Write(binary.AppendUvarint(nil, uint64(run.count)<<1))
+		buf.WriteByte(byte(run.value))
+	}
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(buf.Len())), buf.Bytes()...)
+}
+
+// pageHeader returns the header of an uncompressed PLAIN data page
+func pageHeader(size, numValues int) []byte {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 0) // DATA_PAGE
+	w.i32(2, int32(size))
+	w.i32(3, int32(size))
+	w.structField(5)
+	w.i32(1, int32(numValues))
+	w.i32(2, encodingPlain)
+	w.i32(3, encodingRLE)
+	w.i32(4, encodingRLE)
+	w.end()
+	w.end()
+	return w.buf.Bytes()
+}
+
+// fileMetadata returns the FileMetaData footer describing the schema and
+// the written row groups
+func (w *Writer) fileMetadata() []byte {
+	var t thriftWriter
+	t.begin()
+	t.i32(1, 1) // version
+
+	// The schema, flattened depth-first
+	t.list(2, thriftStruct, 8)
+	schemaElement(&t, "schema", -1, -1, 5, -1)
+	schemaElement(&t, "key", typeByteArray, repetitionRequired, 0, convertedUTF8)
+	schemaElement(&t, "frames", typeByteArray, repetitionRequired, 0, -1)
+	schemaElement(&t, "dtype", typeByteArray, repetitionRequired, 0, convertedUTF8)
+	schemaElement(&t, "shape", -1, repetitionRequired, 1, convertedList)
+	schemaElement(&t, "list", -1, repetitionRepeated, 1, -1)
+	schemaElement(&t, "element", typeInt32, repetitionRequired, 0, -1)
+	schemaElement(&t, "metadata", typeByteArray, repetitionRequired, 0, convertedUTF8)
+
+	t.i64(3, int64(w.numRows))
+	t.list(4, thriftStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(group.chunks))
+		var total int64
+		for i, chunk := range group.chunks {
+			total += chunk.size
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, columns[i].typ)
+			t.list(2, thriftI32, 2)
+			t.varint(zigzag(encodingPlain))
+			t.varint(zigzag(encodingRLE))
+			t.list(3, thriftBinary, len(columns[i].path))
+			for _, name := range columns[i].path {
+				t.strValue(name)
+			}
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(chunk.numValues))
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, total)
+		t.i64(3, int64(group.numRows))
+		t.end()
+	}
+	t.str(6, "go-vidprep")
+	t.end()
+	return t.buf.Bytes()
+}
+
+// schemaElement writes a SchemaElement; negative values leave the optional
+// type, repetition and converted type unset, and a zero numChildren marks
+// a leaf
+func schemaElement(t *thriftWriter, name string, typ, repetition, numChildren, converted int32) {
+	t.begin()
+	if typ >= 0 {
+		t.i32(1, typ)
+	}
+	if repetition >= 0 {
+		t.i32(3, repetition)
+	}
+	t.str(4, name)
+	if numChildren > 0 {
+		t.i32(5, numChildren)
+	}
+	if converted >= 0 {
+		t.i32(6, converted)
+	}
+	t.end()
+}
@@ -0,0 +1,120 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+)
+
+func TestEncodeLevels(t *testing.T) {
+	got := encodeLevels([]level{{0, 1}, {1, 3}})
+	want := []byte{4, 0, 0, 0, 2, 0, 6, 1}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeLevels() = %v, want %v", got, want)
+	}
+}
+
+func TestThriftWriter(t *testing.T) {
+	var w thriftWriter
+	w.begin()
+	w.i32(1, 3)
+	w.str(4, "ab")
+	w.structField(5)
+	w.i64(1, -1)
+	w.end()
+	w.end()
+	want := []byte{0x15, 0x06, 0x38, 2, 'a', 'b', 0x1c, 0x16, 0x01, 0x00, 0x00}
+	if !bytes.Equal(w.buf.Bytes(), want) {
+		t.Errorf("thriftWriter = %x, want %x", w.buf.Bytes(), want)
+	}
+}
+
+// createChunks writes n npy chunks of 2x2x3 frames with JSON metadata
+// under inputDir
+func createChunks(t *testing.T, inputDir string, n int) {
+	clipDir := filepath.Join(inputDir, "video1")
+	if err := os.MkdirAll(clipDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		base := filepath.Join(clipDir, fmt.Sprintf("chunk_%05d", i))
+		w, err := numpy.NewWriter(base + ".npy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(bytes.Repeat([]byte{byte(i)}, 12), []int{1, 2, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		metadata := fmt.Sprintf(`{"key":"video1/chunk_%05d"}`, i)
+		if err := os.WriteFile(base+"_metadata.json", []byte(metadata), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteChunks(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createChunks(t, inputDir, 3)
+
+	opts := Options{RowsPerFile: 2, Format: processor.FormatNPY}
+	if err := WriteChunks(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("WriteChunks() error = %v", err)
+	}
+
+	for i, rows := range []int{2, 1} {
+		data, err := os.ReadFile(filepath.Join(outputDir, fmt.Sprintf("part-%05d.parquet", i)))
+		if err != nil {
+			t.Fatalf("error reading part %d: %v", i, err)
+		}
+		if !bytes.HasPrefix(data, []byte(magic)) || !bytes.HasSuffix(data, []byte(magic)) {
+			t.Fatalf("part %d is not framed by %s", i, magic)
+		}
+		footerLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+		if footerLen <= 0 || footerLen > len(data)-12 {
+			t.Fatalf("part %d has invalid footer length %d", i, footerLen)
+		}
+		for r := 0; r < rows; r++ {
+			chunk := i*2 + r
+			key := fmt.Sprintf("video1/chunk_%05d", chunk)
+			metadata := fmt.Sprintf(`{"key":"video1/chunk_%05d"}`, chunk)
+			for _, value := range []string{key, metadata, string(bytes.Repeat([]byte{byte(chunk)}, 12))} {
+				if !bytes.Contains(data, []byte(value)) {
+					t.Errorf("part %d is missing %q", i, value)
+				}
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "part-00002.parquet")); !os.IsNotExist(err) {
+		t.Errorf("unexpected third part, stat error = %v", err)
+	}
+}
+
+func TestWriteChunksRequiresJSONMetadata(t *testing.T) {
+	inputDir := t.TempDir()
+	createChunks(t, inputDir, 1)
+	base := filepath.Join(inputDir, "video1", "chunk_00000_metadata")
+	if err := os.Rename(base+".json", base+".msgpack"); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := Options{RowsPerFile: 10, Format: processor.FormatNPY}
+	if err := WriteChunks(inputDir, t.TempDir(), opts); err == nil {
+		t.Error("WriteChunks() with msgpack metadata succeeded, want error")
+	}
+}
+
+func TestWriteChunksUnsupportedFormat(t *testing.T) {
+	opts := Options{RowsPerFile: 10, Format: processor.FormatJPEG}
+	err := WriteChunks(t.TempDir(), t.TempDir(), opts)
+	if !errors.Is(err, processor.ErrUnsupportedFormat) {
+		t.Errorf("WriteChunks() error = %v, want %v", err, processor.ErrUnsupportedFormat)
+	}
+}
@@ -0,0 +1,64 @@
+package processor
+
+import (
+	"fmt"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// AudioFormat is the format of the audio track written next to each chunk
+type AudioFormat string
+
+const (
+	AudioOff  AudioFormat = ""
+	AudioWAV  AudioFormat = "wav"
+	AudioFLAC AudioFormat = "flac"
+)
+
+// AudioFormats are the audio formats chunks can be written with
+var AudioFormats = []AudioFormat{AudioWAV, AudioFLAC}
+
+// defaultAudioSampleRate is the sample rate in Hz of chunk audio, as
+// expected by most speech and audio encoders
+const defaultAudioSampleRate = 16000
+
+// audioSampleRate returns the configured audio sample rate, defaulting to
+// 16 kHz
+func (o Options) audioSampleRate() int {
+	if o.AudioSampleRate > 0 {
+		return o.AudioSampleRate
+	}
+	return defaultAudioSampleRate
+}
+
+// audioArgs returns the output arguments of a mono chunk audio track of the
+// given length in seconds. The track is padded with silence if the source
+// audio ends early, so every chunk's audio spans exactly its frames.
+func (o Options) audioArgs(length float64) ffmpeg.KwArgs {
+	return ffmpeg.KwArgs{
+		"vn": "",
+		"ac": 1,
+		"ar": o.audioSampleRate(),
+		"af": "apad",
+		"t":  strconv.FormatFloat(length, 'f', -1, 64),
+	}
+}
+
+// saveChunkAudio writes the source audio over frames [start, end) of the
+// segment to outputPath
+func (c *clipContext) saveChunkAudio(seg segment, start, end int, outputPath string) error {
+	fps := float64(c.opts.FPS)
+	from := seg.Start + float64(start)/fps
+	kwargs := ffmpeg.KwArgs{}
+	if from > 0 {
+		kwargs["ss"] = strconv.FormatFloat(from, 'f', -1, 64)
+	}
+	_, err := runFFmpeg(ffmpeg.Input(c.videoPath, kwargs).
+		Output(outputPath, c.opts.audioArgs(float64(end-start)/fps)).
+		OverWriteOutput(), c.debugLog)
+	if err != nil {
+		return fmt.Errorf("error writing chunk audio: %w", err)
+	}
+	return nil
+}
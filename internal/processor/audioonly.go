@@ -0,0 +1,234 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// audioOnlyConflict returns the name of the first option set that needs
+// video frames, and so is not supported in audio-only mode, or ""
+func (o Options) audioOnlyConflict() string {
+	switch {
+	case o.SceneSplit:
+		return "scene splitting"
+	case o.KeyframeAlign:
+		return "keyframe alignment"
+	case o.Decimate:
+		return "decimation"
+	case o.Precheck:
+		return "prechecking"
+	case o.MinFrames > 0 || o.MinDuration > 0:
+		return "a minimum length"
+	case o.AllStreams || o.VideoStream > 0:
+		return "video stream selection"
+	case o.MultiCrop != MultiCropOff:
+		return "multi-crop output"
+	case o.AugCopies > 0:
+		return "augmented copies"
+	case o.Preview != PreviewOff:
+		return "previews"
+	case o.QualityMetrics || o.VMAF:
+		return "quality metrics"
+	case o.MotionStats:
+		return "motion statistics"
+	case o.UniformFrames > 0:
+		return "uniform sampling"
+	case o.Normalize != nil:
+		return "normalization"
+	case o.Layout == LayoutTCHW:
+		return "channels-first layout"
+	}
+	return ""
+}
+
+// probeAudio runs ffprobe on a file and reports whether it has an audio
+// stream, and its duration in seconds if known. Unlike probeVideo it accepts
+// files without video.
+func probeAudio(path string) (bool, float64, error) {
+	out, err := runProbe(path)
+	if err != nil {
+		return false, 0, err
+	}
+	var probe probeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return false, 0, fmt.Errorf("error parsing ffprobe output: %w", err)
+	}
+	hasAudio := false
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "audio" {
+			hasAudio = true
+		}
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	return hasAudio, duration, nil
+}
+
+// processAudioOnly chunks the clip's audio track into waveform arrays,
+// without extracting frames. Clips without audio produce no chunks.
+func processAudioOnly(ctx *clipContext) error {
+	opts := ctx.opts
+	hasAudio, duration, err := probeAudio(ctx.videoPath)
+	if err != nil {
+		return err
+	}
+	if !hasAudio {
+		return nil
+	}
+	if len(ctx.clip.Timestamps) > 0 {
+		return fmt.Errorf("timestamp samples are not supported in audio-only mode")
+	}
+	ctx.hasAudio = true
+	ctx.duration = duration
+
+	closeLog, err := ctx.createOutput()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	// Detect silent audio to flag or drop silent chunks
+	if opts.Silence != SilenceOff {
+		ctx.silences, err = detectSilence(ctx.videoPath, opts.silenceThresholdDB(), ctx.debugLog)
+		if err != nil {
+			return err
+		}
+	}
+
+	segments, err := ctx.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := processAudioChunks(ctx, seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audioSampleArgs returns the output arguments decoding a segment's audio as
+// raw samples. A segment limited to a number of frames, such as a random
+// chunk, is cut to their length, as frames:v does for video.
+func (o Options) audioSampleArgs(seg segment) ffmpeg.KwArgs {
+	kwargs := ffmpeg.KwArgs{
+		"vn": "",
+		"ac": 1,
+		"ar": o.audioSampleRate(),
+		"f":  "f32le",
+	}
+	if seg.Frames > 0 {
+		kwargs["t"] = strconv.FormatFloat(float64(seg.Frames)/float64(o.FPS), 'f', -1, 64)
+	}
+	return kwargs
+}
+
+// extractAudioSamples decodes the segment's audio as mono little-endian
+// float32 samples at the audio sample rate
+func (c *clipContext) extractAudioSamples(seg segment) ([]byte, error) {
+	tempRawPath := filepath.Join(os.TempDir(), filepath.Base(c.videoPath)+"_audio")
+	defer os.Remove(tempRawPath)
+
+	_, err := runFFmpeg(ffmpeg.Input(c.videoPath, seg.inputArgs()).
+		Output(tempRawPath, c.opts.audioSampleArgs(seg)).
+		OverWriteOutput(), c.debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting audio: %w", err)
+	}
+
+	data, err := os.ReadFile(tempRawPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audio: %w", err)
+	}
+	return data, nil
+}
+
+// audioFrames returns the number of whole frames at fps spanned by a number
+// of samples at rate Hz
+func audioFrames(samples, rate, fps int) int {
+	return samples * fps / rate
+}
+
+// segmentAudioFrames returns the number of frames spanned by a segment's
+// decoded samples, at most the segment's frame limit
+func (o Options) segmentAudioFrames(seg segment, samples int) int {
+	frames := audioFrames(samples, o.audioSampleRate(), o.FPS)
+	if seg.Frames > 0 && frames > seg.Frames {
+		return seg.Frames
+	}
+	return frames
+}
+
+// audioSample returns the index of the sample at rate Hz at which frame
+// starts at fps. Both are rounded down, so a chunk of n frames starting at
+// any frame has room for audioSample(n) samples within the frames counted
+// by audioFrames.
+func audioSample(frame, rate, fps int) int {
+	return frame * rate / fps
+}
+
+// processAudioChunks decodes a segment's audio and saves each complete chunk
+// as a waveform array. Chunks are planned in frames at FPS exactly as in
+// video mode, so -frames, -stride, spans and jitter apply unchanged.
+func processAudioChunks(ctx *clipContext, seg segment) error {
+	opts := ctx.opts
+	rate := opts.audioSampleRate()
+
+	data, err := ctx.extractAudioSamples(seg)
+	if err != nil {
+		return err
+	}
+	const sampleSize = 4
+	totalFrames := opts.segmentAudioFrames(seg, len(data)/sampleSize)
+	chunkSamples := audioSample(opts.TargetFrames, rate, opts.FPS)
+	starts := ctx.chunkStarts(seg, totalFrames)
+	augmentation := ctx.augmentation(seg, totalFrames)
+
+	dropped := make([]bool, len(starts))
+	for k, startFrame := range starts {
+		endFrame := startFrame + opts.TargetFrames
+		silent := ctx.chunkSilent(seg, startFrame, endFrame)
+		if silent && opts.Silence == SilenceDrop {
+			dropped[k] = true
+			continue
+		}
+		chunkIdx := ctx.nextChunk
+		ctx.nextChunk++
+
+		var audio string
+		if opts.Audio != AudioOff {
+			audio = ctx.chunkName(chunkIdx) + "_audio." + string(opts.Audio)
+			if err := ctx.saveChunkAudio(seg, startFrame, endFrame, filepath.Join(ctx.outPath, audio)); err != nil {
+				return err
+			}
+		}
+
+		from := audioSample(startFrame, rate, opts.FPS) * sampleSize
+		samples := data[from : from+chunkSamples*sampleSize]
+
+		metadata := ctx.chunkMetadata(chunkIdx, seg)
+		metadata.Size = nil
+		metadata.Silent = silent
+		metadata.FrameLabels, metadata.Label = ctx.chunkLabels(seg, startFrame, endFrame)
+		metadata.DType = string(numpy.Float32)
+		metadata.SampleRate = rate
+		metadata.Augmentation = augmentation
+		metadata.Audio = audio
+		if err := ctx.saveArrayChunk(ctx.chunkName(chunkIdx), samples, []int{chunkSamples}, numpy.Float32, metadata); err != nil {
+			return err
+		}
+		if err := ctx.saveSidecars(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_sidecar")); err != nil {
+			return err
+		}
+		if err := ctx.saveCaption(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_caption.txt")); err != nil {
+			return err
+		}
+	}
+	ctx.countDiscarded(totalFrames, starts, dropped)
+	return nil
+}
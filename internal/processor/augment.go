@@ -0,0 +1,130 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// Ranges of the random augmentations applied to augmented copies
+const (
+	// augMaxZoom is the largest zoom beyond cover size; crops cover at
+	// least 1/augMaxZoom of each axis
+	augMaxZoom = 1.25
+	// augBrightness is the largest brightness offset, on eq's -1..1 scale
+	augBrightness = 0.1
+	// augContrast and augSaturation are the largest relative changes
+	augContrast   = 0.1
+	augSaturation = 0.1
+)
+
+// ColorJitterTransform adjusts brightness, contrast and saturation (eq)
+type ColorJitterTransform struct {
+	Brightness float64
+	Contrast   float64
+	Saturation float64
+}
+
+func (t ColorJitterTransform) FFmpegArgs() []string {
+	return []string{fmt.Sprintf("eq=brightness=%.3f:contrast=%.3f:saturation=%.3f", t.Brightness, t.Contrast, t.Saturation)}
+}
+
+// augSeed returns the seed of augmented copy i of a segment, derived from
+// the run seed, clip key and segment so each copy is independent but every
+// run produces the same copies
+func (c *clipContext) augSeed(seg segment, i int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%g/aug%d", c.clip.Key, seg.Start, i)
+	return c.opts.Seed ^ int64(h.Sum64())
+}
+
+// augmentedViews returns the randomly augmented copies of a segment: each is
+// a random crop at a random zoom, flipped with probability 1/2 and color
+// jittered. The augmentation is constant across the copy's frames.
+func (c *clipContext) augmentedViews(seg segment) []*cropView {
+	views := make([]*cropView, c.opts.AugCopies)
+	for i := range views {
+		seed := c.augSeed(seg, i)
+		rng := rand.New(rand.NewSource(seed))
+		// Parameters are rounded to the precision passed to ffmpeg, so the
+		// recorded values reproduce the copy exactly
+		params := &types.AugmentedCopy{
+			Seed:  seed,
+			Zoom:  roundTo(1+rng.Float64()*(augMaxZoom-1), 4),
+			CropX: roundTo(rng.Float64(), 4),
+			CropY: roundTo(rng.Float64(), 4),
+			Flip:  rng.Intn(2) == 1,
+		}
+		params.Brightness = roundTo((2*rng.Float64()-1)*augBrightness, 3)
+		params.Contrast = roundTo(1+(2*rng.Float64()-1)*augContrast, 3)
+		params.Saturation = roundTo(1+(2*rng.Float64()-1)*augSaturation, 3)
+		views[i] = augmentedView(fmt.Sprintf("aug%d", i), params, c.dims)
+	}
+	return views
+}
+
+// augmentedView returns the crop view applying an augmented copy's parameters
+func augmentedView(name string, params *types.AugmentedCopy, dims Dimensions) *cropView {
+	return &cropView{
+		Name: name,
+		X:    fmt.Sprintf("(iw-%d)*%.4f", dims.Width, params.CropX),
+		Y:    fmt.Sprintf("(ih-%d)*%.4f", dims.Height, params.CropY),
+		Flip: params.Flip,
+		Zoom: params.Zoom,
+		Jitter: &ColorJitterTransform{
+			Brightness: params.Brightness,
+			Contrast:   params.Contrast,
+			Saturation: params.Saturation,
+		},
+		Augmentation: params,
+	}
+}
+
+// augmentation returns the record of the random choices made for the chunks
+// of a segment with totalFrames frames, or nil if nothing was randomized
+func (c *clipContext) augmentation(seg segment, totalFrames int) *types.Augmentation {
+	var params *types.AugmentedCopy
+	if c.view != nil {
+		params = c.view.Augmentation
+	}
+	var crop *types.RandomCrop
+	if c.opts.Crop == CropRandom {
+		crop = c.randomCrop()
+	}
+	var chunkStart *float64
+	if c.opts.RandomChunks > 0 {
+		chunkStart = &seg.Start
+	}
+	if !c.opts.ChunkJitter && params == nil && crop == nil && chunkStart == nil {
+		return nil
+	}
+	return &types.Augmentation{
+		Seed:        c.opts.Seed,
+		ChunkOffset: c.chunkOffset(seg, totalFrames),
+		ChunkStart:  chunkStart,
+		Copy:        params,
+		RandomCrop:  crop,
+	}
+}
+
+// roundTo rounds v to the given number of decimal places
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
+
+// views returns the views a segment is written in: its augmented copies,
+// its evaluation crops, the plain output and its mirrored copy, or a single
+// nil view for the plain output
+func (c *clipContext) views(seg segment) []*cropView {
+	if c.opts.AugCopies > 0 {
+		return c.augmentedViews(seg)
+	}
+	if c.opts.EmitFlipped {
+		return []*cropView{nil, {Name: "flip", Flip: true, Fit: true}}
+	}
+	return multiCropViews(c.opts.MultiCrop, c.dims.Width, c.dims.Height)
+}
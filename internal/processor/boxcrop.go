@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// defaultBoxSmoothing is the number of consecutive boxes whose centers are
+// averaged to smooth the crop window's motion
+const defaultBoxSmoothing = 5
+
+// boxKeyframe is the smoothed center of the crop window at time T
+type boxKeyframe struct {
+	T, X, Y float64
+}
+
+// boxCrop is a fixed-size crop window that follows the smoothed center of a
+// clip's bounding boxes, interpolating linearly between annotations
+type boxCrop struct {
+	Width     int
+	Height    int
+	Keyframes []boxKeyframe
+}
+
+// planBoxCrop sizes the crop window to fit the largest box at the output
+// aspect ratio, clamped to the source size, and smooths the box centers with
+// a moving average over window boxes
+func planBoxCrop(boxes []types.Box, window int, srcWidth, srcHeight int, aspect float64) *boxCrop {
+	if len(boxes) == 0 {
+		return nil
+	}
+
+	var w, h float64
+	for _, box := range boxes {
+		w = math.Max(w, box.W)
+		h = math.Max(h, box.H)
+	}
+	if w/h < aspect {
+		w = h * aspect
+	} else {
+		h = w / aspect
+	}
+	if w > float64(srcWidth) {
+		w, h = float64(srcWidth), float64(srcWidth)/aspect
+	}
+	if h > float64(srcHeight) {
+		w, h = float64(srcHeight)*aspect, float64(srcHeight)
+	}
+
+	half := max(window, 1) / 2
+	keyframes := make([]boxKeyframe, len(boxes))
+	for i := range boxes {
+		lo, hi := max(i-half, 0), min(i+half, len(boxes)-1)
+		var cx, cy float64
+		for _, box := range boxes[lo : hi+1] {
+			cx += box.X + box.W/2
+			cy += box.Y + box.H/2
+		}
+		n := float64(hi - lo + 1)
+		keyframes[i] = boxKeyframe{T: boxes[i].T, X: cx / n, Y: cy / n}
+	}
+
+	// Even dimensions keep the crop compatible with yuv420p chroma subsampling
+	return &boxCrop{Width: int(w) &^ 1, Height: int(h) &^ 1, Keyframes: keyframes}
+}
+
+// transform returns the crop for a segment whose input starts offset seconds
+// into the clip
+func (b *boxCrop) transform(offset float64) BoxCropTransform {
+	times := make([]float64, len(b.Keyframes))
+	xs := make([]float64, len(b.Keyframes))
+	ys := make([]float64, len(b.Keyframes))
+	for i, k := range b.Keyframes {
+		times[i], xs[i], ys[i] = k.T-offset, k.X, k.Y
+	}
+	return BoxCropTransform{
+		Width:  b.Width,
+		Height: b.Height,
+		X:      fmt.Sprintf(`clip(%s-%d\,0\,iw-%d)`, interpolateExpr(times, xs), b.Width/2, b.Width),
+		Y:      fmt.Sprintf(`clip(%s-%d\,0\,ih-%d)`, interpolateExpr(times, ys), b.Height/2, b.Height),
+	}
+}
+
+// interpolateExpr returns an ffmpeg expression of the frame time t that
+// interpolates linearly between (times[i], values[i]) and holds the first and
+// last values outside them, or is a constant if all values are equal. Commas are escaped for use in a filter option.
+func interpolateExpr(times, values []float64) string {
+	n := len(values)
+	expr := fmt.Sprintf("%.2f", values[n-1])
+	if slices.Min(values) == slices.Max(values) {
+		return expr
+	}
+	t := fmt.Sprintf(`clip(t\,%.3f\,%.3f)`, times[0], times[n-1])
+	for i := n - 2; i >= 0; i-- {
+		dt := times[i+1] - times[i]
+		if dt <= 0 {
+			continue
+		}
+		segment := fmt.Sprintf("%.2f+%.4f*(%s%+.3f)", values[i], (values[i+1]-values[i])/dt, t, 0-times[i])
+		expr = fmt.Sprintf(`if(lt(%s\,%.3f)\,%s\,%s)`, t, times[i+1], segment, expr)
+	}
+	return expr
+}
+
+// BoxCropTransform crops a fixed-size window whose offset is given by ffmpeg
+// expressions, evaluated per frame
+type BoxCropTransform struct {
+	Width  int
+	Height int
+	X, Y   string
+}
+
+func (t BoxCropTransform) FFmpegArgs() []string {
+	return []string{fmt.Sprintf("crop=w=%d:h=%d:x=%s:y=%s", t.Width, t.Height, t.X, t.Y)}
+}
@@ -0,0 +1,56 @@
+package processor
+
+import "strings"
+
+// ColorMatrix selects the YUV matrix used to convert the source to the
+// output pixel format
+type ColorMatrix string
+
+const (
+	// ColorMatrixAuto uses the matrix tagged in the source, which ffmpeg
+	// assumes to be BT.601 when the source is untagged
+	ColorMatrixAuto ColorMatrix = ""
+	// ColorMatrixBT601 forces the standard-definition BT.601 matrix
+	ColorMatrixBT601 ColorMatrix = "bt601"
+	// ColorMatrixBT709 forces the high-definition BT.709 matrix
+	ColorMatrixBT709 ColorMatrix = "bt709"
+)
+
+// ColorRange selects the range of the source's YUV samples
+type ColorRange string
+
+const (
+	// ColorRangeAuto uses the range tagged in the source, assuming limited
+	// range when the source is untagged
+	ColorRangeAuto ColorRange = ""
+	// ColorRangeLimited forces limited (TV, 16-235) range
+	ColorRangeLimited ColorRange = "limited"
+	// ColorRangeFull forces full (PC, 0-255) range
+	ColorRangeFull ColorRange = "full"
+)
+
+// ColorConvertTransform converts frames to the output pixel format with
+// the given source matrix and range instead of the ones tagged in the
+// source. It must be the last filter of the chain so ffmpeg performs the
+// conversion in it.
+type ColorConvertTransform struct {
+	Matrix ColorMatrix
+	Range  ColorRange
+}
+
+func (t ColorConvertTransform) FFmpegArgs() []string {
+	var params []string
+	if t.Matrix != ColorMatrixAuto {
+		params = append(params, "in_color_matrix="+string(t.Matrix))
+	}
+	switch t.Range {
+	case ColorRangeLimited:
+		params = append(params, "in_range=tv")
+	case ColorRangeFull:
+		params = append(params, "in_range=pc")
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return []string{"scale=" + strings.Join(params, ":")}
+}
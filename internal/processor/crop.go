@@ -0,0 +1,84 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// CropMode selects how frames are fitted to the output size
+type CropMode string
+
+const (
+	// CropOff scales the full frame to the output size, distorting it if
+	// the aspect ratios differ
+	CropOff CropMode = ""
+	// CropCenter resizes the shorter side to fit the output size, keeping
+	// the aspect ratio, and crops the center
+	CropCenter CropMode = "center"
+	// CropRandom resizes like CropCenter but crops at a random offset,
+	// drawn from the seed and clip key so reruns crop identically
+	CropRandom CropMode = "random"
+)
+
+// CenterCropTransform scales the source to cover Width x Height, keeping its
+// aspect ratio, and crops the centered Width x Height region
+type CenterCropTransform struct {
+	Width  int
+	Height int
+}
+
+func (t CenterCropTransform) FFmpegArgs() []string {
+	return []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", t.Width, t.Height),
+		fmt.Sprintf("crop=%d:%d", t.Width, t.Height),
+	}
+}
+
+// RandomCropTransform scales the source to cover Width x Height, keeping its
+// aspect ratio, and crops a Width x Height region placed at X and Y, as
+// fractions of the slack left after scaling (0 = left/top, 1 = right/bottom)
+type RandomCropTransform struct {
+	Width  int
+	Height int
+	X, Y   float64
+}
+
+func (t RandomCropTransform) FFmpegArgs() []string {
+	return []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", t.Width, t.Height),
+		fmt.Sprintf("crop=%d:%d:(iw-%d)*%.4f:(ih-%d)*%.4f", t.Width, t.Height, t.Width, t.X, t.Height, t.Y),
+	}
+}
+
+// randomCrop returns the offsets of the clip's random crop, derived from
+// the run seed and clip key only, so every chunk of a clip is cropped alike
+// and every run crops the clip the same way
+func (c *clipContext) randomCrop() *types.RandomCrop {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/crop", c.clip.Key)
+	seed := c.opts.Seed ^ int64(h.Sum64())
+	rng := rand.New(rand.NewSource(seed))
+	// Offsets are rounded to the precision passed to ffmpeg, so the
+	// recorded values reproduce the crop exactly
+	return &types.RandomCrop{
+		Seed:  seed,
+		CropX: roundTo(rng.Float64(), 4),
+		CropY: roundTo(rng.Float64(), 4),
+	}
+}
+
+// fitTransform returns the transform fitting frames to the output size
+// according to the crop mode
+func (c *clipContext) fitTransform() Transform {
+	switch c.opts.Crop {
+	case CropCenter:
+		return CenterCropTransform(c.dims)
+	case CropRandom:
+		crop := c.randomCrop()
+		return RandomCropTransform{Width: c.dims.Width, Height: c.dims.Height, X: crop.CropX, Y: crop.CropY}
+	}
+	return c.dims.ScaleTransform()
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+const (
+	// cropSampleFrames is the number of frames sampled across a clip for crop detection
+	cropSampleFrames = 50
+	// defaultCropDetectLimit is the default cropdetect black threshold (0-255)
+	defaultCropDetectLimit = 24
+)
+
+// cropPattern matches the crop suggestion printed by ffmpeg's cropdetect filter
+var cropPattern = regexp.MustCompile(`crop=(-?\d+):(-?\d+):(-?\d+):(-?\d+)`)
+
+// detectCrop runs cropdetect over a sample of frames spread across the clip and
+// returns the region that excludes letterbox/pillarbox bars, or nil if the
+// frame has no bars to remove. Only the video stream with index stream
+// among the video streams is examined.
+func detectCrop(videoPath string, stream, limit int, debugLog io.Writer) (*types.CropRegion, error) {
+	info, err := probeVideoStream(videoPath, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sample frames evenly across the clip; cropdetect with reset=0 accumulates
+	// the bounding box of non-black content over all sampled frames
+	vf := fmt.Sprintf("cropdetect=limit=%d:round=2:reset=0", limit)
+	if info.Duration > 0 {
+		vf = fmt.Sprintf("fps=%f,%s", cropSampleFrames/info.Duration, vf)
+	}
+
+	// Detect in the stored frames, which are cropped before any rotation
+	stderr, err := runFFmpeg(ffmpeg.Input(videoPath, ffmpeg.KwArgs{"noautorotate": ""}).
+		Get(videoSelector(stream)).
+		Output("-", ffmpeg.KwArgs{
+			"vf":       vf,
+			"frames:v": cropSampleFrames,
+			"f":        "null",
+		}), debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting crop: %w", err)
+	}
+
+	return parseCropDetect(stderr, info.Width, info.Height), nil
+}
+
+// parseCropDetect returns the last crop suggested in cropdetect's log output,
+// or nil if no crop was suggested or it would not remove anything
+func parseCropDetect(log string, width, height int) *types.CropRegion {
+	matches := cropPattern.FindAllStringSubmatch(log, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	last := matches[len(matches)-1]
+	var values [4]int
+	for i := range values {
+		values[i], _ = strconv.Atoi(last[i+1])
+	}
+	crop := &types.CropRegion{Width: values[0], Height: values[1], X: values[2], Y: values[3]}
+
+	// An all-black clip yields a negative size; a crop covering the full frame is a no-op
+	if crop.Width <= 0 || crop.Height <= 0 || crop.X < 0 || crop.Y < 0 {
+		return nil
+	}
+	if crop.Width >= width && crop.Height >= height {
+		return nil
+	}
+	return crop
+}
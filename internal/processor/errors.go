@@ -0,0 +1,59 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for an output format, or a format and
+	// bit depth combination, that the processor cannot write
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrCorruptInput is returned when ffmpeg or ffprobe cannot decode a clip
+	ErrCorruptInput = errors.New("corrupt input")
+	// ErrTooShort is returned for a clip shorter than the minimum length
+	ErrTooShort = errors.New("clip too short")
+	// ErrFFmpegNotFound is returned when the ffmpeg or ffprobe binary is not on PATH
+	ErrFFmpegNotFound = errors.New("ffmpeg not found")
+)
+
+// ClipError records the failure to process a single clip
+type ClipError struct {
+	Key string
+	Err error
+}
+
+func (e *ClipError) Error() string {
+	return fmt.Sprintf("error processing %s: %v", e.Key, e.Err)
+}
+
+func (e *ClipError) Unwrap() error {
+	return e.Err
+}
+
+// corruptInputMessages are ffmpeg log messages that indicate an undecodable input
+var corruptInputMessages = []string{
+	"Invalid data found when processing input",
+	"moov atom not found",
+	"could not find codec parameters",
+	"Error while decoding stream",
+}
+
+// classifyFFmpegError wraps the error of a failed ffmpeg invocation with the
+// matching sentinel, based on the exec error and ffmpeg's stderr
+func classifyFFmpegError(err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%w: %v", ErrFFmpegNotFound, err)
+	}
+	for _, msg := range corruptInputMessages {
+		if strings.Contains(stderr, msg) {
+			return fmt.Errorf("%w: %v", ErrCorruptInput, err)
+		}
+	}
+	return err
+}
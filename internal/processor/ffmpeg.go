@@ -0,0 +1,39 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// stderrTailLines is the number of trailing stderr lines included in the
+// error of a failed ffmpeg invocation in debug mode
+const stderrTailLines = 20
+
+// runFFmpeg runs an ffmpeg command and returns its stderr. If debugLog is
+// non-nil the command line and its stderr are appended to it, and the error
+// of a failed command includes the tail of its stderr. Errors are classified
+// as ErrFFmpegNotFound or ErrCorruptInput where possible.
+func runFFmpeg(stream *ffmpeg.Stream, debugLog io.Writer) (string, error) {
+	var stderr bytes.Buffer
+	err := classifyFFmpegError(stream.WithErrorOutput(&stderr).Run(), stderr.String())
+	if debugLog != nil {
+		fmt.Fprintf(debugLog, "$ ffmpeg %s\n%s\n", strings.Join(stream.GetArgs(), " "), stderr.String())
+		if err != nil {
+			err = fmt.Errorf("%w\n%s", err, stderrTail(stderr.String(), stderrTailLines))
+		}
+	}
+	return stderr.String(), err
+}
+
+// stderrTail returns the last n non-empty lines of an ffmpeg log
+func stderrTail(log string, n int) string {
+	lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// keyframeOutput is the subset of ffprobe's JSON frame listing that we read
+type keyframeOutput struct {
+	Frames []struct {
+		PTSTime string `json:"pts_time"`
+	} `json:"frames"`
+}
+
+// probeKeyframes returns the times in seconds of the keyframes of a video
+// stream, by its index among the video streams, relative to its first frame
+func probeKeyframes(videoPath string, stream int) ([]float64, error) {
+	out, err := ffmpeg.ProbeWithTimeoutExec(videoPath, 0, ffmpeg.KwArgs{
+		"select_streams": videoSelector(stream),
+		"skip_frame":     "nokey",
+		"show_entries":   "frame=pts_time",
+		"of":             "json",
+	})
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("error probing keyframes: %w: %v", ErrFFmpegNotFound, err)
+		}
+		return nil, fmt.Errorf("error probing keyframes: %w: %v", ErrCorruptInput, err)
+	}
+	return parseKeyframes([]byte(out))
+}
+
+// parseKeyframes extracts keyframe times from ffprobe's JSON frame listing
+func parseKeyframes(data []byte) ([]float64, error) {
+	var probe keyframeOutput
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error parsing keyframes: %w", err)
+	}
+
+	var times []float64
+	for _, frame := range probe.Frames {
+		t, err := strconv.ParseFloat(frame.PTSTime, 64)
+		if err != nil {
+			// Frames without a timestamp can't be seeked to
+			continue
+		}
+		times = append(times, t)
+	}
+	for i := len(times) - 1; i >= 0; i-- {
+		times[i] -= times[0]
+	}
+	return times, nil
+}
+
+// keyframeAlignedStarts returns the start frames of consecutive chunks of
+// target frames within a segment of totalFrames frames at fps, where each
+// chunk starts at the first frame at or after a keyframe and no chunks
+// overlap. Keyframe times are relative to the start of the source.
+func keyframeAlignedStarts(keyframes []float64, seg segment, fps, target, totalFrames int) []int {
+	var starts []int
+	next := 0
+	for _, t := range keyframes {
+		// Allow for timestamp rounding so a keyframe on a frame boundary maps to that frame
+		frame := int(math.Ceil((t-seg.Start)*float64(fps) - 1e-3))
+		if frame < next {
+			continue
+		}
+		if frame+target > totalFrames {
+			break
+		}
+		starts = append(starts, frame)
+		next = frame + target
+	}
+	return starts
+}
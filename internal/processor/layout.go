@@ -0,0 +1,64 @@
+package processor
+
+import "github.com/melody-ding/go-vidprep/internal/numpy"
+
+// Layout is the axis order of NPY chunks
+type Layout string
+
+const (
+	// LayoutTHWC is channels-last, (frames, height, width, channels)
+	LayoutTHWC Layout = "thwc"
+	// LayoutTCHW is channels-first, (frames, channels, height, width), as
+	// PyTorch video models expect
+	LayoutTCHW Layout = "tchw"
+)
+
+// layout returns the configured axis order of NPY chunks, defaulting to
+// channels-last
+func (o Options) layout() Layout {
+	if o.Layout == "" {
+		return LayoutTHWC
+	}
+	return o.Layout
+}
+
+// frameShape returns the NPY shape of one output frame in the configured
+// pixel format and layout
+func (o Options) frameShape(dims Dimensions) []int {
+	shape := o.pixelFormat().frameShape(dims)
+	if o.layout() == LayoutTCHW && len(shape) == 3 {
+		return []int{shape[2], shape[0], shape[1]}
+	}
+	return shape
+}
+
+// itemSize returns the size in bytes of one NPY sample of dtype
+func itemSize(dtype numpy.DType) int {
+	return numpy.Header{DType: dtype}.ItemSize()
+}
+
+// channelsFirst reorders frames of interleaved pixels, each of channels
+// samples of size bytes, into one plane per channel
+func channelsFirst(data []byte, pixels, channels, size int) []byte {
+	out := make([]byte, len(data))
+	frameSize := pixels * channels * size
+	for f := 0; f+frameSize <= len(data); f += frameSize {
+		for p := 0; p < pixels; p++ {
+			for c := 0; c < channels; c++ {
+				src := f + (p*channels+c)*size
+				dst := f + (c*pixels+p)*size
+				copy(out[dst:dst+size], data[src:src+size])
+			}
+		}
+	}
+	return out
+}
+
+// applyLayout reorders encoded chunk samples from ffmpeg's interleaved
+// order into the configured layout
+func (o Options) applyLayout(data []byte, dims Dimensions) []byte {
+	if o.layout() != LayoutTCHW {
+		return data
+	}
+	return channelsFirst(data, dims.Width*dims.Height, o.pixelFormat().channels(), itemSize(o.numpyDType()))
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// memorySampleInterval is how often the process RSS is checked
+	memorySampleInterval = 500 * time.Millisecond
+	// memoryLowWater is the fraction of the limit below which paused
+	// workers are resumed one at a time
+	memoryLowWater = 0.8
+)
+
+// memoryGovernor limits how many workers process clips concurrently so that
+// the process RSS stays under a ceiling. Workers over the current allowance
+// finish their clip and then wait before picking up another job. A nil
+// governor imposes no limit.
+type memoryGovernor struct {
+	limit uint64
+	max   int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	allowed int
+	running int
+}
+
+// newMemoryGovernor returns a governor for up to max workers, or nil if limit is zero
+func newMemoryGovernor(limit uint64, max int) *memoryGovernor {
+	if limit == 0 {
+		return nil
+	}
+	g := &memoryGovernor{limit: limit, max: max, allowed: max}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// acquire blocks until the worker may start processing another clip
+func (g *memoryGovernor) acquire() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for g.running >= g.allowed {
+		g.cond.Wait()
+	}
+	g.running++
+}
+
+// release marks a worker as done with its clip
+func (g *memoryGovernor) release() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running--
+	g.cond.Broadcast()
+}
+
+// adjust shrinks the allowance by one worker while rss is over the limit and
+// grows it by one once rss falls below the low-water mark. At least one
+// worker is always allowed so processing keeps making progress.
+func (g *memoryGovernor) adjust(rss uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case rss > g.limit && g.allowed > 1:
+		g.allowed--
+	case float64(rss) < float64(g.limit)*memoryLowWater && g.allowed < g.max:
+		g.allowed++
+		g.cond.Broadcast()
+	}
+}
+
+// monitor samples the process RSS and adjusts the allowance until done is closed
+func (g *memoryGovernor) monitor(done <-chan struct{}) {
+	if g == nil {
+		return
+	}
+	ticker := time.NewTicker(memorySampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			rss := processRSS()
+			if rss > g.limit {
+				// Return freed clip buffers to the OS so RSS can drop
+				debug.FreeOSMemory()
+			}
+			g.adjust(rss)
+		}
+	}
+}
+
+// processRSS returns the resident set size of the process in bytes. It reads
+// /proc/self/statm where available and falls back to the memory obtained by
+// the Go runtime.
+func processRSS() uint64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) >= 2 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys
+}
@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// defaultStaticThreshold is the mean absolute difference from the previous
+// frame, on a 0-1 scale, below which a frame counts as static. It is above
+// the noise JPEG compression adds to an unchanged scene.
+const defaultStaticThreshold = 0.01
+
+// staticThreshold returns the configured static frame threshold, defaulting
+// to 0.01
+func (o Options) staticThreshold() float64 {
+	if o.StaticThreshold > 0 {
+		return o.StaticThreshold
+	}
+	return defaultStaticThreshold
+}
+
+// chunkMotion measures the motion between consecutive frames of frameSize
+// bytes, whose samples are sampleSize bytes (1, or 2 little-endian). It
+// returns nil for fewer than two frames.
+func chunkMotion(data []byte, frameSize, sampleSize int, threshold float64) *types.Motion {
+	numFrames := len(data) / frameSize
+	if numFrames < 2 {
+		return nil
+	}
+	maxValue := float64(255)
+	if sampleSize == 2 {
+		maxValue = 65535
+	}
+	sample := func(i int) float64 {
+		if sampleSize == 2 {
+			return float64(binary.LittleEndian.Uint16(data[i:]))
+		}
+		return float64(data[i])
+	}
+
+	var total float64
+	static := 0
+	for f := 1; f < numFrames; f++ {
+		prev, cur := (f-1)*frameSize, f*frameSize
+		var sum float64
+		for i := 0; i < frameSize; i += sampleSize {
+			sum += math.Abs(sample(cur+i) - sample(prev+i))
+		}
+		diff := sum / float64(frameSize/sampleSize) / maxValue
+		total += diff
+		if diff < threshold {
+			static++
+		}
+	}
+	pairs := float64(numFrames - 1)
+	return &types.Motion{
+		MeanAbsDiff:   roundTo(total/pairs, 4),
+		StaticPercent: roundTo(100*float64(static)/pairs, 2),
+	}
+}
+
+// imageMotion measures the motion between consecutive image frames, read
+// from paths in order, on their RGB samples
+func imageMotion(paths []string, threshold float64) (*types.Motion, error) {
+	var data []byte
+	frameSize := 0
+	for _, path := range paths {
+		frame, err := decodeRGB48(path)
+		if err != nil {
+			return nil, fmt.Errorf("error measuring motion: %w", err)
+		}
+		if frameSize == 0 {
+			frameSize = len(frame)
+		} else if len(frame) != frameSize {
+			return nil, fmt.Errorf("error measuring motion: frame %s has a different size", path)
+		}
+		data = append(data, frame...)
+	}
+	if frameSize == 0 {
+		return nil, nil
+	}
+	return chunkMotion(data, frameSize, 2, threshold), nil
+}
+
+// decodeRGB48 decodes an image file into interleaved 16-bit little-endian
+// RGB samples
+func decodeRGB48(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+
+	bounds := img.Bounds()
+	data := make([]byte, 0, bounds.Dx()*bounds.Dy()*6)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			data = binary.LittleEndian.AppendUint16(data, uint16(r))
+			data = binary.LittleEndian.AppendUint16(data, uint16(g))
+			data = binary.LittleEndian.AppendUint16(data, uint16(b))
+		}
+	}
+	return data, nil
+}
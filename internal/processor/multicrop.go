@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// MultiCropMode selects the evaluation crops emitted per chunk
+type MultiCropMode string
+
+const (
+	// MultiCropOff emits a single view scaled to the output size
+	MultiCropOff MultiCropMode = ""
+	// MultiCropThree emits three crops spread along the longer axis
+	// (left/center/right for landscape sources)
+	MultiCropThree MultiCropMode = "three"
+	// MultiCropTen emits the four corner crops and the center crop, plus
+	// horizontally flipped copies of each
+	MultiCropTen MultiCropMode = "ten"
+)
+
+// cropView is one of the evaluation crops or augmented copies taken from a
+// chunk. The source is scaled to cover the output size, then cropped at (X, Y).
+type cropView struct {
+	Name string
+	// X and Y are ffmpeg crop expressions for the crop offset
+	X, Y string
+	Flip bool
+	// Zoom scales the source beyond the output size before cropping, so
+	// the crop covers a smaller region; 0 or 1 crops at cover size
+	Zoom float64
+	// Jitter is the color jitter applied after cropping, if any
+	Jitter *ColorJitterTransform
+	// Augmentation holds the random parameters of an augmented copy
+	Augmentation *types.AugmentedCopy
+	// Fit fits frames to the output size like the plain output, ignoring
+	// X, Y and Zoom, and only applies Flip
+	Fit bool
+}
+
+// multiCropViews returns the crop views of the mode for an output of w x h,
+// or a single nil view when multi-crop is off
+func multiCropViews(mode MultiCropMode, w, h int) []*cropView {
+	centerX, centerY := fmt.Sprintf("(iw-%d)/2", w), fmt.Sprintf("(ih-%d)/2", h)
+	endX, endY := fmt.Sprintf("iw-%d", w), fmt.Sprintf("ih-%d", h)
+
+	switch mode {
+	case MultiCropThree:
+		// Only the axis with slack after cover-scaling moves
+		return []*cropView{
+			{Name: "start", X: "0", Y: "0"},
+			{Name: "center", X: centerX, Y: centerY},
+			{Name: "end", X: endX, Y: endY},
+		}
+	case MultiCropTen:
+		corners := []*cropView{
+			{Name: "center", X: centerX, Y: centerY},
+			{Name: "top_left", X: "0", Y: "0"},
+			{Name: "top_right", X: endX, Y: "0"},
+			{Name: "bottom_left", X: "0", Y: endY},
+			{Name: "bottom_right", X: endX, Y: endY},
+		}
+		views := corners
+		for _, v := range corners {
+			views = append(views, &cropView{Name: v.Name + "_flip", X: v.X, Y: v.Y, Flip: true})
+		}
+		return views
+	default:
+		return []*cropView{nil}
+	}
+}
+
+// MultiCropTransform scales the source to cover Width x Height times Zoom,
+// keeping its aspect ratio, and crops a Width x Height region at (X, Y),
+// optionally flipping it horizontally
+type MultiCropTransform struct {
+	Width  int
+	Height int
+	X, Y   string
+	Flip   bool
+	Zoom   float64
+}
+
+func (t MultiCropTransform) FFmpegArgs() []string {
+	scaleW, scaleH := t.Width, t.Height
+	if t.Zoom > 1 {
+		// Keep the scaled size even for yuv420p chroma subsampling
+		scaleW = int(math.Ceil(float64(t.Width)*t.Zoom/2)) * 2
+		scaleH = int(math.Ceil(float64(t.Height)*t.Zoom/2)) * 2
+	}
+	args := []string{
+		fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", scaleW, scaleH),
+		fmt.Sprintf("crop=%d:%d:%s:%s", t.Width, t.Height, t.X, t.Y),
+	}
+	if t.Flip {
+		args = append(args, "hflip")
+	}
+	return args
+}
@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// DType is the sample type of NPY chunks
+type DType string
+
+const (
+	// DTypeAuto writes unsigned integers of the output bit depth, or
+	// float32 when normalizing
+	DTypeAuto    DType = ""
+	DTypeFloat32 DType = "float32"
+)
+
+// floatOutput reports whether NPY chunks are written as float32
+func (o Options) floatOutput() bool {
+	return o.Normalize != nil || o.DType == DTypeFloat32
+}
+
+// validateNormalization checks that a normalization has a mean and a positive
+// std for each RGB channel
+func validateNormalization(norm *types.Normalization) error {
+	if len(norm.Mean) != 3 || len(norm.Std) != 3 {
+		return fmt.Errorf("normalization needs 3 mean and 3 std values, got %d and %d", len(norm.Mean), len(norm.Std))
+	}
+	for _, std := range norm.Std {
+		if std <= 0 {
+			return fmt.Errorf("normalization std must be positive, got %v", norm.Std)
+		}
+	}
+	return nil
+}
+
+// sampleNormalization returns the normalization in the channel order of the
+// output pixel format. Mean and std are given per RGB channel, so they are
+// reversed for BGR samples.
+func (o Options) sampleNormalization() *types.Normalization {
+	norm := o.Normalize
+	if norm == nil || o.pixelFormat() != PixFmtBGR24 {
+		return norm
+	}
+	return &types.Normalization{
+		Mean: []float64{norm.Mean[2], norm.Mean[1], norm.Mean[0]},
+		Std:  []float64{norm.Std[2], norm.Std[1], norm.Std[0]},
+	}
+}
+
+// normalizeFrames converts interleaved 3-channel samples of the given bit
+// depth to little-endian float32 values (value/max - mean) / std per channel,
+// with mean and std in the samples' channel order. With a
+// nil normalization samples of any pixel format are only scaled to 0-1.
+func normalizeFrames(data []byte, bitDepth int, norm *types.Normalization) []byte {
+	bytesPerSample := bitDepth / 8
+	maxValue := float64(math.MaxUint8)
+	if bytesPerSample == 2 {
+		maxValue = math.MaxUint16
+	}
+
+	numSamples := len(data) / bytesPerSample
+	out := make([]byte, numSamples*4)
+	for i := 0; i < numSamples; i++ {
+		var v float64
+		if bytesPerSample == 2 {
+			v = float64(binary.LittleEndian.Uint16(data[i*2:]))
+		} else {
+			v = float64(data[i])
+		}
+		normalized := v / maxValue
+		if norm != nil {
+			c := i % 3
+			normalized = (normalized - norm.Mean[c]) / norm.Std[c]
+		}
+		binary.LittleEndian.PutUint32(out[i*4:], math.Float32bits(float32(normalized)))
+	}
+	return out
+}
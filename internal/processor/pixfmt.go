@@ -0,0 +1,78 @@
+package processor
+
+// PixelFormat is the sample layout of raw frames written to NPY chunks
+type PixelFormat string
+
+const (
+	// PixFmtRGB24 is interleaved 8-bit RGB, shape (frames, height, width, 3)
+	PixFmtRGB24 PixelFormat = "rgb24"
+	// PixFmtBGR24 is interleaved 8-bit BGR, as OpenCV expects
+	PixFmtBGR24 PixelFormat = "bgr24"
+	// PixFmtGray is 8-bit luma, shape (frames, height, width, 1)
+	PixFmtGray PixelFormat = "gray"
+	// PixFmtYUV420P is planar YUV with quarter-size chroma planes (I420),
+	// shape (frames, height*3/2, width): the Y plane followed by U and V
+	PixFmtYUV420P PixelFormat = "yuv420p"
+	// PixFmtRGB48 is interleaved 16-bit little-endian RGB; it implies a
+	// bit depth of 16
+	PixFmtRGB48 PixelFormat = "rgb48"
+)
+
+// pixelFormat returns the configured pixel format of NPY chunks, defaulting
+// to RGB of the output bit depth
+func (o Options) pixelFormat() PixelFormat {
+	switch {
+	case o.PixelFormat != "":
+		return o.PixelFormat
+	case o.BitDepth == 16:
+		return PixFmtRGB48
+	default:
+		return PixFmtRGB24
+	}
+}
+
+// ffmpegName returns the name of the pixel format passed to ffmpeg
+func (p PixelFormat) ffmpegName() string {
+	if p == PixFmtRGB48 {
+		return "rgb48le"
+	}
+	return string(p)
+}
+
+// bytesPerSample returns the size of one sample of the pixel format
+func (p PixelFormat) bytesPerSample() int {
+	if p == PixFmtRGB48 {
+		return 2
+	}
+	return 1
+}
+
+// channels returns the number of interleaved channels of the pixel format,
+// or 0 for the planar yuv420p
+func (p PixelFormat) channels() int {
+	switch p {
+	case PixFmtGray:
+		return 1
+	case PixFmtYUV420P:
+		return 0
+	default:
+		return 3
+	}
+}
+
+// frameShape returns the NPY shape of one frame of the given size
+func (p PixelFormat) frameShape(dims Dimensions) []int {
+	if p == PixFmtYUV420P {
+		return []int{dims.Height * 3 / 2, dims.Width}
+	}
+	return []int{dims.Height, dims.Width, p.channels()}
+}
+
+// frameSize returns the size in bytes of one frame of the given size
+func (p PixelFormat) frameSize(dims Dimensions) int {
+	size := p.bytesPerSample()
+	for _, n := range p.frameShape(dims) {
+		size *= n
+	}
+	return size
+}
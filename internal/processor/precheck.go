@@ -0,0 +1,82 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// precheckTailSeconds is the length of the end of a clip decoded by the
+// precheck to catch truncated files whose header is intact
+const precheckTailSeconds = 1
+
+// precheckInput runs cheap checks on a clip's video before processing: it
+// must be non-empty, ffprobe must find a video stream with a size and
+// duration, and its last second must decode cleanly. Clips failing a check
+// return an error wrapping ErrCorruptInput that describes why.
+func precheckInput(videoPath string, size int) error {
+	if size == 0 {
+		return fmt.Errorf("%w: empty file", ErrCorruptInput)
+	}
+	info, err := probeVideo(videoPath)
+	if err != nil {
+		return err
+	}
+	if info.Width <= 0 || info.Height <= 0 {
+		return fmt.Errorf("%w: video stream has no frame size", ErrCorruptInput)
+	}
+	if info.Duration <= 0 {
+		return fmt.Errorf("%w: unknown duration", ErrCorruptInput)
+	}
+
+	// Decoding only the tail is enough to find files cut short after an
+	// intact header, without paying for a full decode
+	stderr, err := runFFmpeg(ffmpeg.Input(videoPath, ffmpeg.KwArgs{"sseof": -precheckTailSeconds}).
+		Output("-", ffmpeg.KwArgs{"map": "0:v:0", "f": "null"}).
+		GlobalArgs("-v", "error", "-xerror"), nil)
+	if errors.Is(err, ErrFFmpegNotFound) {
+		return err
+	}
+	if err != nil || strings.TrimSpace(stderr) != "" {
+		return fmt.Errorf("%w: truncated or undecodable: %s", ErrCorruptInput, firstLine(stderr, err))
+	}
+	return nil
+}
+
+// firstLine returns the first line of an ffmpeg error log, or the error if
+// the log is empty
+func firstLine(log string, err error) string {
+	if line, _, _ := strings.Cut(strings.TrimSpace(log), "\n"); line != "" {
+		return line
+	}
+	return err.Error()
+}
+
+// checkLength returns an error wrapping ErrTooShort if the clip's video is
+// shorter than opts.MinDuration seconds or yields fewer than opts.MinFrames
+// frames at opts.FPS
+func checkLength(videoPath string, opts Options) error {
+	info, err := probeVideo(videoPath)
+	if err != nil {
+		return err
+	}
+	return opts.checkDuration(info.Duration)
+}
+
+// checkDuration checks a clip duration in seconds against the minimum
+// length. Clips of unknown duration pass, as their length cannot be told
+// without decoding them.
+func (o Options) checkDuration(duration float64) error {
+	if duration <= 0 {
+		return nil
+	}
+	if duration < o.MinDuration {
+		return fmt.Errorf("%w: %.2fs is below the minimum of %gs", ErrTooShort, duration, o.MinDuration)
+	}
+	if frames := int(duration * float64(o.FPS)); frames < o.MinFrames {
+		return fmt.Errorf("%w: %d frames at %d fps is below the minimum of %d", ErrTooShort, frames, o.FPS, o.MinFrames)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// PreviewFormat is the format of the animated preview written next to
+// each chunk
+type PreviewFormat string
+
+const (
+	PreviewOff  PreviewFormat = ""
+	PreviewGIF  PreviewFormat = "gif"
+	PreviewWebP PreviewFormat = "webp"
+)
+
+// defaultPreviewWidth is the width in pixels of chunk previews
+const defaultPreviewWidth = 160
+
+// previewWidth returns the configured preview width, defaulting to 160
+func (o Options) previewWidth() int {
+	if o.PreviewWidth > 0 {
+		return o.PreviewWidth
+	}
+	return defaultPreviewWidth
+}
+
+// previewFilter returns the filtergraph downscaling chunk frames to a
+// preview. GIFs are limited to 256 colors, so they use a palette generated
+// from the chunk itself rather than ffmpeg's fixed one.
+func (o Options) previewFilter() string {
+	scale := fmt.Sprintf("scale=%d:-2:flags=lanczos", o.previewWidth())
+	if o.Preview == PreviewGIF {
+		return scale + ",split[a][b];[a]palettegen[p];[b][p]paletteuse"
+	}
+	return scale
+}
+
+// previewArgs returns the output arguments of a looping chunk preview
+func (o Options) previewArgs() ffmpeg.KwArgs {
+	return ffmpeg.KwArgs{"vf": o.previewFilter(), "loop": 0, "an": ""}
+}
+
+// saveRawPreview writes an animated preview of raw frames in the output
+// pixel format, i.e. an NPY chunk before normalization
+func (c *clipContext) saveRawPreview(frames []byte, outputPath string) error {
+	_, err := runFFmpeg(ffmpeg.Input("pipe:", ffmpeg.KwArgs{
+		"f":         "rawvideo",
+		"pix_fmt":   c.opts.pixelFormat().ffmpegName(),
+		"s":         fmt.Sprintf("%dx%d", c.dims.Width, c.dims.Height),
+		"framerate": c.opts.FPS,
+	}).Output(outputPath, c.opts.previewArgs()).
+		OverWriteOutput().
+		WithInput(bytes.NewReader(frames)), c.debugLog)
+	if err != nil {
+		return fmt.Errorf("error writing preview: %w", err)
+	}
+	return nil
+}
+
+// saveFramesPreview writes an animated preview of the image frames in a
+// chunk directory
+func (c *clipContext) saveFramesPreview(chunkDir, outputPath string) error {
+	pattern := filepath.Join(chunkDir, c.opts.framePattern()+"."+string(c.opts.Format))
+	_, err := runFFmpeg(ffmpeg.Input(pattern, ffmpeg.KwArgs{
+		"framerate":    c.opts.FPS,
+		"start_number": c.opts.frameStart(),
+	}).Output(outputPath, c.opts.previewArgs()).
+		OverWriteOutput(), c.debugLog)
+	if err != nil {
+		return fmt.Errorf("error writing preview: %w", err)
+	}
+	return nil
+}
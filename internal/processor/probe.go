@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// videoInfo describes a video stream of a file as reported by ffprobe
+type videoInfo struct {
+	Width    int
+	Height   int
+	Duration float64
+	// FrameRate is the average frame rate, and Frames the number of frames,
+	// counted by the container or estimated from the duration; 0 if unknown
+	FrameRate float64
+	Frames    int
+	HasAudio  bool
+	// Rotation is the clockwise rotation in degrees (0, 90, 180 or 270)
+	// that displays the stream upright, from its display matrix or legacy
+	// rotate tag
+	Rotation int
+	// Interlaced reports whether the stream's field order is interlaced
+	Interlaced bool
+	// VideoStreams is the number of video streams in the file
+	VideoStreams int
+}
+
+// probeOutput is the subset of ffprobe's JSON output that we read
+type probeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		Duration  string `json:"duration"`
+		// AvgFrameRate is a fraction such as 30000/1001
+		AvgFrameRate string `json:"avg_frame_rate"`
+		NbFrames     string `json:"nb_frames"`
+		// FieldOrder is progressive, tt, bb, tb, bt or unknown
+		FieldOrder string `json:"field_order"`
+		Tags       struct {
+			Rotate string `json:"rotate"`
+		} `json:"tags"`
+		SideDataList []struct {
+			SideDataType string  `json:"side_data_type"`
+			Rotation     float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeVideo runs ffprobe on a video file and returns the info of its first
+// video stream
+func probeVideo(videoPath string) (*videoInfo, error) {
+	return probeVideoStream(videoPath, 0)
+}
+
+// probeVideoStream runs ffprobe on a video file and returns the info of the
+// video stream with the given index among its video streams
+func probeVideoStream(videoPath string, stream int) (*videoInfo, error) {
+	out, err := runProbe(videoPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseProbeStream(out, stream)
+}
+
+// runProbe runs ffprobe on a file and returns its JSON output
+func runProbe(path string) ([]byte, error) {
+	out, err := ffmpeg.Probe(path)
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("error probing video: %w: %v", ErrFFmpegNotFound, err)
+		}
+		return nil, fmt.Errorf("error probing video: %w: %v", ErrCorruptInput, err)
+	}
+	return []byte(out), nil
+}
+
+// parseProbeOutput extracts the info of the first video stream from
+// ffprobe's JSON output
+func parseProbeOutput(data []byte) (*videoInfo, error) {
+	return parseProbeStream(data, 0)
+}
+
+// parseProbeStream extracts the info of the selected video stream, by its
+// index among the video streams, from ffprobe's JSON output
+func parseProbeStream(data []byte, selected int) (*videoInfo, error) {
+	var probe probeOutput
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error parsing ffprobe output: %w", err)
+	}
+
+	var info *videoInfo
+	hasAudio := false
+	videoStreams := 0
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "audio" {
+			hasAudio = true
+		}
+		if stream.CodecType != "video" {
+			continue
+		}
+		videoStreams++
+		if videoStreams != selected+1 {
+			continue
+		}
+		info = &videoInfo{Width: stream.Width, Height: stream.Height}
+		// Stream duration is missing for some containers (e.g. mkv), fall back to the format duration
+		duration := stream.Duration
+		if duration == "" {
+			duration = probe.Format.Duration
+		}
+		info.Duration, _ = strconv.ParseFloat(duration, 64)
+		info.FrameRate = parseFrameRate(stream.AvgFrameRate)
+		// The frame count is missing for some containers (e.g. mkv), estimate it from the duration
+		info.Frames, _ = strconv.Atoi(stream.NbFrames)
+		if info.Frames == 0 {
+			info.Frames = int(math.Round(info.Duration * info.FrameRate))
+		}
+		switch stream.FieldOrder {
+		case "tt", "bb", "tb", "bt":
+			info.Interlaced = true
+		}
+
+		// The display matrix rotation is counterclockwise, the legacy
+		// rotate tag clockwise
+		for _, sideData := range stream.SideDataList {
+			if sideData.SideDataType == "Display Matrix" {
+				info.Rotation = clockwiseRotation(-sideData.Rotation)
+			}
+		}
+		if rotate, err := strconv.ParseFloat(stream.Tags.Rotate, 64); err == nil && info.Rotation == 0 {
+			info.Rotation = clockwiseRotation(rotate)
+		}
+	}
+
+	if videoStreams == 0 {
+		return nil, fmt.Errorf("%w: no video stream found", ErrCorruptInput)
+	}
+	if info == nil {
+		return nil, fmt.Errorf("video stream %d not found: the clip has %d video streams", selected, videoStreams)
+	}
+	info.HasAudio = hasAudio
+	info.VideoStreams = videoStreams
+	return info, nil
+}
+
+// parseFrameRate parses a frame rate given as a fraction such as 30000/1001,
+// returning 0 for an unknown rate (0/0)
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -1,16 +1,24 @@
 package processor
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
 	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/torch"
 	"github.com/melody-ding/go-vidprep/internal/types"
 	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
@@ -20,9 +28,596 @@ type OutputFormat string
 
 const (
 	FormatJPEG OutputFormat = "jpg"
+	FormatPNG  OutputFormat = "png"
 	FormatNPY  OutputFormat = "npy"
+	// FormatNPZ stores each chunk's frames and metadata together in a
+	// zip-compressed NumPy archive
+	FormatNPZ OutputFormat = "npz"
+	// FormatPT stores each chunk as a tensor file loadable with torch.load
+	FormatPT OutputFormat = "pt"
 )
 
+// isArray reports whether chunks are written as arrays (NumPy arrays or
+// PyTorch tensors) rather than image files
+func (f OutputFormat) isArray() bool {
+	return f == FormatNPY || f == FormatNPZ || f == FormatPT
+}
+
+// Options configures how clips are processed
+type Options struct {
+	OutputDir    string
+	FPS          int
+	Size         string
+	Format       OutputFormat
+	TargetFrames int
+	// ChunkSeconds, if positive, sets the chunk length in seconds instead,
+	// TargetFrames being derived from it at each clip's frame rate so the
+	// same configuration works across frame rates.
+	ChunkSeconds float64
+	// BitDepth is the per-channel sample depth of the output (8 or 16).
+	// 16-bit output preserves 10/12-bit source precision and is only
+	// supported for the png, npy, npz and pt formats.
+	BitDepth int
+	// PixelFormat is the sample layout of NPY chunks (default rgb24, or
+	// rgb48 for 16-bit output), chosen to match what the downstream loader
+	// expects. Only supported for the npy, npz and pt formats.
+	PixelFormat PixelFormat
+	// JPEGQuality is the quality scale of jpg frames, ffmpeg's -q:v, from 2
+	// (best, largest files) to 31 (worst, smallest); 0 uses the encoder
+	// default.
+	JPEGQuality int
+	// Preview writes a low-resolution animated preview (gif or webp) of
+	// each chunk, PreviewWidth pixels wide (default 160), for spot-checking
+	// the dataset in a file browser.
+	Preview      PreviewFormat
+	PreviewWidth int
+	// Audio writes the source audio aligned to each chunk's frames as a
+	// mono wav or flac file, resampled to AudioSampleRate Hz (default
+	// 16000), for training audiovisual models. Clips without audio get no
+	// audio files.
+	Audio           AudioFormat
+	AudioSampleRate int
+	// VideoStream selects the video stream to chunk, by its index among
+	// the source's video streams, for stereo or multi-camera containers
+	// (default 0, the first). AllStreams instead chunks every video stream
+	// as its own chunk set, keyed <clip key>/stream_<index>; chunks with
+	// the same number cover the same source time in every set.
+	VideoStream int
+	AllStreams  bool
+	// AudioOnly skips frame extraction and writes each chunk's audio as a
+	// mono float32 waveform array in the npy, npz or pt format, resampled
+	// to AudioSampleRate Hz, for audio-only datasets. Chunks span the same
+	// TargetFrames frames at FPS as in video mode, and sources need no
+	// video stream.
+	AudioOnly bool
+	// MotionStats records the mean absolute difference between consecutive
+	// frames of each chunk and the percentage of static frames, those
+	// differing from the previous one by less than StaticThreshold, in chunk
+	// metadata. StaticThreshold is on a 0-1 scale; 0 uses the default of 0.01.
+	MotionStats     bool
+	StaticThreshold float64
+	// QualityMetrics computes per-chunk PSNR/SSIM against the source video
+	// and records the averages in chunk metadata.
+	QualityMetrics bool
+	// VMAF computes a per-chunk VMAF score via ffmpeg's libvmaf filter and
+	// records it in chunk metadata.
+	VMAF bool
+	// NoAutoRotate stores frames of video with a rotation flag, such as
+	// phone video recorded in portrait, as encoded. By default they are
+	// rotated so they are stored upright.
+	NoAutoRotate bool
+	// Deinterlace removes the combing of interlaced footage with yadif:
+	// DeinterlaceOn for every clip, or DeinterlaceAuto for clips whose
+	// field order ffprobe reports as interlaced.
+	Deinterlace DeinterlaceMode
+	// Denoise removes noise, e.g. from low-light footage, with the
+	// DenoiseHQDN3D or DenoiseNLMeans filter after fps resampling.
+	// DenoiseStrength sets its strength; 0 uses the filter's default.
+	Denoise         string
+	DenoiseStrength float64
+	// ColorMatrix and ColorRange override the YUV matrix and range the
+	// source is assumed to use when converting it to the output pixel
+	// format, for sources whose tags are missing or wrong. The defaults use
+	// the source's tags.
+	ColorMatrix ColorMatrix
+	ColorRange  ColorRange
+	// AutoCrop detects letterbox/pillarbox bars with ffmpeg's cropdetect and
+	// crops them away before scaling. It is off by default, like -autocrop,
+	// since detection adds an ffmpeg pass per clip.
+	AutoCrop bool
+	// AutoCropLimit is the brightness (1-255) below which AutoCrop counts
+	// pixels as black; 0 uses the default of 24. Raise it for noisy or
+	// compressed bars that are not quite black.
+	AutoCropLimit int
+	// Interpolate resamples to FPS with motion-compensated frame
+	// interpolation (ffmpeg's minterpolate), so low frame rate sources are
+	// upsampled smoothly instead of by duplicating frames. It is much
+	// slower than plain resampling.
+	Interpolate bool
+	// Decimate drops consecutive near-identical frames (ffmpeg's mpdecimate)
+	// after fps resampling, so low-motion footage doesn't produce chunks of
+	// static duplicates.
+	Decimate bool
+	// Silence enables silencedetect on the clip's audio track to flag or drop
+	// chunks whose time window is entirely silent.
+	Silence SilenceMode
+	// SilenceThresholdDB is the noise level below which audio counts as
+	// silent. It must be negative; 0 uses the default of -50 dB.
+	SilenceThresholdDB float64
+	// SceneSplit splits each clip into shots at the scene changes detected
+	// by ffmpeg's scene score, chunking every shot separately so no chunk
+	// spans a cut. SceneThreshold is the score (0-1) above which a frame
+	// starts a new shot, above 0 and at most 1; 0 uses the default of 0.3.
+	SceneSplit     bool
+	SceneThreshold float64
+	// Debug writes each ffmpeg invocation's command line and stderr to an
+	// ffmpeg.log file in the clip's output directory, and includes the tail
+	// of stderr in the error of a failed invocation.
+	Debug bool
+	// DebugOverlay burns the clip key, frame index and source timestamp
+	// into the corner of each output frame.
+	DebugOverlay bool
+	// MemoryLimit is a ceiling on the process RSS in bytes. When set,
+	// ProcessClipsWithOptions runs fewer workers while RSS is over the
+	// limit and scales back up as memory is freed. Zero disables the limit.
+	MemoryLimit uint64
+	// ChunkDigits is the zero-padded width of chunk numbers (default 5).
+	ChunkDigits int
+	// ChunkStart is the number of each clip's first chunk.
+	ChunkStart int
+	// FramePattern is the printf-style name of frame files within a chunk,
+	// without extension (default "frame_%06d").
+	FramePattern string
+	// FrameOffset shifts the numbers of frames within each chunk, which
+	// start at 1 by default; -1 numbers them from 0.
+	FrameOffset int
+	// Normalize writes NPY chunks as float32 with the per-channel mean/std
+	// applied, so dataloaders can skip normalization. Only supported for
+	// npy, npz and pt.
+	Normalize *types.Normalization
+	// DType is the sample type of NPY chunks. DTypeFloat32 writes samples
+	// scaled to 0-1 (value / 255, or / 65535 for 16-bit output) when not
+	// normalizing. Only supported for npy, npz and pt.
+	DType DType
+	// Layout is the axis order of NPY chunks (default LayoutTHWC);
+	// LayoutTCHW writes channels-first arrays. Only supported for npy, npz
+	// and pt.
+	Layout Layout
+	// Crop fits frames to the output size by cropping instead of scaling
+	// the full frame, e.g. CropCenter for the resize-then-center-crop
+	// preprocessing most video models expect, or CropRandom for a seeded
+	// random crop.
+	Crop CropMode
+	// Transforms are applied in order after the built-in transforms, e.g.
+	// registered transforms built with ParseTransform or a library user's
+	// own Transform implementations.
+	Transforms []Transform
+	// EmitFlipped writes a horizontally mirrored copy of each chunk as a
+	// sibling sample named with a _flip suffix, next to the plain chunk.
+	EmitFlipped bool
+	// ExtraFilters is an ffmpeg filter chain appended after the built-in
+	// transforms, e.g. "eq=saturation=1.2,unsharp", for filters the
+	// processor has no option for.
+	ExtraFilters string
+	// MultiCrop emits several evaluation crops of each chunk as sibling
+	// samples sharing a base key, instead of scaling the full frame.
+	MultiCrop MultiCropMode
+	// ChunkJitter starts each segment's first chunk at a random frame offset
+	// below one chunk length (or Stride, if shorter) instead of frame 0,
+	// reducing systematic alignment of chunks with the start of clips.
+	ChunkJitter bool
+	// Stride is the number of frames between the starts of consecutive
+	// chunks; below TargetFrames chunks overlap, e.g. 16-frame windows
+	// every 8 frames. 0 uses TargetFrames, for back-to-back chunks.
+	Stride int
+	// MaxChunks, if positive, caps the number of chunks a clip contributes,
+	// so very long videos don't dominate the dataset. Only the first
+	// MaxChunks chunks are written, or with MaxChunksUniform chunks spread
+	// evenly over the clip. Segments (spans or shots) are filled in order.
+	MaxChunks        int
+	MaxChunksUniform bool
+	// RandomChunks, if positive, extracts this many chunks per clip at
+	// random offsets, seeded by Seed and the clip key, instead of chunking
+	// it exhaustively, decoding only the frames of those chunks. Chunks may
+	// overlap.
+	RandomChunks int
+	// Seed seeds all random choices, such as chunk jitter, so runs are reproducible.
+	Seed int64
+	// BoxSmoothing is the number of consecutive bounding boxes averaged to
+	// smooth the crop window of clips with box annotations (default 5).
+	BoxSmoothing int
+	// KeyframeAlign starts each chunk at the first frame at or after a
+	// source keyframe, so a chunk can be decoded without seeking back to a
+	// distant keyframe. Frames between chunks are discarded.
+	KeyframeAlign bool
+	// UniformFrames, if positive, samples this many frames spread evenly
+	// over the whole clip as its single sample instead of resampling to FPS
+	// and chunking, like the frame sampling of most video classifiers.
+	// Clips with explicit timestamps keep them.
+	UniformFrames int
+	// MetadataFormat is the serialization of chunk metadata files (json,
+	// msgpack or cbor); it also sets their extension (default json).
+	MetadataFormat metaformat.Format
+	// AugCopies emits this many independently augmented copies of each
+	// chunk (random crop, zoom, flip and color jitter, seeded by Seed) as
+	// sibling samples sharing a base key, instead of the plain scaled chunk.
+	AugCopies int
+	// Precheck probes each clip before processing and skips clips that are
+	// empty, truncated or undecodable with a ClipSkipped result, rather than
+	// failing them partway through the pipeline.
+	Precheck bool
+	// MinFrames and MinDuration skip clips that yield fewer frames at FPS,
+	// or last fewer seconds, before extracting any frames, e.g. clips too
+	// short to fill one chunk. Zero disables the check.
+	MinFrames   int
+	MinDuration float64
+	// OnResult, if set, is called with the result of each clip as soon as
+	// ProcessClipStream or ProcessClipsWithOptions finishes it, e.g. to
+	// checkpoint progress. It is called from worker goroutines concurrently.
+	OnResult func(ClipResult)
+}
+
+const (
+	defaultChunkDigits  = 5
+	defaultFramePattern = "frame_%06d"
+	// extractPattern names frames extracted ahead of chunking; it is wide
+	// enough that lexical order matches frame order for long sources
+	extractPattern = "extract_%09d"
+)
+
+// framePatternRegexp matches a file name pattern with a single integer verb
+var framePatternRegexp = regexp.MustCompile(`^[^%/\\]*%0?\d*d[^%/\\]*$`)
+
+// chunkName returns the name of the chunk with the given zero-based index
+func (o Options) chunkName(idx int) string {
+	digits := o.ChunkDigits
+	if digits == 0 {
+		digits = defaultChunkDigits
+	}
+	return fmt.Sprintf("chunk_%0*d", digits, idx+o.ChunkStart)
+}
+
+// framePattern returns the configured frame file name pattern, defaulting
+// to frame_%06d
+func (o Options) framePattern() string {
+	if o.FramePattern == "" {
+		return defaultFramePattern
+	}
+	return o.FramePattern
+}
+
+// frameName returns the file name, without extension, of the frame with
+// the given zero-based index within its chunk
+func (o Options) frameName(idx int) string {
+	return fmt.Sprintf(o.framePattern(), idx+o.frameStart())
+}
+
+// frameStart returns the number of the first frame within each chunk
+func (o Options) frameStart() int {
+	return 1 + o.FrameOffset
+}
+
+// boxSmoothing returns the configured box smoothing window, defaulting to 5
+func (o Options) boxSmoothing() int {
+	if o.BoxSmoothing == 0 {
+		return defaultBoxSmoothing
+	}
+	return o.BoxSmoothing
+}
+
+// bitDepth returns the configured bit depth, defaulting to 8, or 16 for
+// the rgb48 pixel format
+func (o Options) bitDepth() int {
+	if o.PixelFormat == PixFmtRGB48 {
+		return 16
+	}
+	if o.BitDepth == 0 {
+		return 8
+	}
+	return o.BitDepth
+}
+
+// withOverrides returns the options a clip is processed with: the options
+// with its per-clip overrides applied, its transform specs parsed with
+// ParseTransform, and the chunk length derived from ChunkSeconds at its
+// frame rate unless it overrides the frame count
+func (o Options) withOverrides(overrides *types.ClipOverrides) (Options, error) {
+	if overrides == nil {
+		overrides = &types.ClipOverrides{}
+	}
+	if overrides.FPS > 0 {
+		o.FPS = overrides.FPS
+	}
+	if o.ChunkSeconds > 0 {
+		o.TargetFrames = max(1, int(math.Round(o.ChunkSeconds*float64(o.FPS))))
+	}
+	if overrides.Size != "" {
+		o.Size = overrides.Size
+	}
+	if overrides.TargetFrames > 0 {
+		o.TargetFrames = overrides.TargetFrames
+	}
+	if len(overrides.Transforms) > 0 {
+		transforms := make([]Transform, 0, len(overrides.Transforms))
+		for _, spec := range overrides.Transforms {
+			t, err := ParseTransform(spec)
+			if err != nil {
+				return o, err
+			}
+			transforms = append(transforms, t)
+		}
+		o.Transforms = transforms
+	}
+	return o, nil
+}
+
+// Validate checks that the options describe a supported configuration
+func (o Options) Validate() error {
+	switch o.Format {
+	case FormatJPEG, FormatPNG, FormatNPY, FormatNPZ, FormatPT:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, o.Format)
+	}
+	switch o.bitDepth() {
+	case 8:
+	case 16:
+		if o.Format != FormatPNG && !o.Format.isArray() {
+			return fmt.Errorf("%w: 16-bit output is only supported for png, npy, npz and pt formats, got %s", ErrUnsupportedFormat, o.Format)
+		}
+	default:
+		return fmt.Errorf("unsupported bit depth: %d", o.BitDepth)
+	}
+	switch o.PixelFormat {
+	case "":
+	case PixFmtRGB24, PixFmtBGR24, PixFmtGray, PixFmtYUV420P, PixFmtRGB48:
+		if !o.Format.isArray() {
+			return fmt.Errorf("%w: pixel formats are only supported for npy, npz and pt formats, got %s", ErrUnsupportedFormat, o.Format)
+		}
+		if o.BitDepth == 16 && o.PixelFormat != PixFmtRGB48 {
+			return fmt.Errorf("%w: 16-bit output needs the rgb48 pixel format, got %s", ErrUnsupportedFormat, o.PixelFormat)
+		}
+		if o.Normalize != nil && o.PixelFormat.channels() != 3 {
+			return fmt.Errorf("%w: normalization needs an RGB or BGR pixel format, got %s", ErrUnsupportedFormat, o.PixelFormat)
+		}
+		// Chroma planes are half the frame size on each axis
+		if dims, err := parseDimensions(o.Size); o.PixelFormat == PixFmtYUV420P && err == nil && (dims.Width%2 != 0 || dims.Height%2 != 0) {
+			return fmt.Errorf("yuv420p output needs an even size, got %s", o.Size)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported pixel format %s", ErrUnsupportedFormat, o.PixelFormat)
+	}
+	if o.Normalize != nil {
+		if !o.Format.isArray() {
+			return fmt.Errorf("%w: normalization is only supported for npy, npz and pt formats, got %s", ErrUnsupportedFormat, o.Format)
+		}
+		if err := validateNormalization(o.Normalize); err != nil {
+			return err
+		}
+	}
+	switch o.DType {
+	case DTypeAuto:
+	case DTypeFloat32:
+		if !o.Format.isArray() {
+			return fmt.Errorf("%w: float32 samples are only supported for npy, npz and pt formats, got %s", ErrUnsupportedFormat, o.Format)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported dtype %s", ErrUnsupportedFormat, o.DType)
+	}
+	switch o.Layout {
+	case "", LayoutTHWC:
+	case LayoutTCHW:
+		if !o.Format.isArray() {
+			return fmt.Errorf("%w: layouts are only supported for npy, npz and pt formats, got %s", ErrUnsupportedFormat, o.Format)
+		}
+		if o.pixelFormat() == PixFmtYUV420P {
+			return fmt.Errorf("%w: the planar yuv420p pixel format has no channel axis", ErrUnsupportedFormat)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported layout %s", ErrUnsupportedFormat, o.Layout)
+	}
+	switch o.MultiCrop {
+	case MultiCropOff:
+	case MultiCropThree, MultiCropTen:
+		if o.qualityMetrics().any() {
+			return fmt.Errorf("quality metrics are not supported with multi-crop output")
+		}
+	default:
+		return fmt.Errorf("unsupported multi-crop mode: %s", o.MultiCrop)
+	}
+	if o.JPEGQuality != 0 {
+		if o.Format != FormatJPEG {
+			return fmt.Errorf("%w: jpeg quality is only supported for jpg output", ErrUnsupportedFormat)
+		}
+		if o.JPEGQuality < 2 || o.JPEGQuality > 31 {
+			return fmt.Errorf("invalid jpeg quality: %d (must be 2-31)", o.JPEGQuality)
+		}
+	}
+	switch o.Preview {
+	case PreviewOff, PreviewGIF, PreviewWebP:
+	default:
+		return fmt.Errorf("unsupported preview format: %s", o.Preview)
+	}
+	if o.PreviewWidth < 0 {
+		return fmt.Errorf("invalid preview width: %d", o.PreviewWidth)
+	}
+	switch o.Audio {
+	case AudioOff, AudioWAV, AudioFLAC:
+	default:
+		return fmt.Errorf("unsupported audio format: %s", o.Audio)
+	}
+	if o.AudioSampleRate < 0 {
+		return fmt.Errorf("invalid audio sample rate: %d", o.AudioSampleRate)
+	}
+	if o.AudioOnly {
+		if !o.Format.isArray() {
+			return fmt.Errorf("%w: audio-only mode is only supported for npy, npz and pt formats", ErrUnsupportedFormat)
+		}
+		if conflict := o.audioOnlyConflict(); conflict != "" {
+			return fmt.Errorf("%s is not supported in audio-only mode", conflict)
+		}
+	}
+	if o.StaticThreshold < 0 || o.StaticThreshold > 1 {
+		return fmt.Errorf("invalid static threshold: %g (must be between 0 and 1)", o.StaticThreshold)
+	}
+	if o.VideoStream < 0 {
+		return fmt.Errorf("invalid video stream: %d", o.VideoStream)
+	}
+	if o.AllStreams && o.VideoStream > 0 {
+		return fmt.Errorf("a video stream cannot be selected when chunking all streams")
+	}
+	if o.AllStreams && (o.SceneSplit || o.Decimate || o.KeyframeAlign) {
+		return fmt.Errorf("scene splitting, decimation and keyframe alignment are not supported when chunking all streams, as they would chunk each stream differently")
+	}
+	if o.Audio != AudioOff && o.Decimate {
+		return fmt.Errorf("chunk audio is not supported with decimation, which breaks the alignment of frames to source time")
+	}
+	switch o.Crop {
+	case CropOff:
+	case CropCenter, CropRandom:
+		if o.MultiCrop != MultiCropOff || o.AugCopies > 0 {
+			return fmt.Errorf("cropping is not supported with multi-crop output or augmented copies")
+		}
+	default:
+		return fmt.Errorf("unsupported crop mode: %s", o.Crop)
+	}
+	if o.EmitFlipped {
+		if o.MultiCrop != MultiCropOff || o.AugCopies > 0 {
+			return fmt.Errorf("flipped copies are not supported with multi-crop output or augmented copies")
+		}
+		if o.qualityMetrics().any() {
+			return fmt.Errorf("quality metrics are not supported with flipped copies")
+		}
+	}
+	if o.ChunkDigits < 0 {
+		return fmt.Errorf("invalid chunk digits: %d", o.ChunkDigits)
+	}
+	if o.FramePattern != "" && !framePatternRegexp.MatchString(o.FramePattern) {
+		return fmt.Errorf("invalid frame pattern %q: must contain exactly one integer verb such as %%06d", o.FramePattern)
+	}
+	if o.Interpolate && o.Decimate {
+		return fmt.Errorf("frame interpolation is not supported with decimation")
+	}
+	if o.UniformFrames < 0 {
+		return fmt.Errorf("invalid uniform frame count: %d", o.UniformFrames)
+	}
+	if o.MinFrames < 0 || o.MinDuration < 0 {
+		return fmt.Errorf("invalid minimum clip length")
+	}
+	if o.ChunkSeconds < 0 {
+		return fmt.Errorf("invalid chunk length: %gs", o.ChunkSeconds)
+	}
+	if o.RandomChunks < 0 {
+		return fmt.Errorf("invalid random chunk count: %d", o.RandomChunks)
+	}
+	if o.RandomChunks > 0 && o.KeyframeAlign {
+		return fmt.Errorf("random chunks are not supported with keyframe alignment")
+	}
+	if o.MaxChunks < 0 {
+		return fmt.Errorf("invalid chunk cap: %d", o.MaxChunks)
+	}
+	if o.Stride < 0 {
+		return fmt.Errorf("invalid stride: %d", o.Stride)
+	}
+	if o.KeyframeAlign && o.Stride != 0 {
+		return fmt.Errorf("a chunk stride is not supported with keyframe alignment")
+	}
+	if o.KeyframeAlign && (o.Decimate || o.ChunkJitter) {
+		return fmt.Errorf("keyframe alignment is not supported with decimation or chunk jitter")
+	}
+	if o.AugCopies < 0 {
+		return fmt.Errorf("invalid augmented copy count: %d", o.AugCopies)
+	}
+	if o.AugCopies > 0 {
+		if o.MultiCrop != MultiCropOff {
+			return fmt.Errorf("augmented copies are not supported with multi-crop output")
+		}
+		if o.qualityMetrics().any() {
+			return fmt.Errorf("quality metrics are not supported with augmented copies")
+		}
+		// Color jitter (eq) only operates on 8-bit samples
+		if o.bitDepth() != 8 {
+			return fmt.Errorf("augmented copies are only supported for 8-bit output")
+		}
+	}
+	if err := o.MetadataFormat.Validate(); err != nil {
+		return err
+	}
+	if o.AutoCropLimit < 0 || o.AutoCropLimit > 255 {
+		return fmt.Errorf("invalid autocrop limit: %d", o.AutoCropLimit)
+	}
+	if o.BoxSmoothing < 0 {
+		return fmt.Errorf("invalid box smoothing: %d", o.BoxSmoothing)
+	}
+	switch o.Deinterlace {
+	case DeinterlaceOff, DeinterlaceOn, DeinterlaceAuto:
+	default:
+		return fmt.Errorf("unsupported deinterlace mode: %s", o.Deinterlace)
+	}
+	switch o.Denoise {
+	case "", DenoiseHQDN3D, DenoiseNLMeans:
+	default:
+		return fmt.Errorf("unsupported denoise filter: %s", o.Denoise)
+	}
+	switch o.ColorMatrix {
+	case ColorMatrixAuto, ColorMatrixBT601, ColorMatrixBT709:
+	default:
+		return fmt.Errorf("unsupported color matrix: %s", o.ColorMatrix)
+	}
+	switch o.ColorRange {
+	case ColorRangeAuto, ColorRangeLimited, ColorRangeFull:
+	default:
+		return fmt.Errorf("unsupported color range: %s", o.ColorRange)
+	}
+	if o.DenoiseStrength < 0 {
+		return fmt.Errorf("invalid denoise strength: %g", o.DenoiseStrength)
+	}
+	if o.SceneThreshold < 0 || o.SceneThreshold > 1 {
+		return fmt.Errorf("invalid scene threshold: %g", o.SceneThreshold)
+	}
+	if o.SilenceThresholdDB > 0 {
+		return fmt.Errorf("invalid silence threshold: %g dB (must be below 0)", o.SilenceThresholdDB)
+	}
+	switch o.Silence {
+	case SilenceOff, SilenceFlag, SilenceDrop:
+	default:
+		return fmt.Errorf("unsupported silence mode: %s", o.Silence)
+	}
+	return nil
+}
+
+// autoCropLimit returns the configured black threshold of AutoCrop,
+// defaulting to 24
+func (o Options) autoCropLimit() int {
+	if o.AutoCropLimit == 0 {
+		return defaultCropDetectLimit
+	}
+	return o.AutoCropLimit
+}
+
+// silenceThresholdDB returns the configured silence threshold, defaulting to -50 dB
+func (o Options) silenceThresholdDB() float64 {
+	if o.SilenceThresholdDB == 0 {
+		return defaultSilenceThresholdDB
+	}
+	return o.SilenceThresholdDB
+}
+
+// stride returns the configured chunk stride, defaulting to the chunk length
+func (o Options) stride() int {
+	if o.Stride == 0 {
+		return o.TargetFrames
+	}
+	return o.Stride
+}
+
+// sceneThreshold returns the configured scene change threshold, defaulting to 0.3
+func (o Options) sceneThreshold() float64 {
+	if o.SceneThreshold == 0 {
+		return defaultSceneThreshold
+	}
+	return o.SceneThreshold
+}
+
 // Dimensions represents video frame dimensions
 type Dimensions struct {
 	Width  int
@@ -51,39 +646,63 @@ func parseDimensions(size string) (Dimensions, error) {
 	return Dimensions{Width: width, Height: height}, nil
 }
 
-// extractRawFrames extracts raw RGB frames from a video using ffmpeg
-func extractRawFrames(videoPath string, dims Dimensions, fps int) ([]byte, error) {
-	tempRawPath := filepath.Join(os.TempDir(), filepath.Base(videoPath)+"_raw")
+// extractRawFrames extracts raw frames in the configured pixel format from a
+// segment of the clip using ffmpeg
+func (c *clipContext) extractRawFrames(seg segment) ([]byte, error) {
+	tempRawPath := filepath.Join(os.TempDir(), filepath.Base(c.videoPath)+"_raw")
 	defer os.Remove(tempRawPath)
 
-	transforms := []Transform{
-		FPSTransform{FPS: fps},
-		dims.ScaleTransform(),
-	}
-
-	err := ffmpeg.Input(videoPath).
-		Output(tempRawPath,
-			ffmpeg.KwArgs{
-				"vf":      ComposeTransforms(transforms...),
-				"f":       "rawvideo",
-				"pix_fmt": "rgb24",
-			}).
-		OverWriteOutput().
-		Run()
+	kwargs := c.outputArgs(seg)
+	kwargs["vf"] = ComposeTransforms(c.transforms(seg)...)
+	kwargs["f"] = "rawvideo"
+	kwargs["pix_fmt"] = c.opts.pixelFormat().ffmpegName()
+	_, err := runFFmpeg(c.videoInput(seg).
+		Output(tempRawPath, kwargs).
+		OverWriteOutput(), c.debugLog)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting raw frames: %v", err)
+		return nil, fmt.Errorf("error extracting raw frames: %w", err)
 	}
 
 	rawData, err := os.ReadFile(tempRawPath)
 	if err != nil {
-		return nil, fmt.Errorf("error reading raw frames: %v", err)
+		return nil, fmt.Errorf("error reading raw frames: %w", err)
 	}
 
 	return rawData, nil
 }
 
-// saveNumpyArray saves raw frame data as a NumPy array
-func saveNumpyArray(data []byte, dims Dimensions, numFrames int, outputPath string) error {
+// numpyDType returns the dtype of array chunks: float32 when normalizing or
+// requested, otherwise an unsigned integer of the output bit depth. PyTorch
+// has no uint16 storage, so 16-bit pt chunks are widened to int32.
+func (o Options) numpyDType() numpy.DType {
+	switch {
+	case o.floatOutput():
+		return numpy.Float32
+	case o.bitDepth() == 16 && o.Format == FormatPT:
+		return numpy.Int32
+	case o.bitDepth() == 16:
+		return numpy.Uint16
+	default:
+		return numpy.Uint8
+	}
+}
+
+// encodeSamples converts raw frames in the output pixel format to the
+// samples of array chunks: float32 if requested, or widened for 16-bit pt
+// chunks, in the configured layout
+func (o Options) encodeSamples(data []byte, dims Dimensions) []byte {
+	switch o.numpyDType() {
+	case numpy.Float32:
+		data = normalizeFrames(data, o.bitDepth(), o.sampleNormalization())
+	case numpy.Int32:
+		data = widenSamples(data)
+	}
+	return o.applyLayout(data, dims)
+}
+
+// saveNumpyArray saves frame data, encoded as dtype, as a NumPy array of
+// numFrames frames of frameShape
+func saveNumpyArray(data []byte, frameShape []int, numFrames int, dtype numpy.DType, outputPath string) error {
 	// Create the NumPy writer
 	writer, err := numpy.NewWriter(outputPath)
 	if err != nil {
@@ -91,277 +710,1157 @@ func saveNumpyArray(data []byte, dims Dimensions, numFrames int, outputPath stri
 	}
 	defer writer.Close()
 
-	// Write the data with shape (frames, height, width, channels)
-	shape := []int{numFrames, dims.Height, dims.Width, 3}
-	return writer.Write(data, shape)
+	// Write the data with shape (frames, ...frameShape), e.g. (frames,
+	// height, width, channels)
+	shape := append([]int{numFrames}, frameShape...)
+	return writer.WriteDType(data, shape, dtype)
+}
+
+// saveFrames saves individual image frames (JPEG or PNG) from a segment of the clip
+func (c *clipContext) saveFrames(seg segment) error {
+	kwargs := c.outputArgs(seg)
+	kwargs["vf"] = ComposeTransforms(c.transforms(seg)...)
+	if c.opts.Format == FormatPNG && c.opts.bitDepth() == 16 {
+		kwargs["pix_fmt"] = "rgb48be"
+	}
+	if c.opts.Format == FormatJPEG && c.opts.JPEGQuality > 0 {
+		kwargs["q:v"] = c.opts.JPEGQuality
+	}
+
+	_, err := runFFmpeg(c.videoInput(seg).
+		Output(filepath.Join(c.outPath, extractPattern+"."+string(c.opts.Format)), kwargs).
+		OverWriteOutput(), c.debugLog)
+	return err
 }
 
-// saveJPEGFrames saves individual JPEG frames
-func saveJPEGFrames(videoPath string, dims Dimensions, fps int, outputPath string) error {
-	transforms := []Transform{
-		FPSTransform{FPS: fps},
-		dims.ScaleTransform(),
+// saveNumpyChunk saves encoded chunk samples of numFrames frames and the
+// chunk's metadata as name.npy (or name.pt) and name_metadata.<ext>, or
+// together as the frames and metadata arrays of name.npz
+func (c *clipContext) saveNumpyChunk(name string, data []byte, numFrames int, metadata types.ClipMetadata) error {
+	shape := append([]int{numFrames}, c.opts.frameShape(c.dims)...)
+	return c.saveArrayChunk(name, data, shape, c.opts.numpyDType(), metadata)
+}
+
+// saveArrayChunk saves a chunk array of the given shape and dtype and the
+// chunk's metadata in the npy, npz or pt format
+func (c *clipContext) saveArrayChunk(name string, data []byte, shape []int, dtype numpy.DType, metadata types.ClipMetadata) error {
+	opts := c.opts
+	if opts.Format == FormatNPZ {
+		encoded, err := metaformat.Marshal(metadata, opts.MetadataFormat)
+		if err != nil {
+			return fmt.Errorf("error marshaling metadata: %w", err)
+		}
+		return numpy.WriteNPZ(filepath.Join(c.outPath, name+".npz"),
+			numpy.Array{Name: "frames", Data: data, Shape: shape, DType: dtype},
+			numpy.Array{Name: "metadata", Data: encoded, Shape: []int{len(encoded)}, DType: numpy.Uint8})
 	}
 
-	return ffmpeg.Input(videoPath).
-		Output(filepath.Join(outputPath, "frame_%03d.jpg"),
-			ffmpeg.KwArgs{
-				"vf": ComposeTransforms(transforms...),
-			}).
-		OverWriteOutput().
-		Run()
+	var err error
+	if opts.Format == FormatPT {
+		err = torch.WriteTensor(filepath.Join(c.outPath, name+".pt"), data, shape, torchDType(dtype))
+	} else {
+		err = saveNumpyArray(data, shape[1:], shape[0], dtype, filepath.Join(c.outPath, name+".npy"))
+	}
+	if err != nil {
+		return err
+	}
+	metadataFile := filepath.Join(c.outPath, name+"_metadata."+opts.MetadataFormat.Ext())
+	return saveMetadata(metadata, metadataFile, opts.MetadataFormat)
 }
 
-// saveMetadata saves clip metadata to a JSON file
-func saveMetadata(metadata types.ClipMetadata, outputPath string) error {
-	data, err := json.MarshalIndent(metadata, "", "  ")
+// saveMetadata saves clip metadata to a file in the given format
+func saveMetadata(metadata types.ClipMetadata, outputPath string, format metaformat.Format) error {
+	data, err := metaformat.Marshal(metadata, format)
 	if err != nil {
-		return fmt.Errorf("error marshaling metadata: %v", err)
+		return fmt.Errorf("error marshaling metadata: %w", err)
 	}
 
 	return os.WriteFile(outputPath, data, 0644)
 }
 
+// saveSidecars writes the clip's sidecar files as prefix.<ext>
+func (c *clipContext) saveSidecars(prefix string) error {
+	for ext, data := range c.clip.Sidecars {
+		if err := os.WriteFile(prefix+"."+ext, data, 0644); err != nil {
+			return fmt.Errorf("error writing %s sidecar: %w", ext, err)
+		}
+	}
+	return nil
+}
+
+// caption returns the clip's caption: the one given by its manifest entry,
+// or else the text of its .txt sidecar
+func (c *clipContext) caption() string {
+	if c.clip.Caption != "" {
+		return c.clip.Caption
+	}
+	return strings.TrimSpace(string(c.clip.Sidecars["txt"]))
+}
+
+// saveCaption writes the clip's caption, if it has one, to outputPath
+func (c *clipContext) saveCaption(outputPath string) error {
+	caption := c.caption()
+	if caption == "" {
+		return nil
+	}
+	if err := os.WriteFile(outputPath, []byte(caption+"\n"), 0644); err != nil {
+		return fmt.Errorf("error writing caption: %w", err)
+	}
+	return nil
+}
+
 // ProcessClip extracts frames from a video clip using ffmpeg
 func ProcessClip(clip types.Clip, outputDir string, fps int, size string, format OutputFormat, targetFrames int) error {
-	// Create temporary video file
-	tempVideoPath := filepath.Join(os.TempDir(), clip.Key+".mp4")
-	if err := os.WriteFile(tempVideoPath, clip.RawData, 0644); err != nil {
+	_, err := ProcessClipWithOptions(clip, Options{
+		OutputDir:    outputDir,
+		FPS:          fps,
+		Size:         size,
+		Format:       format,
+		TargetFrames: targetFrames,
+	})
+	return err
+}
+
+// segment is a time span of the source video that is chunked independently
+type segment struct {
+	// Start and End are in seconds; End <= 0 means the end of the video
+	Start float64
+	End   float64
+	// Span is the annotation span the segment was built from, if any
+	Span *types.Span
+	// Shot is the shot the segment covers, when splitting at scene changes
+	Shot *types.Shot
+	// Frames limits the number of frames extracted, if positive
+	Frames int
+}
+
+// inputArgs returns the ffmpeg input options that seek to the segment
+func (s segment) inputArgs() ffmpeg.KwArgs {
+	// ffmpeg's own rotation is disabled since rotation is applied
+	// explicitly by the transform chain, unless NoAutoRotate is set
+	kwargs := ffmpeg.KwArgs{"noautorotate": ""}
+	if s.Start > 0 {
+		kwargs["ss"] = strconv.FormatFloat(s.Start, 'f', -1, 64)
+	}
+	if s.End > 0 {
+		kwargs["t"] = strconv.FormatFloat(s.End-s.Start, 'f', -1, 64)
+	}
+	return kwargs
+}
+
+// clipContext carries the per-clip state shared by the format-specific processors
+type clipContext struct {
+	clip      types.Clip
+	videoPath string
+	outPath   string
+	dims      Dimensions
+	opts      Options
+	// crop is the black-bar crop detected for the clip, if any
+	crop *types.CropRegion
+	// keyframes are the source keyframe times in seconds, if probed
+	keyframes []float64
+	// boxCrop is the crop window following the clip's bounding boxes, if any
+	boxCrop *boxCrop
+	// silences are the silent audio intervals of the clip, if detected
+	silences []silenceInterval
+	// sceneCuts are the times of the clip's scene changes, if detected
+	sceneCuts []float64
+	// nextChunk is the index of the next chunk to be written for the clip
+	nextChunk int
+	// framesDiscarded counts frames not written to any chunk, by reason
+	framesDiscarded DiscardCounts
+	// duration is the probed length of the source in seconds, if known
+	duration float64
+	// stream is the index of the video stream being chunked among the
+	// source's videoStreams video streams
+	stream       int
+	videoStreams int
+	// hasAudio reports whether the source has an audio track
+	hasAudio bool
+	// sourceFPS and sourceFrames are the probed average frame rate and
+	// frame count of the source, if known
+	sourceFPS    float64
+	sourceFrames int
+	// rotation is the clockwise rotation in degrees applied to display the
+	// source upright, or 0
+	rotation int
+	// deinterlace reports whether the source is deinterlaced
+	deinterlace bool
+	// debugLog receives ffmpeg command lines and stderr in debug mode
+	debugLog io.Writer
+	// view is the evaluation crop or augmented copy currently being written, if any
+	view *cropView
+	// skipReason is why the precheck skipped the clip, if it did
+	skipReason error
+}
+
+// segments returns the time spans of the clip to chunk: the annotated spans
+// if the clip has any, otherwise the whole video, split into shots with
+// scene splitting
+func (c *clipContext) segments() ([]segment, error) {
+	segments := []segment{{}}
+	if len(c.clip.Spans) > 0 {
+		segments = make([]segment, len(c.clip.Spans))
+		for i := range c.clip.Spans {
+			span := &c.clip.Spans[i]
+			segments[i] = segment{Start: span.Start, End: span.End, Span: span}
+		}
+	}
+	if c.opts.SceneSplit {
+		segments = c.shotSegments(segments)
+	}
+	if c.opts.RandomChunks > 0 {
+		return c.randomSegments(segments)
+	}
+	return segments, nil
+}
+
+// randomSegments returns RandomChunks segments of one chunk each, in time
+// order, starting at random times within segments. Start times are drawn
+// uniformly over the segments' possible starts, seeded by the run seed and
+// clip key so every run picks the same chunks. It fails if a segment runs
+// to the end of a clip whose duration could not be probed, rather than
+// silently extracting nothing.
+func (c *clipContext) randomSegments(segments []segment) ([]segment, error) {
+	length := float64(c.opts.TargetFrames) / float64(c.opts.FPS)
+	type window struct {
+		seg   segment
+		slack float64
+	}
+	var windows []window
+	var total float64
+	for _, seg := range segments {
+		end := seg.End
+		if end <= 0 {
+			if c.duration <= 0 {
+				return nil, fmt.Errorf("random chunks need the clip duration, which could not be probed")
+			}
+			end = c.duration
+		}
+		if slack := end - seg.Start - length; slack >= 0 {
+			windows = append(windows, window{seg: seg, slack: slack})
+			total += slack
+		}
+	}
+	if len(windows) == 0 {
+		return nil, nil
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/random", c.clip.Key)
+	rng := rand.New(rand.NewSource(c.opts.Seed ^ int64(h.Sum64())))
+	random := make([]segment, c.opts.RandomChunks)
+	for i := range random {
+		x := rng.Float64() * total
+		w := windows[len(windows)-1]
+		for _, candidate := range windows {
+			if x <= candidate.slack {
+				w = candidate
+				break
+			}
+			x -= candidate.slack
+		}
+		// The frame limit ends the chunk, so it is not cut short by
+		// rounding of its end time
+		random[i] = segment{
+			Start:  roundTo(w.seg.Start+min(x, w.slack), 3),
+			Span:   w.seg.Span,
+			Shot:   w.seg.Shot,
+			Frames: c.opts.TargetFrames,
+		}
+	}
+	sort.Slice(random, func(i, j int) bool { return random[i].Start < random[j].Start })
+	return random, nil
+}
+
+// sourceTransforms returns the transforms applied to the segment's source
+// before scaling
+func (c *clipContext) sourceTransforms(seg segment) []Transform {
+	// Deinterlace before fps resampling drops or repeats fields
+	var transforms []Transform
+	if c.deinterlace {
+		transforms = append(transforms, DeinterlaceTransform{})
+	}
+	if c.opts.Interpolate {
+		transforms = append(transforms, InterpolateTransform{FPS: c.opts.FPS})
+	} else {
+		transforms = append(transforms, FPSTransform{FPS: c.opts.FPS})
+	}
+	if c.opts.Denoise != "" {
+		transforms = append(transforms, DenoiseTransform{Filter: c.opts.Denoise, Strength: c.opts.DenoiseStrength})
+	}
+	// Black bars are detected in the stored frames, bounding boxes are
+	// annotated on the upright frames
+	if c.boxCrop == nil && c.crop != nil {
+		transforms = append(transforms, CropTransform{
+			Width:  c.crop.Width,
+			Height: c.crop.Height,
+			X:      c.crop.X,
+			Y:      c.crop.Y,
+		})
+	}
+	transforms = append(transforms, c.rotationTransforms()...)
+	if c.boxCrop != nil {
+		transforms = append(transforms, c.boxCrop.transform(seg.Start))
+	}
+	if c.opts.Decimate {
+		transforms = append(transforms, DecimateTransform{})
+	}
+	return transforms
+}
+
+// transforms returns the full transform chain for the clip
+func (c *clipContext) transforms(seg segment) []Transform {
+	transforms := c.sourceTransforms(seg)
+	if c.view != nil && !c.view.Fit {
+		transforms = append(transforms, MultiCropTransform{
+			Width:  c.dims.Width,
+			Height: c.dims.Height,
+			X:      c.view.X,
+			Y:      c.view.Y,
+			Flip:   c.view.Flip,
+			Zoom:   c.view.Zoom,
+		})
+		if c.view.Jitter != nil {
+			transforms = append(transforms, *c.view.Jitter)
+		}
+	} else {
+		transforms = append(transforms, c.fitTransform())
+		if c.view != nil && c.view.Flip {
+			transforms = append(transforms, FlipTransform{})
+		}
+	}
+	transforms = append(transforms, c.opts.Transforms...)
+	if c.opts.ExtraFilters != "" {
+		transforms = append(transforms, FilterTransform{Filters: c.opts.ExtraFilters})
+	}
+	if c.opts.DebugOverlay {
+		transforms = append(transforms, OverlayTransform{Label: c.clip.Key, Offset: seg.Start})
+	}
+	if c.opts.ColorMatrix != ColorMatrixAuto || c.opts.ColorRange != ColorRangeAuto {
+		transforms = append(transforms, ColorConvertTransform{Matrix: c.opts.ColorMatrix, Range: c.opts.ColorRange})
+	}
+	return transforms
+}
+
+// outputArgs returns the extra ffmpeg output options required by the
+// transform chain and the segment
+func (c *clipContext) outputArgs(seg segment) ffmpeg.KwArgs {
+	kwargs := ffmpeg.KwArgs{}
+	if seg.Frames > 0 {
+		kwargs["frames:v"] = seg.Frames
+	}
+	if c.opts.Decimate {
+		// Keep the decimated frames' timestamps instead of duplicating frames to a constant rate
+		kwargs["vsync"] = "vfr"
+	}
+	return kwargs
+}
+
+// ProcessClipWithOptions extracts frames from a video clip using ffmpeg and
+// returns the outcome of the clip along with any error
+func ProcessClipWithOptions(clip types.Clip, opts Options) (ClipResult, error) {
+	start := time.Now()
+	ctx := &clipContext{clip: clip, opts: opts}
+	err := processClip(ctx)
+
+	result := ClipResult{
+		Key:             clip.Key,
+		Status:          ClipOK,
+		Chunks:          ctx.nextChunk,
+		FramesDiscarded: ctx.framesDiscarded,
+		Duration:        time.Since(start),
+	}
+	if err != nil {
+		result.Status = ClipFailed
+		result.Err = err
+	} else if ctx.skipReason != nil {
+		result.Status = ClipSkipped
+		result.Err = ctx.skipReason
+	} else if result.Chunks == 0 {
+		result.Status = ClipEmpty
+	}
+	return result, err
+}
+
+// processClip runs the full pipeline for the context's clip
+func processClip(ctx *clipContext) error {
+	opts, err := ctx.opts.withOverrides(ctx.clip.Overrides)
+	if err != nil {
+		return err
+	}
+	ctx.opts = opts
+	clip := ctx.clip
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	// Create temporary video file; keys may contain slashes, so the name
+	// is not derived from the key
+	tempVideo, err := os.CreateTemp("", "govidprep-*.mp4")
+	if err != nil {
 		return err
 	}
+	tempVideoPath := tempVideo.Name()
 	defer os.Remove(tempVideoPath)
+	_, err = tempVideo.Write(clip.RawData)
+	if closeErr := tempVideo.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
 
 	// Parse dimensions
-	dims, err := parseDimensions(size)
+	dims, err := parseDimensions(opts.Size)
 	if err != nil {
 		return err
 	}
 
-	// Process based on format
-	switch format {
-	case FormatNPY:
-		// First extract all frames
-		outPath := filepath.Join(outputDir, clip.Key)
-		if err := os.MkdirAll(outPath, 0755); err != nil {
+	if opts.AudioOnly {
+		ctx.videoPath = tempVideoPath
+		return processAudioOnly(ctx)
+	}
+
+	// Skip broken inputs before creating any output for them
+	if opts.Precheck {
+		if err := precheckInput(tempVideoPath, len(clip.RawData)); errors.Is(err, ErrCorruptInput) {
+			ctx.skipReason = err
+			return nil
+		} else if err != nil {
 			return err
 		}
+	}
+	if opts.MinFrames > 0 || opts.MinDuration > 0 {
+		if err := checkLength(tempVideoPath, opts); errors.Is(err, ErrTooShort) {
+			ctx.skipReason = err
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 
-		// Extract raw frames
-		rawData, err := extractRawFrames(tempVideoPath, dims, fps)
+	ctx.videoPath = tempVideoPath
+	ctx.dims = dims
+
+	// Chunk the selected video stream, or each video stream in turn as its
+	// own chunk set. Chunk numbers restart for every stream, so chunks of
+	// the same number cover the same source time.
+	streams := opts.streams(1)
+	if opts.AllStreams {
+		info, err := probeVideo(tempVideoPath)
+		if err != nil {
+			return err
+		}
+		streams = opts.streams(info.VideoStreams)
+	}
+	chunks := 0
+	for _, stream := range streams {
+		ctx.stream, ctx.nextChunk, ctx.crop = stream, 0, nil
+		err := processStream(ctx)
+		chunks += ctx.nextChunk
 		if err != nil {
 			return err
 		}
+	}
+	ctx.nextChunk = chunks
+	return nil
+}
 
-		// Calculate number of frames and chunks
-		frameSize := dims.Width * dims.Height * 3
-		totalFrames := len(rawData) / frameSize
-		numChunks := totalFrames / targetFrames
+// createOutput creates the output directory of the context's chunk set
+// and, in debug mode, the log capturing ffmpeg's stderr. The returned
+// function closes the log.
+func (c *clipContext) createOutput() (func(), error) {
+	c.outPath = filepath.Join(c.opts.OutputDir, c.key())
+	if err := os.MkdirAll(c.outPath, 0755); err != nil {
+		return nil, err
+	}
+	if !c.opts.Debug {
+		return func() {}, nil
+	}
+	logFile, err := os.Create(filepath.Join(c.outPath, "ffmpeg.log"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating ffmpeg log: %w", err)
+	}
+	c.debugLog = logFile
+	return func() { logFile.Close() }, nil
+}
 
-		// Process each chunk
-		for i := 0; i < numChunks; i++ {
-			// Extract chunk data
-			startFrame := i * targetFrames
-			endFrame := (i + 1) * targetFrames
-			chunkData := rawData[startFrame*frameSize : endFrame*frameSize]
+// processStream chunks the context's video stream of the clip
+func processStream(ctx *clipContext) error {
+	opts, clip := ctx.opts, ctx.clip
+	closeLog, err := ctx.createOutput()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
 
-			// Save as NumPy array
-			chunkFile := filepath.Join(outPath, fmt.Sprintf("chunk_%05d.npy", i))
-			if err := saveNumpyArray(chunkData, dims, targetFrames, chunkFile); err != nil {
-				return err
-			}
+	// Probe the source frame rate, frame count and length to record them
+	// and count the frames removed by decimation, its rotation to display
+	// it upright, its field order to deinterlace it, its size to fit the
+	// bounding-box crop, and its length to record the end of its last shot
+	// or sample it uniformly
+	ctx.deinterlace = opts.Deinterlace == DeinterlaceOn
+	info, err := probeVideoStream(ctx.videoPath, ctx.stream)
+	if err != nil {
+		return err
+	}
+	ctx.videoStreams = info.VideoStreams
+	ctx.duration = info.Duration
+	ctx.sourceFPS = roundTo(info.FrameRate, 3)
+	ctx.sourceFrames = info.Frames
+	ctx.hasAudio = info.HasAudio
+	if opts.Deinterlace == DeinterlaceAuto {
+		ctx.deinterlace = info.Interlaced
+	}
+	width, height := info.Width, info.Height
+	if !opts.NoAutoRotate {
+		ctx.rotation = info.Rotation
+		if ctx.rotation == 90 || ctx.rotation == 270 {
+			width, height = height, width
+		}
+	}
+	ctx.boxCrop = planBoxCrop(clip.Boxes, opts.boxSmoothing(), width, height,
+		float64(ctx.dims.Width)/float64(ctx.dims.Height))
 
-			// Save metadata for this chunk
-			metadata := types.ClipMetadata{
-				Key:         fmt.Sprintf("%s/chunk_%05d", clip.Key, i),
-				FPS:         fps,
-				FrameCount:  targetFrames,
-				Size:        []int{dims.Height, dims.Width},
-				OriginalFPS: fps,
-			}
-			metadataFile := filepath.Join(outPath, fmt.Sprintf("chunk_%05d_metadata.json", i))
-			if err := saveMetadata(metadata, metadataFile); err != nil {
-				return err
-			}
+	// Detect letterbox/pillarbox bars to crop before scaling; the box crop
+	// already excludes them
+	if opts.AutoCrop && ctx.boxCrop == nil {
+		ctx.crop, err = detectCrop(ctx.videoPath, ctx.stream, opts.autoCropLimit(), ctx.debugLog)
+		if err != nil {
+			return err
 		}
+	}
 
-		// Handle remaining frames if they form a complete chunk
-		remainingFrames := totalFrames % targetFrames
-		if remainingFrames == targetFrames {
-			startFrame := numChunks * targetFrames
-			endFrame := startFrame + targetFrames
-			chunkData := rawData[startFrame*frameSize : endFrame*frameSize]
+	// Find the keyframes to align chunk starts with
+	if opts.KeyframeAlign {
+		ctx.keyframes, err = probeKeyframes(ctx.videoPath, ctx.stream)
+		if err != nil {
+			return err
+		}
+	}
 
-			chunkFile := filepath.Join(outPath, fmt.Sprintf("chunk_%05d.npy", numChunks))
-			if err := saveNumpyArray(chunkData, dims, targetFrames, chunkFile); err != nil {
-				return err
-			}
+	// Extract the frames at explicit timestamps, or spread evenly over the
+	// clip, instead of chunking
+	if opts.UniformFrames > 0 && len(clip.Timestamps) == 0 {
+		if ctx.duration <= 0 {
+			return fmt.Errorf("cannot sample %d frames uniformly: unknown clip duration", opts.UniformFrames)
+		}
+		ctx.clip.Timestamps = uniformTimestamps(ctx.duration, opts.UniformFrames)
+		clip = ctx.clip
+	}
+	if len(clip.Timestamps) > 0 {
+		return processTimestamps(ctx)
+	}
 
-			metadata := types.ClipMetadata{
-				Key:         fmt.Sprintf("%s/chunk_%05d", clip.Key, numChunks),
-				FPS:         fps,
-				FrameCount:  targetFrames,
-				Size:        []int{dims.Height, dims.Width},
-				OriginalFPS: fps,
-			}
-			metadataFile := filepath.Join(outPath, fmt.Sprintf("chunk_%05d_metadata.json", numChunks))
-			return saveMetadata(metadata, metadataFile)
+	// Detect silent audio to flag or drop silent chunks
+	if opts.Silence != SilenceOff {
+		ctx.silences, err = detectSilence(ctx.videoPath, opts.silenceThresholdDB(), ctx.debugLog)
+		if err != nil {
+			return err
 		}
+	}
 
-		return nil
+	// Find the scene changes to split the clip into shots at
+	if opts.SceneSplit {
+		ctx.sceneCuts, err = detectScenes(ctx.videoPath, ctx.stream, opts.sceneThreshold(), ctx.debugLog)
+		if err != nil {
+			return err
+		}
+	}
 
-	default:
-		// For JPEG format, first extract all frames
-		outPath := filepath.Join(outputDir, clip.Key)
-		if err := os.MkdirAll(outPath, 0755); err != nil {
+	// Chunk each segment of the clip, numbering chunks consecutively
+	segments, err := ctx.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if err := processSegment(ctx, seg); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		// Extract all frames
-		err = ffmpeg.Input(tempVideoPath).
-			Output(filepath.Join(outPath, "frame_%03d.jpg"),
-				ffmpeg.KwArgs{
-					"vf": ComposeTransforms(FPSTransform{FPS: fps}, dims.ScaleTransform()),
-				}).
-			OverWriteOutput().
-			Run()
+// processSegment chunks a segment once per crop view or augmented copy.
+// Every view produces the same chunks, so chunk numbers and discard counts
+// are taken from the first view.
+func processSegment(ctx *clipContext, seg segment) error {
+	firstChunk := ctx.nextChunk
+	var discarded DiscardCounts
+	for i, view := range ctx.views(seg) {
+		ctx.view = view
+		ctx.nextChunk = firstChunk
+		var err error
+		if ctx.opts.Format.isArray() {
+			err = processNumpyChunks(ctx, seg)
+		} else {
+			err = processFrameChunks(ctx, seg)
+		}
 		if err != nil {
-			return fmt.Errorf("error extracting frames: %v", err)
+			return err
+		}
+		if i == 0 {
+			discarded = ctx.framesDiscarded
+		}
+	}
+	ctx.framesDiscarded = discarded
+	return nil
+}
+
+// chunkStarts returns the start frame of each chunk of a segment with
+// totalFrames frames: chunks one stride apart from the jitter offset, or
+// chunks aligned with keyframes, up to the clip's chunk cap
+func (c *clipContext) chunkStarts(seg segment, totalFrames int) []int {
+	target := c.opts.TargetFrames
+	var starts []int
+	if c.opts.KeyframeAlign {
+		starts = keyframeAlignedStarts(c.keyframes, seg, c.opts.FPS, target, totalFrames)
+	} else {
+		for start := c.chunkOffset(seg, totalFrames); start+target <= totalFrames; start += c.opts.stride() {
+			starts = append(starts, start)
+		}
+	}
+	return c.capChunks(starts)
+}
+
+// capChunks limits the chunk starts of a segment to the number of chunks
+// the clip may still contribute under MaxChunks: the first ones, or with
+// MaxChunksUniform the centers of equal runs of chunks
+func (c *clipContext) capChunks(starts []int) []int {
+	if c.opts.MaxChunks == 0 {
+		return starts
+	}
+	remaining := max(0, c.opts.MaxChunks-c.nextChunk)
+	if len(starts) <= remaining {
+		return starts
+	}
+	if !c.opts.MaxChunksUniform {
+		return starts[:remaining]
+	}
+	capped := make([]int, remaining)
+	for i := range capped {
+		capped[i] = starts[(2*i+1)*len(starts)/(2*remaining)]
+	}
+	return capped
+}
+
+// countDiscarded adds the frames of a segment with totalFrames frames that
+// are in no written chunk to the discard counts: as silent if they are in a
+// chunk dropped for silent audio, otherwise as remainder. Frames shared by
+// overlapping chunks are counted once.
+func (c *clipContext) countDiscarded(totalFrames int, starts []int, dropped []bool) {
+	const (
+		unused = iota
+		inDropped
+		inWritten
+	)
+	use := make([]int, totalFrames)
+	for k, start := range starts {
+		state := inWritten
+		if dropped[k] {
+			state = inDropped
+		}
+		for i := start; i < start+c.opts.TargetFrames; i++ {
+			use[i] = max(use[i], state)
+		}
+	}
+	for _, state := range use {
+		switch state {
+		case unused:
+			c.framesDiscarded.Remainder++
+		case inDropped:
+			c.framesDiscarded.Silent++
+		}
+	}
+}
+
+// chunkOffset returns the frame at which the first chunk of a segment with
+// totalFrames frames starts. With chunk jitter this is a random offset below
+// one chunk length, or one stride if shorter, seeded by the clip key and
+// segment so every run and every crop view produce the same chunks;
+// otherwise it is zero. The offset is capped so that at least one chunk
+// still fits.
+func (c *clipContext) chunkOffset(seg segment, totalFrames int) int {
+	target := c.opts.TargetFrames
+	if !c.opts.ChunkJitter || totalFrames <= target {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s/%g", c.clip.Key, seg.Start)
+	rng := rand.New(rand.NewSource(c.opts.Seed ^ int64(h.Sum64())))
+	// Overlapping chunks repeat every stride, so a longer offset would only
+	// drop the first chunk
+	return rng.Intn(min(target, c.opts.stride(), totalFrames-target+1))
+}
+
+// chunkName returns the name of a chunk of the current crop view
+func (c *clipContext) chunkName(chunkIdx int) string {
+	if c.view == nil {
+		return c.opts.chunkName(chunkIdx)
+	}
+	return c.opts.chunkName(chunkIdx) + "_" + c.view.Name
+}
+
+// countDecimated records the frames of a segment removed by mpdecimate, given
+// the number of frames that remained after decimation
+func (c *clipContext) countDecimated(seg segment, kept int) {
+	if !c.opts.Decimate || c.duration <= 0 {
+		return
+	}
+	end := c.duration
+	if seg.End > 0 && seg.End < end {
+		end = seg.End
+	}
+	expected := int(math.Round((end - seg.Start) * float64(c.opts.FPS)))
+	if expected > kept {
+		c.framesDiscarded.Decimated += expected - kept
+	}
+}
+
+// chunkSilent reports whether the audio over frames [start, end) of the segment is silent
+func (c *clipContext) chunkSilent(seg segment, start, end int) bool {
+	fps := float64(c.opts.FPS)
+	return isSilent(c.silences, seg.Start+float64(start)/fps, seg.Start+float64(end)/fps)
+}
+
+// chunkLabels maps the clip's dense labels onto frames [start, end) of the
+// segment, returning the per-frame labels and the majority label
+func (c *clipContext) chunkLabels(seg segment, start, end int) ([]string, string) {
+	fps := float64(c.opts.FPS)
+	times := make([]float64, 0, end-start)
+	for i := start; i < end; i++ {
+		times = append(times, seg.Start+float64(i)/fps)
+	}
+	return c.labelsAt(times)
+}
+
+// labelsAt maps the clip's dense labels onto frames at the given times,
+// returning the per-frame labels and the majority label. The clip's own
+// label is used when it has no dense labels or none cover the frames.
+func (c *clipContext) labelsAt(times []float64) ([]string, string) {
+	if c.clip.DenseLabels == nil {
+		return nil, c.clip.Label
+	}
+
+	frameLabels := make([]string, 0, len(times))
+	counts := make(map[string]int)
+	majority := ""
+	for _, t := range times {
+		label := c.clip.DenseLabels.At(t)
+		frameLabels = append(frameLabels, label)
+		if label == "" {
+			continue
+		}
+		counts[label]++
+		// Ties go to the label that reached the count first
+		if counts[label] > counts[majority] {
+			majority = label
 		}
+	}
+	if majority == "" {
+		majority = c.clip.Label
+	}
+	return frameLabels, majority
+}
+
+// chunkMetadata builds the metadata record for a single chunk
+func (c *clipContext) chunkMetadata(chunkIdx int, seg segment) types.ClipMetadata {
+	metadata := types.ClipMetadata{
+		Key:            c.key() + "/" + c.chunkName(chunkIdx),
+		FPS:            c.opts.FPS,
+		FrameCount:     c.opts.TargetFrames,
+		Size:           []int{c.dims.Height, c.dims.Width},
+		OriginalFPS:    c.sourceFPS,
+		SourceFrames:   c.sourceFrames,
+		SourceDuration: roundTo(c.duration, 3),
+		Crop:           c.crop,
+		Decimated:      c.opts.Decimate,
+		Deinterlaced:   c.deinterlace,
+		ColorMatrix:    string(c.opts.ColorMatrix),
+		ColorRange:     string(c.opts.ColorRange),
+		Span:           seg.Span,
+		Shot:           seg.Shot,
+		Caption:        c.caption(),
+	}
+	if c.opts.bitDepth() != 8 {
+		metadata.BitDepth = c.opts.bitDepth()
+	}
+	if c.videoStreams > 1 {
+		stream := c.stream
+		metadata.VideoStream = &stream
+	}
+	if c.view != nil {
+		metadata.BaseKey = c.key() + "/" + c.opts.chunkName(chunkIdx)
+		metadata.CropView = c.view.Name
+	}
+	return metadata
+}
+
+// applyQuality records the average quality of frames [start, end) in metadata
+func applyQuality(metadata *types.ClipMetadata, scores []frameQuality, start, end int) {
+	if start >= len(scores) {
+		return
+	}
+	if end > len(scores) {
+		end = len(scores)
+	}
+	avg := averageQuality(scores[start:end])
+	metadata.PSNR = avg.PSNR
+	metadata.SSIM = avg.SSIM
+	metadata.VMAF = avg.VMAF
+}
+
+// processNumpyChunks extracts raw frames from a segment and saves each complete chunk as a NumPy array
+func processNumpyChunks(ctx *clipContext, seg segment) error {
+	opts := ctx.opts
+
+	// Extract raw frames
+	rawData, err := ctx.extractRawFrames(seg)
+	if err != nil {
+		return err
+	}
 
-		// Get list of extracted frames
-		files, err := os.ReadDir(outPath)
+	var scores []frameQuality
+	if opts.qualityMetrics().any() {
+		scores, err = ctx.measureQuality(seg, "")
 		if err != nil {
-			return fmt.Errorf("error reading output directory: %v", err)
+			return err
 		}
+	}
 
-		// Filter for only jpg files and sort them
-		var frameFiles []string
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".jpg") {
-				frameFiles = append(frameFiles, file.Name())
-			}
+	// Calculate number of frames and chunks
+	frameSize := opts.pixelFormat().frameSize(ctx.dims)
+	totalFrames := len(rawData) / frameSize
+	starts := ctx.chunkStarts(seg, totalFrames)
+	augmentation := ctx.augmentation(seg, totalFrames)
+
+	// Process each chunk
+	dropped := make([]bool, len(starts))
+	for k, startFrame := range starts {
+		// Extract chunk data
+		endFrame := startFrame + opts.TargetFrames
+		silent := ctx.chunkSilent(seg, startFrame, endFrame)
+		if silent && opts.Silence == SilenceDrop {
+			dropped[k] = true
+			continue
 		}
-		sort.Strings(frameFiles)
+		chunkData := rawData[startFrame*frameSize : endFrame*frameSize]
+		chunkIdx := ctx.nextChunk
+		ctx.nextChunk++
 
-		// Calculate number of complete chunks
-		totalFrames := len(frameFiles)
-		numChunks := totalFrames / targetFrames
+		// Preview the frames before they are normalized
+		var preview string
+		if opts.Preview != PreviewOff {
+			preview = ctx.chunkName(chunkIdx) + "_preview." + string(opts.Preview)
+			if err := ctx.saveRawPreview(chunkData, filepath.Join(ctx.outPath, preview)); err != nil {
+				return err
+			}
+		}
 
-		// Process each chunk
-		for i := 0; i < numChunks; i++ {
-			// Create chunk directory
-			chunkDir := filepath.Join(outPath, fmt.Sprintf("chunk_%05d", i))
-			if err := os.MkdirAll(chunkDir, 0755); err != nil {
+		var audio string
+		if opts.Audio != AudioOff && ctx.hasAudio {
+			audio = ctx.chunkName(chunkIdx) + "_audio." + string(opts.Audio)
+			if err := ctx.saveChunkAudio(seg, startFrame, endFrame, filepath.Join(ctx.outPath, audio)); err != nil {
 				return err
 			}
+		}
+
+		var motion *types.Motion
+		if opts.MotionStats {
+			motion = chunkMotion(chunkData, frameSize, opts.pixelFormat().bytesPerSample(), opts.staticThreshold())
+		}
+
+		// Encode the samples, converting to float32 if requested
+		chunkData = opts.encodeSamples(chunkData, ctx.dims)
+
+		// Save the chunk with its metadata
+		metadata := ctx.chunkMetadata(chunkIdx, seg)
+		metadata.Silent = silent
+		metadata.FrameLabels, metadata.Label = ctx.chunkLabels(seg, startFrame, endFrame)
+		metadata.DType = string(opts.numpyDType())
+		metadata.PixelFormat = string(opts.pixelFormat())
+		metadata.Layout = string(opts.layout())
+		metadata.Normalization = opts.Normalize
+		metadata.Augmentation = augmentation
+		metadata.Preview = preview
+		metadata.Audio = audio
+		metadata.Motion = motion
+		applyQuality(&metadata, scores, startFrame, endFrame)
+		if err := ctx.saveNumpyChunk(ctx.chunkName(chunkIdx), chunkData, opts.TargetFrames, metadata); err != nil {
+			return err
+		}
+		if err := ctx.saveSidecars(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_sidecar")); err != nil {
+			return err
+		}
+		if err := ctx.saveCaption(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_caption.txt")); err != nil {
+			return err
+		}
+	}
+	ctx.countDiscarded(totalFrames, starts, dropped)
+	ctx.countDecimated(seg, totalFrames)
+
+	return nil
+}
+
+// processFrameChunks extracts image frames from a segment and moves each complete chunk into its own directory
+func processFrameChunks(ctx *clipContext, seg segment) error {
+	opts, outPath := ctx.opts, ctx.outPath
+
+	// Extract all frames
+	if err := ctx.saveFrames(seg); err != nil {
+		return fmt.Errorf("error extracting frames: %w", err)
+	}
 
-			// Move frames for this chunk
-			startIdx := i * targetFrames
-			endIdx := (i + 1) * targetFrames
-			for j, frameFile := range frameFiles[startIdx:endIdx] {
-				oldPath := filepath.Join(outPath, frameFile)
-				newPath := filepath.Join(chunkDir, fmt.Sprintf("frame_%03d.jpg", j+1))
-				if err := os.Rename(oldPath, newPath); err != nil {
-					return fmt.Errorf("error moving frame %s: %v", frameFile, err)
+	// Get list of extracted frames
+	files, err := os.ReadDir(outPath)
+	if err != nil {
+		return fmt.Errorf("error reading output directory: %w", err)
+	}
+
+	// Filter for only frame files and sort them
+	ext := "." + string(opts.Format)
+	var frameFiles []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ext) {
+			frameFiles = append(frameFiles, file.Name())
+		}
+	}
+	sort.Strings(frameFiles)
+
+	var scores []frameQuality
+	if opts.qualityMetrics().any() {
+		scores, err = ctx.measureQuality(seg, filepath.Join(outPath, extractPattern+ext))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Calculate number of complete chunks
+	totalFrames := len(frameFiles)
+	starts := ctx.chunkStarts(seg, totalFrames)
+	augmentation := ctx.augmentation(seg, totalFrames)
+
+	// Silent chunks are dropped before moving frames, so frames shared with
+	// a later written chunk are known when moving them
+	dropped := make([]bool, len(starts))
+	lastUse := make([]int, totalFrames)
+	for i := range lastUse {
+		lastUse[i] = -1
+	}
+	for k, startIdx := range starts {
+		endIdx := startIdx + opts.TargetFrames
+		if opts.Silence == SilenceDrop && ctx.chunkSilent(seg, startIdx, endIdx) {
+			dropped[k] = true
+			continue
+		}
+		for i := startIdx; i < endIdx; i++ {
+			lastUse[i] = k
+		}
+	}
+	moved := make([]bool, totalFrames)
+
+	// Process each chunk
+	for k, startIdx := range starts {
+		if dropped[k] {
+			continue
+		}
+		endIdx := startIdx + opts.TargetFrames
+		silent := ctx.chunkSilent(seg, startIdx, endIdx)
+		chunkIdx := ctx.nextChunk
+		ctx.nextChunk++
+
+		// Create chunk directory
+		chunkDir := filepath.Join(outPath, ctx.chunkName(chunkIdx))
+		if err := os.MkdirAll(chunkDir, 0755); err != nil {
+			return err
+		}
+
+		// Move frames for this chunk, copying those a later overlapping
+		// chunk also needs
+		for j, frameFile := range frameFiles[startIdx:endIdx] {
+			oldPath := filepath.Join(outPath, frameFile)
+			newPath := filepath.Join(chunkDir, opts.frameName(j)+ext)
+			if lastUse[startIdx+j] > k {
+				if err := copyFile(oldPath, newPath); err != nil {
+					return fmt.Errorf("error copying frame %s: %w", frameFile, err)
 				}
+				continue
 			}
-
-			// Save metadata for this chunk
-			metadata := types.ClipMetadata{
-				Key:         fmt.Sprintf("%s/chunk_%05d", clip.Key, i),
-				FPS:         fps,
-				FrameCount:  targetFrames,
-				Size:        []int{dims.Height, dims.Width},
-				OriginalFPS: fps,
+			if err := os.Rename(oldPath, newPath); err != nil {
+				return fmt.Errorf("error moving frame %s: %w", frameFile, err)
 			}
-			if err := saveMetadata(metadata, filepath.Join(chunkDir, "metadata.json")); err != nil {
+			moved[startIdx+j] = true
+		}
+
+		var preview string
+		if opts.Preview != PreviewOff {
+			preview = "preview." + string(opts.Preview)
+			if err := ctx.saveFramesPreview(chunkDir, filepath.Join(chunkDir, preview)); err != nil {
 				return err
 			}
 		}
 
-		// Handle remaining frames if they form a complete chunk
-		remainingFrames := totalFrames % targetFrames
-		if remainingFrames == targetFrames {
-			chunkDir := filepath.Join(outPath, fmt.Sprintf("chunk_%05d", numChunks))
-			if err := os.MkdirAll(chunkDir, 0755); err != nil {
+		var audio string
+		if opts.Audio != AudioOff && ctx.hasAudio {
+			audio = "audio." + string(opts.Audio)
+			if err := ctx.saveChunkAudio(seg, startIdx, endIdx, filepath.Join(chunkDir, audio)); err != nil {
 				return err
 			}
+		}
 
-			startIdx := numChunks * targetFrames
-			endIdx := startIdx + targetFrames
-			for j, frameFile := range frameFiles[startIdx:endIdx] {
-				oldPath := filepath.Join(outPath, frameFile)
-				newPath := filepath.Join(chunkDir, fmt.Sprintf("frame_%03d.jpg", j+1))
-				if err := os.Rename(oldPath, newPath); err != nil {
-					return fmt.Errorf("error moving frame %s: %v", frameFile, err)
-				}
+		// Save metadata for this chunk
+		metadata := ctx.chunkMetadata(chunkIdx, seg)
+		metadata.Silent = silent
+		metadata.FrameLabels, metadata.Label = ctx.chunkLabels(seg, startIdx, endIdx)
+		metadata.Augmentation = augmentation
+		metadata.Preview = preview
+		metadata.Audio = audio
+		if opts.MotionStats {
+			paths := make([]string, opts.TargetFrames)
+			for j := range paths {
+				paths[j] = filepath.Join(chunkDir, opts.frameName(j)+ext)
 			}
-
-			metadata := types.ClipMetadata{
-				Key:         fmt.Sprintf("%s/chunk_%05d", clip.Key, numChunks),
-				FPS:         fps,
-				FrameCount:  targetFrames,
-				Size:        []int{dims.Height, dims.Width},
-				OriginalFPS: fps,
+			if metadata.Motion, err = imageMotion(paths, opts.staticThreshold()); err != nil {
+				return err
 			}
-			return saveMetadata(metadata, filepath.Join(chunkDir, "metadata.json"))
 		}
+		applyQuality(&metadata, scores, startIdx, endIdx)
+		metadataFile := filepath.Join(chunkDir, "metadata."+opts.MetadataFormat.Ext())
+		if err := saveMetadata(metadata, metadataFile, opts.MetadataFormat); err != nil {
+			return err
+		}
+		if err := ctx.saveSidecars(filepath.Join(chunkDir, "sidecar")); err != nil {
+			return err
+		}
+		if err := ctx.saveCaption(filepath.Join(chunkDir, "caption.txt")); err != nil {
+			return err
+		}
+	}
 
-		// Clean up any remaining frames that don't form a complete chunk
-		for _, frameFile := range frameFiles[numChunks*targetFrames:] {
-			oldPath := filepath.Join(outPath, frameFile)
-			if err := os.Remove(oldPath); err != nil {
-				return fmt.Errorf("error removing incomplete frame %s: %v", frameFile, err)
-			}
+	// Clean up frames skipped by the jitter offset, stride or keyframe
+	// alignment, of silent chunks, or that don't form a complete chunk
+	ctx.countDiscarded(totalFrames, starts, dropped)
+	ctx.countDecimated(seg, totalFrames)
+	for i, frameFile := range frameFiles {
+		if moved[i] {
+			continue
 		}
+		oldPath := filepath.Join(outPath, frameFile)
+		if err := os.Remove(oldPath); err != nil {
+			return fmt.Errorf("error removing incomplete frame %s: %w", frameFile, err)
+		}
+	}
 
-		return nil
+	return nil
+}
+
+// copyFile copies the file at src to dst
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(dst, data, 0644)
 }
 
 // ProcessClips processes multiple video clips in parallel
-func ProcessClips(clips []types.Clip, outputDir string, fps int, size string, format OutputFormat, targetFrames int, numWorkers int) error {
+func ProcessClips(clips []types.Clip, outputDir string, fps int, size string, format OutputFormat, targetFrames int, numWorkers int) ([]ClipResult, error) {
+	return ProcessClipsWithOptions(clips, Options{
+		OutputDir:    outputDir,
+		FPS:          fps,
+		Size:         size,
+		Format:       format,
+		TargetFrames: targetFrames,
+	}, numWorkers)
+}
+
+// ProcessClipsWithOptions processes multiple video clips in parallel. It
+// returns one result per clip, in input order, and an aggregate of the
+// per-clip errors.
+func ProcessClipsWithOptions(clips []types.Clip, opts Options, numWorkers int) ([]ClipResult, error) {
+	stream := make(chan types.Clip)
+	go func() {
+		for _, clip := range clips {
+			stream <- clip
+		}
+		close(stream)
+	}()
+	return ProcessClipStream(stream, opts, numWorkers)
+}
+
+// ProcessClipStream processes the clips received from clips in parallel until
+// it is closed. Clips are handed to workers as they arrive and are not
+// retained, so with an unbuffered channel at most one clip beyond those being
+// processed is held in memory. It returns one result per clip, in arrival
+// order, and an aggregate of the per-clip errors.
+func ProcessClipStream(clips <-chan types.Clip, opts Options, numWorkers int) ([]ClipResult, error) {
 	if numWorkers <= 0 {
 		numWorkers = 4 // Default number of workers
 	}
 
-	// Create channels for work distribution and error collection
-	jobs := make(chan types.Clip, len(clips))
-	errors := make(chan error, len(clips))
+	type job struct {
+		idx  int
+		clip types.Clip
+	}
+
+	// Create channels for work distribution; results and errors are
+	// collected under mu since the number of clips is not known upfront
+	jobs := make(chan job)
+	var mu sync.Mutex
+	var results []ClipResult
+	var errs []error
 	var wg sync.WaitGroup
 
+	// Scale the number of active workers to stay under the memory limit
+	governor := newMemoryGovernor(opts.MemoryLimit, numWorkers)
+	done := make(chan struct{})
+	go governor.monitor(done)
+	defer close(done)
+
 	// Start worker goroutines
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for clip := range jobs {
-				if err := ProcessClip(clip, outputDir, fps, size, format, targetFrames); err != nil {
-					errors <- fmt.Errorf("error processing %s: %v", clip.Key, err)
+			for {
+				governor.acquire()
+				j, ok := <-jobs
+				if !ok {
+					governor.release()
+					return
 				}
+				result, err := ProcessClipWithOptions(j.clip, opts)
+				if opts.OnResult != nil {
+					opts.OnResult(result)
+				}
+				mu.Lock()
+				results[j.idx] = result
+				if err != nil {
+					errs = append(errs, &ClipError{Key: j.clip.Key, Err: err})
+				}
+				mu.Unlock()
+				governor.release()
 			}
 		}()
 	}
 
-	// Send jobs to workers
-	for _, clip := range clips {
-		jobs <- clip
+	// Send jobs to workers as clips arrive
+	for clip := range clips {
+		mu.Lock()
+		idx := len(results)
+		results = append(results, ClipResult{})
+		mu.Unlock()
+		jobs <- job{idx: idx, clip: clip}
 	}
 	close(jobs)
 
 	// Wait for all workers to finish
 	wg.Wait()
-	close(errors)
-
-	// Collect any errors
-	var errs []error
-	for err := range errors {
-		errs = append(errs, err)
-	}
 
 	// Return combined errors if any occurred
 	if len(errs) > 0 {
-		return fmt.Errorf("encountered %d errors: %v", len(errs), errs)
+		return results, fmt.Errorf("encountered %d errors: %w", len(errs), errors.Join(errs...))
 	}
-	return nil
+	return results, nil
 }
@@ -1,14 +1,26 @@
 package processor
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+	"github.com/melody-ding/go-vidprep/internal/numpy"
 	"github.com/melody-ding/go-vidprep/internal/types"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
 // createTestVideo creates a small test video file using ffmpeg
@@ -84,6 +96,1802 @@ func TestParseDimensions(t *testing.T) {
 	}
 }
 
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{
+			name:    "default bit depth",
+			opts:    Options{Format: FormatJPEG},
+			wantErr: false,
+		},
+		{
+			name:    "16-bit png",
+			opts:    Options{Format: FormatPNG, BitDepth: 16},
+			wantErr: false,
+		},
+		{
+			name:    "16-bit npy",
+			opts:    Options{Format: FormatNPY, BitDepth: 16},
+			wantErr: false,
+		},
+		{
+			name:    "16-bit jpeg",
+			opts:    Options{Format: FormatJPEG, BitDepth: 16},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported bit depth",
+			opts:    Options{Format: FormatNPY, BitDepth: 12},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported format",
+			opts:    Options{Format: "gif"},
+			wantErr: true,
+		},
+		{
+			name:    "normalized npy",
+			opts:    Options{Format: FormatNPY, Normalize: &types.Normalization{Mean: []float64{0.5, 0.5, 0.5}, Std: []float64{0.25, 0.25, 0.25}}},
+			wantErr: false,
+		},
+		{
+			name:    "normalized jpeg",
+			opts:    Options{Format: FormatJPEG, Normalize: &types.Normalization{Mean: []float64{0.5, 0.5, 0.5}, Std: []float64{0.25, 0.25, 0.25}}},
+			wantErr: true,
+		},
+		{
+			name:    "normalization with zero std",
+			opts:    Options{Format: FormatNPY, Normalize: &types.Normalization{Mean: []float64{0.5, 0.5, 0.5}, Std: []float64{0.25, 0, 0.25}}},
+			wantErr: true,
+		},
+		{
+			name:    "multi-crop with quality metrics",
+			opts:    Options{Format: FormatJPEG, MultiCrop: MultiCropThree, QualityMetrics: true},
+			wantErr: true,
+		},
+		{
+			name:    "custom frame pattern",
+			opts:    Options{Format: FormatJPEG, FramePattern: "img%05d"},
+			wantErr: false,
+		},
+		{
+			name:    "frame pattern without verb",
+			opts:    Options{Format: FormatJPEG, FramePattern: "frame"},
+			wantErr: true,
+		},
+		{
+			name:    "frame pattern with two verbs",
+			opts:    Options{Format: FormatJPEG, FramePattern: "%d_%d"},
+			wantErr: true,
+		},
+		{
+			name:    "negative box smoothing",
+			opts:    Options{Format: FormatJPEG, BoxSmoothing: -1},
+			wantErr: true,
+		},
+		{
+			name:    "keyframe alignment with decimation",
+			opts:    Options{Format: FormatJPEG, KeyframeAlign: true, Decimate: true},
+			wantErr: true,
+		},
+		{
+			name:    "augmented copies",
+			opts:    Options{Format: FormatJPEG, AugCopies: 2},
+			wantErr: false,
+		},
+		{
+			name:    "augmented copies with 16-bit output",
+			opts:    Options{Format: FormatPNG, AugCopies: 2, BitDepth: 16},
+			wantErr: true,
+		},
+		{
+			name:    "augmented copies with multi-crop",
+			opts:    Options{Format: FormatJPEG, AugCopies: 2, MultiCrop: MultiCropTen},
+			wantErr: true,
+		},
+		{
+			name:    "center crop",
+			opts:    Options{Format: FormatJPEG, Crop: CropCenter},
+			wantErr: false,
+		},
+		{
+			name:    "center crop with multi-crop",
+			opts:    Options{Format: FormatJPEG, Crop: CropCenter, MultiCrop: MultiCropThree},
+			wantErr: true,
+		},
+		{
+			name:    "random crop with augmented copies",
+			opts:    Options{Format: FormatJPEG, Crop: CropRandom, AugCopies: 2},
+			wantErr: true,
+		},
+		{
+			name:    "flipped copies with multi-crop",
+			opts:    Options{Format: FormatJPEG, EmitFlipped: true, MultiCrop: MultiCropTen},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported deinterlace mode",
+			opts:    Options{Format: FormatJPEG, Deinterlace: "bwdif"},
+			wantErr: true,
+		},
+		{
+			name:    "interpolation with decimation",
+			opts:    Options{Format: FormatJPEG, Interpolate: true, Decimate: true},
+			wantErr: true,
+		},
+		{
+			name:    "autocrop limit out of range",
+			opts:    Options{Format: FormatJPEG, AutoCrop: true, AutoCropLimit: 300},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported denoise filter",
+			opts:    Options{Format: FormatJPEG, Denoise: "atadenoise"},
+			wantErr: true,
+		},
+		{
+			name:    "negative denoise strength",
+			opts:    Options{Format: FormatJPEG, Denoise: DenoiseNLMeans, DenoiseStrength: -1},
+			wantErr: true,
+		},
+		{
+			name:    "jpeg quality",
+			opts:    Options{Format: FormatJPEG, JPEGQuality: 2},
+			wantErr: false,
+		},
+		{
+			name:    "jpeg quality out of range",
+			opts:    Options{Format: FormatJPEG, JPEGQuality: 1},
+			wantErr: true,
+		},
+		{
+			name:    "jpeg quality for png",
+			opts:    Options{Format: FormatPNG, JPEGQuality: 5},
+			wantErr: true,
+		},
+		{
+			name:    "channels-first float32 npz",
+			opts:    Options{Format: FormatNPZ, Layout: LayoutTCHW, DType: DTypeFloat32},
+			wantErr: false,
+		},
+		{
+			name:    "16-bit pt",
+			opts:    Options{Format: FormatPT, BitDepth: 16},
+			wantErr: false,
+		},
+		{
+			name:    "float32 npy",
+			opts:    Options{Format: FormatNPY, DType: DTypeFloat32},
+			wantErr: false,
+		},
+		{
+			name:    "float32 png",
+			opts:    Options{Format: FormatPNG, DType: DTypeFloat32},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported dtype",
+			opts:    Options{Format: FormatNPY, DType: "float16"},
+			wantErr: true,
+		},
+		{
+			name:    "channels-first npy",
+			opts:    Options{Format: FormatNPY, Layout: LayoutTCHW},
+			wantErr: false,
+		},
+		{
+			name:    "channels-first jpg",
+			opts:    Options{Format: FormatJPEG, Layout: LayoutTCHW},
+			wantErr: true,
+		},
+		{
+			name:    "channels-first yuv420p",
+			opts:    Options{Format: FormatNPY, Layout: LayoutTCHW, PixelFormat: PixFmtYUV420P},
+			wantErr: true,
+		},
+		{
+			name:    "webp preview",
+			opts:    Options{Format: FormatJPEG, Preview: PreviewWebP, PreviewWidth: 96},
+			wantErr: false,
+		},
+		{
+			name:    "unsupported preview format",
+			opts:    Options{Format: FormatJPEG, Preview: "mp4"},
+			wantErr: true,
+		},
+		{
+			name:    "negative preview width",
+			opts:    Options{Format: FormatJPEG, Preview: PreviewGIF, PreviewWidth: -1},
+			wantErr: true,
+		},
+		{
+			name:    "flac audio",
+			opts:    Options{Format: FormatNPY, Audio: AudioFLAC, AudioSampleRate: 48000},
+			wantErr: false,
+		},
+		{
+			name:    "all streams",
+			opts:    Options{Format: FormatNPY, AllStreams: true},
+			wantErr: false,
+		},
+		{
+			name:    "static threshold above 1",
+			opts:    Options{Format: FormatJPEG, MotionStats: true, StaticThreshold: 2},
+			wantErr: true,
+		},
+		{
+			name:    "audio only",
+			opts:    Options{Format: FormatNPY, AudioOnly: true, Audio: AudioWAV},
+			wantErr: false,
+		},
+		{
+			name:    "audio only jpg",
+			opts:    Options{Format: FormatJPEG, AudioOnly: true},
+			wantErr: true,
+		},
+		{
+			name:    "audio only with previews",
+			opts:    Options{Format: FormatNPY, AudioOnly: true, Preview: PreviewGIF},
+			wantErr: true,
+		},
+		{
+			name:    "negative video stream",
+			opts:    Options{Format: FormatJPEG, VideoStream: -1},
+			wantErr: true,
+		},
+		{
+			name:    "video stream with all streams",
+			opts:    Options{Format: FormatJPEG, VideoStream: 1, AllStreams: true},
+			wantErr: true,
+		},
+		{
+			name:    "scene split with all streams",
+			opts:    Options{Format: FormatJPEG, AllStreams: true, SceneSplit: true},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported audio format",
+			opts:    Options{Format: FormatJPEG, Audio: "mp3"},
+			wantErr: true,
+		},
+		{
+			name:    "audio with decimation",
+			opts:    Options{Format: FormatJPEG, Audio: AudioWAV, Decimate: true},
+			wantErr: true,
+		},
+		{
+			name:    "gray npy",
+			opts:    Options{Format: FormatNPY, PixelFormat: PixFmtGray},
+			wantErr: false,
+		},
+		{
+			name:    "rgb48 npy",
+			opts:    Options{Format: FormatNPY, PixelFormat: PixFmtRGB48, BitDepth: 8},
+			wantErr: false,
+		},
+		{
+			name:    "pixel format for jpeg",
+			opts:    Options{Format: FormatJPEG, PixelFormat: PixFmtBGR24},
+			wantErr: true,
+		},
+		{
+			name:    "16-bit gray",
+			opts:    Options{Format: FormatNPY, PixelFormat: PixFmtGray, BitDepth: 16},
+			wantErr: true,
+		},
+		{
+			name:    "normalized yuv420p",
+			opts:    Options{Format: FormatNPY, PixelFormat: PixFmtYUV420P, Normalize: &types.Normalization{Mean: []float64{0.5, 0.5, 0.5}, Std: []float64{0.25, 0.25, 0.25}}},
+			wantErr: true,
+		},
+		{
+			name:    "yuv420p with odd size",
+			opts:    Options{Format: FormatNPY, PixelFormat: PixFmtYUV420P, Size: "225x224"},
+			wantErr: true,
+		},
+		{
+			name:    "random chunks with keyframe alignment",
+			opts:    Options{Format: FormatJPEG, RandomChunks: 4, KeyframeAlign: true},
+			wantErr: true,
+		},
+		{
+			name:    "negative chunk cap",
+			opts:    Options{Format: FormatJPEG, MaxChunks: -1},
+			wantErr: true,
+		},
+		{
+			name:    "negative chunk seconds",
+			opts:    Options{Format: FormatJPEG, ChunkSeconds: -2},
+			wantErr: true,
+		},
+		{
+			name:    "stride with keyframe alignment",
+			opts:    Options{Format: FormatJPEG, Stride: 8, KeyframeAlign: true},
+			wantErr: true,
+		},
+		{
+			name:    "negative uniform frames",
+			opts:    Options{Format: FormatJPEG, UniformFrames: -8},
+			wantErr: true,
+		},
+		{
+			name:    "positive silence threshold",
+			opts:    Options{Format: FormatJPEG, Silence: SilenceFlag, SilenceThresholdDB: 3},
+			wantErr: true,
+		},
+		{
+			name:    "scene threshold above 1",
+			opts:    Options{Format: FormatJPEG, SceneSplit: true, SceneThreshold: 30},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported color matrix",
+			opts:    Options{Format: FormatJPEG, ColorMatrix: "bt2020"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported color range",
+			opts:    Options{Format: FormatJPEG, ColorRange: "tv"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported pixel format",
+			opts:    Options{Format: FormatNPY, PixelFormat: "nv12"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported crop mode",
+			opts:    Options{Format: FormatJPEG, Crop: "corner"},
+			wantErr: true,
+		},
+		{
+			name:    "cbor metadata",
+			opts:    Options{Format: FormatNPY, MetadataFormat: metaformat.CBOR},
+			wantErr: false,
+		},
+		{
+			name:    "unsupported metadata format",
+			opts:    Options{Format: FormatNPY, MetadataFormat: "yaml"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseProbeRotation(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   int
+	}{
+		{name: "none", stream: `{"codec_type": "video"}`, want: 0},
+		{name: "portrait display matrix", stream: `{"codec_type": "video", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]}`, want: 90},
+		{name: "upside down display matrix", stream: `{"codec_type": "video", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": 180}]}`, want: 180},
+		{name: "counterclockwise display matrix", stream: `{"codec_type": "video", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": 90}]}`, want: 270},
+		{name: "legacy rotate tag", stream: `{"codec_type": "video", "tags": {"rotate": "90"}}`, want: 90},
+		{name: "other side data", stream: `{"codec_type": "video", "side_data_list": [{"side_data_type": "Stereo 3D"}]}`, want: 0},
+	}
+	for _, tt := range tests {
+		info, err := parseProbeOutput([]byte(`{"streams": [` + tt.stream + `]}`))
+		if err != nil {
+			t.Fatalf("%s: parseProbeOutput() error = %v", tt.name, err)
+		}
+		if info.Rotation != tt.want {
+			t.Errorf("%s: rotation = %d, want %d", tt.name, info.Rotation, tt.want)
+		}
+	}
+
+	ctx := &clipContext{
+		opts:     Options{FPS: 10},
+		dims:     Dimensions{Width: 64, Height: 48},
+		crop:     &types.CropRegion{Width: 100, Height: 80, X: 10, Y: 0},
+		rotation: 90,
+	}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "fps=10,crop=100:80:10:0,transpose=clock,scale=64:48"; got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+}
+
+func TestVideoStreams(t *testing.T) {
+	probe := []byte(`{"streams": [
+		{"codec_type": "video", "width": 640, "height": 480},
+		{"codec_type": "audio"},
+		{"codec_type": "video", "width": 320, "height": 240}
+	]}`)
+	info, err := parseProbeStream(probe, 1)
+	if err != nil {
+		t.Fatalf("parseProbeStream() error = %v", err)
+	}
+	if info.Width != 320 || info.VideoStreams != 2 || !info.HasAudio {
+		t.Errorf("stream 1 = %dpx wide, %d video streams, audio %v, want 320, 2, true", info.Width, info.VideoStreams, info.HasAudio)
+	}
+	if _, err := parseProbeStream(probe, 2); err == nil {
+		t.Error("parseProbeStream() of a missing stream succeeded, want error")
+	}
+
+	ctx := &clipContext{clip: types.Clip{Key: "rig"}, videoPath: "rig.mkv", stream: 1, videoStreams: 2}
+	args := strings.Join(ctx.videoInput(segment{Start: 2}).Output("out", ffmpeg.KwArgs{"f": "null"}).GetArgs(), " ")
+	if want := "-noautorotate -ss 2 -i rig.mkv -map 0:v:1 -f null out"; args != want {
+		t.Errorf("videoInput() args = %s, want %s", args, want)
+	}
+	if key := ctx.key(); key != "rig" {
+		t.Errorf("key() = %s, want rig", key)
+	}
+	ctx.opts.AllStreams = true
+	if key := ctx.key(); key != "rig/stream_1" {
+		t.Errorf("key() with all streams = %s, want rig/stream_1", key)
+	}
+	metadata := ctx.chunkMetadata(0, segment{})
+	if metadata.Key != "rig/stream_1/chunk_00000" || metadata.VideoStream == nil || *metadata.VideoStream != 1 {
+		t.Errorf("chunkMetadata() key = %s, video stream = %v, want rig/stream_1/chunk_00000, 1", metadata.Key, metadata.VideoStream)
+	}
+	if streams := ctx.opts.streams(3); !reflect.DeepEqual(streams, []int{0, 1, 2}) {
+		t.Errorf("streams() = %v, want [0 1 2]", streams)
+	}
+}
+
+func TestParseProbeFrameRate(t *testing.T) {
+	tests := []struct {
+		name      string
+		stream    string
+		format    string
+		wantFPS   float64
+		wantCount int
+	}{
+		{name: "ntsc", stream: `{"codec_type": "video", "avg_frame_rate": "30000/1001", "duration": "10.010000", "nb_frames": "300"}`, wantFPS: 30000.0 / 1001, wantCount: 300},
+		{name: "estimated frame count", stream: `{"codec_type": "video", "avg_frame_rate": "25/1"}`, format: `"duration": "4.000000"`, wantFPS: 25, wantCount: 100},
+		{name: "unknown rate", stream: `{"codec_type": "video", "avg_frame_rate": "0/0", "duration": "2.0"}`, wantFPS: 0, wantCount: 0},
+	}
+	for _, tt := range tests {
+		info, err := parseProbeOutput([]byte(`{"streams": [` + tt.stream + `], "format": {` + tt.format + `}}`))
+		if err != nil {
+			t.Fatalf("%s: parseProbeOutput() error = %v", tt.name, err)
+		}
+		if info.FrameRate != tt.wantFPS || info.Frames != tt.wantCount {
+			t.Errorf("%s: frame rate/count = %g/%d, want %g/%d", tt.name, info.FrameRate, info.Frames, tt.wantFPS, tt.wantCount)
+		}
+	}
+
+	ctx := &clipContext{opts: Options{FPS: 8}, sourceFPS: 29.97, sourceFrames: 300, duration: 10.01}
+	metadata := ctx.chunkMetadata(0, segment{})
+	if metadata.FPS != 8 || metadata.OriginalFPS != 29.97 || metadata.SourceFrames != 300 || metadata.SourceDuration != 10.01 {
+		t.Errorf("chunkMetadata() fps = %d, source %g fps/%d frames/%gs, want 8, source 29.97 fps/300 frames/10.01s",
+			metadata.FPS, metadata.OriginalFPS, metadata.SourceFrames, metadata.SourceDuration)
+	}
+}
+
+func TestCaption(t *testing.T) {
+	sidecars := map[string][]byte{"txt": []byte("a dog runs\n"), "json": []byte("{}")}
+	tests := []struct {
+		name string
+		clip types.Clip
+		want string
+	}{
+		{"none", types.Clip{}, ""},
+		{"sidecar", types.Clip{Sidecars: sidecars}, "a dog runs"},
+		{"manifest", types.Clip{Caption: "a cat sleeps", Sidecars: sidecars}, "a cat sleeps"},
+	}
+	for _, tt := range tests {
+		ctx := &clipContext{clip: tt.clip}
+		if got := ctx.chunkMetadata(0, segment{}).Caption; got != tt.want {
+			t.Errorf("%s: caption = %q, want %q", tt.name, got, tt.want)
+		}
+
+		path := filepath.Join(t.TempDir(), "caption.txt")
+		if err := ctx.saveCaption(path); err != nil {
+			t.Fatalf("%s: saveCaption() error = %v", tt.name, err)
+		}
+		data, err := os.ReadFile(path)
+		if tt.want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s: caption file written without a caption", tt.name)
+			}
+		} else if string(data) != tt.want+"\n" {
+			t.Errorf("%s: caption file = %q, want %q", tt.name, data, tt.want+"\n")
+		}
+	}
+}
+
+func TestDeinterlace(t *testing.T) {
+	for fieldOrder, want := range map[string]bool{"progressive": false, "unknown": false, "": false, "tt": true, "bb": true, "tb": true, "bt": true} {
+		info, err := parseProbeOutput([]byte(`{"streams": [{"codec_type": "video", "field_order": "` + fieldOrder + `"}]}`))
+		if err != nil {
+			t.Fatalf("parseProbeOutput() error = %v", err)
+		}
+		if info.Interlaced != want {
+			t.Errorf("field order %q: interlaced = %v, want %v", fieldOrder, info.Interlaced, want)
+		}
+	}
+
+	ctx := &clipContext{opts: Options{FPS: 10}, dims: Dimensions{Width: 64, Height: 48}, deinterlace: true}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "yadif,fps=10,scale=64:48"; got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+	if !ctx.chunkMetadata(0, segment{}).Deinterlaced {
+		t.Error("chunk metadata of a deinterlaced clip does not record it")
+	}
+}
+
+func TestParseStatsLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		field  string
+		want   float64
+		wantOK bool
+	}{
+		{
+			name:   "ssim line",
+			line:   "n:1 Y:0.991234 U:0.995000 V:0.994000 All:0.992500 (21.249387)",
+			field:  "All:",
+			want:   0.9925,
+			wantOK: true,
+		},
+		{
+			name:   "psnr line",
+			line:   "n:3 mse_avg:1.25 mse_y:1.50 mse_u:0.75 mse_v:0.75 psnr_avg:47.16 psnr_y:46.37",
+			field:  "psnr_avg:",
+			want:   47.16,
+			wantOK: true,
+		},
+		{
+			name:   "identical frames",
+			line:   "n:1 mse_avg:0.00 psnr_avg:inf psnr_y:inf",
+			field:  "psnr_avg:",
+			want:   maxPSNR,
+			wantOK: true,
+		},
+		{
+			name:   "missing field",
+			line:   "n:1 Y:0.99",
+			field:  "All:",
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseStatsLine(tt.line, tt.field)
+			if ok != tt.wantOK {
+				t.Fatalf("parseStatsLine() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("parseStatsLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseVMAFLog(t *testing.T) {
+	logFile, err := os.CreateTemp("", "vmaf-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(logFile.Name())
+
+	log := `{"version": "2.3.1", "frames": [
+		{"frameNum": 0, "metrics": {"integer_adm2": 0.98, "vmaf": 91.5}},
+		{"frameNum": 1, "metrics": {"integer_adm2": 0.97, "vmaf": 88.25}}
+	], "pooled_metrics": {"vmaf": {"mean": 89.875}}}`
+	if _, err := logFile.WriteString(log); err != nil {
+		t.Fatal(err)
+	}
+	logFile.Close()
+
+	scores, err := parseVMAFLog(logFile.Name())
+	if err != nil {
+		t.Fatalf("parseVMAFLog() error = %v", err)
+	}
+	if len(scores) != 2 || scores[0] != 91.5 || scores[1] != 88.25 {
+		t.Errorf("parseVMAFLog() = %v, want [91.5 88.25]", scores)
+	}
+}
+
+func TestParseCropDetect(t *testing.T) {
+	letterbox := `[Parsed_cropdetect_1 @ 0x5581] x1:0 x2:1919 y1:142 y2:937 w:1920 h:800 x:0 y:140 pts:1 t:0.04 crop=1920:800:0:140
+[Parsed_cropdetect_1 @ 0x5581] x1:0 x2:1919 y1:138 y2:941 w:1920 h:800 x:0 y:140 pts:2 t:0.08 crop=1920:800:0:140`
+
+	tests := []struct {
+		name string
+		log  string
+		want *types.CropRegion
+	}{
+		{
+			name: "letterboxed",
+			log:  letterbox,
+			want: &types.CropRegion{Width: 1920, Height: 800, X: 0, Y: 140},
+		},
+		{
+			name: "no bars",
+			log:  "[Parsed_cropdetect_1 @ 0x5581] x1:0 x2:1919 y1:0 y2:1079 w:1920 h:1080 x:0 y:0 pts:1 t:0.04 crop=1920:1080:0:0",
+			want: nil,
+		},
+		{
+			name: "all black",
+			log:  "[Parsed_cropdetect_1 @ 0x5581] x1:1919 x2:0 y1:1079 y2:0 w:-1904 h:-1064 x:1912 y:1072 pts:1 t:0.04 crop=-1904:-1064:1912:1072",
+			want: nil,
+		},
+		{
+			name: "no output",
+			log:  "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseCropDetect(tt.log, 1920, 1080)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("parseCropDetect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSilenceDetect(t *testing.T) {
+	log := `[silencedetect @ 0x55d1] silence_start: 0
+[silencedetect @ 0x55d1] silence_end: 2.5 | silence_duration: 2.5
+[silencedetect @ 0x55d1] silence_start: 6.25`
+
+	intervals := parseSilenceDetect(log)
+	want := []silenceInterval{{Start: 0, End: 2.5}, {Start: 6.25, End: -1}}
+	if len(intervals) != len(want) {
+		t.Fatalf("parseSilenceDetect() = %v, want %v", intervals, want)
+	}
+	for i := range want {
+		if intervals[i] != want[i] {
+			t.Errorf("interval %d = %v, want %v", i, intervals[i], want[i])
+		}
+	}
+
+	tests := []struct {
+		start, end float64
+		want       bool
+	}{
+		{0, 2, true},
+		{2, 4, false},
+		{4, 6, false},
+		{6.5, 8.5, true},
+	}
+	for _, tt := range tests {
+		if got := isSilent(intervals, tt.start, tt.end); got != tt.want {
+			t.Errorf("isSilent(%v, %v) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyFFmpegError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		stderr string
+		want   error
+	}{
+		{"not found", &exec.Error{Name: "ffmpeg", Err: exec.ErrNotFound}, "", ErrFFmpegNotFound},
+		{"corrupt input", errors.New("exit status 1"), "input.mp4: Invalid data found when processing input", ErrCorruptInput},
+		{"missing moov atom", errors.New("exit status 1"), "moov atom not found", ErrCorruptInput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFFmpegError(tt.err, tt.stderr); !errors.Is(got, tt.want) {
+				t.Errorf("classifyFFmpegError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	other := errors.New("exit status 1")
+	if got := classifyFFmpegError(other, "Unknown encoder"); got != other {
+		t.Errorf("classifyFFmpegError() = %v, want unclassified error", got)
+	}
+
+	clipErr := error(&ClipError{Key: "video1", Err: fmt.Errorf("error probing video: %w", ErrCorruptInput)})
+	var target *ClipError
+	if !errors.As(clipErr, &target) || target.Key != "video1" || !errors.Is(clipErr, ErrCorruptInput) {
+		t.Errorf("ClipError does not unwrap to its key and cause: %v", clipErr)
+	}
+}
+
+func TestProcessClipsResults(t *testing.T) {
+	clips := []types.Clip{{Key: "a"}, {Key: "b"}, {Key: "c"}}
+	var reported atomic.Int32
+	opts := Options{OutputDir: t.TempDir(), Format: "gif", OnResult: func(ClipResult) { reported.Add(1) }}
+
+	results, err := ProcessClipsWithOptions(clips, opts, 2)
+	if !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("ProcessClipsWithOptions() error = %v, want ErrUnsupportedFormat", err)
+	}
+	if len(results) != len(clips) {
+		t.Fatalf("ProcessClipsWithOptions() returned %d results, want %d", len(results), len(clips))
+	}
+	for i, result := range results {
+		if result.Key != clips[i].Key || result.Status != ClipFailed || result.Err == nil {
+			t.Errorf("results[%d] = %+v, want failed result for %s", i, result, clips[i].Key)
+		}
+	}
+	if got := reported.Load(); got != int32(len(clips)) {
+		t.Errorf("OnResult called %d times, want %d", got, len(clips))
+	}
+}
+
+func TestPrecheckSkipsEmptyClip(t *testing.T) {
+	outputDir := t.TempDir()
+	opts := Options{OutputDir: outputDir, FPS: 8, Size: "64x64", Format: FormatJPEG, TargetFrames: 8, Precheck: true}
+
+	result, err := ProcessClipWithOptions(types.Clip{Key: "empty"}, opts)
+	if err != nil {
+		t.Fatalf("ProcessClipWithOptions() error = %v, want skip", err)
+	}
+	if result.Status != ClipSkipped || !errors.Is(result.Err, ErrCorruptInput) {
+		t.Errorf("result = %+v, want skipped with ErrCorruptInput", result)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "empty")); !os.IsNotExist(err) {
+		t.Errorf("skipped clip created an output directory (stat error = %v)", err)
+	}
+}
+
+func TestCheckDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		duration float64
+		wantErr  bool
+	}{
+		{name: "no minimum", opts: Options{FPS: 8}, duration: 0.5},
+		{name: "enough frames", opts: Options{FPS: 8, MinFrames: 16}, duration: 2},
+		{name: "too few frames", opts: Options{FPS: 8, MinFrames: 16}, duration: 1.9, wantErr: true},
+		{name: "long enough", opts: Options{FPS: 8, MinDuration: 1.5}, duration: 1.5},
+		{name: "too short", opts: Options{FPS: 8, MinDuration: 1.5}, duration: 1.2, wantErr: true},
+		{name: "unknown duration", opts: Options{FPS: 8, MinFrames: 16, MinDuration: 1.5}, duration: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.checkDuration(tt.duration)
+			if (err != nil) != tt.wantErr || err != nil && !errors.Is(err, ErrTooShort) {
+				t.Errorf("checkDuration(%g) error = %v, wantErr %v", tt.duration, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []ClipResult{
+		{Key: "a", Status: ClipOK, Chunks: 3, FramesDiscarded: DiscardCounts{Remainder: 2, Decimated: 5}},
+		{Key: "b", Status: ClipEmpty, FramesDiscarded: DiscardCounts{Remainder: 10}},
+		{Key: "c", Status: ClipFailed, Err: ErrCorruptInput},
+		{Key: "d", Status: ClipOK, Chunks: 1, FramesDiscarded: DiscardCounts{Silent: 16}},
+		{Key: "e", Status: ClipSkipped, Err: ErrCorruptInput},
+		{Key: "f", Status: ClipSkipped, Err: fmt.Errorf("%w: 0.50s is below the minimum of 1s", ErrTooShort)},
+	}
+
+	got := Summarize(results)
+	want := Summary{
+		Clips:           6,
+		Failed:          1,
+		Empty:           1,
+		Skipped:         1,
+		TooShort:        1,
+		Chunks:          4,
+		FramesDiscarded: DiscardCounts{Remainder: 12, Silent: 16, Decimated: 5},
+	}
+	if got != want {
+		t.Errorf("Summarize() = %+v, want %+v", got, want)
+	}
+	if total := got.FramesDiscarded.Total(); total != 33 {
+		t.Errorf("Total() = %d, want 33", total)
+	}
+}
+
+func TestOverlayTransform(t *testing.T) {
+	got := OverlayTransform{Label: "clips/it's:50%", Offset: 2.5}.FFmpegArgs()
+	want := `drawtext=text='clips/it_s_50_ #%{n} %{pts\:hms\:2.5}':x=4:y=4:fontsize=12:fontcolor=white:box=1:boxcolor=black@0.6`
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("FFmpegArgs() = %v, want [%s]", got, want)
+	}
+}
+
+func TestMemoryGovernorAdjust(t *testing.T) {
+	g := newMemoryGovernor(1000, 3)
+
+	steps := []struct {
+		rss  uint64
+		want int
+	}{
+		{1500, 2}, // over the limit: shrink
+		{1500, 1},
+		{1500, 1}, // never below one worker
+		{900, 1},  // between low water and limit: hold
+		{500, 2},  // under low water: grow
+		{500, 3},
+		{500, 3}, // never above the worker count
+	}
+	for i, step := range steps {
+		g.adjust(step.rss)
+		if g.allowed != step.want {
+			t.Errorf("step %d: adjust(%d) allowed = %d, want %d", i, step.rss, g.allowed, step.want)
+		}
+	}
+
+	if newMemoryGovernor(0, 3) != nil {
+		t.Error("newMemoryGovernor() with no limit should return nil")
+	}
+}
+
+func TestNumbering(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		idx       int
+		wantChunk string
+		wantFrame string
+	}{
+		{"defaults", Options{}, 0, "chunk_00000", "frame_000001"},
+		{"zero-based frames", Options{FrameOffset: -1}, 0, "chunk_00000", "frame_000000"},
+		{"more than 999 frames", Options{}, 1234, "chunk_01234", "frame_001235"},
+		{
+			name:      "custom widths and starts",
+			opts:      Options{ChunkDigits: 3, ChunkStart: 1, FramePattern: "%06d", FrameOffset: -1},
+			idx:       7,
+			wantChunk: "chunk_008",
+			wantFrame: "000007",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.chunkName(tt.idx); got != tt.wantChunk {
+				t.Errorf("chunkName(%d) = %s, want %s", tt.idx, got, tt.wantChunk)
+			}
+			if got := tt.opts.frameName(tt.idx); got != tt.wantFrame {
+				t.Errorf("frameName(%d) = %s, want %s", tt.idx, got, tt.wantFrame)
+			}
+		})
+	}
+}
+
+func TestChunkStride(t *testing.T) {
+	tests := []struct {
+		name    string
+		stride  int
+		dropped []bool
+		want    []int
+		discard DiscardCounts
+	}{
+		{name: "back to back", want: []int{0, 4, 8}, dropped: []bool{false, false, false}, discard: DiscardCounts{Remainder: 2}},
+		{name: "overlapping", stride: 2, want: []int{0, 2, 4, 6, 8, 10}, dropped: make([]bool, 6)},
+		{name: "gaps", stride: 6, want: []int{0, 6}, dropped: []bool{false, false}, discard: DiscardCounts{Remainder: 6}},
+		{name: "overlapping silent chunk", stride: 2, want: []int{0, 2, 4, 6, 8, 10}, dropped: []bool{false, false, false, false, true, true}, discard: DiscardCounts{Silent: 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &clipContext{opts: Options{TargetFrames: 4, Stride: tt.stride}}
+			starts := ctx.chunkStarts(segment{}, 14)
+			if !reflect.DeepEqual(starts, tt.want) {
+				t.Fatalf("chunkStarts() = %v, want %v", starts, tt.want)
+			}
+			ctx.countDiscarded(14, starts, tt.dropped)
+			if ctx.framesDiscarded != tt.discard {
+				t.Errorf("countDiscarded() = %+v, want %+v", ctx.framesDiscarded, tt.discard)
+			}
+		})
+	}
+}
+
+func TestRandomSegments(t *testing.T) {
+	ctx := &clipContext{
+		clip:     types.Clip{Key: "video1"},
+		opts:     Options{FPS: 8, TargetFrames: 16, RandomChunks: 5, Seed: 7},
+		duration: 60,
+	}
+	segments, err := ctx.segments()
+	if err != nil {
+		t.Fatalf("segments() error = %v", err)
+	}
+	if len(segments) != 5 {
+		t.Fatalf("segments() = %d segments, want 5", len(segments))
+	}
+	for i, seg := range segments {
+		if seg.Start < 0 || seg.Start > 58 || seg.Frames != 16 || seg.End != 0 {
+			t.Errorf("segment %d = %+v, want 16 frames starting in [0, 58]", i, seg)
+		}
+		if i > 0 && seg.Start < segments[i-1].Start {
+			t.Errorf("segment %d starts at %g before segment %d at %g", i, seg.Start, i-1, segments[i-1].Start)
+		}
+	}
+	if again, _ := ctx.segments(); !reflect.DeepEqual(again, segments) {
+		t.Errorf("segments() = %+v on a second call, want the seeded %+v", again, segments)
+	}
+	if start := ctx.augmentation(segments[0], 16).ChunkStart; start == nil || *start != segments[0].Start {
+		t.Errorf("augmentation() chunk start = %v, want %g", start, segments[0].Start)
+	}
+
+	// Chunks are drawn from spans long enough to hold one
+	ctx.clip.Spans = []types.Span{{Start: 10, End: 11}, {Start: 30, End: 34}}
+	got, _ := ctx.segments()
+	for _, seg := range got {
+		if seg.Start < 30 || seg.Start > 32 || seg.Span != &ctx.clip.Spans[1] {
+			t.Errorf("segment %+v, want a start in [30, 32] within the second span", seg)
+		}
+	}
+	ctx.clip.Spans = []types.Span{{Start: 10, End: 11}}
+	if got, err := ctx.segments(); len(got) != 0 || err != nil {
+		t.Errorf("segments() with only a short span = %+v, %v, want none", got, err)
+	}
+
+	// Without a probed duration, where to draw chunks from the whole clip
+	// is unknown
+	ctx.clip.Spans = nil
+	ctx.duration = 0
+	if got, err := ctx.segments(); err == nil {
+		t.Errorf("segments() without a duration = %+v, want error", got)
+	}
+}
+
+func TestCapChunks(t *testing.T) {
+	starts := []int{0, 4, 8, 12, 16, 20, 24, 28, 32, 36}
+	tests := []struct {
+		name    string
+		opts    Options
+		written int
+		want    []int
+	}{
+		{name: "no cap", opts: Options{}, want: starts},
+		{name: "under the cap", opts: Options{MaxChunks: 12}, want: starts},
+		{name: "first", opts: Options{MaxChunks: 3}, want: []int{0, 4, 8}},
+		{name: "uniform", opts: Options{MaxChunks: 3, MaxChunksUniform: true}, want: []int{4, 20, 32}},
+		{name: "uniform single", opts: Options{MaxChunks: 1, MaxChunksUniform: true}, want: []int{20}},
+		{name: "earlier segments", opts: Options{MaxChunks: 5}, written: 3, want: []int{0, 4}},
+		{name: "cap reached", opts: Options{MaxChunks: 5}, written: 5, want: []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &clipContext{opts: tt.opts, nextChunk: tt.written}
+			if got := ctx.capChunks(starts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("capChunks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUniformTimestamps(t *testing.T) {
+	tests := []struct {
+		duration float64
+		n        int
+		want     []float64
+	}{
+		{duration: 8, n: 4, want: []float64{1, 3, 5, 7}},
+		{duration: 10, n: 3, want: []float64{1.667, 5, 8.333}},
+		{duration: 2.5, n: 1, want: []float64{1.25}},
+	}
+	for _, tt := range tests {
+		if got := uniformTimestamps(tt.duration, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniformTimestamps(%g, %d) = %v, want %v", tt.duration, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestShotSegments(t *testing.T) {
+	log := "[Parsed_showinfo_1 @ 0x1] n:   0 pts:  61440 pts_time:4.8     duration:512\n" +
+		"[Parsed_showinfo_1 @ 0x1] n:   1 pts: 130560 pts_time:10.2    duration:512\n" +
+		"[Parsed_showinfo_1 @ 0x1] n:   2 pts: 199680 pts_time:15.6    duration:512\n"
+	cuts := parseSceneCuts(log)
+	if !reflect.DeepEqual(cuts, []float64{4.8, 10.2, 15.6}) {
+		t.Fatalf("parseSceneCuts() = %v, want [4.8 10.2 15.6]", cuts)
+	}
+
+	ctx := &clipContext{opts: Options{SceneSplit: true}, sceneCuts: cuts, duration: 20}
+	want := []segment{
+		{Start: 0, End: 4.8, Shot: &types.Shot{Index: 0, Start: 0, End: 4.8}},
+		{Start: 4.8, End: 10.2, Shot: &types.Shot{Index: 1, Start: 4.8, End: 10.2}},
+		{Start: 10.2, End: 15.6, Shot: &types.Shot{Index: 2, Start: 10.2, End: 15.6}},
+		{Start: 15.6, Shot: &types.Shot{Index: 3, Start: 15.6, End: 20}},
+	}
+	if got, _ := ctx.segments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("segments() = %+v, want %+v", got, want)
+	}
+
+	// Spans are split at the cuts within them only
+	ctx.clip.Spans = []types.Span{{Start: 2, End: 8, Label: "jump"}}
+	span := &ctx.clip.Spans[0]
+	want = []segment{
+		{Start: 2, End: 4.8, Span: span, Shot: &types.Shot{Index: 0, Start: 2, End: 4.8}},
+		{Start: 4.8, End: 8, Span: span, Shot: &types.Shot{Index: 1, Start: 4.8, End: 8}},
+	}
+	if got, _ := ctx.segments(); !reflect.DeepEqual(got, want) {
+		t.Errorf("segments() with a span = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithOverrides(t *testing.T) {
+	opts := Options{FPS: 10, Size: "64x48", TargetFrames: 16, Transforms: []Transform{FlipTransform{}}}
+	if got, err := opts.withOverrides(nil); err != nil || !reflect.DeepEqual(got, opts) {
+		t.Errorf("withOverrides(nil) = %+v, %v, want the options unchanged", got, err)
+	}
+
+	got, err := opts.withOverrides(&types.ClipOverrides{Size: "48x64", Transforms: []string{"vflip", "grayscale"}})
+	if err != nil {
+		t.Fatalf("withOverrides() error = %v", err)
+	}
+	if got.FPS != 10 || got.Size != "48x64" || got.TargetFrames != 16 {
+		t.Errorf("withOverrides() fps/size/frames = %d/%s/%d, want 10/48x64/16", got.FPS, got.Size, got.TargetFrames)
+	}
+	if transforms := ComposeTransforms(got.Transforms...); transforms != "vflip,hue=s=0" {
+		t.Errorf("withOverrides() transforms = %s, want vflip,hue=s=0", transforms)
+	}
+
+	if _, err := opts.withOverrides(&types.ClipOverrides{Transforms: []string{"sepia"}}); err == nil {
+		t.Error("withOverrides() with an unknown transform succeeded")
+	}
+
+	// Chunk lengths in seconds follow the clip's frame rate
+	opts.ChunkSeconds = 2.5
+	for _, tt := range []struct {
+		overrides *types.ClipOverrides
+		want      int
+	}{
+		{overrides: nil, want: 25},
+		{overrides: &types.ClipOverrides{FPS: 30}, want: 75},
+		{overrides: &types.ClipOverrides{FPS: 30, TargetFrames: 8}, want: 8},
+	} {
+		got, err := opts.withOverrides(tt.overrides)
+		if err != nil || got.TargetFrames != tt.want {
+			t.Errorf("withOverrides(%+v) with 2.5s chunks = %d frames, %v, want %d", tt.overrides, got.TargetFrames, err, tt.want)
+		}
+	}
+}
+
+func TestColorConvert(t *testing.T) {
+	tests := []struct {
+		matrix ColorMatrix
+		rng    ColorRange
+		want   string
+	}{
+		{want: "fps=10,scale=64:48"},
+		{matrix: ColorMatrixBT709, want: "fps=10,scale=64:48,scale=in_color_matrix=bt709"},
+		{rng: ColorRangeFull, want: "fps=10,scale=64:48,scale=in_range=pc"},
+		{matrix: ColorMatrixBT601, rng: ColorRangeLimited, want: "fps=10,scale=64:48,scale=in_color_matrix=bt601:in_range=tv"},
+	}
+	for _, tt := range tests {
+		ctx := &clipContext{
+			opts: Options{FPS: 10, ColorMatrix: tt.matrix, ColorRange: tt.rng},
+			dims: Dimensions{Width: 64, Height: 48},
+		}
+		if got := ComposeTransforms(ctx.transforms(segment{})...); got != tt.want {
+			t.Errorf("transforms() with %q/%q = %s, want %s", tt.matrix, tt.rng, got, tt.want)
+		}
+		metadata := ctx.chunkMetadata(0, segment{})
+		if metadata.ColorMatrix != string(tt.matrix) || metadata.ColorRange != string(tt.rng) {
+			t.Errorf("chunkMetadata() color = %q/%q, want %q/%q", metadata.ColorMatrix, metadata.ColorRange, tt.matrix, tt.rng)
+		}
+	}
+}
+
+func TestPreviewFilter(t *testing.T) {
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Preview: PreviewGIF}, "scale=160:-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse"},
+		{Options{Preview: PreviewWebP, PreviewWidth: 96}, "scale=96:-2:flags=lanczos"},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.previewFilter(); got != tt.want {
+			t.Errorf("previewFilter() for %s = %s, want %s", tt.opts.Preview, got, tt.want)
+		}
+	}
+}
+
+func TestAudioArgs(t *testing.T) {
+	got := Options{}.audioArgs(2)
+	want := ffmpeg.KwArgs{"vn": "", "ac": 1, "ar": 16000, "af": "apad", "t": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("audioArgs() = %v, want %v", got, want)
+	}
+	if got := (Options{AudioSampleRate: 44100}).audioArgs(0.5); got["ar"] != 44100 || got["t"] != "0.5" {
+		t.Errorf("audioArgs() with 44.1 kHz = %v", got)
+	}
+}
+
+func TestChunkMotion(t *testing.T) {
+	// Three frames of two samples: unchanged, then all samples up by 0.2
+	data := []byte{0, 0, 0, 0, 51, 51}
+	want := &types.Motion{MeanAbsDiff: 0.1, StaticPercent: 50}
+	if got := chunkMotion(data, 2, 1, defaultStaticThreshold); !reflect.DeepEqual(got, want) {
+		t.Errorf("chunkMotion() = %+v, want %+v", got, want)
+	}
+
+	// The same frames as 16-bit samples
+	data16 := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x33, 0x33, 0x33, 0x33}
+	if got := chunkMotion(data16, 4, 2, defaultStaticThreshold); !reflect.DeepEqual(got, want) {
+		t.Errorf("chunkMotion() of 16-bit samples = %+v, want %+v", got, want)
+	}
+
+	if got := chunkMotion(data[:2], 2, 1, defaultStaticThreshold); got != nil {
+		t.Errorf("chunkMotion() of one frame = %+v, want nil", got)
+	}
+}
+
+func TestImageMotion(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i, level := range []uint8{0, 0, 255} {
+		img := image.NewGray(image.Rect(0, 0, 2, 2))
+		for p := range img.Pix {
+			img.Pix[p] = level
+		}
+		path := filepath.Join(dir, fmt.Sprintf("frame_%d.png", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		paths = append(paths, path)
+	}
+
+	got, err := imageMotion(paths, defaultStaticThreshold)
+	if err != nil {
+		t.Fatalf("imageMotion() error = %v", err)
+	}
+	want := &types.Motion{MeanAbsDiff: 0.5, StaticPercent: 50}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("imageMotion() = %+v, want %+v", got, want)
+	}
+}
+
+func TestAudioChunkSamples(t *testing.T) {
+	tests := []struct {
+		rate, fps, frames int
+		wantSamples       int
+	}{
+		{16000, 8, 16, 32000},
+		{16000, 30, 16, 8533},
+		{44100, 24, 5, 9187},
+	}
+	for _, tt := range tests {
+		chunkSamples := audioSample(tt.frames, tt.rate, tt.fps)
+		if chunkSamples != tt.wantSamples {
+			t.Errorf("audioSample(%d, %d, %d) = %d, want %d", tt.frames, tt.rate, tt.fps, chunkSamples, tt.wantSamples)
+		}
+		// Every chunk fits in the audio the frame count was derived from
+		for total := 0; total < 3*tt.rate; total += 997 {
+			frames := audioFrames(total, tt.rate, tt.fps)
+			for start := 0; start+tt.frames <= frames; start++ {
+				if end := audioSample(start, tt.rate, tt.fps) + chunkSamples; end > total {
+					t.Fatalf("%d Hz at %d fps: chunk at frame %d ends at sample %d of %d", tt.rate, tt.fps, start, end, total)
+				}
+			}
+		}
+	}
+}
+
+func TestAudioOnlyRandomChunks(t *testing.T) {
+	ctx := &clipContext{
+		clip:     types.Clip{Key: "video1"},
+		opts:     Options{FPS: 8, TargetFrames: 16, RandomChunks: 3, Seed: 7},
+		duration: 60,
+	}
+	segments, err := ctx.segments()
+	if err != nil {
+		t.Fatalf("segments() error = %v", err)
+	}
+	if len(segments) != 3 {
+		t.Fatalf("segments() = %d segments, want 3", len(segments))
+	}
+	chunks := 0
+	for _, seg := range segments {
+		if got := ctx.opts.audioSampleArgs(seg)["t"]; got != "2" {
+			t.Errorf("audio of random segment %+v lasts %v seconds, want 2", seg, got)
+		}
+		// Decoders may return a few samples beyond the requested length
+		frames := ctx.opts.segmentAudioFrames(seg, 33000)
+		chunks += len(ctx.chunkStarts(seg, frames))
+	}
+	if chunks != 3 {
+		t.Errorf("random segments yield %d audio chunks, want 3", chunks)
+	}
+
+	if _, ok := ctx.opts.audioSampleArgs(segment{})["t"]; ok {
+		t.Error("audio of a whole clip is cut to a length")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	dims := Dimensions{Width: 2, Height: 1}
+	// Two frames of two RGB pixels
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	tests := []struct {
+		opts  Options
+		shape []int
+		want  []byte
+	}{
+		{Options{}, []int{1, 2, 3}, data},
+		{Options{Layout: LayoutTCHW}, []int{3, 1, 2}, []byte{1, 4, 2, 5, 3, 6, 7, 10, 8, 11, 9, 12}},
+		{Options{Layout: LayoutTCHW, PixelFormat: PixFmtGray}, []int{1, 1, 2}, data},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.frameShape(dims); !reflect.DeepEqual(got, tt.shape) {
+			t.Errorf("frameShape() with %+v = %v, want %v", tt.opts, got, tt.shape)
+		}
+		if got := tt.opts.applyLayout(data, dims); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("applyLayout() with %+v = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+
+	// Multi-byte samples move as a whole
+	got := channelsFirst([]byte{1, 0, 2, 0, 3, 0, 4, 0}, 2, 2, 2)
+	if want := []byte{1, 0, 3, 0, 2, 0, 4, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("channelsFirst() = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeSamples(t *testing.T) {
+	dims := Dimensions{Width: 1, Height: 1}
+	// One rgb48 pixel
+	data := []byte{0x01, 0x02, 0xff, 0xff, 0, 0}
+	tests := []struct {
+		opts  Options
+		dtype numpy.DType
+		want  []byte
+	}{
+		{Options{Format: FormatNPY, BitDepth: 16}, numpy.Uint16, data},
+		{Options{Format: FormatPT, BitDepth: 16}, numpy.Int32, []byte{0x01, 0x02, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0}},
+		{Options{Format: FormatPT, Layout: LayoutTCHW}, numpy.Uint8, data},
+	}
+	for _, tt := range tests {
+		if got := tt.opts.numpyDType(); got != tt.dtype {
+			t.Errorf("numpyDType() with %+v = %s, want %s", tt.opts, got, tt.dtype)
+		}
+		if got := tt.opts.encodeSamples(data, dims); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("encodeSamples() with %+v = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestPixelFormat(t *testing.T) {
+	dims := Dimensions{Width: 4, Height: 2}
+	tests := []struct {
+		opts      Options
+		want      PixelFormat
+		ffmpeg    string
+		shape     []int
+		frameSize int
+	}{
+		{opts: Options{}, want: PixFmtRGB24, ffmpeg: "rgb24", shape: []int{2, 4, 3}, frameSize: 24},
+		{opts: Options{BitDepth: 16}, want: PixFmtRGB48, ffmpeg: "rgb48le", shape: []int{2, 4, 3}, frameSize: 48},
+		{opts: Options{PixelFormat: PixFmtBGR24}, want: PixFmtBGR24, ffmpeg: "bgr24", shape: []int{2, 4, 3}, frameSize: 24},
+		{opts: Options{PixelFormat: PixFmtGray}, want: PixFmtGray, ffmpeg: "gray", shape: []int{2, 4, 1}, frameSize: 8},
+		{opts: Options{PixelFormat: PixFmtYUV420P}, want: PixFmtYUV420P, ffmpeg: "yuv420p", shape: []int{3, 4}, frameSize: 12},
+		{opts: Options{PixelFormat: PixFmtRGB48}, want: PixFmtRGB48, ffmpeg: "rgb48le", shape: []int{2, 4, 3}, frameSize: 48},
+	}
+	for _, tt := range tests {
+		p := tt.opts.pixelFormat()
+		if p != tt.want || p.ffmpegName() != tt.ffmpeg || !reflect.DeepEqual(p.frameShape(dims), tt.shape) || p.frameSize(dims) != tt.frameSize {
+			t.Errorf("pixel format of %+v = %s (%s, shape %v, %d bytes), want %s (%s, shape %v, %d bytes)",
+				tt.opts, p, p.ffmpegName(), p.frameShape(dims), p.frameSize(dims), tt.want, tt.ffmpeg, tt.shape, tt.frameSize)
+		}
+	}
+	if depth := (Options{PixelFormat: PixFmtRGB48}).bitDepth(); depth != 16 {
+		t.Errorf("bitDepth() with rgb48 = %d, want 16", depth)
+	}
+}
+
+func TestNormalizeFrames(t *testing.T) {
+	norm := &types.Normalization{Mean: []float64{0.5, 0, 1}, Std: []float64{0.5, 1, 0.5}}
+	tests := []struct {
+		name     string
+		data     []byte
+		bitDepth int
+		norm     *types.Normalization
+		want     []float32
+	}{
+		{"8-bit", []byte{255, 0, 255, 0, 255, 0}, 8, norm, []float32{1, 0, 0, -1, 1, -2}},
+		{"16-bit", []byte{0xff, 0xff, 0, 0, 0xff, 0xff}, 16, norm, []float32{1, 0, 0}},
+		{"scale only", []byte{255, 0, 51, 102}, 8, nil, []float32{1, 0, 0.2, 0.4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeFrames(tt.data, tt.bitDepth, tt.norm)
+			if len(got) != len(tt.want)*4 {
+				t.Fatalf("normalizeFrames() returned %d bytes, want %d", len(got), len(tt.want)*4)
+			}
+			for i, want := range tt.want {
+				v := math.Float32frombits(binary.LittleEndian.Uint32(got[i*4:]))
+				if math.Abs(float64(v-want)) > 1e-6 {
+					t.Errorf("sample %d = %v, want %v", i, v, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeBGR(t *testing.T) {
+	norm := &types.Normalization{Mean: []float64{0.5, 0, 1}, Std: []float64{0.5, 1, 0.5}}
+	tests := []struct {
+		pixFmt PixelFormat
+		data   []byte
+		want   []float32
+	}{
+		// R=255, G=0, B=255 in each sample order
+		{PixFmtRGB24, []byte{255, 0, 255}, []float32{1, 0, 0}},
+		{PixFmtBGR24, []byte{255, 0, 255}, []float32{0, 0, 1}},
+	}
+	for _, tt := range tests {
+		opts := Options{Format: FormatNPY, PixelFormat: tt.pixFmt, Normalize: norm}
+		got := opts.encodeSamples(tt.data, Dimensions{Width: 1, Height: 1})
+		for i, want := range tt.want {
+			if v := math.Float32frombits(binary.LittleEndian.Uint32(got[i*4:])); math.Abs(float64(v-want)) > 1e-6 {
+				t.Errorf("%s sample %d = %v, want %v", tt.pixFmt, i, v, want)
+			}
+		}
+	}
+	if !reflect.DeepEqual(norm.Mean, []float64{0.5, 0, 1}) {
+		t.Errorf("normalization mean changed to %v", norm.Mean)
+	}
+}
+
+func TestMultiCropViews(t *testing.T) {
+	if views := multiCropViews(MultiCropOff, 224, 224); len(views) != 1 || views[0] != nil {
+		t.Errorf("multiCropViews(off) = %v, want a single nil view", views)
+	}
+
+	three := multiCropViews(MultiCropThree, 224, 224)
+	if len(three) != 3 || three[1].Name != "center" || three[1].X != "(iw-224)/2" || three[2].X != "iw-224" {
+		t.Errorf("multiCropViews(three) = %+v", three)
+	}
+
+	ten := multiCropViews(MultiCropTen, 224, 224)
+	flipped := 0
+	for _, v := range ten {
+		if v.Flip {
+			flipped++
+		}
+	}
+	if len(ten) != 10 || flipped != 5 {
+		t.Errorf("multiCropViews(ten) returned %d views with %d flipped, want 10 and 5", len(ten), flipped)
+	}
+
+	got := ComposeTransforms(MultiCropTransform{Width: 224, Height: 224, X: "0", Y: "ih-224", Flip: true})
+	want := "scale=224:224:force_original_aspect_ratio=increase,crop=224:224:0:ih-224,hflip"
+	if got != want {
+		t.Errorf("MultiCropTransform = %s, want %s", got, want)
+	}
+}
+
+func TestFitTransform(t *testing.T) {
+	tests := []struct {
+		crop CropMode
+		want string
+	}{
+		{crop: CropOff, want: "scale=224:160"},
+		{crop: CropCenter, want: "scale=224:160:force_original_aspect_ratio=increase,crop=224:160"},
+		{crop: CropRandom, want: "scale=224:160:force_original_aspect_ratio=increase,crop=224:160:(iw-224)*0.3372:(ih-160)*0.5391"},
+	}
+	for _, tt := range tests {
+		ctx := &clipContext{opts: Options{Crop: tt.crop, Seed: 7}, clip: types.Clip{Key: "video1"}, dims: Dimensions{Width: 224, Height: 160}}
+		if got := ComposeTransforms(ctx.fitTransform()); got != tt.want {
+			t.Errorf("fitTransform(%q) = %s, want %s", tt.crop, got, tt.want)
+		}
+	}
+}
+
+func TestExtraFilters(t *testing.T) {
+	ctx := &clipContext{
+		opts: Options{FPS: 10, Crop: CropCenter, ExtraFilters: "eq=contrast=1.1,unsharp"},
+		dims: Dimensions{Width: 64, Height: 48},
+	}
+	got := ComposeTransforms(ctx.transforms(segment{})...)
+	want := "fps=10,scale=64:48:force_original_aspect_ratio=increase,crop=64:48,eq=contrast=1.1,unsharp"
+	if got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+}
+
+type mirrorTransform struct{ axis string }
+
+func (t mirrorTransform) FFmpegArgs() []string {
+	return []string{t.axis + "flip"}
+}
+
+// registerMirror registers test_mirror once, since registering a name twice
+// panics and tests may run more than once with -count
+var registerMirror = sync.OnceFunc(func() {
+	RegisterTransform("test_mirror", func(params string) (Transform, error) {
+		if params != "h" && params != "v" {
+			return nil, fmt.Errorf("axis must be h or v, got %q", params)
+		}
+		return mirrorTransform{axis: params}, nil
+	})
+})
+
+func TestParseTransform(t *testing.T) {
+	registerMirror()
+
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "boxblur=2", want: "boxblur=2"},
+		{spec: "hflip", want: "hflip"},
+		{spec: " eq=contrast=1.1:saturation=1.2 ", want: "eq=contrast=1.1:saturation=1.2"},
+		{spec: "grayscale", want: "hue=s=0"},
+		{spec: "grayscale=1", wantErr: true},
+		{spec: "test_mirror=v", want: "vflip"},
+		{spec: "test_mirror=x", wantErr: true},
+		{spec: "sharpen", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTransform(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTransform(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && ComposeTransforms(got) != tt.want {
+			t.Errorf("ParseTransform(%q) = %s, want %s", tt.spec, ComposeTransforms(got), tt.want)
+		}
+	}
+
+	// User transforms run after the built-in ones and before -vf-extra
+	ctx := &clipContext{
+		opts: Options{FPS: 10, Transforms: []Transform{mirrorTransform{axis: "h"}}, ExtraFilters: "unsharp"},
+		dims: Dimensions{Width: 64, Height: 48},
+	}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "fps=10,scale=64:48,hflip,unsharp"; got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	ctx := &clipContext{opts: Options{FPS: 30, Interpolate: true}, dims: Dimensions{Width: 64, Height: 48}, deinterlace: true}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "yadif,minterpolate=fps=30:mi_mode=mci,scale=64:48"; got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+}
+
+func TestDenoiseTransform(t *testing.T) {
+	tests := []struct {
+		transform DenoiseTransform
+		want      string
+	}{
+		{transform: DenoiseTransform{Filter: DenoiseHQDN3D}, want: "hqdn3d"},
+		{transform: DenoiseTransform{Filter: DenoiseHQDN3D, Strength: 6}, want: "hqdn3d=luma_spatial=6"},
+		{transform: DenoiseTransform{Filter: DenoiseNLMeans, Strength: 2.5}, want: "nlmeans=s=2.5"},
+	}
+	for _, tt := range tests {
+		if got := ComposeTransforms(tt.transform); got != tt.want {
+			t.Errorf("%+v = %s, want %s", tt.transform, got, tt.want)
+		}
+	}
+
+	ctx := &clipContext{opts: Options{FPS: 10, Denoise: DenoiseHQDN3D}, dims: Dimensions{Width: 64, Height: 48}}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "fps=10,hqdn3d,scale=64:48"; got != want {
+		t.Errorf("transforms() = %s, want %s", got, want)
+	}
+}
+
+func TestDecimateTransform(t *testing.T) {
+	if got := ComposeTransforms(DecimateTransform{}); got != "mpdecimate" {
+		t.Errorf("DecimateTransform = %s, want mpdecimate", got)
+	}
+
+	ctx := &clipContext{opts: Options{FPS: 10, Decimate: true}, dims: Dimensions{Width: 64, Height: 48}}
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "fps=10,mpdecimate,scale=64:48"; got != want {
+		t.Errorf("transforms() with decimation = %s, want %s", got, want)
+	}
+	if kwargs := ctx.outputArgs(segment{}); kwargs["vsync"] != "vfr" {
+		t.Errorf("outputArgs() with decimation = %v, want vfr output", kwargs)
+	}
+
+	ctx.opts.Decimate = false
+	if got, want := ComposeTransforms(ctx.transforms(segment{})...), "fps=10,scale=64:48"; got != want {
+		t.Errorf("transforms() without decimation = %s, want %s", got, want)
+	}
+	if kwargs := ctx.outputArgs(segment{}); len(kwargs) != 0 {
+		t.Errorf("outputArgs() without decimation = %v, want none", kwargs)
+	}
+}
+
+func TestEmitFlipped(t *testing.T) {
+	ctx := &clipContext{
+		opts: Options{FPS: 10, Crop: CropCenter, EmitFlipped: true},
+		clip: types.Clip{Key: "video1"},
+		dims: Dimensions{Width: 64, Height: 48},
+	}
+	views := ctx.views(segment{})
+	if len(views) != 2 || views[0] != nil || views[1].Name != "flip" {
+		t.Fatalf("views() = %+v, want the plain output and a flip view", views)
+	}
+
+	want := []string{
+		"fps=10,scale=64:48:force_original_aspect_ratio=increase,crop=64:48",
+		"fps=10,scale=64:48:force_original_aspect_ratio=increase,crop=64:48,hflip",
+	}
+	wantNames := []string{"chunk_00000", "chunk_00000_flip"}
+	for i, view := range views {
+		ctx.view = view
+		if got := ComposeTransforms(ctx.transforms(segment{})...); got != want[i] {
+			t.Errorf("transforms() for view %d = %s, want %s", i, got, want[i])
+		}
+		if got := ctx.chunkName(0); got != wantNames[i] {
+			t.Errorf("chunkName() for view %d = %s, want %s", i, got, wantNames[i])
+		}
+	}
+	if metadata := ctx.chunkMetadata(0, segment{}); metadata.BaseKey != "video1/chunk_00000" || metadata.CropView != "flip" {
+		t.Errorf("flipped chunk base_key = %q, crop_view = %q, want video1/chunk_00000 and flip", metadata.BaseKey, metadata.CropView)
+	}
+}
+
+func TestRandomCrop(t *testing.T) {
+	ctx := &clipContext{opts: Options{Crop: CropRandom, Seed: 7}, clip: types.Clip{Key: "video1"}}
+	crop := ctx.randomCrop()
+	if crop.CropX < 0 || crop.CropX > 1 || crop.CropY < 0 || crop.CropY > 1 {
+		t.Fatalf("randomCrop() = %+v, want offsets in [0, 1]", crop)
+	}
+	if again := ctx.randomCrop(); *again != *crop {
+		t.Errorf("randomCrop() = %+v then %+v, want the same crop for a fixed seed and key", crop, again)
+	}
+	other := &clipContext{opts: ctx.opts, clip: types.Clip{Key: "video2"}}
+	if *other.randomCrop() == *crop {
+		t.Error("randomCrop() did not vary with the clip key")
+	}
+
+	// Every chunk of the clip records the same crop
+	record := ctx.augmentation(segment{Start: 5}, 100)
+	if record == nil || record.RandomCrop == nil || *record.RandomCrop != *crop {
+		t.Errorf("augmentation() = %+v, want the clip's random crop %+v", record, crop)
+	}
+}
+
+func TestAugmentedViews(t *testing.T) {
+	ctx := &clipContext{
+		clip: types.Clip{Key: "video1"},
+		dims: Dimensions{Width: 224, Height: 224},
+		opts: Options{AugCopies: 3, Seed: 7},
+	}
+
+	views := ctx.views(segment{})
+	if len(views) != 3 {
+		t.Fatalf("views() returned %d views, want 3", len(views))
+	}
+	for i, v := range views {
+		if v.Name != fmt.Sprintf("aug%d", i) {
+			t.Errorf("view %d name = %s, want aug%d", i, v.Name, i)
+		}
+		if v.Zoom < 1 || v.Zoom > augMaxZoom || v.Jitter == nil {
+			t.Errorf("view %d = %+v, want zoom in [1, %v] and color jitter", i, v, augMaxZoom)
+		}
+	}
+	if views[0].X == views[1].X && views[0].Zoom == views[1].Zoom {
+		t.Error("augmented copies share the same crop")
+	}
+
+	again := ctx.views(segment{})
+	if again[2].X != views[2].X || again[2].Flip != views[2].Flip || *again[2].Jitter != *views[2].Jitter {
+		t.Error("augmented views are not deterministic for a fixed seed")
+	}
+	if other := ctx.views(segment{Start: 5}); other[0].X == views[0].X {
+		t.Error("augmented views did not vary with the segment")
+	}
+
+	// The recorded parameters regenerate the copy
+	ctx.view = views[1]
+	record := ctx.augmentation(segment{}, 100)
+	if record == nil || record.Seed != 7 || record.Copy != views[1].Augmentation {
+		t.Fatalf("augmentation() = %+v, want the run seed and the copy's parameters", record)
+	}
+	if regenerated := augmentedView("aug1", record.Copy, ctx.dims); regenerated.X != views[1].X || *regenerated.Jitter != *views[1].Jitter {
+		t.Errorf("augmentedView() from recorded parameters = %+v, want %+v", regenerated, views[1])
+	}
+	ctx.view, ctx.opts.AugCopies = nil, 0
+	if record := ctx.augmentation(segment{}, 100); record != nil {
+		t.Errorf("augmentation() without random transforms = %+v, want nil", record)
+	}
+
+	got := ComposeTransforms(MultiCropTransform{Width: 224, Height: 224, X: "0", Y: "0", Zoom: 1.1},
+		ColorJitterTransform{Brightness: -0.05, Contrast: 1.1, Saturation: 0.9})
+	want := "scale=248:248:force_original_aspect_ratio=increase,crop=224:224:0:0,eq=brightness=-0.050:contrast=1.100:saturation=0.900"
+	if got != want {
+		t.Errorf("augmented transform = %s, want %s", got, want)
+	}
+}
+
+func TestTimestampSampleArgs(t *testing.T) {
+	ctx := &clipContext{
+		clip: types.Clip{DenseLabels: &types.DenseLabels{FPS: 1, Labels: []string{"walk", "run", "run"}}},
+		opts: Options{Decimate: true},
+	}
+
+	labels, majority := ctx.labelsAt([]float64{2.5, 0.2, 1.9})
+	if fmt.Sprint(labels) != "[run walk run]" || majority != "run" {
+		t.Errorf("labelsAt() = %v, %q, want [run walk run], run", labels, majority)
+	}
+
+	kwargs := ctx.outputArgs(segment{Start: 2.5, Frames: 1})
+	if kwargs["frames:v"] != 1 || kwargs["vsync"] != "vfr" {
+		t.Errorf("outputArgs() = %v, want a single frame with vfr output", kwargs)
+	}
+	if input := (segment{Start: 2.5, Frames: 1}).inputArgs(); input["ss"] != "2.5" {
+		t.Errorf("inputArgs() = %v, want a seek to 2.5", input)
+	}
+}
+
+func TestClipLabelAndCaption(t *testing.T) {
+	ctx := &clipContext{
+		clip: types.Clip{Key: "video1", Label: "jump", Caption: "a man jumps"},
+		opts: Options{TargetFrames: 16, FPS: 8},
+	}
+	if labels, majority := ctx.labelsAt([]float64{0, 1}); labels != nil || majority != "jump" {
+		t.Errorf("labelsAt() without dense labels = %v, %q, want nil, jump", labels, majority)
+	}
+
+	// The clip label fills in where dense labels have no majority
+	ctx.clip.DenseLabels = &types.DenseLabels{FPS: 1, Labels: []string{"", "run"}}
+	if _, majority := ctx.labelsAt([]float64{0.5}); majority != "jump" {
+		t.Errorf("labelsAt() over unlabeled frames majority = %q, want jump", majority)
+	}
+	if _, majority := ctx.labelsAt([]float64{1.5}); majority != "run" {
+		t.Errorf("labelsAt() over labeled frames majority = %q, want run", majority)
+	}
+
+	if metadata := ctx.chunkMetadata(0, segment{}); metadata.Caption != "a man jumps" {
+		t.Errorf("chunkMetadata() caption = %q, want a man jumps", metadata.Caption)
+	}
+}
+
+func TestSaveSidecars(t *testing.T) {
+	dir := t.TempDir()
+	ctx := &clipContext{clip: types.Clip{Sidecars: map[string][]byte{"txt": []byte("a caption"), "json": []byte(`{}`)}}}
+	if err := ctx.saveSidecars(filepath.Join(dir, "sidecar")); err != nil {
+		t.Fatalf("saveSidecars() error = %v", err)
+	}
+	for name, want := range map[string]string{"sidecar.txt": "a caption", "sidecar.json": "{}"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestChunkOffset(t *testing.T) {
+	ctx := &clipContext{clip: types.Clip{Key: "video1"}, opts: Options{TargetFrames: 16}}
+	if got := ctx.chunkOffset(segment{}, 100); got != 0 {
+		t.Errorf("chunkOffset() without jitter = %d, want 0", got)
+	}
+
+	ctx.opts.ChunkJitter = true
+	first := ctx.chunkOffset(segment{}, 100)
+	if first < 0 || first >= 16 {
+		t.Errorf("chunkOffset() = %d, want an offset in [0, 16)", first)
+	}
+	if again := ctx.chunkOffset(segment{}, 100); again != first {
+		t.Errorf("chunkOffset() = %d on a second call, want the seeded %d", again, first)
+	}
+
+	// Offsets are capped so one chunk still fits
+	for seed := int64(0); seed < 50; seed++ {
+		ctx.opts.Seed = seed
+		if got := ctx.chunkOffset(segment{}, 20); got > 4 {
+			t.Fatalf("chunkOffset() with seed %d = %d, want at most 4 for 20 frames", seed, got)
+		}
+	}
+	if got := ctx.chunkOffset(segment{}, 10); got != 0 {
+		t.Errorf("chunkOffset() for a clip shorter than a chunk = %d, want 0", got)
+	}
+
+	// Overlapping chunks are offset by less than one stride
+	ctx.opts.Stride = 4
+	for seed := int64(0); seed < 50; seed++ {
+		ctx.opts.Seed = seed
+		if got := ctx.chunkOffset(segment{}, 100); got >= 4 {
+			t.Fatalf("chunkOffset() with seed %d and stride 4 = %d, want below 4", seed, got)
+		}
+	}
+}
+
+func TestPlanBoxCrop(t *testing.T) {
+	boxes := []types.Box{
+		{T: 0, X: 50, Y: 0, W: 100, H: 200},
+		{T: 1, X: 150, Y: 0, W: 100, H: 200},
+		{T: 2, X: 250, Y: 0, W: 100, H: 200},
+	}
+
+	crop := planBoxCrop(boxes, 3, 640, 480, 1)
+	if crop.Width != 200 || crop.Height != 200 {
+		t.Errorf("planBoxCrop() size = %dx%d, want 200x200", crop.Width, crop.Height)
+	}
+	var xs []float64
+	for _, k := range crop.Keyframes {
+		xs = append(xs, k.X)
+	}
+	if fmt.Sprint(xs) != "[150 200 250]" {
+		t.Errorf("planBoxCrop() smoothed centers = %v, want [150 200 250]", xs)
+	}
+
+	// A wide output clamps the crop to the source width
+	if wide := planBoxCrop(boxes, 1, 640, 480, 16.0/9); wide.Width != 354 || wide.Height != 200 {
+		t.Errorf("planBoxCrop(16:9) size = %dx%d, want 354x200", wide.Width, wide.Height)
+	}
+	if tall := planBoxCrop(boxes, 1, 640, 180, 1); tall.Width != 180 || tall.Height != 180 {
+		t.Errorf("planBoxCrop() clamped size = %dx%d, want 180x180", tall.Width, tall.Height)
+	}
+
+	got := ComposeTransforms(crop.transform(1))
+	want := `crop=w=200:h=200:x=clip(if(lt(clip(t\,-1.000\,1.000)\,0.000)\,150.00+50.0000*(clip(t\,-1.000\,1.000)+1.000)\,if(lt(clip(t\,-1.000\,1.000)\,1.000)\,200.00+50.0000*(clip(t\,-1.000\,1.000)+0.000)\,250.00))-100\,0\,iw-200):y=clip(100.00-100\,0\,ih-200)`
+	if got != want {
+		t.Errorf("box crop transform = %s, want %s", got, want)
+	}
+}
+
+func TestKeyframeAlignedStarts(t *testing.T) {
+	keyframes, err := parseKeyframes([]byte(`{"frames": [
+		{"pts_time": "0.040000"}, {"pts_time": "1.040000"}, {"pts_time": "1.540000"},
+		{"pts_time": "N/A"}, {"pts_time": "4.040000"}, {"pts_time": "5.540000"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parseKeyframes() error = %v", err)
+	}
+	if fmt.Sprint(keyframes) != "[0 1 1.5 4 5.5]" {
+		t.Fatalf("parseKeyframes() = %v, want times relative to the first keyframe", keyframes)
+	}
+
+	tests := []struct {
+		name  string
+		seg   segment
+		total int
+		want  string
+	}{
+		{"whole clip", segment{}, 60, "[0 10 40]"},
+		{"segment", segment{Start: 0.95, End: 6}, 50, "[1 31]"},
+		{"too short", segment{}, 10, "[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 10 fps, 10-frame chunks: the keyframe at 1.5s falls inside the chunk from 1s
+			got := fmt.Sprint(keyframeAlignedStarts(keyframes, tt.seg, 10, 10, tt.total))
+			if got != tt.want {
+				t.Errorf("keyframeAlignedStarts() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		n    int
+		want string
+	}{
+		{"shorter than n", "line1\nline2\n", 5, "line1\nline2"},
+		{"longer than n", "a\nb\nc\nd\n", 2, "c\nd"},
+		{"empty", "", 3, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stderrTail(tt.log, tt.n); got != tt.want {
+				t.Errorf("stderrTail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestProcessClip(t *testing.T) {
 	// Create a test video file (3 seconds at 8fps = 24 frames)
 	testVideoPath := createTestVideo(t, 3.0)
@@ -0,0 +1,30 @@
+package processor
+
+import (
+	"encoding/binary"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/torch"
+)
+
+// torchDType returns the tensor element type of pt chunks with samples of
+// the given NumPy dtype
+func torchDType(dtype numpy.DType) torch.DType {
+	switch dtype {
+	case numpy.Float32:
+		return torch.Float32
+	case numpy.Int32:
+		return torch.Int32
+	default:
+		return torch.Uint8
+	}
+}
+
+// widenSamples converts little-endian uint16 samples to little-endian int32
+func widenSamples(data []byte) []byte {
+	out := make([]byte, len(data)*2)
+	for i := 0; i+2 <= len(data); i += 2 {
+		binary.LittleEndian.PutUint32(out[i*2:], uint32(binary.LittleEndian.Uint16(data[i:])))
+	}
+	return out
+}
@@ -0,0 +1,218 @@
+package processor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// maxPSNR caps the PSNR of identical frames, which ffmpeg reports as inf
+const maxPSNR = 100.0
+
+// frameQuality holds the quality scores of a single output frame
+type frameQuality struct {
+	PSNR float64
+	SSIM float64
+	VMAF float64
+}
+
+// qualityMetrics selects which metrics measureQuality computes
+type qualityMetrics struct {
+	PSNRSSIM bool
+	VMAF     bool
+}
+
+// qualityMetrics returns the metrics enabled by the options
+func (o Options) qualityMetrics() qualityMetrics {
+	return qualityMetrics{PSNRSSIM: o.QualityMetrics, VMAF: o.VMAF}
+}
+
+// any reports whether at least one metric is enabled
+func (m qualityMetrics) any() bool {
+	return m.PSNRSSIM || m.VMAF
+}
+
+// measureQuality computes per-frame quality scores of the processed frames of
+// a segment against the source after the pre-scale transforms (fps, crop, box crop). If
+// framesPattern is empty the reference is compared against the resized raw
+// frames (measuring resize loss); otherwise it is compared against the encoded
+// image sequence on disk (measuring resize plus encoding loss). Distorted
+// frames are scaled back up to the source resolution before comparison.
+func (c *clipContext) measureQuality(seg segment, framesPattern string) ([]frameQuality, error) {
+	dims, fps, metrics := c.dims, c.opts.FPS, c.opts.qualityMetrics()
+
+	statsDir, err := os.MkdirTemp("", "govidprep-quality-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating quality stats directory: %w", err)
+	}
+	defer os.RemoveAll(statsDir)
+	ssimPath := filepath.Join(statsDir, "ssim.log")
+	psnrPath := filepath.Join(statsDir, "psnr.log")
+	vmafPath := filepath.Join(statsDir, "vmaf.json")
+
+	source := applyTransforms(c.videoInput(seg), c.sourceTransforms(seg))
+
+	var dist *ffmpeg.Stream
+	var ref *ffmpeg.Stream
+	if framesPattern == "" {
+		split := source.Split()
+		ref = split.Get("0")
+		dist = split.Get("1").Filter("scale", ffmpeg.Args{strconv.Itoa(dims.Width), strconv.Itoa(dims.Height)})
+	} else {
+		// Renumber reference timestamps to match the image sequence, which
+		// starts at zero and has no gaps even when frames were decimated
+		ref = source.Filter("setpts", ffmpeg.Args{fmt.Sprintf("N/(%d*TB)", fps)})
+		dist = ffmpeg.Input(framesPattern, ffmpeg.KwArgs{"framerate": fps})
+	}
+
+	// Scale the distorted frames back to the source size, then give each
+	// metric filter its own copy of both streams
+	pair := ffmpeg.FilterMultiOutput([]*ffmpeg.Stream{dist, ref}, "scale2ref", nil)
+	dists := pair.Get("0").Split()
+	refs := pair.Get("1").Split()
+
+	var outputs []*ffmpeg.Stream
+	addMetric := func(name string, kwargs ffmpeg.KwArgs) {
+		label := strconv.Itoa(len(outputs))
+		outputs = append(outputs, ffmpeg.Filter([]*ffmpeg.Stream{dists.Get(label), refs.Get(label)}, name, nil, kwargs))
+	}
+	if metrics.PSNRSSIM {
+		addMetric("ssim", ffmpeg.KwArgs{"stats_file": ssimPath})
+		addMetric("psnr", ffmpeg.KwArgs{"stats_file": psnrPath})
+	}
+	if metrics.VMAF {
+		addMetric("libvmaf", ffmpeg.KwArgs{"log_path": vmafPath, "log_fmt": "json"})
+	}
+
+	_, err = runFFmpeg(ffmpeg.Output(outputs, "-", ffmpeg.KwArgs{"f": "null"}).
+		OverWriteOutput(), c.debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("error measuring quality: %w", err)
+	}
+
+	var ssimScores, psnrScores, vmafScores []float64
+	n := -1
+	if metrics.PSNRSSIM {
+		if ssimScores, err = parseStatsFile(ssimPath, "All:"); err != nil {
+			return nil, err
+		}
+		if psnrScores, err = parseStatsFile(psnrPath, "psnr_avg:"); err != nil {
+			return nil, err
+		}
+		n = min(len(ssimScores), len(psnrScores))
+	}
+	if metrics.VMAF {
+		if vmafScores, err = parseVMAFLog(vmafPath); err != nil {
+			return nil, err
+		}
+		if n < 0 || len(vmafScores) < n {
+			n = len(vmafScores)
+		}
+	}
+
+	scores := make([]frameQuality, max(n, 0))
+	for i := range scores {
+		if metrics.PSNRSSIM {
+			scores[i].PSNR = psnrScores[i]
+			scores[i].SSIM = ssimScores[i]
+		}
+		if metrics.VMAF {
+			scores[i].VMAF = vmafScores[i]
+		}
+	}
+	return scores, nil
+}
+
+// vmafLog is the subset of libvmaf's JSON log that we read
+type vmafLog struct {
+	Frames []struct {
+		FrameNum int `json:"frameNum"`
+		Metrics  struct {
+			VMAF float64 `json:"vmaf"`
+		} `json:"metrics"`
+	} `json:"frames"`
+}
+
+// parseVMAFLog reads per-frame VMAF scores from a libvmaf JSON log
+func parseVMAFLog(path string) ([]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading vmaf log: %w", err)
+	}
+
+	var log vmafLog
+	if err := json.Unmarshal(data, &log); err != nil {
+		return nil, fmt.Errorf("error parsing vmaf log: %w", err)
+	}
+
+	values := make([]float64, len(log.Frames))
+	for i, frame := range log.Frames {
+		values[i] = frame.Metrics.VMAF
+	}
+	return values, nil
+}
+
+// parseStatsFile reads the per-frame value following field from an ffmpeg
+// psnr/ssim stats file, one line per frame
+func parseStatsFile(path string, field string) ([]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening stats file: %w", err)
+	}
+	defer f.Close()
+
+	var values []float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := parseStatsLine(scanner.Text(), field)
+		if ok {
+			values = append(values, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stats file: %w", err)
+	}
+	return values, nil
+}
+
+// parseStatsLine extracts the numeric value following field from a stats line
+func parseStatsLine(line, field string) (float64, bool) {
+	for _, token := range strings.Fields(line) {
+		if !strings.HasPrefix(token, field) {
+			continue
+		}
+		raw := strings.TrimPrefix(token, field)
+		if raw == "inf" {
+			return maxPSNR, true
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return 0, false
+		}
+		return value, true
+	}
+	return 0, false
+}
+
+// averageQuality returns the mean scores over the given frames
+func averageQuality(scores []frameQuality) frameQuality {
+	var avg frameQuality
+	if len(scores) == 0 {
+		return avg
+	}
+	for _, s := range scores {
+		avg.PSNR += s.PSNR
+		avg.SSIM += s.SSIM
+		avg.VMAF += s.VMAF
+	}
+	avg.PSNR /= float64(len(scores))
+	avg.SSIM /= float64(len(scores))
+	avg.VMAF /= float64(len(scores))
+	return avg
+}
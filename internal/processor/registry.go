@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TransformFactory builds a transform from the parameters of a transform
+// spec, the part after "=" (empty if there is none)
+type TransformFactory func(params string) (Transform, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]TransformFactory)
+)
+
+func init() {
+	// Common ffmpeg filters, passed through with their parameters
+	for _, name := range []string{"boxblur", "gblur", "unsharp", "eq", "hue", "hflip", "vflip", "negate"} {
+		RegisterTransform(name, filterFactory(name))
+	}
+	RegisterTransform("grayscale", func(params string) (Transform, error) {
+		if params != "" {
+			return nil, fmt.Errorf("grayscale takes no parameters")
+		}
+		return FilterTransform{Filters: "hue=s=0"}, nil
+	})
+}
+
+// RegisterTransform makes a transform available by name to ParseTransform,
+// and so to the -transform flag. It panics if the name is empty, contains
+// "=" or is already registered, like database/sql.Register. The package is
+// internal, so transforms are registered by code in this module, e.g. an init
+// function in a file next to this one.
+func RegisterTransform(name string, factory TransformFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if name == "" || strings.Contains(name, "=") {
+		panic(fmt.Sprintf("processor: invalid transform name %q", name))
+	}
+	if factory == nil {
+		panic("processor: RegisterTransform factory is nil")
+	}
+	if _, ok := registry[name]; ok {
+		panic("processor: RegisterTransform called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// RegisteredTransforms returns the names of the registered transforms in
+// sorted order
+func RegisteredTransforms() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseTransform builds a registered transform from a spec of its name,
+// optionally followed by "=" and its parameters, e.g. "boxblur=2"
+func ParseTransform(spec string) (Transform, error) {
+	name, params, _ := strings.Cut(strings.TrimSpace(spec), "=")
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transform %q (registered: %s)", name, strings.Join(RegisteredTransforms(), ", "))
+	}
+	t, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transform %q: %w", spec, err)
+	}
+	return t, nil
+}
+
+// filterFactory returns a factory passing the parameters through to the
+// ffmpeg filter of the same name
+func filterFactory(name string) TransformFactory {
+	return func(params string) (Transform, error) {
+		if params == "" {
+			return FilterTransform{Filters: name}, nil
+		}
+		return FilterTransform{Filters: name + "=" + params}, nil
+	}
+}
@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"errors"
+	"time"
+)
+
+// ClipStatus is the outcome of processing a single clip
+type ClipStatus string
+
+const (
+	ClipOK     ClipStatus = "ok"
+	ClipFailed ClipStatus = "failed"
+	// ClipEmpty marks a clip that was processed but produced no chunks,
+	// e.g. because it was shorter than one chunk
+	ClipEmpty ClipStatus = "empty"
+	// ClipSkipped marks a clip skipped before processing because the
+	// Options.Precheck found it empty, truncated or undecodable, or it is
+	// shorter than the minimum length (Err wraps ErrTooShort)
+	ClipSkipped ClipStatus = "skipped"
+)
+
+// DiscardCounts breaks down the frames dropped from a clip by reason
+type DiscardCounts struct {
+	// Remainder counts frames outside any complete chunk: the trailing
+	// remainder and frames skipped by chunk jitter, keyframe alignment, a
+	// stride longer than a chunk or the per-clip chunk cap
+	Remainder int
+	// Silent counts the frames of chunks dropped for silent audio
+	Silent int
+	// Decimated counts near-duplicate frames removed by mpdecimate
+	Decimated int
+}
+
+// Total returns the number of frames discarded for any reason
+func (d DiscardCounts) Total() int {
+	return d.Remainder + d.Silent + d.Decimated
+}
+
+func (d *DiscardCounts) add(other DiscardCounts) {
+	d.Remainder += other.Remainder
+	d.Silent += other.Silent
+	d.Decimated += other.Decimated
+}
+
+// ClipResult describes the outcome of processing a single clip
+type ClipResult struct {
+	Key    string
+	Status ClipStatus
+	// Chunks is the number of chunks written for the clip
+	Chunks int
+	// FramesDiscarded counts the frames that were not written to any chunk
+	FramesDiscarded DiscardCounts
+	Duration        time.Duration
+	// Err is the error that failed the clip, or the reason it was skipped
+	Err error
+}
+
+// Summary aggregates the results of processing a set of clips
+type Summary struct {
+	Clips  int
+	Failed int
+	// Empty counts clips discarded because they produced no chunks
+	Empty int
+	// Skipped counts clips skipped by the precheck
+	Skipped int
+	// TooShort counts clips skipped for being shorter than the minimum length
+	TooShort        int
+	Chunks          int
+	FramesDiscarded DiscardCounts
+}
+
+// Summarize aggregates per-clip results
+func Summarize(results []ClipResult) Summary {
+	summary := Summary{Clips: len(results)}
+	for _, result := range results {
+		switch result.Status {
+		case ClipFailed:
+			summary.Failed++
+		case ClipEmpty:
+			summary.Empty++
+		case ClipSkipped:
+			if errors.Is(result.Err, ErrTooShort) {
+				summary.TooShort++
+			} else {
+				summary.Skipped++
+			}
+		}
+		summary.Chunks += result.Chunks
+		summary.FramesDiscarded.add(result.FramesDiscarded)
+	}
+	return summary
+}
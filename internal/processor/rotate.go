@@ -0,0 +1,37 @@
+package processor
+
+import "math"
+
+// RotateTransform rotates frames clockwise by a multiple of 90 degrees,
+// e.g. to display phone video recorded in portrait upright
+type RotateTransform struct {
+	Degrees int
+}
+
+func (t RotateTransform) FFmpegArgs() []string {
+	switch t.Degrees {
+	case 90:
+		return []string{"transpose=clock"}
+	case 180:
+		return []string{"hflip", "vflip"}
+	case 270:
+		return []string{"transpose=cclock"}
+	}
+	return nil
+}
+
+// clockwiseRotation normalizes a rotation in degrees to the clockwise
+// multiple of 90 in [0, 360) nearest to it
+func clockwiseRotation(degrees float64) int {
+	quarters := int(math.Round(degrees / 90))
+	return ((quarters%4 + 4) % 4) * 90
+}
+
+// rotationTransforms returns the transform displaying the clip upright, if
+// it needs rotating
+func (c *clipContext) rotationTransforms() []Transform {
+	if c.rotation == 0 {
+		return nil
+	}
+	return []Transform{RotateTransform{Degrees: c.rotation}}
+}
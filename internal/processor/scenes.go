@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// defaultSceneThreshold is the scene score (0-1) above which a frame starts
+// a new shot
+const defaultSceneThreshold = 0.3
+
+// scenePattern matches the time of a frame printed by ffmpeg's showinfo filter
+var scenePattern = regexp.MustCompile(`\bpts_time:\s*(-?[\d.]+)`)
+
+// detectScenes runs ffmpeg's scene change detection over the clip and
+// returns the times in seconds of the frames starting a new shot. Only the
+// video stream with index stream among the video streams is examined.
+func detectScenes(videoPath string, stream int, threshold float64, debugLog io.Writer) ([]float64, error) {
+	// Cuts are found in the stored frames; rotation does not change them
+	stderr, err := runFFmpeg(ffmpeg.Input(videoPath, ffmpeg.KwArgs{"noautorotate": ""}).
+		Get(videoSelector(stream)).
+		Output("-", ffmpeg.KwArgs{
+			"vf": fmt.Sprintf("select='gt(scene,%g)',showinfo", threshold),
+			"an": "",
+			"f":  "null",
+		}), debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting scenes: %w", err)
+	}
+
+	return parseSceneCuts(stderr), nil
+}
+
+// parseSceneCuts extracts the times of the selected frames from showinfo's
+// log output, in increasing order
+func parseSceneCuts(log string) []float64 {
+	var cuts []float64
+	for _, m := range scenePattern.FindAllStringSubmatch(log, -1) {
+		t, err := strconv.ParseFloat(m[1], 64)
+		if err != nil || len(cuts) > 0 && t <= cuts[len(cuts)-1] {
+			continue
+		}
+		cuts = append(cuts, t)
+	}
+	return cuts
+}
+
+// shotSegments splits segments at the clip's scene cuts, returning one
+// segment per shot, numbered consecutively across the clip
+func (c *clipContext) shotSegments(segments []segment) []segment {
+	var shots []segment
+	for _, seg := range segments {
+		start := seg.Start
+		for _, cut := range c.sceneCuts {
+			if cut <= start || seg.End > 0 && cut >= seg.End {
+				continue
+			}
+			shots = append(shots, c.shot(seg, start, cut, len(shots)))
+			start = cut
+		}
+		shots = append(shots, c.shot(seg, start, seg.End, len(shots)))
+	}
+	return shots
+}
+
+// shot returns the segment of the shot from start to end within seg. An end
+// of 0 means the end of the video, recorded as its probed duration.
+func (c *clipContext) shot(seg segment, start, end float64, index int) segment {
+	shot := &types.Shot{Index: index, Start: start, End: end}
+	if end <= 0 {
+		shot.End = c.duration
+	}
+	return segment{Start: start, End: end, Span: seg.Span, Shot: shot}
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// SilenceMode controls what happens to chunks whose audio is silent
+type SilenceMode string
+
+const (
+	// SilenceOff disables silence detection
+	SilenceOff SilenceMode = ""
+	// SilenceFlag marks silent chunks in their metadata
+	SilenceFlag SilenceMode = "flag"
+	// SilenceDrop skips writing silent chunks
+	SilenceDrop SilenceMode = "drop"
+)
+
+// defaultSilenceThresholdDB is the noise level below which audio counts as silent
+const defaultSilenceThresholdDB = -50.0
+
+// silenceInterval is a span of silent audio in seconds. End is negative if
+// the silence runs to the end of the stream.
+type silenceInterval struct {
+	Start float64
+	End   float64
+}
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[\d.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (-?[\d.]+)`)
+)
+
+// detectSilence runs ffmpeg's silencedetect over the clip's audio track and
+// returns the silent intervals. Clips without audio have no silent intervals.
+func detectSilence(videoPath string, thresholdDB float64, debugLog io.Writer) ([]silenceInterval, error) {
+	info, err := probeVideo(videoPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasAudio {
+		return nil, nil
+	}
+
+	stderr, err := runFFmpeg(ffmpeg.Input(videoPath).
+		Output("-", ffmpeg.KwArgs{
+			"af": fmt.Sprintf("silencedetect=noise=%gdB:d=0.1", thresholdDB),
+			"vn": "",
+			"f":  "null",
+		}), debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting silence: %w", err)
+	}
+
+	return parseSilenceDetect(stderr), nil
+}
+
+// parseSilenceDetect extracts silent intervals from silencedetect's log output
+func parseSilenceDetect(log string) []silenceInterval {
+	var intervals []silenceInterval
+	starts := silenceStartPattern.FindAllStringSubmatchIndex(log, -1)
+	ends := silenceEndPattern.FindAllStringSubmatchIndex(log, -1)
+
+	for i, start := range starts {
+		interval := silenceInterval{End: -1}
+		interval.Start, _ = strconv.ParseFloat(log[start[2]:start[3]], 64)
+		// Pair each start with the next end that follows it
+		for _, end := range ends {
+			if end[0] > start[0] && (i+1 >= len(starts) || end[0] < starts[i+1][0]) {
+				interval.End, _ = strconv.ParseFloat(log[end[2]:end[3]], 64)
+				break
+			}
+		}
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// isSilent reports whether the time span [start, end) lies entirely within one silent interval
+func isSilent(intervals []silenceInterval, start, end float64) bool {
+	for _, interval := range intervals {
+		if interval.Start <= start && (interval.End < 0 || interval.End >= end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package processor
+
+import (
+	"fmt"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
+)
+
+// videoSelector returns the ffmpeg stream specifier of the video stream with
+// the given index among a file's video streams
+func videoSelector(stream int) string {
+	return fmt.Sprintf("v:%d", stream)
+}
+
+// videoInput returns the clip's selected video stream as an ffmpeg input
+// seeking to the segment. The stream is always mapped explicitly, since
+// ffmpeg otherwise picks the largest video stream rather than the first.
+func (c *clipContext) videoInput(seg segment) *ffmpeg.Stream {
+	return ffmpeg.Input(c.videoPath, seg.inputArgs()).Get(videoSelector(c.stream))
+}
+
+// streamName returns the directory name of a video stream's chunk set when
+// chunking all streams
+func streamName(stream int) string {
+	return fmt.Sprintf("stream_%d", stream)
+}
+
+// key returns the key of the clip's current chunk set: the clip key, with
+// the stream directory appended when chunking all video streams
+func (c *clipContext) key() string {
+	if c.opts.AllStreams {
+		return c.clip.Key + "/" + streamName(c.stream)
+	}
+	return c.clip.Key
+}
+
+// streams returns the indexes of the video streams to chunk, given the
+// number of video streams in the clip
+func (o Options) streams(count int) []int {
+	if !o.AllStreams {
+		return []int{o.VideoStream}
+	}
+	streams := make([]int, count)
+	for i := range streams {
+		streams[i] = i
+	}
+	return streams
+}
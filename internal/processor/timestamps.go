@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// uniformTimestamps returns the times of n frames spread evenly over a clip
+// of the given duration in seconds: the centers of n equal segments, so the
+// first and last frames are not at the very edges of the clip. Times are
+// rounded to milliseconds.
+func uniformTimestamps(duration float64, n int) []float64 {
+	timestamps := make([]float64, n)
+	for i := range timestamps {
+		timestamps[i] = roundTo((float64(i)+0.5)*duration/float64(n), 3)
+	}
+	return timestamps
+}
+
+// processTimestamps extracts the frames at the clip's timestamps as a single
+// sample, once per crop view or augmented copy
+func processTimestamps(ctx *clipContext) error {
+	firstChunk := ctx.nextChunk
+	for _, view := range ctx.views(segment{}) {
+		ctx.view = view
+		ctx.nextChunk = firstChunk
+		if err := processTimestampSample(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processTimestampSample writes the frames at the clip's timestamps as one
+// sample. Each frame is extracted by its own ffmpeg invocation with an
+// accurate seek, so timestamps may be in any order and may repeat.
+func processTimestampSample(ctx *clipContext) error {
+	opts, timestamps := ctx.opts, ctx.clip.Timestamps
+	chunkIdx := ctx.nextChunk
+	ctx.nextChunk++
+	ext := "." + string(opts.Format)
+
+	chunkDir := filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx))
+	if !opts.Format.isArray() {
+		if err := os.MkdirAll(chunkDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	var rawData []byte
+	for j, t := range timestamps {
+		seg := segment{Start: t, Frames: 1}
+		if opts.Format.isArray() {
+			frame, err := ctx.extractRawFrames(seg)
+			if err != nil {
+				return err
+			}
+			if len(frame) == 0 {
+				return fmt.Errorf("no frame at %gs", t)
+			}
+			rawData = append(rawData, frame...)
+			continue
+		}
+
+		if err := ctx.saveFrames(seg); err != nil {
+			return fmt.Errorf("error extracting frame at %gs: %w", t, err)
+		}
+		extracted := filepath.Join(ctx.outPath, fmt.Sprintf(extractPattern, 1)+ext)
+		if err := os.Rename(extracted, filepath.Join(chunkDir, opts.frameName(j)+ext)); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("no frame at %gs", t)
+			}
+			return fmt.Errorf("error moving frame at %gs: %w", t, err)
+		}
+	}
+
+	metadata := ctx.chunkMetadata(chunkIdx, segment{})
+	metadata.FrameCount = len(timestamps)
+	metadata.Timestamps = timestamps
+	metadata.FrameLabels, metadata.Label = ctx.labelsAt(timestamps)
+	metadata.Augmentation = ctx.augmentation(segment{}, 0)
+
+	if !opts.Format.isArray() {
+		metadataFile := filepath.Join(chunkDir, "metadata."+opts.MetadataFormat.Ext())
+		if err := saveMetadata(metadata, metadataFile, opts.MetadataFormat); err != nil {
+			return err
+		}
+		if err := ctx.saveSidecars(filepath.Join(chunkDir, "sidecar")); err != nil {
+			return err
+		}
+		return ctx.saveCaption(filepath.Join(chunkDir, "caption.txt"))
+	}
+
+	rawData = opts.encodeSamples(rawData, ctx.dims)
+	metadata.DType = string(opts.numpyDType())
+	metadata.PixelFormat = string(opts.pixelFormat())
+	metadata.Layout = string(opts.layout())
+	metadata.Normalization = opts.Normalize
+	if err := ctx.saveNumpyChunk(ctx.chunkName(chunkIdx), rawData, len(timestamps), metadata); err != nil {
+		return err
+	}
+	if err := ctx.saveSidecars(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_sidecar")); err != nil {
+		return err
+	}
+	return ctx.saveCaption(filepath.Join(ctx.outPath, ctx.chunkName(chunkIdx)+"_caption.txt"))
+}
@@ -3,6 +3,8 @@ package processor
 import (
 	"fmt"
 	"strings"
+
+	ffmpeg "github.com/u2takey/ffmpeg-go"
 )
 
 // Transform represents a video transformation that can be applied using ffmpeg
@@ -20,6 +22,17 @@ func (t FPSTransform) FFmpegArgs() []string {
 	return []string{fmt.Sprintf("fps=%d", t.FPS)}
 }
 
+// InterpolateTransform sets the output frame rate like FPSTransform, but
+// synthesizes intermediate frames with motion-compensated interpolation
+// (minterpolate) instead of duplicating frames
+type InterpolateTransform struct {
+	FPS int
+}
+
+func (t InterpolateTransform) FFmpegArgs() []string {
+	return []string{fmt.Sprintf("minterpolate=fps=%d:mi_mode=mci", t.FPS)}
+}
+
 // ScaleTransform resizes the video
 type ScaleTransform struct {
 	Width  int
@@ -38,3 +51,134 @@ func ComposeTransforms(transforms ...Transform) string {
 	}
 	return strings.Join(args, ",")
 }
+
+// CropTransform crops a region of the given size at offset (X, Y)
+type CropTransform struct {
+	Width  int
+	Height int
+	X      int
+	Y      int
+}
+
+func (t CropTransform) FFmpegArgs() []string {
+	return []string{fmt.Sprintf("crop=%d:%d:%d:%d", t.Width, t.Height, t.X, t.Y)}
+}
+
+// FilterTransform appends a user-supplied ffmpeg filter chain, e.g.
+// "eq=contrast=1.1,unsharp", passed through verbatim
+type FilterTransform struct {
+	Filters string
+}
+
+func (t FilterTransform) FFmpegArgs() []string {
+	return []string{t.Filters}
+}
+
+// DeinterlaceMode selects which clips are deinterlaced
+type DeinterlaceMode string
+
+const (
+	// DeinterlaceOff leaves frames as decoded
+	DeinterlaceOff DeinterlaceMode = ""
+	// DeinterlaceOn deinterlaces every clip
+	DeinterlaceOn DeinterlaceMode = "on"
+	// DeinterlaceAuto deinterlaces clips whose field order ffprobe reports
+	// as interlaced
+	DeinterlaceAuto DeinterlaceMode = "auto"
+)
+
+// DeinterlaceTransform deinterlaces frames with yadif, emitting one frame
+// per frame so the frame rate is unchanged
+type DeinterlaceTransform struct{}
+
+func (t DeinterlaceTransform) FFmpegArgs() []string {
+	return []string{"yadif"}
+}
+
+// Denoise filters for Options.Denoise
+const (
+	// DenoiseHQDN3D is ffmpeg's fast spatio-temporal hqdn3d filter
+	DenoiseHQDN3D = "hqdn3d"
+	// DenoiseNLMeans is ffmpeg's slower, higher quality non-local means
+	// filter
+	DenoiseNLMeans = "nlmeans"
+)
+
+// DenoiseTransform removes noise with the hqdn3d or nlmeans filter. Strength
+// is hqdn3d's luma spatial strength (default 4, the other strengths follow
+// it) or nlmeans' denoising strength s (default 1); 0 uses the default.
+type DenoiseTransform struct {
+	Filter   string
+	Strength float64
+}
+
+func (t DenoiseTransform) FFmpegArgs() []string {
+	if t.Strength == 0 {
+		return []string{t.Filter}
+	}
+	param := "luma_spatial"
+	if t.Filter == DenoiseNLMeans {
+		param = "s"
+	}
+	return []string{fmt.Sprintf("%s=%s=%g", t.Filter, param, t.Strength)}
+}
+
+// FlipTransform mirrors frames horizontally (hflip)
+type FlipTransform struct{}
+
+func (t FlipTransform) FFmpegArgs() []string {
+	return []string{"hflip"}
+}
+
+// DecimateTransform drops consecutive near-identical frames (mpdecimate).
+// Output must use variable frame rate so the dropped frames are not re-duplicated.
+type DecimateTransform struct{}
+
+func (t DecimateTransform) FFmpegArgs() []string {
+	return []string{"mpdecimate"}
+}
+
+// applyTransforms chains the transforms onto an ffmpeg-go stream as filter nodes
+func applyTransforms(stream *ffmpeg.Stream, transforms []Transform) *ffmpeg.Stream {
+	for _, t := range transforms {
+		for _, arg := range t.FFmpegArgs() {
+			name, params, _ := strings.Cut(arg, "=")
+			var args ffmpeg.Args
+			if params != "" {
+				args = ffmpeg.Args{params}
+			}
+			stream = stream.Filter(name, args)
+		}
+	}
+	return stream
+}
+
+// OverlayTransform burns a label, the frame index and the frame timestamp into
+// the top-left corner of each frame (drawtext), for debugging temporal
+// alignment in downstream loaders
+type OverlayTransform struct {
+	Label string
+	// Offset is added to the frame timestamp, e.g. the segment start when
+	// the input was seeked
+	Offset float64
+}
+
+func (t OverlayTransform) FFmpegArgs() []string {
+	text := fmt.Sprintf("%s #%%{n} %%{pts\\:hms\\:%g}", drawTextSafe(t.Label), t.Offset)
+	return []string{fmt.Sprintf(
+		"drawtext=text='%s':x=4:y=4:fontsize=12:fontcolor=white:box=1:boxcolor=black@0.6", text)}
+}
+
+// drawTextSafe replaces characters that would need filtergraph or drawtext
+// escaping, which is only for display, with underscores
+func drawTextSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune("._-/ ", r):
+			return r
+		}
+		return '_'
+	}, s)
+}
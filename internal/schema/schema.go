@@ -0,0 +1,233 @@
+// Package schema publishes JSON Schemas for the metadata and manifest files
+// written by govidprep and validates documents against them.
+//
+// The validator implements the subset of JSON Schema (draft 2020-12) used by
+// the bundled schemas: type, enum, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, minimum,
+// maximum and local $ref into $defs.
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+//go:embed *.schema.json
+var files embed.FS
+
+// Names of the bundled schemas
+const (
+	ClipMetadata = "clip_metadata"
+	Dataset      = "dataset"
+)
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	root map[string]any
+}
+
+// Load returns the bundled schema with the given name
+func Load(name string) (*Schema, error) {
+	data, err := files.ReadFile(name + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema: %s", name)
+	}
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing schema %s: %v", name, err)
+	}
+	return &Schema{root: root}, nil
+}
+
+// Source returns the JSON text of the bundled schema with the given name
+func Source(name string) ([]byte, error) {
+	return files.ReadFile(name + ".schema.json")
+}
+
+// ValidateJSON parses a JSON document and returns its violations of the
+// schema, each prefixed with the JSON pointer of the offending value
+func (s *Schema) ValidateJSON(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing document: %v", err)
+	}
+	return s.Validate(doc), nil
+}
+
+// Validate returns the violations of the schema by a document decoded with
+// json.Decoder.UseNumber
+func (s *Schema) Validate(doc any) []string {
+	var problems []string
+	s.validate(s.root, doc, "", &problems)
+	return problems
+}
+
+func (s *Schema) validate(schema map[string]any, value any, path string, problems *[]string) {
+	report := func(format string, args ...any) {
+		at := path
+		if at == "" {
+			at = "/"
+		}
+		*problems = append(*problems, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := s.resolve(ref)
+		if err != nil {
+			report("%v", err)
+			return
+		}
+		schema = target
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		report("expected %v, got %s", types, typeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if equal(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report("%v is not one of %v", value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			report("%v is less than the minimum %v", v, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			report("%v is greater than the maximum %v", v, max)
+		}
+	case string:
+		if min, ok := schema["minLength"].(float64); ok && float64(len(v)) < min {
+			report("string is shorter than %v", min)
+		}
+	case []any:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			report("array has %d items, want at least %v", len(v), min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			report("array has %d items, want at most %v", len(v), max)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s/%d", path, i), problems)
+			}
+		}
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					report("missing required property %q", name)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := properties[k].(map[string]any); ok {
+				s.validate(prop, v[k], path+"/"+k, problems)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				report("unexpected property %q", k)
+			}
+		}
+	}
+}
+
+// resolve returns the schema a local reference such as #/$defs/crop points to
+func (s *Schema) resolve(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference %s", ref)
+	}
+	var node any = s.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolved reference %s", ref)
+		}
+		node = m[part]
+	}
+	target, ok := node.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unresolved reference %s", ref)
+	}
+	return target, nil
+}
+
+// matchesType reports whether value has the schema type, or one of the types
+// when a list is given
+func matchesType(types any, value any) bool {
+	if list, ok := types.([]any); ok {
+		for _, t := range list {
+			if matchesType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	name := typeName(value)
+	switch types {
+	case name:
+		return true
+	case "number":
+		return name == "integer"
+	}
+	return false
+}
+
+// typeName returns the JSON Schema type of a decoded value
+func typeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// equal compares a schema enum value, decoded without UseNumber, with a
+// document value
+func equal(allowed, value any) bool {
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		a, isNumber := allowed.(float64)
+		return err == nil && isNumber && f == a
+	case string, bool, nil:
+		return allowed == value
+	}
+	return false
+}
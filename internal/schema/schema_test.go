@@ -0,0 +1,187 @@
+package schema
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/dataset"
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// TestSchemasMatchTypes catches drift between the Go types and the schemas:
+// every field set, including optional ones, must validate
+func TestSchemasMatchTypes(t *testing.T) {
+	metadata := types.ClipMetadata{
+		Key: "video1/chunk_00000_aug0", FPS: 8, FrameCount: 16, Size: []int{224, 224},
+		IsPadded: true, IsTrimmed: true, OriginalFPS: 30, BitDepth: 16, DType: "<f4",
+		PSNR: 40.5, SSIM: 0.98, VMAF: 91.2,
+		Crop:          &types.CropRegion{Width: 1920, Height: 800, X: 0, Y: 140},
+		Decimated:     true,
+		Silent:        true,
+		Span:          &types.Span{Start: 1, End: 4.5, Label: "jump"},
+		Label:         "jump",
+		FrameLabels:   []string{"jump", ""},
+		Caption:       "a man jumps",
+		Normalization: &types.Normalization{Mean: []float64{0.4, 0.4, 0.4}, Std: []float64{0.2, 0.2, 0.2}},
+		BaseKey:       "video1/chunk_00000",
+		CropView:      "aug0",
+		Timestamps:    []float64{0.5, 2},
+		Augmentation: &types.Augmentation{Seed: -3, ChunkOffset: 2, Copy: &types.AugmentedCopy{
+			Seed: 42, Zoom: 1.1, CropX: 0.5, CropY: 1, Flip: true, Brightness: -0.05, Contrast: 1.1, Saturation: 0.9,
+		}},
+	}
+	manifest := dataset.Manifest{Stats: &types.ChannelStats{
+		Mean: []float64{0.4, 0.4, 0.4}, Std: []float64{0.2, 0.2, 0.2}, Chunks: 10, Pixels: 1000,
+	}}
+
+	tests := []struct {
+		schema string
+		value  any
+	}{
+		{ClipMetadata, metadata},
+		{ClipMetadata, types.ClipMetadata{Key: "video1/chunk_00000", FPS: 8, FrameCount: 16, Size: []int{224, 224}}},
+		{Dataset, manifest},
+		{Dataset, dataset.Manifest{}},
+	}
+	for _, tt := range tests {
+		s, err := Load(tt.schema)
+		if err != nil {
+			t.Fatalf("Load(%s) error = %v", tt.schema, err)
+		}
+		data, err := json.Marshal(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		problems, err := s.ValidateJSON(data)
+		if err != nil || len(problems) > 0 {
+			t.Errorf("%s: ValidateJSON(%s) = %v, %v, want no problems", tt.schema, data, problems, err)
+		}
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	s, err := Load(ClipMetadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"missing key", `{"fps": 8, "frame_count": 16, "size": [224, 224]}`, `/: missing required property "key"`},
+		{"wrong type", `{"key": "a", "fps": "8", "frame_count": 16, "size": [224, 224]}`, `/fps: expected integer, got string`},
+		{"fractional integer", `{"key": "a", "fps": 8.5, "frame_count": 16, "size": [224, 224]}`, `/fps: expected integer, got number`},
+		{"unknown property", `{"key": "a", "fps": 8, "frame_count": 16, "size": [224, 224], "extra": 1}`, `/: unexpected property "extra"`},
+		{"size length", `{"key": "a", "fps": 8, "frame_count": 16, "size": [224, 224, 3]}`, `/size: array has 3 items, want at most 2`},
+		{"enum", `{"key": "a", "fps": 8, "frame_count": 16, "size": [224, 224], "bit_depth": 10}`, `/bit_depth: 10 is not one of [8 16]`},
+		{"nested ref", `{"key": "a", "fps": 8, "frame_count": 16, "size": [224, 224], "crop": {"width": 0, "height": 1, "x": 0, "y": 0}}`, `/crop/width: 0 is less than the minimum 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems, err := s.ValidateJSON([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("ValidateJSON() error = %v", err)
+			}
+			if len(problems) != 1 || problems[0] != tt.want {
+				t.Errorf("ValidateJSON() = %q, want [%q]", problems, tt.want)
+			}
+		})
+	}
+}
+
+// encodeMetadata encodes a metadata document in a binary format
+func encodeMetadata(t *testing.T, metadata string, f metaformat.Format) string {
+	var value any
+	if err := json.Unmarshal([]byte(metadata), &value); err != nil {
+		t.Fatal(err)
+	}
+	data, err := metaformat.Marshal(value, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestValidateDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"dataset.json":                     `{"stats": {"mean": [0.4, 0.4, 0.4], "std": [0.2, 0.2, 0.2], "chunks": 1, "pixels": 10}}`,
+		"video1/chunk_00000/metadata.json": `{"key": "video1/chunk_00000", "fps": 8, "frame_count": 16, "size": [224, 224]}`,
+		"video1/chunk_00000/frame_001.jpg": "",
+		"video2/chunk_00000_metadata.json": `{"key": "video2/chunk_00000", "fps": 8, "size": [224, 224]}`,
+		"video3/chunk_00000/metadata.cbor": encodeMetadata(t, `{"key": "video3/chunk_00000", "fps": 8, "frame_count": 16, "size": [224, 224]}`, metaformat.CBOR),
+		"video5/chunk_00000/metadata.cbor": "\xa1",
+		"video3/chunk_00000/frame_001.jpg": "",
+		"video4/chunk_00000_metadata.json": `{not json`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ValidateDir(dir)
+	if err != nil {
+		t.Fatalf("ValidateDir() error = %v", err)
+	}
+	if report.Files != 6 || len(report.Problems) != 3 {
+		t.Fatalf("ValidateDir() = %+v, want 6 files and 3 problems", report)
+	}
+	if !strings.Contains(report.Problems[0].String(), "video2") || !strings.Contains(report.Problems[0].Message, "frame_count") {
+		t.Errorf("first problem = %s, want the missing frame_count of video2", report.Problems[0])
+	}
+}
+
+func TestValidateShards(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "shard_00000.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	entries := []struct{ name, content string }{
+		{"chunk_00000.npy", "data"},
+		{"chunk_00000.json", `{"key": "video1/chunk_00000", "fps": 8, "frame_count": 16, "size": [224, 224]}`},
+		{"chunk_00001.json", `{"key": "video1/chunk_00001", "fps": 8, "frame_count": 16, "size": [224]}`},
+		{"chunk_00002.msgpack", encodeMetadata(t, `{"key": "video1/chunk_00002", "fps": "8", "frame_count": 16, "size": [224, 224]}`, metaformat.MsgPack)},
+		{"chunk_00002.sidecar.json", `{"source": "web"}`},
+		{"chunk_00003/sidecar.json", `[1, 2]`},
+	}
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	report, err := ValidateShards(dir)
+	if err != nil {
+		t.Fatalf("ValidateShards() error = %v", err)
+	}
+	if report.Files != 3 || len(report.Problems) != 2 {
+		t.Fatalf("ValidateShards() = %+v, want 3 files and 2 problems", report)
+	}
+	if want := "shard_00000.tar:chunk_00001.json"; !strings.HasSuffix(report.Problems[0].File, want) {
+		t.Errorf("problem file = %s, want suffix %s", report.Problems[0].File, want)
+	}
+	if !strings.HasSuffix(report.Problems[1].File, "chunk_00002.msgpack") || !strings.Contains(report.Problems[1].Message, "/fps") {
+		t.Errorf("second problem = %s, want the string fps of chunk_00002.msgpack", report.Problems[1])
+	}
+}
@@ -0,0 +1,196 @@
+package schema
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+)
+
+// Problem is a schema violation, or an unreadable document, found in a file
+type Problem struct {
+	// File is the path of the file, or shard.tar:entry for a shard entry
+	File    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.File + ": " + p.Message
+}
+
+// Report summarizes the validation of an output tree or shard set
+type Report struct {
+	// Files is the number of documents validated, including binary
+	// (msgpack, cbor) metadata
+	Files    int
+	Problems []Problem
+}
+
+// validator validates documents against the bundled schemas
+type validator struct {
+	metadata *Schema
+	dataset  *Schema
+	report   *Report
+}
+
+func newValidator() (*validator, error) {
+	metadata, err := Load(ClipMetadata)
+	if err != nil {
+		return nil, err
+	}
+	dataset, err := Load(Dataset)
+	if err != nil {
+		return nil, err
+	}
+	return &validator{metadata: metadata, dataset: dataset, report: &Report{}}, nil
+}
+
+// check validates one document and records its problems under file
+func (v *validator) check(schema *Schema, file string, data []byte) {
+	v.report.Files++
+	problems, err := schema.ValidateJSON(data)
+	if err != nil {
+		v.report.Problems = append(v.report.Problems, Problem{File: file, Message: err.Error()})
+		return
+	}
+	for _, p := range problems {
+		v.report.Problems = append(v.report.Problems, Problem{File: file, Message: p})
+	}
+}
+
+// checkBinary decodes binary metadata and validates it like JSON metadata
+func (v *validator) checkBinary(file string, data []byte) {
+	f := metaformat.Format(strings.TrimPrefix(filepath.Ext(file), "."))
+	data, err := metaformat.ToJSON(data, f)
+	if err != nil {
+		v.report.Files++
+		v.report.Problems = append(v.report.Problems, Problem{File: file, Message: err.Error()})
+		return
+	}
+	v.check(v.metadata, file, data)
+}
+
+// isBinaryMetadata reports whether a file name is chunk metadata in a
+// binary format
+func isBinaryMetadata(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".msgpack" || ext == ".cbor"
+}
+
+// isSidecar reports whether a shard entry is a clip's sidecar file:
+// sidecar.<ext> in an image chunk or <key>.sidecar.<ext> for npy chunks
+func isSidecar(name string) bool {
+	base := path.Base(name)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	return stem == "sidecar" || strings.HasSuffix(stem, ".sidecar")
+}
+
+// ValidateDir validates the chunk metadata files and dataset manifest of an
+// output directory
+func ValidateDir(dir string) (*Report, error) {
+	v, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		isMetadata := base == "metadata" || strings.HasSuffix(base, "_metadata")
+
+		switch {
+		case path == filepath.Join(dir, "dataset.json"):
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			v.check(v.dataset, path, data)
+		case isMetadata && filepath.Ext(name) == ".json":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			v.check(v.metadata, path, data)
+		case isMetadata && isBinaryMetadata(name):
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			v.checkBinary(path, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %v", dir, err)
+	}
+	return v.report, nil
+}
+
+// ValidateShards validates the chunk metadata packed in the .tar shards of
+// a shard directory
+func ValidateShards(dir string) (*Report, error) {
+	v, err := newValidator()
+	if err != nil {
+		return nil, err
+	}
+
+	shards, err := filepath.Glob(filepath.Join(dir, "*.tar"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(shards)
+	for _, shard := range shards {
+		if err := v.checkShard(shard); err != nil {
+			v.report.Problems = append(v.report.Problems, Problem{File: shard, Message: err.Error()})
+		}
+	}
+	return v.report, nil
+}
+
+// checkShard validates the metadata entries of a shard
+func (v *validator) checkShard(shard string) error {
+	f, err := os.Open(shard)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading shard: %v", err)
+		}
+		switch {
+		case isSidecar(header.Name):
+			// Sidecar files are copied from the input verbatim
+		case strings.HasSuffix(header.Name, ".json"):
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", header.Name, err)
+			}
+			v.check(v.metadata, shard+":"+header.Name, data)
+		case isBinaryMetadata(header.Name):
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", header.Name, err)
+			}
+			v.checkBinary(shard+":"+header.Name, data)
+		}
+	}
+}
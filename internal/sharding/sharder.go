@@ -2,16 +2,51 @@ package sharding
 
 import (
 	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
 	"github.com/melody-ding/go-vidprep/internal/processor"
+	"github.com/melody-ding/go-vidprep/internal/shuffle"
+	"github.com/melody-ding/go-vidprep/internal/types"
 )
 
+// Options configures how processed samples are packed into shards
+type Options struct {
+	ShardSize int
+	Format    processor.OutputFormat
+	// Resume keeps shards from a previous run whose tar data is intact and
+	// matches its .sha256 sidecar, rebuilding only missing or incomplete ones
+	Resume bool
+	// ShuffleBuffer mixes samples through a buffer of this many samples
+	// before they are packed, so shards are well mixed without a separate
+	// reshuffle pass. Zero keeps samples in key order.
+	ShuffleBuffer int
+	// ShuffleClips packs clips in the seeded order -shuffle processed them
+	// in instead of key order, keeping each clip's samples together
+	ShuffleClips bool
+	// Seed seeds the clip shuffle and the shuffle buffer so shard contents
+	// are reproducible
+	Seed int64
+}
+
 // CreateWebDatasetShards creates WebDataset shards from processed samples
 func CreateWebDatasetShards(inputDir, outputDir string, shardSize int, format processor.OutputFormat) error {
+	return CreateWebDatasetShardsWithOptions(inputDir, outputDir, Options{ShardSize: shardSize, Format: format})
+}
+
+// CreateWebDatasetShardsWithOptions creates WebDataset shards from processed samples
+func CreateWebDatasetShardsWithOptions(inputDir, outputDir string, opts Options) error {
+	shardSize, format := opts.ShardSize, opts.Format
 	var samples []string
 	filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -19,15 +54,16 @@ func CreateWebDatasetShards(inputDir, outputDir string, shardSize int, format pr
 		}
 
 		switch format {
-		case processor.FormatNPY:
-			// For NPY format, collect individual .npy files
-			if !info.IsDir() && strings.HasSuffix(path, ".npy") {
+		case processor.FormatNPY, processor.FormatNPZ, processor.FormatPT:
+			// For array formats, collect individual .npy, .npz or .pt
+			// files, but not chunk embeddings
+			if !info.IsDir() && types.IsChunkFile(path, "."+string(format)) {
 				samples = append(samples, path)
 			}
-		case processor.FormatJPEG:
-			// For JPEG format, collect chunk directories containing metadata.json
+		case processor.FormatJPEG, processor.FormatPNG:
+			// For image formats, collect chunk directories containing a metadata file
 			if info.IsDir() && strings.Contains(path, "chunk_") {
-				if _, err := os.Stat(filepath.Join(path, "metadata.json")); err == nil {
+				if _, _, ok := metaformat.FindFile(filepath.Join(path, "metadata")); ok {
 					samples = append(samples, path)
 				}
 			}
@@ -35,7 +71,18 @@ func CreateWebDatasetShards(inputDir, outputDir string, shardSize int, format pr
 		return nil
 	})
 
+	// Order samples by key so shard contents are reproducible across runs,
+	// then mix them if requested
+	sortSamples(inputDir, samples)
+	if opts.ShuffleClips {
+		shuffleClips(inputDir, samples, opts.Seed)
+	}
+	if opts.ShuffleBuffer > 0 {
+		samples = bufferShuffle(samples, opts.ShuffleBuffer, opts.Seed)
+	}
+
 	// Create shards
+	var sums []string
 	numShards := (len(samples) + shardSize - 1) / shardSize
 	for i := 0; i < numShards; i++ {
 		start := i * shardSize
@@ -44,49 +91,307 @@ func CreateWebDatasetShards(inputDir, outputDir string, shardSize int, format pr
 			end = len(samples)
 		}
 
-		shardPath := filepath.Join(outputDir, fmt.Sprintf("shard_%05d.tar", i))
-		if err := createShard(shardPath, samples[start:end], format); err != nil {
+		shardName := fmt.Sprintf("shard_%05d.tar", i)
+		shardPath := filepath.Join(outputDir, shardName)
+
+		// Keep shards completed by a previous run with the same samples
+		list := sampleList(inputDir, samples[start:end])
+		if opts.Resume {
+			if sum, ok := verifyShard(shardPath, list); ok {
+				sums = append(sums, checksumLine(sum, shardName))
+				continue
+			}
+		}
+
+		sum, err := createShard(inputDir, shardPath, samples[start:end], list, format)
+		if err != nil {
 			return fmt.Errorf("error creating shard %d: %v", i, err)
 		}
+		sums = append(sums, checksumLine(sum, shardName))
 	}
 
+	if err := removeStaleShards(outputDir, numShards); err != nil {
+		return err
+	}
+
+	// Write a combined checksum file covering every shard
+	if err := os.WriteFile(filepath.Join(outputDir, "SHA256SUMS"), []byte(strings.Join(sums, "")), 0644); err != nil {
+		return fmt.Errorf("error writing SHA256SUMS: %v", err)
+	}
+
+	return nil
+}
+
+// removeStaleShards removes the shards numbered from numShards on, and their
+// sidecars, left by an earlier run over more samples
+func removeStaleShards(outputDir string, numShards int) error {
+	paths, err := filepath.Glob(filepath.Join(outputDir, "shard_*.tar"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "shard_"), ".tar"))
+		if err != nil || n < numShards {
+			continue
+		}
+		for _, stale := range []string{path, path + ".sha256", path + ".samples"} {
+			if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing stale shard: %v", err)
+			}
+		}
+	}
 	return nil
 }
 
-// createShard creates a tar file containing the given samples
-func createShard(shardPath string, samples []string, format processor.OutputFormat) error {
+// sampleKey returns the key a sample is ordered by: its path relative to the
+// input directory, with forward slashes and without the .npy extension
+func sampleKey(inputDir, sample string) string {
+	rel, err := filepath.Rel(inputDir, sample)
+	if err != nil {
+		rel = sample
+	}
+	rel = filepath.ToSlash(rel)
+	for _, ext := range []string{".npy", ".npz", ".pt"} {
+		rel = strings.TrimSuffix(rel, ext)
+	}
+	return rel
+}
+
+// entryKey returns the name a sample's files are packed under in a shard:
+// its key with "/" replaced by "_", e.g. video1_chunk_00000, so chunks of
+// different clips don't collide when shards mix clips
+func entryKey(inputDir, sample string) string {
+	return strings.ReplaceAll(sampleKey(inputDir, sample), "/", "_")
+}
+
+// sortSamples sorts samples by key. filepath.Walk's per-directory order
+// differs from key order when a clip key is a prefix of another (e.g. "a"
+// and "a-b"), so the order is made explicit.
+func sortSamples(inputDir string, samples []string) {
+	sort.Slice(samples, func(i, j int) bool {
+		return sampleKey(inputDir, samples[i]) < sampleKey(inputDir, samples[j])
+	})
+}
+
+// shuffleClips reorders key-sorted samples into the seeded clip order of
+// shuffle.Sort. A sample's clip key is its directory, so the chunks of a
+// clip stay together and in order.
+func shuffleClips(inputDir string, samples []string, seed int64) {
+	shuffle.Sort(len(samples), seed, func(i int) string {
+		return path.Dir(sampleKey(inputDir, samples[i]))
+	}, func(i, j int) {
+		samples[i], samples[j] = samples[j], samples[i]
+	})
+}
+
+// bufferShuffle returns samples in the order a seeded shuffle buffer of the
+// given size emits them: each incoming sample replaces a randomly chosen
+// buffered one, which is emitted, and the buffer is drained in random order
+// at the end. A buffer at least as large as the input is a full shuffle.
+func bufferShuffle(samples []string, size int, seed int64) []string {
+	rng := rand.New(rand.NewSource(seed))
+	out := make([]string, 0, len(samples))
+	buffer := make([]string, 0, size)
+	for _, sample := range samples {
+		if len(buffer) < size {
+			buffer = append(buffer, sample)
+			continue
+		}
+		i := rng.Intn(size)
+		out = append(out, buffer[i])
+		buffer[i] = sample
+	}
+	rng.Shuffle(len(buffer), func(i, j int) { buffer[i], buffer[j] = buffer[j], buffer[i] })
+	return append(out, buffer...)
+}
+
+// checksumLine formats a checksum in sha256sum's output format
+func checksumLine(sum, name string) string {
+	return fmt.Sprintf("%s  %s\n", sum, name)
+}
+
+// sampleList returns the contents of a shard's .samples sidecar: the paths of
+// its samples relative to the input directory, one per line. Unlike tar entry
+// names they include the clip key, so they identify the samples exactly.
+func sampleList(inputDir string, samples []string) string {
+	var b strings.Builder
+	for _, sample := range samples {
+		rel, err := filepath.Rel(inputDir, sample)
+		if err != nil {
+			rel = sample
+		}
+		b.WriteString(filepath.ToSlash(rel) + "\n")
+	}
+	return b.String()
+}
+
+// verifyShard reports whether a shard from a previous run is complete and
+// current: its .samples sidecar lists the samples now assigned to it, so
+// shards are rebuilt when filters, sampling or the clip set change, its
+// .sha256 sidecar exists, the tar reads cleanly to its end-of-archive marker,
+// and its checksum matches the sidecar. It returns the verified checksum.
+func verifyShard(shardPath, list string) (string, bool) {
+	if previous, err := os.ReadFile(shardPath + ".samples"); err != nil || string(previous) != list {
+		return "", false
+	}
+	sidecar, err := os.ReadFile(shardPath + ".sha256")
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return "", false
+	}
+	want := fields[0]
+
+	f, err := os.Open(shardPath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	// Read every entry to catch truncation, then hash any trailing padding
+	hash := sha256.New()
+	tr := tar.NewReader(io.TeeReader(f, hash))
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return "", false
+		}
+	}
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", false
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != want {
+		return "", false
+	}
+	return want, true
+}
+
+// createShard creates a tar file containing the given samples, with a
+// .samples sidecar holding their list and a .sha256 sidecar next to it. The
+// checksum is computed as the shard is written and returned as a hex string.
+func createShard(inputDir, shardPath string, samples []string, list string, format processor.OutputFormat) (string, error) {
+	// Remove any stale sidecar so an interrupted rebuild is never taken as complete
+	if err := os.Remove(shardPath + ".sha256"); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error removing stale checksum: %v", err)
+	}
+
 	tarFile, err := os.Create(shardPath)
 	if err != nil {
-		return fmt.Errorf("error creating tar file: %v", err)
+		return "", fmt.Errorf("error creating tar file: %v", err)
 	}
 	defer tarFile.Close()
 
-	tw := tar.NewWriter(tarFile)
-	defer tw.Close()
+	hash := sha256.New()
+	tw := tar.NewWriter(io.MultiWriter(tarFile, hash))
+	if err := writeSamples(tw, inputDir, samples, format); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("error closing tar file: %v", err)
+	}
+	if err := tarFile.Close(); err != nil {
+		return "", fmt.Errorf("error closing tar file: %v", err)
+	}
+
+	if err := os.WriteFile(shardPath+".samples", []byte(list), 0644); err != nil {
+		return "", fmt.Errorf("error writing sample list: %v", err)
+	}
+
+	// The sidecar is written last so its presence marks a complete shard
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if err := os.WriteFile(shardPath+".sha256", []byte(checksumLine(sum, filepath.Base(shardPath))), 0644); err != nil {
+		return "", fmt.Errorf("error writing checksum: %v", err)
+	}
+	return sum, nil
+}
+
+// writeSamples adds the files of each sample to the tar, in order, with the
+// files of an image chunk in lexical order. Headers carry no timestamps or
+// ownership, so the same samples always produce the same bytes.
+func writeSamples(tw *tar.Writer, inputDir string, samples []string, format processor.OutputFormat) error {
 
 	for _, sample := range samples {
-		if format == processor.FormatNPY {
-			// For NPY format, just add the file directly
+		key := entryKey(inputDir, sample)
+		if format == processor.FormatNPY || format == processor.FormatNPZ || format == processor.FormatPT {
+			// For array formats, add the array and its metadata as <key>.npy
+			// (or <key>.pt) and <key>.json (or .msgpack/.cbor), or the
+			// archive holding both as <key>.npz
 			data, err := os.ReadFile(sample)
 			if err != nil {
 				return fmt.Errorf("error reading sample %s: %v", sample, err)
 			}
+			if err := addFile(tw, key+filepath.Ext(sample), data); err != nil {
+				return err
+			}
 
-			header := &tar.Header{
-				Name: filepath.Base(sample),
-				Mode: 0644,
-				Size: int64(len(data)),
+			base := strings.TrimSuffix(sample, filepath.Ext(sample))
+			if metadataPath, metadataFormat, ok := metaformat.FindFile(base + "_metadata"); ok {
+				metadata, err := os.ReadFile(metadataPath)
+				if err != nil {
+					return fmt.Errorf("error reading metadata for sample %s: %v", sample, err)
+				}
+				if err := addFile(tw, key+"."+metadataFormat.Ext(), metadata); err != nil {
+					return err
+				}
 			}
 
-			if err := tw.WriteHeader(header); err != nil {
-				return fmt.Errorf("error writing tar header: %v", err)
+			// Add the clip's caption as <key>.txt, so WebDataset groups it
+			// with the frames
+			if data, err := os.ReadFile(base + "_caption.txt"); err == nil {
+				if err := addFile(tw, key+".txt", data); err != nil {
+					return err
+				}
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("error reading caption for sample %s: %v", sample, err)
+			}
+
+			// Add the chunk's audio track as <key>.wav (or .flac)
+			for _, audioFormat := range processor.AudioFormats {
+				data, err := os.ReadFile(base + "_audio." + string(audioFormat))
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error reading audio for sample %s: %v", sample, err)
+				}
+				if err := addFile(tw, key+"."+string(audioFormat), data); err != nil {
+					return err
+				}
 			}
 
-			if _, err := tw.Write(data); err != nil {
-				return fmt.Errorf("error writing tar data: %v", err)
+			// Add the chunk's embedding as <key>.emb.npy
+			if data, err := os.ReadFile(base + types.EmbeddingSuffix); err == nil {
+				if err := addFile(tw, key+types.EmbeddingSuffix, data); err != nil {
+					return err
+				}
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("error reading embedding for sample %s: %v", sample, err)
+			}
+
+			// Add the clip's sidecar files as <key>.sidecar.<ext>
+			for _, ext := range types.SidecarExtensions {
+				data, err := os.ReadFile(base + "_sidecar." + ext)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("error reading sidecar for sample %s: %v", sample, err)
+				}
+				if err := addFile(tw, key+".sidecar."+ext, data); err != nil {
+					return err
+				}
 			}
 		} else {
-			// For JPEG format, add all files in the chunk directory
+			// For image formats, add all files in the chunk directory
 			err := filepath.Walk(sample, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return err
@@ -97,26 +402,15 @@ func createShard(shardPath string, samples []string, format processor.OutputForm
 						return fmt.Errorf("error reading file %s: %v", path, err)
 					}
 
-					// Create relative path within the tar file
-					relPath, err := filepath.Rel(filepath.Dir(sample), path)
+					// Create relative path within the tar file, under the
+					// sample's key
+					relPath, err := filepath.Rel(sample, path)
 					if err != nil {
 						return fmt.Errorf("error getting relative path: %v", err)
 					}
-					tarPath := filepath.Join(filepath.Base(sample), relPath)
-
-					header := &tar.Header{
-						Name: tarPath,
-						Mode: 0644,
-						Size: int64(len(data)),
-					}
-
-					if err := tw.WriteHeader(header); err != nil {
-						return fmt.Errorf("error writing tar header: %v", err)
-					}
+					tarPath := key + "/" + filepath.ToSlash(relPath)
 
-					if _, err := tw.Write(data); err != nil {
-						return fmt.Errorf("error writing tar data: %v", err)
-					}
+					return addFile(tw, tarPath, data)
 				}
 				return nil
 			})
@@ -128,3 +422,19 @@ func createShard(shardPath string, samples []string, format processor.OutputForm
 
 	return nil
 }
+
+// addFile writes a single file entry to the tar
+func addFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name: name,
+		Mode: 0644,
+		Size: int64(len(data)),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing tar header: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing tar data: %v", err)
+	}
+	return nil
+}
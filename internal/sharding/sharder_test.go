@@ -0,0 +1,466 @@
+package sharding
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/processor"
+)
+
+// createNumpySamples writes n fake .npy chunks under inputDir
+func createNumpySamples(t *testing.T, inputDir string, n int) {
+	clipDir := filepath.Join(inputDir, "video1")
+	if err := os.MkdirAll(clipDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		path := filepath.Join(clipDir, fmt.Sprintf("chunk_%05d.npy", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("chunk %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestShardChecksums(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createNumpySamples(t, inputDir, 3)
+
+	if err := CreateWebDatasetShards(inputDir, outputDir, 2, processor.FormatNPY); err != nil {
+		t.Fatalf("CreateWebDatasetShards() error = %v", err)
+	}
+
+	sums, err := os.ReadFile(filepath.Join(outputDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatalf("error reading SHA256SUMS: %v", err)
+	}
+
+	var want strings.Builder
+	for _, name := range []string{"shard_00000.tar", "shard_00001.tar"} {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := sha256.Sum256(data)
+		line := hex.EncodeToString(hash[:]) + "  " + name + "\n"
+		want.WriteString(line)
+
+		sidecar, err := os.ReadFile(filepath.Join(outputDir, name+".sha256"))
+		if err != nil {
+			t.Fatalf("error reading sidecar for %s: %v", name, err)
+		}
+		if string(sidecar) != line {
+			t.Errorf("sidecar for %s = %q, want %q", name, sidecar, line)
+		}
+	}
+
+	if string(sums) != want.String() {
+		t.Errorf("SHA256SUMS = %q, want %q", sums, want.String())
+	}
+}
+
+func TestResumeRebuildsIncompleteShards(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createNumpySamples(t, inputDir, 6)
+
+	opts := Options{ShardSize: 2, Format: processor.FormatNPY, Resume: true}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() error = %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join(outputDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash: truncate shard 0 and lose the sidecar of shard 1
+	shard0 := filepath.Join(outputDir, "shard_00000.tar")
+	info, err := os.Stat(shard0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(shard0, info.Size()/2); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(outputDir, "shard_00001.tar.sha256")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mark shard 2 so we can tell whether it is rebuilt
+	shard2 := filepath.Join(outputDir, "shard_00002.tar")
+	before, err := os.Stat(shard2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := verifyShard(shard0, "video1/chunk_00000.npy\nvideo1/chunk_00001.npy\n"); ok {
+		t.Error("verifyShard() accepted a truncated shard")
+	}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() on resume error = %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outputDir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("SHA256SUMS after resume = %q, want %q", got, want)
+	}
+	for i, name := range []string{"shard_00000.tar", "shard_00001.tar"} {
+		list := fmt.Sprintf("video1/chunk_%05d.npy\nvideo1/chunk_%05d.npy\n", 2*i, 2*i+1)
+		if _, ok := verifyShard(filepath.Join(outputDir, name), list); !ok {
+			t.Errorf("%s was not repaired", name)
+		}
+	}
+	after, err := os.Stat(shard2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("complete shard_00002.tar was rebuilt")
+	}
+}
+
+func TestResumeRebuildsShardsWithChangedSamples(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createNumpySamples(t, inputDir, 6)
+
+	opts := Options{ShardSize: 2, Format: processor.FormatNPY, Resume: true}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() error = %v", err)
+	}
+
+	// Drop a sample, e.g. excluded by a filter on the next run, so every
+	// shard's samples change although all shards are intact
+	if err := os.Remove(filepath.Join(inputDir, "video1", "chunk_00001.npy")); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() on resume error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(outputDir, "shard_00000.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+	if want := "[video1_chunk_00000.npy video1_chunk_00002.npy]"; fmt.Sprint(names) != want {
+		t.Errorf("shard_00000.tar entries after resume = %v, want %s", names, want)
+	}
+	samples, err := os.ReadFile(filepath.Join(outputDir, "shard_00002.tar.samples"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "video1/chunk_00005.npy\n"; string(samples) != want {
+		t.Errorf("shard_00002.tar.samples = %q, want %q", samples, want)
+	}
+}
+
+func TestResumeRemovesStaleShards(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createNumpySamples(t, inputDir, 6)
+
+	opts := Options{ShardSize: 2, Format: processor.FormatNPY, Resume: true}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() error = %v", err)
+	}
+
+	// Drop two samples, so the next run needs one shard less
+	for _, name := range []string{"chunk_00001.npy", "chunk_00004.npy"} {
+		if err := os.Remove(filepath.Join(inputDir, "video1", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() on resume error = %v", err)
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := "[SHA256SUMS shard_00000.tar shard_00000.tar.samples shard_00000.tar.sha256 shard_00001.tar shard_00001.tar.samples shard_00001.tar.sha256]"
+	if fmt.Sprint(names) != want {
+		t.Errorf("shard directory after resume = %v, want %s", names, want)
+	}
+}
+
+func TestShardOrderIsDeterministic(t *testing.T) {
+	inputDir := t.TempDir()
+	for _, key := range []string{"a-b/chunk_00000.npy", "a/chunk_00001.npy", "a/chunk_00000.npy", "a/chunk_00000_center.npy"} {
+		path := filepath.Join(inputDir, key)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(key), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var samples []string
+	filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			samples = append(samples, path)
+		}
+		return nil
+	})
+	sortSamples(inputDir, samples)
+	var keys []string
+	for _, sample := range samples {
+		keys = append(keys, sampleKey(inputDir, sample))
+	}
+	want := "[a-b/chunk_00000 a/chunk_00000 a/chunk_00000_center a/chunk_00001]"
+	if fmt.Sprint(keys) != want {
+		t.Errorf("sample order = %v, want %s", keys, want)
+	}
+
+	// Two runs over the same samples produce identical shards
+	var runs []string
+	for i := 0; i < 2; i++ {
+		outputDir := t.TempDir()
+		if err := CreateWebDatasetShards(inputDir, outputDir, 3, processor.FormatNPY); err != nil {
+			t.Fatalf("CreateWebDatasetShards() error = %v", err)
+		}
+		sums, err := os.ReadFile(filepath.Join(outputDir, "SHA256SUMS"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, string(sums))
+	}
+	if runs[0] != runs[1] {
+		t.Errorf("shards differ between runs:\n%s\n%s", runs[0], runs[1])
+	}
+}
+
+func TestBufferShuffle(t *testing.T) {
+	var samples []string
+	for i := 0; i < 100; i++ {
+		samples = append(samples, fmt.Sprintf("video1/chunk_%05d", i))
+	}
+
+	got := bufferShuffle(samples, 10, 1)
+	if len(got) != len(samples) {
+		t.Fatalf("bufferShuffle() returned %d samples, want %d", len(got), len(samples))
+	}
+	seen := make(map[string]bool)
+	moved := 0
+	for i, sample := range got {
+		seen[sample] = true
+		if sample != samples[i] {
+			moved++
+		}
+	}
+	if len(seen) != len(samples) {
+		t.Errorf("bufferShuffle() returned %d distinct samples, want %d", len(seen), len(samples))
+	}
+	if moved == 0 {
+		t.Error("bufferShuffle() did not reorder samples")
+	}
+
+	if fmt.Sprint(bufferShuffle(samples, 10, 1)) != fmt.Sprint(got) {
+		t.Error("bufferShuffle() is not deterministic for a fixed seed")
+	}
+	if fmt.Sprint(bufferShuffle(samples, 10, 2)) == fmt.Sprint(got) {
+		t.Error("bufferShuffle() ignored the seed")
+	}
+}
+
+func TestNumpyShardsIncludeMetadata(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	createNumpySamples(t, inputDir, 2)
+	metadata := filepath.Join(inputDir, "video1", "chunk_00000_metadata.json")
+	if err := os.WriteFile(metadata, []byte(`{"fps": 8}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chunk_00000_audio.wav", "chunk_00000_caption.txt", "chunk_00000.emb.npy"} {
+		if err := os.WriteFile(filepath.Join(inputDir, "video1", name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ext := range []string{"txt", "json"} {
+		sidecar := filepath.Join(inputDir, "video1", "chunk_00001_sidecar."+ext)
+		if err := os.WriteFile(sidecar, []byte("sidecar"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CreateWebDatasetShards(inputDir, outputDir, 2, processor.FormatNPY); err != nil {
+		t.Fatalf("CreateWebDatasetShards() error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(outputDir, "shard_00000.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+
+	want := "[video1_chunk_00000.npy video1_chunk_00000.json video1_chunk_00000.txt video1_chunk_00000.wav video1_chunk_00000.emb.npy video1_chunk_00001.npy video1_chunk_00001.sidecar.txt video1_chunk_00001.sidecar.json]"
+	if fmt.Sprint(names) != want {
+		t.Errorf("shard entries = %v, want %s", names, want)
+	}
+}
+
+func TestShuffledShardEntriesAreUnique(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	for _, clip := range []string{"video1", "video2", "video3"} {
+		clipDir := filepath.Join(inputDir, clip)
+		if err := os.MkdirAll(clipDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			path := filepath.Join(clipDir, fmt.Sprintf("chunk_%05d.npy", i))
+			if err := os.WriteFile(path, []byte(clip), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	opts := Options{ShardSize: 9, Format: processor.FormatNPY, ShuffleBuffer: 9, Seed: 1}
+	if err := CreateWebDatasetShardsWithOptions(inputDir, outputDir, opts); err != nil {
+		t.Fatalf("CreateWebDatasetShardsWithOptions() error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(outputDir, "shard_00000.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := make(map[string]bool)
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[header.Name] {
+			t.Errorf("shard entry %s is repeated", header.Name)
+		}
+		seen[header.Name] = true
+
+		// Each entry's name carries its clip, whose name is its content
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(header.Name, string(data)+"_chunk_") {
+			t.Errorf("shard entry %s holds a chunk of %s", header.Name, data)
+		}
+	}
+	if len(seen) != 9 {
+		t.Errorf("shard has %d distinct entries, want 9", len(seen))
+	}
+}
+
+func TestNPZShards(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	clipDir := filepath.Join(inputDir, "video1")
+	if err := os.MkdirAll(clipDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"chunk_00001.npz", "chunk_00000.npz", "chunk_00000_preview.gif", "chunk_00001_sidecar.txt"} {
+		if err := os.WriteFile(filepath.Join(clipDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CreateWebDatasetShards(inputDir, outputDir, 2, processor.FormatNPZ); err != nil {
+		t.Fatalf("CreateWebDatasetShards() error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(outputDir, "shard_00000.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+
+	// Metadata is inside the archives
+	want := "[video1_chunk_00000.npz video1_chunk_00001.npz video1_chunk_00001.sidecar.txt]"
+	if fmt.Sprint(names) != want {
+		t.Errorf("shard entries = %v, want %s", names, want)
+	}
+}
+
+func TestShuffleClips(t *testing.T) {
+	inputDir := t.TempDir()
+	var samples []string
+	for clip := 0; clip < 20; clip++ {
+		for chunk := 0; chunk < 3; chunk++ {
+			samples = append(samples, filepath.Join(inputDir, fmt.Sprintf("class_a/clip_%02d/chunk_%05d.npy", clip, chunk)))
+		}
+	}
+	sortSamples(inputDir, samples)
+	sorted := append([]string(nil), samples...)
+
+	shuffleClips(inputDir, samples, 1)
+	var clips []string
+	for i, sample := range samples {
+		key := sampleKey(inputDir, sample)
+		clip, chunk := filepath.Dir(key), filepath.Base(key)
+		if i%3 == 0 {
+			clips = append(clips, clip)
+		} else if clip != clips[len(clips)-1] {
+			t.Fatalf("sample %s is separated from the rest of its clip", key)
+		}
+		if want := fmt.Sprintf("chunk_%05d", i%3); chunk != want {
+			t.Errorf("sample %s out of order, want %s", key, want)
+		}
+	}
+	if fmt.Sprint(samples) == fmt.Sprint(sorted) {
+		t.Error("shuffleClips() did not reorder clips")
+	}
+
+	again := append([]string(nil), sorted...)
+	shuffleClips(inputDir, again, 1)
+	if fmt.Sprint(again) != fmt.Sprint(samples) {
+		t.Error("shuffleClips() is not deterministic for a fixed seed")
+	}
+}
@@ -0,0 +1,54 @@
+// Package shuffle orders clips in a seeded pseudo-random permutation that
+// depends only on the seed and each clip's key, so the clip processing order
+// and the shard order agree without sharing state between runs.
+package shuffle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+// Rank returns the position of key in the permutation chosen by seed. Ranks
+// are uniformly distributed, so Rank(seed, key) / 2^64 also serves as a
+// seeded uniform sample in [0, 1).
+func Rank(seed int64, key string) uint64 {
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(key))
+	return binary.LittleEndian.Uint64(h.Sum(nil))
+}
+
+// Sort reorders n items into the seeded permutation. key returns the key of
+// the i-th item and swap exchanges two items, as in sort.Slice; items with
+// equal keys keep their relative order.
+func Sort(n int, seed int64, key func(i int) string, swap func(i, j int)) {
+	s := &byRank{ranks: make([]uint64, n), keys: make([]string, n), swap: swap}
+	for i := 0; i < n; i++ {
+		s.keys[i] = key(i)
+		s.ranks[i] = Rank(seed, s.keys[i])
+	}
+	sort.Stable(s)
+}
+
+// byRank sorts by rank, breaking ties by key so the order is total
+type byRank struct {
+	ranks []uint64
+	keys  []string
+	swap  func(i, j int)
+}
+
+func (s *byRank) Len() int { return len(s.ranks) }
+
+func (s *byRank) Less(i, j int) bool {
+	if s.ranks[i] != s.ranks[j] {
+		return s.ranks[i] < s.ranks[j]
+	}
+	return s.keys[i] < s.keys[j]
+}
+
+func (s *byRank) Swap(i, j int) {
+	s.ranks[i], s.ranks[j] = s.ranks[j], s.ranks[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.swap(i, j)
+}
@@ -0,0 +1,50 @@
+package shuffle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	var keys []string
+	for i := 0; i < 50; i++ {
+		keys = append(keys, fmt.Sprintf("class_a/clip_%02d", i))
+	}
+	shuffled := func(seed int64) []string {
+		out := append([]string(nil), keys...)
+		Sort(len(out), seed, func(i int) string { return out[i] }, func(i, j int) { out[i], out[j] = out[j], out[i] })
+		return out
+	}
+
+	got := shuffled(1)
+	seen := make(map[string]bool)
+	moved := 0
+	for i, key := range got {
+		seen[key] = true
+		if key != keys[i] {
+			moved++
+		}
+	}
+	if len(seen) != len(keys) {
+		t.Errorf("Sort() kept %d distinct keys, want %d", len(seen), len(keys))
+	}
+	if moved == 0 {
+		t.Error("Sort() did not reorder keys")
+	}
+	if fmt.Sprint(shuffled(1)) != fmt.Sprint(got) {
+		t.Error("Sort() is not deterministic for a fixed seed")
+	}
+	if fmt.Sprint(shuffled(2)) == fmt.Sprint(got) {
+		t.Error("Sort() ignored the seed")
+	}
+
+	// The order depends only on the keys, not on the input order
+	reversed := make([]string, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+	Sort(len(reversed), 1, func(i int) string { return reversed[i] }, func(i, j int) { reversed[i], reversed[j] = reversed[j], reversed[i] })
+	if fmt.Sprint(reversed) != fmt.Sprint(got) {
+		t.Error("Sort() order depends on the input order")
+	}
+}
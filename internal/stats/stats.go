@@ -0,0 +1,205 @@
+package stats
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/metaformat"
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// channels is the number of color channels in produced chunks
+const channels = 3
+
+// Options configures how statistics are sampled
+type Options struct {
+	// MaxChunks caps the number of chunks read, chosen at random; zero reads all chunks
+	MaxChunks int
+	// Seed seeds the chunk sampling
+	Seed int64
+}
+
+// accumulator keeps running per-channel sums of values in [0, 1]
+type accumulator struct {
+	sum    [channels]float64
+	sumSq  [channels]float64
+	pixels int64
+}
+
+func (a *accumulator) add(channel int, v float64) {
+	a.sum[channel] += v
+	a.sumSq[channel] += v * v
+}
+
+// result returns the mean and population standard deviation per channel
+func (a *accumulator) result(chunks int) types.ChannelStats {
+	stats := types.ChannelStats{
+		Mean:   make([]float64, channels),
+		Std:    make([]float64, channels),
+		Chunks: chunks,
+		Pixels: a.pixels,
+	}
+	if a.pixels == 0 {
+		return stats
+	}
+	n := float64(a.pixels)
+	for c := 0; c < channels; c++ {
+		mean := a.sum[c] / n
+		stats.Mean[c] = mean
+		stats.Std[c] = math.Sqrt(math.Max(a.sumSq[c]/n-mean*mean, 0))
+	}
+	return stats
+}
+
+// Compute streams over the chunks produced in dir (.npy arrays or image
+// chunk directories) and returns per-channel mean and standard deviation
+func Compute(dir string, opts Options) (types.ChannelStats, error) {
+	chunks, err := findChunks(dir)
+	if err != nil {
+		return types.ChannelStats{}, err
+	}
+	if opts.MaxChunks > 0 && len(chunks) > opts.MaxChunks {
+		rng := rand.New(rand.NewSource(opts.Seed))
+		rng.Shuffle(len(chunks), func(i, j int) { chunks[i], chunks[j] = chunks[j], chunks[i] })
+		chunks = chunks[:opts.MaxChunks]
+	}
+
+	var acc accumulator
+	for _, chunk := range chunks {
+		if strings.HasSuffix(chunk, ".npy") || strings.HasSuffix(chunk, ".npz") {
+			err = addNumpy(&acc, chunk)
+		} else {
+			err = addImages(&acc, chunk)
+		}
+		if err != nil {
+			return types.ChannelStats{}, err
+		}
+	}
+	return acc.result(len(chunks)), nil
+}
+
+// findChunks returns the .npy and .npz chunk files and image chunk
+// directories under dir
+func findChunks(dir string) ([]string, error) {
+	var chunks []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && types.IsChunkFile(path, ".npy", ".npz") {
+			chunks = append(chunks, path)
+		}
+		if info.IsDir() && strings.Contains(filepath.Base(path), "chunk_") {
+			if _, _, ok := metaformat.FindFile(filepath.Join(path, "metadata")); ok {
+				chunks = append(chunks, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding chunks: %v", err)
+	}
+	sort.Strings(chunks)
+	return chunks, nil
+}
+
+// addNumpy adds the pixels of a channels-last uint8 or uint16 NumPy chunk,
+// or of the frames array of an .npz chunk
+func addNumpy(acc *accumulator, path string) error {
+	reader, err := numpy.OpenFrames(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	h := reader.Header
+	if len(h.Shape) == 0 || h.Shape[len(h.Shape)-1] != channels {
+		return fmt.Errorf("unsupported shape %v in %s: expected channels-last RGB", h.Shape, path)
+	}
+	var maxValue float64
+	switch h.DType {
+	case numpy.Uint8:
+		maxValue = math.MaxUint8
+	case numpy.Uint16:
+		maxValue = math.MaxUint16
+	default:
+		return fmt.Errorf("unsupported dtype %s in %s", h.DType, path)
+	}
+
+	itemSize := h.ItemSize()
+	buf := make([]byte, 4096*channels*itemSize)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		for i := 0; i+channels*itemSize <= n; i += channels * itemSize {
+			for c := 0; c < channels; c++ {
+				offset := i + c*itemSize
+				v := float64(buf[offset])
+				if itemSize == 2 {
+					v = float64(uint16(buf[offset]) | uint16(buf[offset+1])<<8)
+				}
+				acc.add(c, v/maxValue)
+			}
+			acc.pixels++
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+	}
+}
+
+// addImages adds the pixels of every image frame in a chunk directory
+func addImages(acc *accumulator, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading chunk %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".jpg" && ext != ".png") {
+			continue
+		}
+		if err := addImage(acc, filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addImage adds the pixels of a single JPEG or PNG frame
+func addImage(acc *accumulator, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening frame %s: %v", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("error decoding frame %s: %v", path, err)
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			acc.add(0, float64(r)/math.MaxUint16)
+			acc.add(1, float64(g)/math.MaxUint16)
+			acc.add(2, float64(b)/math.MaxUint16)
+			acc.pixels++
+		}
+	}
+	return nil
+}
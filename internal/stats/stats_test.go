@@ -0,0 +1,121 @@
+package stats
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+)
+
+func writeNumpyChunk(t *testing.T, path string, pixels [][3]byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writer, err := numpy.NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	var data []byte
+	for _, p := range pixels {
+		data = append(data, p[:]...)
+	}
+	if err := writer.Write(data, []int{1, 1, len(pixels), 3}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePNGChunk(t *testing.T, dir string, c color.RGBA) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, c)
+	img.Set(1, 0, c)
+	f, err := os.Create(filepath.Join(dir, "frame_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "metadata.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertClose(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestComputeNumpy(t *testing.T) {
+	dir := t.TempDir()
+	writeNumpyChunk(t, filepath.Join(dir, "video1", "chunk_00000.npy"), [][3]byte{{0, 255, 51}, {255, 255, 51}})
+
+	stats, err := Compute(dir, Options{})
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+	if stats.Chunks != 1 || stats.Pixels != 2 {
+		t.Errorf("Compute() sampled %d chunks and %d pixels, want 1 and 2", stats.Chunks, stats.Pixels)
+	}
+	assertClose(t, "Mean", stats.Mean, []float64{0.5, 1, 0.2})
+	assertClose(t, "Std", stats.Std, []float64{0.5, 0, 0})
+}
+
+func TestComputeNPZ(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "video1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := numpy.WriteNPZ(filepath.Join(dir, "video1", "chunk_00000.npz"),
+		numpy.Array{Name: "frames", Data: []byte{0, 255, 51, 255, 255, 51}, Shape: []int{1, 1, 2, 3}, DType: numpy.Uint8},
+		numpy.Array{Name: "metadata", Data: []byte("{}"), Shape: []int{2}, DType: numpy.Uint8},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := Compute(dir, Options{})
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+	if stats.Chunks != 1 || stats.Pixels != 2 {
+		t.Errorf("Compute() sampled %d chunks and %d pixels, want 1 and 2", stats.Chunks, stats.Pixels)
+	}
+	assertClose(t, "Mean", stats.Mean, []float64{0.5, 1, 0.2})
+}
+
+func TestComputeImages(t *testing.T) {
+	dir := t.TempDir()
+	writePNGChunk(t, filepath.Join(dir, "video1", "chunk_00000"), color.RGBA{R: 255, A: 255})
+	writePNGChunk(t, filepath.Join(dir, "video1", "chunk_00001"), color.RGBA{B: 255, A: 255})
+
+	stats, err := Compute(dir, Options{})
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+	assertClose(t, "Mean", stats.Mean, []float64{0.5, 0, 0.5})
+	assertClose(t, "Std", stats.Std, []float64{0.5, 0, 0.5})
+
+	sampled, err := Compute(dir, Options{MaxChunks: 1, Seed: 1})
+	if err != nil {
+		t.Fatalf("Compute() error = %v", err)
+	}
+	if sampled.Chunks != 1 || sampled.Pixels != 2 {
+		t.Errorf("Compute() with MaxChunks sampled %d chunks and %d pixels, want 1 and 2", sampled.Chunks, sampled.Pixels)
+	}
+}
@@ -0,0 +1,117 @@
+package tar_reader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// braceRangePattern matches the body of a numeric brace range, e.g. 0000..0099
+var braceRangePattern = regexp.MustCompile(`^(-?\d+)\.\.(-?\d+)$`)
+
+// expandBraces expands WebDataset-style brace patterns, as in shell brace
+// expansion: "data-{0000..0099}.tar" lists a zero-padded numeric range and
+// "{train,val}.tar" lists alternatives. Several groups expand left to right
+// and groups may be nested. Braces without a range or a comma are kept as
+// is.
+func expandBraces(pattern string) []string {
+	open, close := findBraceGroup(pattern)
+	if open < 0 {
+		return []string{pattern}
+	}
+	prefix, body, suffix := pattern[:open], pattern[open+1:close], pattern[close+1:]
+	var expanded []string
+	for _, alt := range braceAlternatives(body) {
+		expanded = append(expanded, expandBraces(prefix+alt+suffix)...)
+	}
+	return expanded
+}
+
+// findBraceGroup returns the positions of the braces of the first group in
+// pattern holding a range or a top-level comma, or -1 if there is none
+func findBraceGroup(pattern string) (int, int) {
+	for open := strings.IndexByte(pattern, '{'); open >= 0; {
+		depth, comma := 0, false
+		for i := open; i < len(pattern); i++ {
+			switch pattern[i] {
+			case '{':
+				depth++
+			case ',':
+				comma = comma || depth == 1
+			case '}':
+				depth--
+			}
+			if depth == 0 {
+				if comma || braceRangePattern.MatchString(pattern[open+1:i]) {
+					return open, i
+				}
+				break
+			}
+		}
+		next := strings.IndexByte(pattern[open+1:], '{')
+		if next < 0 {
+			break
+		}
+		open += next + 1
+	}
+	return -1, -1
+}
+
+// braceAlternatives returns the values listed by the body of a brace group:
+// the numbers of a range, or its top-level comma-separated parts
+func braceAlternatives(body string) []string {
+	if m := braceRangePattern.FindStringSubmatch(body); m != nil {
+		return braceRange(m[1], m[2])
+	}
+	var alts []string
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, body[start:])
+}
+
+// braceRange returns the numbers from first to last inclusive, counting
+// down if last is smaller. If either bound has a leading zero, numbers are
+// zero-padded to the width of the wider bound.
+func braceRange(first, last string) []string {
+	from, _ := strconv.Atoi(first)
+	to, _ := strconv.Atoi(last)
+	width := 0
+	if padded(first) || padded(last) {
+		width = max(len(strings.TrimPrefix(first, "-")), len(strings.TrimPrefix(last, "-")))
+	}
+	step := 1
+	if to < from {
+		step = -1
+	}
+	var values []string
+	for n := from; ; n += step {
+		if n < 0 {
+			values = append(values, fmt.Sprintf("-%0*d", width, -n))
+		} else {
+			values = append(values, fmt.Sprintf("%0*d", width, n))
+		}
+		if n == to {
+			break
+		}
+	}
+	return values
+}
+
+// padded reports whether a range bound is written with a leading zero
+func padded(bound string) bool {
+	bound = strings.TrimPrefix(bound, "-")
+	return len(bound) > 1 && bound[0] == '0'
+}
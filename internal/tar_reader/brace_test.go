@@ -0,0 +1,29 @@
+package tar_reader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"data.tar", "data.tar"},
+		{"data-{0000..0003}.tar", "data-0000.tar,data-0001.tar,data-0002.tar,data-0003.tar"},
+		{"data-{8..11}.tar", "data-8.tar,data-9.tar,data-10.tar,data-11.tar"},
+		{"data-{08..11}.tar", "data-08.tar,data-09.tar,data-10.tar,data-11.tar"},
+		{"data-{2..0}.tar", "data-2.tar,data-1.tar,data-0.tar"},
+		{"{train,val}-{0..1}.tar", "train-0.tar,train-1.tar,val-0.tar,val-1.tar"},
+		{"{a,b{1..2}}.tar", "a.tar,b1.tar,b2.tar"},
+		{"s3://bucket/{x}/data-{0..1}.tar", "s3://bucket/{x}/data-0.tar,s3://bucket/{x}/data-1.tar"},
+		{"data-{0..1.tar", "data-{0..1.tar"},
+		{"data-{a..c}.tar", "data-{a..c}.tar"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(expandBraces(tt.pattern), ","); got != tt.want {
+			t.Errorf("expandBraces(%q) = %s, want %s", tt.pattern, got, tt.want)
+		}
+	}
+}
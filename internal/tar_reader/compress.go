@@ -0,0 +1,74 @@
+package tar_reader
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// isCompressed reports whether magic starts a gzip or zstd stream
+func isCompressed(magic []byte) bool {
+	return bytes.HasPrefix(magic, gzipMagic) || bytes.HasPrefix(magic, zstdMagic)
+}
+
+// decompress returns a reader of the uncompressed contents of r, sniffing its
+// magic bytes for gzip or zstd compression; other data is returned as is.
+// zstd streams are decoded by the zstd command. The returned close function
+// releases the decoder and reports decoding errors not yet seen by the reader.
+func decompress(r io.Reader) (io.Reader, func() error, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading gzip stream: %v", err)
+		}
+		return gz, gz.Close, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		cmd := exec.Command("zstd", "-dc")
+		cmd.Stdin = br
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			if errors.Is(err, exec.ErrNotFound) {
+				return nil, nil, fmt.Errorf("zstd-compressed archives require the zstd command: %v", err)
+			}
+			return nil, nil, fmt.Errorf("error starting zstd: %v", err)
+		}
+		closeFn := func() error {
+			// Stop zstd rather than decompressing the rest of the stream
+			// when the caller stopped early. Killing a finished process
+			// fails, and a process the kill stopped has no failure to report.
+			cmd.Process.Kill()
+			if err := cmd.Wait(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) && !exitErr.Exited() {
+					return nil
+				}
+				return fmt.Errorf("error decompressing zstd stream: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+			}
+			return nil
+		}
+		return out, closeFn, nil
+	default:
+		return br, func() error { return nil }, nil
+	}
+}
@@ -0,0 +1,286 @@
+package tar_reader
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Dataset layouts for Dataset.Layout
+const (
+	// LayoutFolders is one directory per class under the root, labelling
+	// each video with the name of the top-level directory it is in
+	LayoutFolders = "folders"
+	// LayoutUCF101 is the UCF101 layout: class directories with official
+	// split files such as trainlist01.txt listing Class/video.avi
+	LayoutUCF101 = "ucf101"
+	// LayoutHMDB51 is the HMDB51 layout: class directories with official
+	// split files <class>_test_split<N>.txt marking each video as train (1),
+	// test (2) or unused (0)
+	LayoutHMDB51 = "hmdb51"
+	// LayoutKinetics is the Kinetics layout: videos named by YouTube ID,
+	// optionally followed by _<start>_<end>, with an annotation CSV of
+	// label, youtube_id, time_start, time_end and split columns
+	LayoutKinetics = "kinetics"
+)
+
+// Dataset describes a local video dataset in a common academic layout
+type Dataset struct {
+	// Layout is one of the Layout constants
+	Layout string
+	// Root is the directory holding the videos
+	Root string
+	// Split, if set, selects the videos of an official split and where
+	// their labels come from: a UCF101 split list, a glob of HMDB51 split
+	// files (e.g. splits/*_test_split1.txt) or a Kinetics annotation CSV.
+	// Without a split every video under Root is read, labelled by its
+	// class directory.
+	Split string
+	// Subset selects the HMDB51 subset, train (the default) or test, or
+	// the Kinetics rows whose split column matches it
+	Subset string
+}
+
+// kineticsName matches the file name of a trimmed Kinetics clip,
+// <youtube_id>_<start>_<end>, as written by the common download scripts
+var kineticsName = regexp.MustCompile(`^(.+)_(\d{6})_(\d{6})$`)
+
+// LoadDataset lists the videos of a dataset as manifest entries labelled
+// with their class, to be read with ExtractClipsFromManifest or
+// StreamClipsFromManifest so the labels are recorded in chunk metadata.
+// opts selects the video extensions and how the root is walked; with
+// PathKeys clips are keyed by their path under the root.
+func LoadDataset(d Dataset, opts Options) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	var err error
+	switch {
+	case d.Layout != LayoutFolders && d.Layout != LayoutUCF101 && d.Layout != LayoutHMDB51 && d.Layout != LayoutKinetics:
+		return nil, fmt.Errorf("unknown dataset layout: %s", d.Layout)
+	case d.Split == "" || d.Layout == LayoutFolders:
+		entries, err = loadFolders(d.Root, opts)
+	case d.Layout == LayoutUCF101:
+		entries, err = loadUCF101Split(d.Root, d.Split)
+	case d.Layout == LayoutHMDB51:
+		entries, err = loadHMDB51Split(d.Root, d.Split, d.Subset)
+	case d.Layout == LayoutKinetics:
+		entries, err = loadKineticsSplit(d.Root, d.Split, d.Subset, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no videos found in dataset %s", d.Root)
+	}
+	if opts.PathKeys {
+		for i := range entries {
+			e := &entries[i]
+			rel, err := filepath.Rel(d.Root, e.Path)
+			if err != nil {
+				return nil, err
+			}
+			e.Key = sanitizeKey(strings.TrimSuffix(rel, filepath.Ext(rel)))
+		}
+	}
+	return entries, nil
+}
+
+// datasetVideos returns the paths relative to root of the video files
+// under it, in lexical order
+func datasetVideos(root string, opts Options) ([]string, error) {
+	var videos []string
+	err := walkTree(root, opts, func(p string) error {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if _, ok := opts.clipKey(rel); ok {
+			videos = append(videos, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading dataset: %v", err)
+	}
+	return videos, nil
+}
+
+// loadFolders lists the videos under root labelled by their top-level
+// directory; videos directly in root are unlabelled
+func loadFolders(root string, opts Options) ([]ManifestEntry, error) {
+	videos, err := datasetVideos(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]ManifestEntry, 0, len(videos))
+	for _, rel := range videos {
+		e := ManifestEntry{Path: filepath.Join(root, rel)}
+		if class, _, ok := strings.Cut(filepath.ToSlash(rel), "/"); ok {
+			e.Label = class
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// loadUCF101Split lists the videos of a UCF101 split file, one
+// Class/video.avi per line optionally followed by a class index, labelled
+// by their class directory
+func loadUCF101Split(root, split string) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	err := readSplitLines(split, func(fields []string) error {
+		name := filepath.ToSlash(fields[0])
+		class := path.Dir(name)
+		if class == "." {
+			return fmt.Errorf("no class directory in %s", name)
+		}
+		entries = append(entries, ManifestEntry{Path: filepath.Join(root, filepath.FromSlash(name)), Label: class})
+		return nil
+	})
+	return entries, err
+}
+
+// loadHMDB51Split lists the videos marked as subset in the HMDB51 split
+// files matching pattern, labelled by the class in the split file's name
+func loadHMDB51Split(root, pattern, subset string) ([]ManifestEntry, error) {
+	var id string
+	switch subset {
+	case "", "train":
+		id = "1"
+	case "test":
+		id = "2"
+	default:
+		return nil, fmt.Errorf("unknown HMDB51 subset: %s", subset)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid split pattern %s: %v", pattern, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no split files match %s", pattern)
+	}
+	sort.Strings(files)
+
+	var entries []ManifestEntry
+	for _, file := range files {
+		class, _, ok := strings.Cut(filepath.Base(file), "_test_split")
+		if !ok {
+			return nil, fmt.Errorf("not an HMDB51 split file: %s", file)
+		}
+		err := readSplitLines(file, func(fields []string) error {
+			if len(fields) < 2 {
+				return fmt.Errorf("missing subset id for %s", fields[0])
+			}
+			if fields[1] == id {
+				entries = append(entries, ManifestEntry{Path: filepath.Join(root, class, fields[0]), Label: class})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// readSplitLines calls fn with the whitespace-separated fields of each
+// non-empty line of a split file
+func readSplitLines(split string, fn func(fields []string) error) error {
+	f, err := os.Open(split)
+	if err != nil {
+		return fmt.Errorf("error opening split file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("%s line %d: %v", split, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading split file: %v", err)
+	}
+	return nil
+}
+
+// loadKineticsSplit lists the videos under root annotated in a Kinetics
+// CSV, labelled by its label column. Videos are matched to rows by YouTube
+// ID, and rows whose video is missing, as many are in any Kinetics
+// download, are skipped. A video named by its bare ID is the untrimmed
+// YouTube video, restricted to the row's time span.
+func loadKineticsSplit(root, split, subset string, opts Options) ([]ManifestEntry, error) {
+	videos, err := datasetVideos(root, opts)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]string, len(videos))
+	for _, rel := range videos {
+		base := filepath.Base(rel)
+		id := strings.TrimSuffix(base, filepath.Ext(base))
+		if m := kineticsName.FindStringSubmatch(id); m != nil {
+			id = m[1]
+		}
+		if _, ok := byID[id]; !ok {
+			byID[id] = rel
+		}
+	}
+
+	f, err := os.Open(split)
+	if err != nil {
+		return nil, fmt.Errorf("error opening split file: %v", err)
+	}
+	defer f.Close()
+
+	table, err := newCSVTable(f, "split file")
+	if err != nil {
+		return nil, err
+	}
+	for _, required := range []string{"label", "youtube_id"} {
+		if !table.hasColumn(required) {
+			return nil, fmt.Errorf("split file header has no %s column", required)
+		}
+	}
+	if subset != "" && !table.hasColumn("split") {
+		return nil, fmt.Errorf("split file header has no split column to select %s", subset)
+	}
+
+	var entries []ManifestEntry
+	for {
+		ok, err := table.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		if subset != "" && table.field("split") != subset {
+			continue
+		}
+		rel, ok := byID[table.field("youtube_id")]
+		if !ok {
+			continue
+		}
+		entry := ManifestEntry{Path: filepath.Join(root, rel), Label: table.field("label")}
+		base := filepath.Base(rel)
+		if strings.TrimSuffix(base, filepath.Ext(base)) == table.field("youtube_id") {
+			if entry.Start, err = table.time("time_start"); err != nil {
+				return nil, err
+			}
+			if entry.End, err = table.time("time_end"); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
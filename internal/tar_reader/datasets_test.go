@@ -0,0 +1,141 @@
+package tar_reader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDataset(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "videos")
+	files := map[string]string{
+		"videos/Archery/v_Archery_g01_c01.avi":            "a1",
+		"videos/Archery/v_Archery_g02_c01.avi":            "a2",
+		"videos/Bowling/v_Bowling_g01_c01.avi":            "b1",
+		"videos/Bowling/notes.txt":                        "not a video",
+		"ucf/trainlist01.txt":                             "Archery/v_Archery_g01_c01.avi 1\nBowling/v_Bowling_g01_c01.avi 2\n",
+		"ucf/testlist01.txt":                              "Archery/v_Archery_g02_c01.avi\n",
+		"hmdb/Archery_test_split1.txt":                    "v_Archery_g01_c01.avi 1\nv_Archery_g02_c01.avi 2\n",
+		"hmdb/Bowling_test_split1.txt":                    "v_Bowling_g01_c01.avi 0\n",
+		"kinetics/clips/abseiling/dQw4w9WgXcQ.mp4":        "untrimmed",
+		"kinetics/clips/juggling/x_y-z_000010_000020.mp4": "trimmed",
+		"kinetics/train.csv": "label,youtube_id,time_start,time_end,split\n" +
+			"abseiling,dQw4w9WgXcQ,5,15,train\n" +
+			"juggling,x_y-z,10,20,train\n" +
+			"juggling,missing0001,0,10,train\n" +
+			"juggling,x_y-z,10,20,val\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kinetics := filepath.Join(dir, "kinetics", "clips")
+	start, end := 5.0, 15.0
+
+	tests := []struct {
+		name     string
+		dataset  Dataset
+		pathKeys bool
+		want     []ManifestEntry
+		wantErr  bool
+	}{
+		{
+			name:    "folders",
+			dataset: Dataset{Layout: LayoutFolders, Root: root},
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g01_c01.avi"), Label: "Archery"},
+				{Path: filepath.Join(root, "Archery/v_Archery_g02_c01.avi"), Label: "Archery"},
+				{Path: filepath.Join(root, "Bowling/v_Bowling_g01_c01.avi"), Label: "Bowling"},
+			},
+		},
+		{
+			name:     "folders with path keys",
+			dataset:  Dataset{Layout: LayoutFolders, Root: root},
+			pathKeys: true,
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g01_c01.avi"), Key: "Archery/v_Archery_g01_c01", Label: "Archery"},
+				{Path: filepath.Join(root, "Archery/v_Archery_g02_c01.avi"), Key: "Archery/v_Archery_g02_c01", Label: "Archery"},
+				{Path: filepath.Join(root, "Bowling/v_Bowling_g01_c01.avi"), Key: "Bowling/v_Bowling_g01_c01", Label: "Bowling"},
+			},
+		},
+		{
+			name:    "ucf101 train split",
+			dataset: Dataset{Layout: LayoutUCF101, Root: root, Split: filepath.Join(dir, "ucf/trainlist01.txt")},
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g01_c01.avi"), Label: "Archery"},
+				{Path: filepath.Join(root, "Bowling/v_Bowling_g01_c01.avi"), Label: "Bowling"},
+			},
+		},
+		{
+			name:    "ucf101 test split",
+			dataset: Dataset{Layout: LayoutUCF101, Root: root, Split: filepath.Join(dir, "ucf/testlist01.txt")},
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g02_c01.avi"), Label: "Archery"},
+			},
+		},
+		{
+			name:    "hmdb51 train subset",
+			dataset: Dataset{Layout: LayoutHMDB51, Root: root, Split: filepath.Join(dir, "hmdb/*_test_split1.txt")},
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g01_c01.avi"), Label: "Archery"},
+			},
+		},
+		{
+			name:    "hmdb51 test subset",
+			dataset: Dataset{Layout: LayoutHMDB51, Root: root, Split: filepath.Join(dir, "hmdb/*_test_split1.txt"), Subset: "test"},
+			want: []ManifestEntry{
+				{Path: filepath.Join(root, "Archery/v_Archery_g02_c01.avi"), Label: "Archery"},
+			},
+		},
+		{
+			name:    "hmdb51 unknown subset",
+			dataset: Dataset{Layout: LayoutHMDB51, Root: root, Split: filepath.Join(dir, "hmdb/*_test_split1.txt"), Subset: "val"},
+			wantErr: true,
+		},
+		{
+			name:    "kinetics",
+			dataset: Dataset{Layout: LayoutKinetics, Root: kinetics, Split: filepath.Join(dir, "kinetics/train.csv"), Subset: "train"},
+			want: []ManifestEntry{
+				{Path: filepath.Join(kinetics, "abseiling/dQw4w9WgXcQ.mp4"), Label: "abseiling", Start: &start, End: &end},
+				{Path: filepath.Join(kinetics, "juggling/x_y-z_000010_000020.mp4"), Label: "juggling"},
+			},
+		},
+		{
+			name:    "kinetics without split file",
+			dataset: Dataset{Layout: LayoutKinetics, Root: kinetics},
+			want: []ManifestEntry{
+				{Path: filepath.Join(kinetics, "abseiling/dQw4w9WgXcQ.mp4"), Label: "abseiling"},
+				{Path: filepath.Join(kinetics, "juggling/x_y-z_000010_000020.mp4"), Label: "juggling"},
+			},
+		},
+		{
+			name:    "no videos",
+			dataset: Dataset{Layout: LayoutFolders, Root: filepath.Join(dir, "ucf")},
+			wantErr: true,
+		},
+		{
+			name:    "unknown layout",
+			dataset: Dataset{Layout: "imagenet", Root: root},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadDataset(tt.dataset, Options{PathKeys: tt.pathKeys})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadDataset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadDataset() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package tar_reader
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// ExtractClipsFromDir reads every video file under dir selected by opts,
+// recursively and in lexical path order, as a clip keyed like the entries
+// of a tar archive, by its base name or, with PathKeys, its path relative to
+// dir. Two files with the same key are handled by opts.Duplicates since their
+// outputs would collide.
+func ExtractClipsFromDir(dir string, opts Options) ([]types.Clip, error) {
+	var clips []types.Clip
+	err := walkDir(dir, opts, func(clip types.Clip) {
+		clips = append(clips, clip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clips, nil
+}
+
+// StreamClipsFromDir reads the clips under dir like ExtractClipsFromDir, but
+// sends each one on clips as soon as it is read. clips is closed when the
+// directory has been read or an error occurs.
+func StreamClipsFromDir(dir string, opts Options, clips chan<- types.Clip) error {
+	defer close(clips)
+	return walkDir(dir, opts, func(clip types.Clip) {
+		clips <- clip
+	})
+}
+
+// walkDir calls fn with each video file under dir in lexical path order
+func walkDir(dir string, opts Options, fn func(types.Clip)) error {
+	keys := newKeySet(opts)
+	err := walkTree(dir, opts, func(path string) error {
+		// Skip macOS hidden files, non-video files and filtered keys
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		key, ok := opts.clipKey(rel)
+		if !ok || !opts.selected(key) {
+			return nil
+		}
+		if key, err = keys.add(key, path); err != nil {
+			return err
+		}
+		if opts.skipped(key) {
+			return nil
+		}
+		if !keys.take() {
+			return fs.SkipAll
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sidecars, err := readSidecars(path)
+		if err != nil {
+			return err
+		}
+		fn(types.Clip{Key: key, RawData: data, Sidecars: sidecars})
+		return nil
+	})
+	if err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkTree calls visit with the path of each file under dir, depth first in
+// lexical order, until visit returns an error. It descends at most
+// opts.MaxDepth directory levels and, with opts.FollowSymlinks, into
+// symlinked directories, skipping links to a directory it is already
+// inside so that cycles end. Other symlinks are visited as files.
+func walkTree(dir string, opts Options, visit func(path string) error) error {
+	var walk func(path string, depth int, ancestors []string) error
+	walk = func(path string, depth int, ancestors []string) error {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return err
+		}
+		for _, ancestor := range ancestors {
+			if ancestor == real {
+				return nil
+			}
+		}
+		ancestors = append(ancestors[:len(ancestors):len(ancestors)], real)
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			child := filepath.Join(path, entry.Name())
+			isDir := entry.IsDir()
+			if opts.FollowSymlinks && entry.Type()&fs.ModeSymlink != 0 {
+				// Broken links are visited as files, failing if they
+				// name a video
+				if info, err := os.Stat(child); err == nil {
+					isDir = info.IsDir()
+				}
+			}
+			if !isDir {
+				err = visit(child)
+			} else if opts.MaxDepth <= 0 || depth < opts.MaxDepth {
+				err = walk(child, depth+1, ancestors)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(dir, 1, nil)
+}
+
+// readSidecars reads the sidecar files next to the video at path, with the
+// same name and a sidecar extension, or returns nil if there are none
+func readSidecars(path string) (map[string][]byte, error) {
+	var sidecars map[string][]byte
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range types.SidecarExtensions {
+		data, err := os.ReadFile(stem + "." + ext)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sidecars == nil {
+			sidecars = make(map[string][]byte)
+		}
+		sidecars[ext] = data
+	}
+	return sidecars, nil
+}
@@ -0,0 +1,151 @@
+package tar_reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// gcsEndpoint is the Cloud Storage JSON API host; replaced in tests
+	gcsEndpoint = "https://storage.googleapis.com"
+
+	// gcsTokens authorizes requests once resolved, or is nil for anonymous
+	// access; replaced in tests
+	gcsMu       sync.Mutex
+	gcsResolved bool
+	gcsTokens   oauth2.TokenSource
+)
+
+// parseGCSURI splits a gs://bucket/object URI
+func parseGCSURI(uri string) (bucket, object string, err error) {
+	bucket, object, _ = strings.Cut(strings.TrimPrefix(uri, "gs://"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid gs URI %s", uri)
+	}
+	return bucket, object, nil
+}
+
+// gcsGet sends an authorized GET request to the Cloud Storage JSON API,
+// with a Range header if byteRange is set
+func gcsGet(apiURL, byteRange string) (*http.Response, error) {
+	gcsMu.Lock()
+	if !gcsResolved {
+		tokens, err := newGCSTokenSource()
+		if err != nil {
+			gcsMu.Unlock()
+			return nil, err
+		}
+		gcsTokens, gcsResolved = tokens, true
+	}
+	tokens := gcsTokens
+	gcsMu.Unlock()
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if tokens != nil {
+		token, err := tokens.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error fetching GCS access token: %v", err)
+		}
+		token.SetAuthHeader(req)
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && !(byteRange != "" && resp.StatusCode == http.StatusPartialContent) {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: %s", &httpStatusError{Status: resp.Status, Code: resp.StatusCode}, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// openGCS opens a Cloud Storage object for a streaming read
+func openGCS(uri string) (io.ReadCloser, error) {
+	return openGCSRange(uri, "")
+}
+
+// openGCSRange opens a Cloud Storage object for a streaming read of the
+// bytes selected by a Range header value, or all of it if byteRange is empty
+func openGCSRange(uri, byteRange string) (io.ReadCloser, error) {
+	bucket, object, err := parseGCSURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := gcsGet(fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media",
+		gcsEndpoint, url.PathEscape(bucket), url.PathEscape(object)), byteRange)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", uri, err)
+	}
+	return resp.Body, nil
+}
+
+// gcsListing is one page of an objects.list response
+type gcsListing struct {
+	Items []struct {
+		Name string `json:"name"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// expandGCS lists the objects selected by a gs:// URI like expandS3
+func expandGCS(pattern string, opts Options) ([]string, error) {
+	bucket, objectPattern, err := parseGCSURI(pattern)
+	if err != nil {
+		return nil, err
+	}
+	prefix, match := listPattern(objectPattern, opts)
+
+	var matches []string
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		resp, err := gcsGet(fmt.Sprintf("%s/storage/v1/b/%s/o?%s", gcsEndpoint, url.PathEscape(bucket), query.Encode()), "")
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %v", pattern, err)
+		}
+		var page gcsListing
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %v", pattern, err)
+		}
+
+		for _, item := range page.Items {
+			ok, err := match(item.Name)
+			if err != nil {
+				return nil, fmt.Errorf("error listing %s: %v", pattern, err)
+			}
+			if ok {
+				matches = append(matches, "gs://"+bucket+"/"+item.Name)
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no objects match %s", pattern)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
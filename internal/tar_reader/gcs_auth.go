@@ -0,0 +1,31 @@
+package tar_reader
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// gcsScope is the OAuth scope requested for reading objects
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+// newGCSTokenSource resolves application default credentials: the file named
+// by GOOGLE_APPLICATION_CREDENTIALS, gcloud's application default
+// credentials, then the service account of a Google Cloud instance. Without
+// any of them it returns nil for anonymous access, which works for public
+// buckets.
+func newGCSTokenSource() (oauth2.TokenSource, error) {
+	creds, err := google.FindDefaultCredentials(context.Background(), gcsScope)
+	if err != nil {
+		// A credentials file that is named but unusable is an error rather
+		// than a silent fallback to anonymous access
+		if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") != "" {
+			return nil, fmt.Errorf("error reading Google credentials: %v", err)
+		}
+		return nil, nil
+	}
+	return creds.TokenSource, nil
+}
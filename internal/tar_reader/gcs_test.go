@@ -0,0 +1,169 @@
+package tar_reader
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeGCS serves a bucket through the Cloud Storage JSON API, requiring the
+// access token its token endpoint hands out for a valid service account JWT
+func fakeGCS(t *testing.T, key *rsa.PrivateKey, objects map[string][]byte) *httptest.Server {
+	const token = "test-token"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if len(parts) != 3 {
+			http.Error(w, "bad assertion", http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"access_token": token, "expires_in": 3600})
+	})
+	mux.HandleFunc("/storage/v1/b/bucket/o", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var names []string
+		for name := range objects {
+			if strings.HasPrefix(name, r.FormValue("prefix")) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		// Serve one object per page to exercise paging
+		var page gcsListing
+		start := 0
+		if r.FormValue("pageToken") != "" {
+			start = len(r.FormValue("pageToken"))
+		}
+		if start < len(names) {
+			page.Items = append(page.Items, struct {
+				Name string `json:"name"`
+			}{names[start]})
+			if start+1 < len(names) {
+				page.NextPageToken = strings.Repeat("x", start+1)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	mux.HandleFunc("/storage/v1/b/bucket/o/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token || r.FormValue("alt") != "media" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		name, _ := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/storage/v1/b/bucket/o/"))
+		data, ok := objects[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGCSSources(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarData := createTestTar(t).Bytes()
+	server := fakeGCS(t, key, map[string][]byte{
+		"data/part-0.tar":     tarData,
+		"data/part-1.tar":     tarData,
+		"data/raw/clip.webm":  []byte("raw video"),
+		"data/raw/readme.txt": []byte("not a video"),
+	})
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "reader@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+		"token_uri":    server.URL + "/token",
+	})
+	credsPath := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(credsPath, creds, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsPath)
+	tokens, err := newGCSTokenSource()
+	if err != nil || tokens == nil {
+		t.Fatalf("newGCSTokenSource() = %v, %v, want service account tokens", tokens, err)
+	}
+
+	savedEndpoint, savedResolved, savedTokens := gcsEndpoint, gcsResolved, gcsTokens
+	gcsEndpoint, gcsResolved, gcsTokens = server.URL, true, tokens
+	t.Cleanup(func() { gcsEndpoint, gcsResolved, gcsTokens = savedEndpoint, savedResolved, savedTokens })
+
+	tests := []struct {
+		name     string
+		patterns []string
+		wantKeys []string
+	}{
+		{"single archive", []string{"gs://bucket/data/part-0.tar"}, []string{"test_video"}},
+		{"glob", []string{"gs://bucket/data/part-*.tar"}, []string{"part-0/test_video", "part-1/test_video"}},
+		{"prefix", []string{"gs://bucket/data/raw/"}, []string{"clip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := ExpandTarPaths(tt.patterns, Options{})
+			if err != nil {
+				t.Fatalf("ExpandTarPaths() error = %v", err)
+			}
+			clips, err := ExtractClipsFromTars(paths, Options{})
+			if err != nil {
+				t.Fatalf("ExtractClipsFromTars() error = %v", err)
+			}
+			var keys []string
+			for _, clip := range clips {
+				keys = append(keys, clip.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+
+	if _, err := ExtractClipsFromTar("gs://bucket/data/missing.tar"); err == nil {
+		t.Error("ExtractClipsFromTar() of missing object succeeded, want error")
+	}
+}
+
+func TestGCSTokenSourceBadCredentials(t *testing.T) {
+	credsPath := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(credsPath, []byte(`{"type": "unknown"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsPath)
+	if _, err := newGCSTokenSource(); err == nil {
+		t.Error("newGCSTokenSource() with unusable credentials succeeded, want error")
+	}
+}
@@ -0,0 +1,184 @@
+package tar_reader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxHTTPRetries is the number of consecutive failed attempts after
+	// which an HTTP download gives up
+	maxHTTPRetries = 5
+)
+
+// httpRetryDelay is the wait before the first retry, doubled on each
+// consecutive failure; replaced in tests
+var httpRetryDelay = time.Second
+
+// httpStatusError is an unsuccessful HTTP response
+type httpStatusError struct {
+	Status string
+	Code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return e.Status
+}
+
+// httpReader streams an HTTP(S) resource, resuming with a range request from
+// the current offset when the connection fails mid-transfer
+type httpReader struct {
+	url    string
+	body   io.ReadCloser
+	offset int64
+	// end is the offset just past the byte range to read, or 0 to read to
+	// the end of the resource
+	end       int64
+	validator string // ETag or Last-Modified checked with If-Range on resume
+	failures  int
+	// pending is a read error that came with data, handled by the next Read
+	// so the data is returned first
+	pending error
+}
+
+// openHTTP starts streaming an HTTP(S) resource
+func openHTTP(url string) (io.ReadCloser, error) {
+	return openHTTPRange(url, 0, 0)
+}
+
+// openHTTPRange starts streaming length bytes of an HTTP(S) resource from
+// offset, or the rest of it from offset if length is 0
+func openHTTPRange(url string, offset, length int64) (io.ReadCloser, error) {
+	r := &httpReader{url: url, offset: offset}
+	if length > 0 {
+		r.end = offset + length
+	}
+	if err := r.connect(); err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", url, err)
+	}
+	return r, nil
+}
+
+// connect (re)opens the response body at the current offset, retrying
+// transient failures with exponential backoff
+func (r *httpReader) connect() error {
+	for {
+		err := r.request()
+		if err == nil {
+			return nil
+		}
+		if !transientHTTPError(err) || r.failures >= maxHTTPRetries {
+			return err
+		}
+		r.backoff()
+	}
+}
+
+// request sends one GET request for the remaining bytes
+func (r *httpReader) request() error {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return err
+	}
+	ranged := r.offset > 0 || r.end > 0
+	if ranged {
+		req.Header.Set("Range", httpRange(r.offset, r.end))
+		if r.validator != "" {
+			req.Header.Set("If-Range", r.validator)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ranged && resp.StatusCode == http.StatusPartialContent:
+	case !ranged && resp.StatusCode == http.StatusOK:
+	case ranged && resp.StatusCode == http.StatusOK:
+		// The server ignored the range or the resource changed
+		resp.Body.Close()
+		return fmt.Errorf("cannot read %s from byte %d: server does not support range requests or the resource changed", r.url, r.offset)
+	default:
+		resp.Body.Close()
+		return &httpStatusError{Status: resp.Status, Code: resp.StatusCode}
+	}
+	if r.validator == "" {
+		r.validator = resp.Header.Get("ETag")
+		if r.validator == "" {
+			r.validator = resp.Header.Get("Last-Modified")
+		}
+	}
+	r.body = resp.Body
+	return nil
+}
+
+// httpRange returns a Range header value for the bytes from offset up to
+// end, exclusive, or to the end of the resource if end is 0
+func httpRange(offset, end int64) string {
+	if end <= 0 {
+		return "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	}
+	return "bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(end-1, 10)
+}
+
+// Read reads from the response body, reconnecting after transient failures
+func (r *httpReader) Read(p []byte) (int, error) {
+	for {
+		n, err := 0, r.pending
+		r.pending = nil
+		if err == nil {
+			n, err = r.body.Read(p)
+			r.offset += int64(n)
+		}
+		if n > 0 {
+			// A connection cut mid-transfer usually fails a read that
+			// also returned data; return the data and resume next time
+			r.failures = 0
+			if err != nil && err != io.EOF {
+				r.pending, err = err, nil
+			}
+			return n, err
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if !transientHTTPError(err) || r.failures >= maxHTTPRetries {
+			return 0, fmt.Errorf("error reading %s: %v", r.url, err)
+		}
+
+		r.body.Close()
+		r.backoff()
+		if err := r.connect(); err != nil {
+			return 0, fmt.Errorf("error resuming %s: %v", r.url, err)
+		}
+	}
+}
+
+// Close closes the current response body
+func (r *httpReader) Close() error {
+	return r.body.Close()
+}
+
+// backoff waits before the next attempt, doubling the delay with each
+// consecutive failure
+func (r *httpReader) backoff() {
+	time.Sleep(httpRetryDelay << r.failures)
+	r.failures++
+}
+
+// transientHTTPError reports whether a request may succeed when retried:
+// connection and truncated transfer errors, rate limiting and server errors
+func transientHTTPError(err error) bool {
+	var status *httpStatusError
+	if errors.As(err, &status) {
+		return status.Code == http.StatusTooManyRequests || status.Code >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,150 @@
+package tar_reader
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPSource(t *testing.T) {
+	tarData := createTestTar(t).Bytes()
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "videos.tar", time.Time{}, bytes.NewReader(tarData))
+	}
+	// truncate sends the first half of the archive, then drops the connection
+	truncate := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(tarData)))
+		w.Write(tarData[:len(tarData)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	tests := []struct {
+		name         string
+		handler      func(attempt int32, w http.ResponseWriter, r *http.Request)
+		wantErr      bool
+		wantRequests int32
+	}{
+		{"plain", func(attempt int32, w http.ResponseWriter, r *http.Request) {
+			serve(w, r)
+		}, false, 1},
+		{"resume after dropped connection", func(attempt int32, w http.ResponseWriter, r *http.Request) {
+			if attempt == 1 {
+				truncate(w, r)
+			}
+			if r.Header.Get("Range") == "" {
+				http.Error(w, "expected range request", http.StatusBadRequest)
+				return
+			}
+			serve(w, r)
+		}, false, 2},
+		{"retry server errors", func(attempt int32, w http.ResponseWriter, r *http.Request) {
+			if attempt <= 2 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			serve(w, r)
+		}, false, 3},
+		{"not found", func(attempt int32, w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}, true, 1},
+		{"no range support", func(attempt int32, w http.ResponseWriter, r *http.Request) {
+			if attempt == 1 {
+				truncate(w, r)
+			}
+			w.Write(tarData)
+		}, true, 2},
+	}
+
+	savedDelay := httpRetryDelay
+	httpRetryDelay = 0
+	t.Cleanup(func() { httpRetryDelay = savedDelay })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(requests.Add(1), w, r)
+			}))
+			defer server.Close()
+
+			clips, err := ExtractClipsFromTar(server.URL + "/data/videos.tar?token=abc")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractClipsFromTar() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(clips) != 1 || string(clips[0].RawData) != "dummy video data") {
+				t.Errorf("ExtractClipsFromTar() = %+v, want test_video with dummy video data", clips)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("server got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// cutBody returns its data together with an error, like a response body
+// whose connection is cut mid-transfer
+type cutBody struct {
+	data []byte
+}
+
+func (b *cutBody) Read(p []byte) (int, error) {
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	return n, io.ErrUnexpectedEOF
+}
+
+func (b *cutBody) Close() error {
+	return nil
+}
+
+func TestHTTPReaderResumesAfterPartialRead(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 10))
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "videos.tar", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	savedDelay := httpRetryDelay
+	httpRetryDelay = 0
+	t.Cleanup(func() { httpRetryDelay = savedDelay })
+
+	r := &httpReader{url: server.URL, body: &cutBody{data: data[:30]}}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadAll() = %q, want %q", got, data)
+	}
+	if want := []string{"bytes=30-"}; !slices.Equal(ranges, want) {
+		t.Errorf("requested ranges %v, want %v", ranges, want)
+	}
+}
+
+func TestHTTPSourceNames(t *testing.T) {
+	if got := ArchiveName("https://example.com/data/part-0001.tar.gz?sig=abc"); got != "part-0001" {
+		t.Errorf("ArchiveName() = %q, want part-0001", got)
+	}
+	if !isVideoSource("https://example.com/clips/a.mp4?download=1", Options{}) {
+		t.Error("isVideoSource() = false for an mp4 URL with a query string")
+	}
+
+	// URLs are never glob-expanded, even with a "?" in the query
+	url := "https://example.com/videos.tar?a=*"
+	paths, err := ExpandTarPaths([]string{url}, Options{})
+	if err != nil || strings.Join(paths, ",") != url {
+		t.Errorf("ExpandTarPaths() = %v, %v, want the URL unchanged", paths, err)
+	}
+}
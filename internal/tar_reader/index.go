@@ -0,0 +1,202 @@
+package tar_reader
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tarIndex lists the entries of an uncompressed tar archive with the offset
+// of their data, so the archive can be read by seeking to the entries needed
+type tarIndex struct {
+	// Size and ModTime identify the version of the archive indexed
+	Size    int64        `json:"size"`
+	ModTime time.Time    `json:"mod_time"`
+	Entries []indexEntry `json:"entries"`
+}
+
+// indexEntry is a non-directory entry of an indexed tar archive
+type indexEntry struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+}
+
+// tarEntry is a non-directory entry of a tar archive
+type tarEntry struct {
+	Name string
+	// read returns the entry's data; it is valid until the next entry
+	read func() ([]byte, error)
+}
+
+// entryReader yields the non-directory entries of a tar archive in order,
+// returning io.EOF after the last one
+type entryReader interface {
+	next() (tarEntry, error)
+}
+
+// openEntries opens the entries of the tar archive at tarPath. A local
+// archive with a current index under opts.IndexDir is read by seeking to its
+// entries; otherwise the archive is read sequentially, decompressing it if
+// needed, and an uncompressed local archive read to the end is indexed.
+func openEntries(tarPath string, opts Options) (entryReader, func() error, error) {
+	local := opts.IndexDir != "" && tarPath != Stdin && !IsRemote(tarPath)
+	if local {
+		if r, closeFn, ok := openIndexed(tarPath, opts.IndexDir); ok {
+			return r, closeFn, nil
+		}
+	}
+
+	f, err := openSource(tarPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(zstdMagic))
+	r, closeDecompressor, err := decompress(br)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	closeFn := func() error {
+		err := closeDecompressor()
+		f.Close()
+		return err
+	}
+
+	s := &scanReader{}
+	if local && !isCompressed(magic) {
+		if info, err := os.Stat(tarPath); err == nil {
+			s.index = &tarIndex{Size: info.Size(), ModTime: info.ModTime()}
+			s.indexPath = indexPath(opts.IndexDir, tarPath)
+		}
+	}
+	s.counter = &countingReader{r: r}
+	s.tr = tar.NewReader(s.counter)
+	return s, closeFn, nil
+}
+
+// scanReader reads a tar archive sequentially, recording an index of its
+// entries if index is set
+type scanReader struct {
+	tr        *tar.Reader
+	counter   *countingReader
+	index     *tarIndex
+	indexPath string
+}
+
+func (s *scanReader) next() (tarEntry, error) {
+	for {
+		hdr, err := s.tr.Next()
+		if err == io.EOF && s.index != nil {
+			// The index is only a cache, so failing to save it is not an error
+			saveIndex(s.indexPath, s.index)
+		}
+		if err != nil {
+			return tarEntry{}, err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if s.index != nil {
+			s.index.Entries = append(s.index.Entries, indexEntry{Name: hdr.Name, Offset: s.counter.n, Size: hdr.Size})
+		}
+		return tarEntry{Name: hdr.Name, read: func() ([]byte, error) {
+			return io.ReadAll(s.tr)
+		}}, nil
+	}
+}
+
+// indexedReader reads the entries of an indexed archive by seeking to them
+type indexedReader struct {
+	f       *os.File
+	entries []indexEntry
+}
+
+func (r *indexedReader) next() (tarEntry, error) {
+	if len(r.entries) == 0 {
+		return tarEntry{}, io.EOF
+	}
+	e := r.entries[0]
+	r.entries = r.entries[1:]
+	return tarEntry{Name: e.Name, read: func() ([]byte, error) {
+		return io.ReadAll(io.NewSectionReader(r.f, e.Offset, e.Size))
+	}}, nil
+}
+
+// openIndexed opens tarPath for reading through its cached index, reporting
+// false if there is no index or the archive changed since it was indexed
+func openIndexed(tarPath, indexDir string) (entryReader, func() error, bool) {
+	data, err := os.ReadFile(indexPath(indexDir, tarPath))
+	if err != nil {
+		return nil, nil, false
+	}
+	var index tarIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, nil, false
+	}
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() != index.Size || !info.ModTime().Equal(index.ModTime) {
+		f.Close()
+		return nil, nil, false
+	}
+	return &indexedReader{f: f, entries: index.Entries}, f.Close, true
+}
+
+// indexPath returns the path of the cached index of a local archive, named
+// by a hash of its absolute path
+func indexPath(indexDir, tarPath string) string {
+	if abs, err := filepath.Abs(tarPath); err == nil {
+		tarPath = abs
+	}
+	sum := sha256.Sum256([]byte(tarPath))
+	return filepath.Join(indexDir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// saveIndex writes an index atomically, so a concurrent reader never sees a
+// partial one
+func saveIndex(path string, index *tarIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// countingReader counts the bytes read through it, giving the offset of
+// tar entry data in the archive
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,130 @@
+package tar_reader
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTarIndex(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct{ name, data string }{
+		{"a/video1.mp4", "video one"},
+		{"a/video1.txt", "caption one"},
+		{"a/" + strings.Repeat("long", 40) + ".mp4", "video with a long name"},
+		{"b/video3.mkv", "video three"},
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0600, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexDir := filepath.Join(dir, "index")
+	opts := Options{IndexDir: indexDir, PathKeys: true}
+	reader := func() string {
+		t.Helper()
+		r, closeFn, err := openEntries(tarPath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closeFn()
+		return fmt.Sprintf("%T", r)
+	}
+	extract := func(opts Options) string {
+		t.Helper()
+		clips, err := ExtractClipsFromTarWithOptions(tarPath, opts)
+		if err != nil {
+			t.Fatalf("ExtractClipsFromTarWithOptions() error = %v", err)
+		}
+		var got []string
+		for _, clip := range clips {
+			got = append(got, fmt.Sprintf("%s=%s %s", clip.Key, clip.RawData, clip.Sidecars["txt"]))
+		}
+		return strings.Join(got, ",")
+	}
+
+	// A read stopped early doesn't index the archive
+	extract(Options{IndexDir: indexDir, MaxClips: 1})
+	if got := reader(); got != "*tar_reader.scanReader" {
+		t.Fatalf("archive read by %s after a partial read, want scanReader", got)
+	}
+
+	// A full read indexes it, and later reads return the same clips
+	want := extract(opts)
+	if got := reader(); got != "*tar_reader.indexedReader" {
+		t.Fatalf("archive read by %s after a full read, want indexedReader", got)
+	}
+	if got := extract(opts); got != want {
+		t.Errorf("clips read through the index = %s, want %s", got, want)
+	}
+	filtered := Options{IndexDir: indexDir, PathKeys: true, Include: regexp.MustCompile("^b/")}
+	if got := extract(filtered); got != "b/video3=video three " {
+		t.Errorf("filtered clips read through the index = %s", got)
+	}
+
+	// A changed archive is read again
+	if err := os.Chtimes(tarPath, time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if got := reader(); got != "*tar_reader.scanReader" {
+		t.Errorf("changed archive read by %s, want scanReader", got)
+	}
+
+	// Compressed archives are never indexed
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(buf.Bytes())
+	zw.Close()
+	gzPath := filepath.Join(dir, "videos.tar.gz")
+	if err := os.WriteFile(gzPath, gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractClipsFromTarWithOptions(gzPath, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(indexPath(indexDir, gzPath)); !os.IsNotExist(err) {
+		t.Errorf("compressed archive was indexed (stat error = %v)", err)
+	}
+
+	var index tarIndex
+	entries, _ := filepath.Glob(filepath.Join(indexDir, "*.json"))
+	if len(entries) != 1 {
+		t.Fatalf("index directory holds %d indexes, want 1", len(entries))
+	}
+	data, _ := os.ReadFile(entries[0])
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range index.Entries {
+		names = append(names, e.Name)
+	}
+	if wantNames := []string{files[0].name, files[1].name, files[2].name, files[3].name}; !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("indexed entries = %v, want %v", names, wantNames)
+	}
+}
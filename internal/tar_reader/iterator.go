@@ -0,0 +1,121 @@
+package tar_reader
+
+import (
+	"io"
+	"sync"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// ClipIterator reads the clips of an input one at a time, so callers in this
+// module can feed their pipelines without holding every clip in memory
+type ClipIterator interface {
+	// Next returns the next clip in input order. It returns io.EOF after
+	// the last clip, or the error that stopped reading the input; a
+	// *DownloadError for URL lists is returned after the clips that were
+	// downloaded.
+	Next() (types.Clip, error)
+	// Close stops reading the input and releases it. It must be called
+	// if Next has not returned an error, and may be called more than once.
+	Close()
+}
+
+// NewTarIterator returns an iterator over the clips of tar archives or
+// single videos, read like ExtractClipsFromTars
+func NewTarIterator(tarPaths []string, opts Options) ClipIterator {
+	return newWalkIterator(opts, func(opts Options, fn func(types.Clip)) error {
+		return walkTars(tarPaths, opts, fn)
+	})
+}
+
+// NewDirIterator returns an iterator over the video files under dir, read
+// like ExtractClipsFromDir
+func NewDirIterator(dir string, opts Options) ClipIterator {
+	return newWalkIterator(opts, func(opts Options, fn func(types.Clip)) error {
+		return walkDir(dir, opts, fn)
+	})
+}
+
+// NewManifestIterator returns an iterator over the videos of manifest
+// entries, read like ExtractClipsFromManifest
+func NewManifestIterator(entries []ManifestEntry, opts Options) ClipIterator {
+	return newWalkIterator(opts, func(opts Options, fn func(types.Clip)) error {
+		return walkManifest(entries, opts, fn)
+	})
+}
+
+// NewURLIterator returns an iterator over the videos of a URL list,
+// downloaded like ExtractClipsFromURLs by workers concurrent downloads.
+// Clips are returned in the order their downloads complete.
+func NewURLIterator(entries []URLEntry, workers int, opts Options) ClipIterator {
+	return newWalkIterator(opts, func(opts Options, fn func(types.Clip)) error {
+		return downloadURLs(entries, workers, opts, func(_ int, clip types.Clip) {
+			fn(clip)
+		})
+	})
+}
+
+// NewYTDLPIterator returns an iterator over the videos of a list of IDs or
+// URLs, downloaded like ExtractClipsWithYTDLP. Clips are returned in the
+// order their downloads complete.
+func NewYTDLPIterator(ids []string, dl YTDLP, opts Options) ClipIterator {
+	return newWalkIterator(opts, func(opts Options, fn func(types.Clip)) error {
+		return dl.fetch(ids, opts, func(_ int, clip types.Clip) {
+			fn(clip)
+		})
+	})
+}
+
+// walkIterator runs a walk function in a goroutine, handing each clip to
+// Next over an unbuffered channel so at most one clip is held beyond those
+// the caller has taken
+type walkIterator struct {
+	clips chan types.Clip
+	errc  chan error
+	done  chan struct{}
+	once  sync.Once
+	// err is returned by Next once the walk has finished
+	err error
+}
+
+func newWalkIterator(opts Options, walk func(Options, func(types.Clip)) error) *walkIterator {
+	it := &walkIterator{
+		clips: make(chan types.Clip),
+		errc:  make(chan error, 1),
+		done:  make(chan struct{}),
+	}
+	opts.done = it.done
+	go func() {
+		defer close(it.clips)
+		it.errc <- walk(opts, func(clip types.Clip) {
+			select {
+			case it.clips <- clip:
+			case <-it.done:
+			}
+		})
+	}()
+	return it
+}
+
+func (it *walkIterator) Next() (types.Clip, error) {
+	if it.err != nil {
+		return types.Clip{}, it.err
+	}
+	if clip, ok := <-it.clips; ok {
+		return clip, nil
+	}
+	if it.err = <-it.errc; it.err == nil {
+		it.err = io.EOF
+	}
+	return types.Clip{}, it.err
+}
+
+// Close stops the walk at its next clip and waits for it to finish, so the
+// input is closed when Close returns
+func (it *walkIterator) Close() {
+	it.once.Do(func() {
+		close(it.done)
+		for range it.clips {
+		}
+	})
+}
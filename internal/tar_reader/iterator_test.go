@@ -0,0 +1,72 @@
+package tar_reader
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClipIterator(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("video%03d.mp4", i)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading to the end yields every clip in order, then io.EOF
+	it := NewTarIterator([]string{tarPath}, Options{})
+	for i := 0; i < 100; i++ {
+		clip, err := it.Next()
+		if err != nil {
+			t.Fatalf("Next() error = %v after %d clips", err, i)
+		}
+		if want := fmt.Sprintf("video%03d", i); clip.Key != want || string(clip.RawData) != want+".mp4" {
+			t.Fatalf("clip %d = %s, want %s", i, clip.Key, want)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := it.Next(); err != io.EOF {
+			t.Errorf("Next() after the last clip error = %v, want io.EOF", err)
+		}
+	}
+	it.Close()
+
+	// Closing early stops reading the archive
+	var considered int
+	it = NewTarIterator([]string{tarPath}, Options{Skip: func(string) bool {
+		considered++
+		return false
+	}})
+	if _, err := it.Next(); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	it.Close()
+	it.Close()
+	if considered > 3 {
+		t.Errorf("iterator read %d clips after being closed at the first, want at most 3", considered)
+	}
+
+	// Errors stopping the input are returned by Next
+	it = NewDirIterator(filepath.Join(t.TempDir(), "missing"), Options{})
+	defer it.Close()
+	if _, err := it.Next(); err == nil || err == io.EOF {
+		t.Errorf("Next() on a missing directory error = %v, want error", err)
+	}
+}
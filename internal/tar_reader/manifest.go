@@ -0,0 +1,354 @@
+package tar_reader
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// ManifestEntry is one video listed in an input manifest, with optional
+// per-clip fields carried through to the clip's chunk metadata
+type ManifestEntry struct {
+	// Path is a local path, resolved relative to the manifest if relative,
+	// or a remote URI
+	Path string `json:"path"`
+	// Key overrides the clip key, which defaults to the file name without
+	// its extension, followed by _<offset> for a byte range
+	Key     string `json:"key,omitempty"`
+	Label   string `json:"label,omitempty"`
+	Caption string `json:"caption,omitempty"`
+	// Start and End restrict processing to a time span in seconds
+	Start *float64 `json:"start,omitempty"`
+	End   *float64 `json:"end,omitempty"`
+	// Offset and Length, if Length is positive, select the video as a byte
+	// range of Path, a large container file holding many videos, so only
+	// that range is read
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
+	// FPS, Size, TargetFrames and Transforms override the run's options
+	// for this clip, e.g. to crop portrait and landscape videos differently
+	FPS          int      `json:"fps,omitempty"`
+	Size         string   `json:"size,omitempty"`
+	TargetFrames int      `json:"target_frames,omitempty"`
+	Transforms   []string `json:"transforms,omitempty"`
+}
+
+// overrides returns the entry's per-clip option overrides, if any
+func (e *ManifestEntry) overrides() *types.ClipOverrides {
+	if e.FPS == 0 && e.Size == "" && e.TargetFrames == 0 && len(e.Transforms) == 0 {
+		return nil
+	}
+	return &types.ClipOverrides{
+		FPS:          e.FPS,
+		Size:         e.Size,
+		TargetFrames: e.TargetFrames,
+		Transforms:   e.Transforms,
+	}
+}
+
+// LoadManifest reads an input manifest from a local file or remote URI.
+// CSV manifests need a header row naming their columns: path (required),
+// key, label, caption, start, end, offset, length, and the overrides fps,
+// size, target_frames and transforms, a ";"-separated list of transform
+// specs. JSONL manifests have one JSON object per line with the same
+// fields, transforms being an array:
+//
+//	{"path": "videos/a.mp4", "label": "jump", "caption": "a man jumps", "start": 1.5, "end": 4}
+//	{"path": "packed/videos-000.bin", "key": "b", "offset": 1048576, "length": 524288}
+//	{"path": "videos/portrait.mp4", "size": "144x256", "transforms": ["hflip"]}
+//
+// Other columns and fields are ignored.
+func LoadManifest(path string) ([]ManifestEntry, error) {
+	r, err := openSource(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening manifest: %v", err)
+	}
+	defer r.Close()
+
+	var entries []ManifestEntry
+	switch strings.ToLower(filepath.Ext(sourceName(path))) {
+	case ".csv":
+		entries, err = parseCSVManifest(r)
+	case ".jsonl":
+		entries, err = parseJSONLManifest(r)
+	default:
+		return nil, fmt.Errorf("unsupported manifest format: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve relative paths against the manifest's directory
+	dir := filepath.Dir(path)
+	for i := range entries {
+		e := &entries[i]
+		if e.Path == "" {
+			return nil, fmt.Errorf("manifest entry %d: missing path", i+1)
+		}
+		if e.Start != nil && *e.Start < 0 || e.End != nil && *e.End <= startOf(e) {
+			return nil, fmt.Errorf("manifest entry %d: invalid span", i+1)
+		}
+		if e.Offset < 0 || e.Length < 0 || e.Offset > 0 && e.Length == 0 {
+			return nil, fmt.Errorf("manifest entry %d: invalid byte range", i+1)
+		}
+		if e.FPS < 0 || e.TargetFrames < 0 {
+			return nil, fmt.Errorf("manifest entry %d: invalid fps or target_frames", i+1)
+		}
+		if !IsRemote(path) && !IsRemote(e.Path) && !filepath.IsAbs(e.Path) {
+			e.Path = filepath.Join(dir, e.Path)
+		}
+	}
+	return entries, nil
+}
+
+// startOf returns the start time of an entry, 0 if unset
+func startOf(e *ManifestEntry) float64 {
+	if e.Start == nil {
+		return 0
+	}
+	return *e.Start
+}
+
+// parseCSVManifest parses a CSV manifest with a header row
+func parseCSVManifest(r io.Reader) ([]ManifestEntry, error) {
+	table, err := newCSVTable(r, "manifest")
+	if err != nil {
+		return nil, err
+	}
+	if !table.hasColumn("path") {
+		return nil, fmt.Errorf("manifest header has no path column")
+	}
+
+	var entries []ManifestEntry
+	for {
+		ok, err := table.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		entry := ManifestEntry{
+			Path:    table.field("path"),
+			Key:     table.field("key"),
+			Label:   table.field("label"),
+			Caption: table.field("caption"),
+		}
+		if entry.Start, err = table.time("start"); err != nil {
+			return nil, err
+		}
+		if entry.End, err = table.time("end"); err != nil {
+			return nil, err
+		}
+		if entry.Offset, err = table.size("offset"); err != nil {
+			return nil, err
+		}
+		if entry.Length, err = table.size("length"); err != nil {
+			return nil, err
+		}
+		fps, err := table.size("fps")
+		if err != nil {
+			return nil, err
+		}
+		targetFrames, err := table.size("target_frames")
+		if err != nil {
+			return nil, err
+		}
+		entry.FPS, entry.TargetFrames = int(fps), int(targetFrames)
+		entry.Size = table.field("size")
+		for _, spec := range strings.Split(table.field("transforms"), ";") {
+			if spec = strings.TrimSpace(spec); spec != "" {
+				entry.Transforms = append(entry.Transforms, spec)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// csvTable reads the records of a CSV file by the column names in its
+// header row, which are matched case-insensitively
+type csvTable struct {
+	reader *csv.Reader
+	// name describes the file in errors, e.g. "manifest"
+	name    string
+	columns map[string]int
+	record  []string
+	line    int
+}
+
+// newCSVTable reads the header row of r
+func newCSVTable(r io.Reader, name string) (*csvTable, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s header: %v", name, err)
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	return &csvTable{reader: reader, name: name, columns: columns, line: 1}, nil
+}
+
+func (t *csvTable) hasColumn(name string) bool {
+	_, ok := t.columns[name]
+	return ok
+}
+
+// next reads the next record, returning false at the end of the file
+func (t *csvTable) next() (bool, error) {
+	record, err := t.reader.Read()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error parsing %s: %v", t.name, err)
+	}
+	t.record = record
+	t.line++
+	return true, nil
+}
+
+// field returns the trimmed value of a column in the current record, or
+// "" if the column is missing
+func (t *csvTable) field(name string) string {
+	if i, ok := t.columns[name]; ok && i < len(t.record) {
+		return strings.TrimSpace(t.record[i])
+	}
+	return ""
+}
+
+// time parses a column of seconds, returning nil if it is empty
+func (t *csvTable) time(name string) (*float64, error) {
+	value := t.field(name)
+	if value == "" {
+		return nil, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s line %d: invalid %s %q", t.name, t.line, name, value)
+	}
+	return &seconds, nil
+}
+
+// size parses an integer column, returning 0 if it is empty
+func (t *csvTable) size(name string) (int64, error) {
+	value := t.field(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s line %d: invalid %s %q", t.name, t.line, name, value)
+	}
+	return n, nil
+}
+
+// parseJSONLManifest parses a manifest of one JSON object per line
+func parseJSONLManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry ManifestEntry
+		if err := json.Unmarshal([]byte(text), &entry); err != nil {
+			return nil, fmt.Errorf("manifest line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+	return entries, nil
+}
+
+// ExtractClipsFromManifest reads the videos listed in a manifest as clips
+// carrying the entries' label, caption, span and option overrides. Duplicate keys are handled
+// by opts.Duplicates.
+func ExtractClipsFromManifest(entries []ManifestEntry, opts Options) ([]types.Clip, error) {
+	var clips []types.Clip
+	err := walkManifest(entries, opts, func(clip types.Clip) {
+		clips = append(clips, clip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clips, nil
+}
+
+// StreamClipsFromManifest reads the videos of a manifest like
+// ExtractClipsFromManifest, but sends each clip on clips as soon as it is
+// read. clips is closed when all entries have been read or an error occurs.
+func StreamClipsFromManifest(entries []ManifestEntry, opts Options, clips chan<- types.Clip) error {
+	defer close(clips)
+	return walkManifest(entries, opts, func(clip types.Clip) {
+		clips <- clip
+	})
+}
+
+// walkManifest calls fn with the clip of each manifest entry in order
+func walkManifest(entries []ManifestEntry, opts Options, fn func(types.Clip)) error {
+	keys := newKeySet(opts)
+	for _, e := range entries {
+		source := e.Path
+		if e.Length > 0 {
+			source = fmt.Sprintf("%s@%d+%d", e.Path, e.Offset, e.Length)
+		}
+		key := e.Key
+		if key == "" {
+			base := filepath.Base(sourceName(e.Path))
+			key = strings.TrimSuffix(base, filepath.Ext(base))
+			if e.Length > 0 {
+				key += "_" + strconv.FormatInt(e.Offset, 10)
+			}
+		}
+		if !opts.selected(key) {
+			continue
+		}
+		key, err := keys.add(key, source)
+		if err != nil {
+			return err
+		}
+		if opts.skipped(key) {
+			continue
+		}
+		if !keys.take() {
+			break
+		}
+
+		var clip types.Clip
+		if e.Length > 0 {
+			clip, err = readRange(e.Path, key, e.Offset, e.Length)
+		} else {
+			clip, err = readVideo(e.Path, key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+		clip.Label = e.Label
+		clip.Caption = e.Caption
+		if e.Start != nil || e.End != nil {
+			span := types.Span{Start: startOf(&e)}
+			if e.End != nil {
+				span.End = *e.End
+			}
+			clip.Spans = []types.Span{span}
+		}
+		clip.Overrides = e.overrides()
+		fn(clip)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package tar_reader
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"a.mp4": "video a", "sub/b.mkv": "video b"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wantClips := []types.Clip{
+		{Key: "a", RawData: []byte("video a"), Label: "jump", Caption: "a man jumps, twice",
+			Spans: []types.Span{{Start: 1.5, End: 4}}},
+		{Key: "clip_b", RawData: []byte("video b"), Spans: []types.Span{{Start: 2}},
+			Overrides: &types.ClipOverrides{FPS: 15, Size: "144x256", TargetFrames: 8, Transforms: []string{"hflip", "eq=contrast=1.2"}}},
+	}
+
+	tests := []struct {
+		name     string
+		manifest string
+		data     string
+		wantErr  bool
+	}{
+		{
+			name:     "csv",
+			manifest: "manifest.csv",
+			data: "key,path,label,caption,start,end,source,fps,size,target_frames,transforms\n" +
+				",a.mp4,jump,\"a man jumps, twice\",1.5,4,web,,,,\n" +
+				"clip_b,sub/b.mkv,,,2,,,15,144x256,8,hflip; eq=contrast=1.2\n",
+		},
+		{
+			name:     "jsonl",
+			manifest: "manifest.jsonl",
+			data: `{"path": "a.mp4", "label": "jump", "caption": "a man jumps, twice", "start": 1.5, "end": 4}` + "\n\n" +
+				`{"path": "sub/b.mkv", "key": "clip_b", "start": 2, "fps": 15, "size": "144x256", "target_frames": 8, "transforms": ["hflip", "eq=contrast=1.2"]}` + "\n",
+		},
+		{name: "missing path column", manifest: "bad.csv", data: "file,label\na.mp4,jump\n", wantErr: true},
+		{name: "invalid time", manifest: "bad.csv", data: "path,start\na.mp4,soon\n", wantErr: true},
+		{name: "invalid fps", manifest: "bad.csv", data: "path,fps\na.mp4,fast\n", wantErr: true},
+		{name: "negative target frames", manifest: "bad.jsonl", data: `{"path": "a.mp4", "target_frames": -1}` + "\n", wantErr: true},
+		{name: "end before start", manifest: "bad.csv", data: "path,start,end\na.mp4,4,2\n", wantErr: true},
+		{name: "missing path", manifest: "bad.jsonl", data: `{"label": "jump"}` + "\n", wantErr: true},
+		{name: "unsupported format", manifest: "bad.txt", data: "a.mp4\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.manifest)
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := LoadManifest(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			clips, err := ExtractClipsFromManifest(entries, Options{})
+			if err != nil {
+				t.Fatalf("ExtractClipsFromManifest() error = %v", err)
+			}
+			if !reflect.DeepEqual(clips, wantClips) {
+				t.Errorf("ExtractClipsFromManifest() = %+v, want %+v", clips, wantClips)
+			}
+		})
+	}
+
+	// Two rows with the same key are rejected
+	entries := []ManifestEntry{{Path: filepath.Join(dir, "a.mp4")}, {Path: filepath.Join(dir, "a.mp4")}}
+	if _, err := ExtractClipsFromManifest(entries, Options{}); err == nil {
+		t.Error("ExtractClipsFromManifest() with duplicate keys succeeded, want error")
+	}
+}
+
+func TestManifestByteRanges(t *testing.T) {
+	container := []byte("headervideo-onevideo-two")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "packed.bin"), container, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "packed.bin", time.Time{}, bytes.NewReader(container))
+	}))
+	defer server.Close()
+	useFakeS3(t, map[string][]byte{"packed.bin": container})
+
+	manifest := filepath.Join(dir, "manifest.csv")
+	data := "path,key,offset,length\n" +
+		"packed.bin,,6,9\n" +
+		"packed.bin,two,15,9\n" +
+		server.URL + "/packed.bin,web,15,9\n" +
+		"s3://bucket/packed.bin,s3,6,9\n"
+	if err := os.WriteFile(manifest, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := LoadManifest(manifest)
+	if err != nil {
+		t.Fatalf("LoadManifest() error = %v", err)
+	}
+	clips, err := ExtractClipsFromManifest(entries, Options{})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromManifest() error = %v", err)
+	}
+	var got []string
+	for _, clip := range clips {
+		got = append(got, clip.Key+"="+string(clip.RawData))
+	}
+	want := "packed_6=video-one,two=video-two,web=video-two,s3=video-one"
+	if strings.Join(got, ",") != want {
+		t.Errorf("clips = %v, want %s", got, want)
+	}
+	if strings.Join(ranges, ",") != "bytes=15-23" {
+		t.Errorf("HTTP range requests = %v, want [bytes=15-23]", ranges)
+	}
+
+	// A range past the end of the file fails
+	past := []ManifestEntry{{Path: filepath.Join(dir, "packed.bin"), Offset: 20, Length: 9}}
+	if _, err := ExtractClipsFromManifest(past, Options{}); err == nil {
+		t.Error("ExtractClipsFromManifest() with a range past the end succeeded, want error")
+	}
+
+	for _, bad := range []string{"path,offset\npacked.bin,6\n", "path,offset,length\npacked.bin,-1,9\n", "path,length\npacked.bin,many\n"} {
+		if err := os.WriteFile(manifest, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadManifest(manifest); err == nil {
+			t.Errorf("LoadManifest(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package tar_reader
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// archiveExtensions are stripped from tar file names to name their archive,
+// longest first
+var archiveExtensions = []string{".tar.gz", ".tar.zst", ".tgz", ".tar"}
+
+// ExpandTarPaths expands brace patterns among paths, such as
+// "data-{0000..0099}.tar", into the paths they list in order, then glob
+// patterns into the files they match, sorted within each pattern. Paths
+// without glob metacharacters are kept as is; a pattern matching nothing is
+// an error. S3 and GCS URIs are expanded by listing the bucket, and a URI
+// ending in "/" selects every archive and video (per opts) under that
+// prefix. HTTP(S) URLs are expanded only by braces.
+func ExpandTarPaths(paths []string, opts Options) ([]string, error) {
+	var listed []string
+	for _, path := range paths {
+		listed = append(listed, expandBraces(path)...)
+	}
+
+	var expanded []string
+	for _, path := range listed {
+		if isBucketURI(path) && (strings.ContainsAny(path, "*?[") || strings.HasSuffix(path, "/")) {
+			matches, err := expandRemote(path, opts)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, matches...)
+			continue
+		}
+		if IsRemote(path) || !strings.ContainsAny(path, "*?[") {
+			expanded = append(expanded, path)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar pattern %s: %v", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no tar files match %s", path)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// ArchiveName returns the name of a tar archive used to namespace its clip
+// keys: its base name without the tar and compression extensions (and
+// without the query string of a URL), or "stdin" for standard input
+func ArchiveName(tarPath string) string {
+	if tarPath == Stdin {
+		return stdinArchiveName
+	}
+	base := filepath.Base(sourceName(tarPath))
+	for _, ext := range archiveExtensions {
+		if len(base) > len(ext) && strings.EqualFold(base[len(base)-len(ext):], ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+// ExtractClipsFromTars reads the clips of several sources in order. Each
+// source is a tar archive, or a single video if its name has a video
+// extension (per opts) and no archive extension. With more than one archive
+// the keys of their clips are prefixed by the ArchiveName and a slash, e.g.
+// "part-0001/video1", so that clips of different archives never collide.
+func ExtractClipsFromTars(tarPaths []string, opts Options) ([]types.Clip, error) {
+	var clips []types.Clip
+	err := walkTars(tarPaths, opts, func(clip types.Clip) {
+		clips = append(clips, clip)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clips, nil
+}
+
+// StreamClipsFromTars reads the clips of several sources like
+// ExtractClipsFromTars, but sends each one on clips as soon as it is read.
+// clips is closed when all sources have been read or an error occurs.
+func StreamClipsFromTars(tarPaths []string, opts Options, clips chan<- types.Clip) error {
+	defer close(clips)
+	return walkTars(tarPaths, opts, func(clip types.Clip) {
+		clips <- clip
+	})
+}
+
+// walkTars calls fn with each clip of the sources in order, namespacing
+// archive keys when there is more than one archive
+func walkTars(tarPaths []string, opts Options, fn func(types.Clip)) error {
+	var archives []string
+	for _, path := range tarPaths {
+		if !isVideoSource(path, opts) {
+			archives = append(archives, path)
+		}
+	}
+	namespace := len(archives) > 1
+
+	stdin := 0
+	for _, path := range tarPaths {
+		if path == Stdin {
+			stdin++
+		}
+	}
+	if stdin > 1 {
+		return fmt.Errorf("standard input can be read only once")
+	}
+
+	seen := make(map[string]string)
+	for _, path := range archives {
+		name := ArchiveName(path)
+		if other, ok := seen[name]; ok && namespace {
+			return fmt.Errorf("duplicate archive name %s: %s and %s", name, other, path)
+		}
+		seen[name] = path
+	}
+
+	keys := newKeySet(opts)
+	for _, path := range tarPaths {
+		if keys.full() {
+			break
+		}
+		if isVideoSource(path, opts) {
+			key, _ := opts.clipKey(filepath.Base(sourceName(path)))
+			if !opts.selected(key) {
+				continue
+			}
+			key, err := keys.add(key, path)
+			if err != nil {
+				return err
+			}
+			if opts.skipped(key) {
+				continue
+			}
+			if !keys.take() {
+				return nil
+			}
+			clip, err := readVideo(path, key)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			fn(clip)
+			continue
+		}
+
+		prefix := ""
+		if namespace {
+			prefix = ArchiveName(path) + "/"
+		}
+		err := walkTar(path, opts, prefix, keys, fn)
+		if err != nil {
+			if !namespace {
+				return err
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// isVideoSource reports whether a source is a single video rather than an
+// archive: its name has a video extension (per opts) and no archive extension
+func isVideoSource(source string, opts Options) bool {
+	name := sourceName(source)
+	_, video := opts.clipKey(name)
+	return video && !isArchive(name)
+}
+
+// readVideo reads a single video source as a clip
+func readVideo(path, key string) (types.Clip, error) {
+	r, err := openSource(path)
+	if err != nil {
+		return types.Clip{}, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return types.Clip{}, err
+	}
+	return types.Clip{Key: key, RawData: data}, nil
+}
+
+// readRange reads length bytes from offset of a local file or remote object
+// as a clip, failing if the range extends past the end of the file
+func readRange(path, key string, offset, length int64) (types.Clip, error) {
+	r, err := openRange(path, offset, length)
+	if err != nil {
+		return types.Clip{}, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, length))
+	if err != nil {
+		return types.Clip{}, err
+	}
+	if int64(len(data)) != length {
+		return types.Clip{}, fmt.Errorf("byte range %d+%d extends past the end of the file", offset, length)
+	}
+	return types.Clip{Key: key, RawData: data}, nil
+}
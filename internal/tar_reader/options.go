@@ -0,0 +1,238 @@
+package tar_reader
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/shuffle"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// DefaultExtensions are the video file extensions read when Options lists none
+var DefaultExtensions = []string{".mp4", ".mkv", ".webm", ".mov", ".avi", ".m4v"}
+
+// Duplicate key policies for Options.Duplicates
+const (
+	// DuplicateError fails the input on the first duplicate key
+	DuplicateError = "error"
+	// DuplicateSuffix renames a duplicate key by appending _2, _3, ...
+	DuplicateSuffix = "suffix"
+)
+
+// Options configures which files of an input are read as clips and how they
+// are keyed
+type Options struct {
+	// Extensions lists the file extensions read as clips, matched case
+	// insensitively with or without the leading dot. Empty means
+	// DefaultExtensions.
+	Extensions []string
+	// PathKeys keys clips of archives and directories by their sanitized
+	// path within the input, e.g. "a/clip", instead of their base name
+	PathKeys bool
+	// Duplicates is the policy for two clips with the same key, whose
+	// outputs would otherwise clobber each other: DuplicateError (the
+	// default when empty) or DuplicateSuffix
+	Duplicates string
+	// OnDuplicate, if set, is called when a duplicate key of the clip at
+	// path is renamed to renamed
+	OnDuplicate func(key, renamed, path string)
+	// Include, if set, selects only clips whose key it matches, and
+	// Exclude drops clips whose key it matches. Keys are matched as
+	// produced, including any archive prefix, before duplicates are
+	// renamed; unselected clips are skipped without reading their data.
+	Include *regexp.Regexp
+	Exclude *regexp.Regexp
+	// Skip, if set, drops clips whose final key it reports true, e.g. clips
+	// processed by an earlier run, without reading their data. Skipped
+	// clips still count for duplicate detection, so renamed keys are the
+	// same in every run.
+	Skip func(key string) bool
+	// MaxClips, if positive, stops reading the input once this many clips
+	// have been read, e.g. for a quick pilot run
+	MaxClips int
+	// SampleFraction, if positive, keeps a random fraction of the clips,
+	// chosen by a hash of Seed and the clip key so the same clips are
+	// picked in every run and input order
+	SampleFraction float64
+	Seed           int64
+	// FollowSymlinks descends into symlinked directories of an input
+	// directory, such as a symlink farm pointing into an archive volume.
+	// Clips are keyed by their path through the link; links back to a
+	// directory being walked are skipped.
+	FollowSymlinks bool
+	// MaxDepth, if positive, limits how many directory levels of an input
+	// directory are read: 1 reads only the files directly in it
+	MaxDepth int
+	// IndexDir, if set, caches an index of the entries of each local
+	// uncompressed tar archive in this directory the first time it is read
+	// to the end, so later reads seek straight to the entries they need
+	// instead of reading through the whole archive
+	IndexDir string
+
+	// done, when closed, stops reading the input at the next clip, as if
+	// MaxClips had been reached; set by iterators on Close
+	done <-chan struct{}
+}
+
+// stopped reports whether reading the input was stopped through done
+func (o Options) stopped() bool {
+	select {
+	case <-o.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// clipKey returns the key of the clip stored at name, its base name (or
+// sanitized path with PathKeys) without the extension, and whether name is
+// a video file to read. macOS resource fork files ("._name") are never read.
+func (o Options) clipKey(name string) (string, bool) {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, "._") {
+		return "", false
+	}
+	extensions := o.Extensions
+	if len(extensions) == 0 {
+		extensions = DefaultExtensions
+	}
+	ext := filepath.Ext(base)
+	for _, allowed := range extensions {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(allowed, ".")) {
+			if o.PathKeys {
+				return sanitizeKey(strings.TrimSuffix(name, ext)), true
+			}
+			return strings.TrimSuffix(base, ext), true
+		}
+	}
+	return "", false
+}
+
+// sidecarExt returns the extension of a sidecar file, lowercase and without
+// the dot, and whether name is one. macOS resource fork files are never
+// sidecars.
+func sidecarExt(name string) (string, bool) {
+	if strings.HasPrefix(filepath.Base(name), "._") {
+		return "", false
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, allowed := range types.SidecarExtensions {
+		if ext == allowed {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
+// selected reports whether a clip key passes the Include and Exclude filters
+// and is in the sample
+func (o Options) selected(key string) bool {
+	if o.Include != nil && !o.Include.MatchString(key) {
+		return false
+	}
+	if o.Exclude != nil && o.Exclude.MatchString(key) {
+		return false
+	}
+	return o.SampleFraction <= 0 || sampleValue(o.Seed, key) < o.SampleFraction
+}
+
+// sampleValue maps a seed and clip key to a uniform value in [0, 1)
+func sampleValue(seed int64, key string) float64 {
+	return float64(shuffle.Rank(seed, key)>>11) / (1 << 53)
+}
+
+// skipped reports whether the clip with the final key is dropped by Skip
+func (o Options) skipped(key string) bool {
+	return o.Skip != nil && o.Skip(key)
+}
+
+// sanitizeKey turns a file path into a clip key that is safe to use as an
+// output path: forward slashes only, no empty, "." or ".." elements, and
+// characters other than letters, digits, "-", "_" and "." replaced by "_"
+func sanitizeKey(name string) string {
+	var elems []string
+	for _, elem := range strings.Split(filepath.ToSlash(name), "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			continue
+		}
+		elems = append(elems, strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+				return r
+			}
+			return '_'
+		}, elem))
+	}
+	return strings.Join(elems, "/")
+}
+
+// Validate checks that the options are consistent
+func (o Options) Validate() error {
+	switch o.Duplicates {
+	case "", DuplicateError, DuplicateSuffix:
+	default:
+		return fmt.Errorf("unknown duplicate key policy: %s", o.Duplicates)
+	}
+	if o.MaxClips < 0 {
+		return fmt.Errorf("max clips must not be negative, got %d", o.MaxClips)
+	}
+	if o.SampleFraction < 0 || o.SampleFraction > 1 {
+		return fmt.Errorf("sample fraction must be between 0 and 1, got %g", o.SampleFraction)
+	}
+	if o.MaxDepth < 0 {
+		return fmt.Errorf("max depth must not be negative, got %d", o.MaxDepth)
+	}
+	return nil
+}
+
+// keySet tracks the clip keys of an input to apply the duplicate policy,
+// and counts the clips read to apply MaxClips
+type keySet struct {
+	opts  Options
+	seen  map[string]string
+	clips int
+}
+
+func newKeySet(opts Options) *keySet {
+	return &keySet{opts: opts, seen: make(map[string]string)}
+}
+
+// add records the key of the clip at path, returning the key to use: key
+// itself, or a renamed key for a duplicate under DuplicateSuffix
+func (k *keySet) add(key, path string) (string, error) {
+	other, ok := k.seen[key]
+	if !ok {
+		k.seen[key] = path
+		return key, nil
+	}
+	if k.opts.Duplicates != DuplicateSuffix {
+		return "", fmt.Errorf("duplicate clip key %s: %s and %s", key, other, path)
+	}
+	for n := 2; ; n++ {
+		renamed := key + "_" + strconv.Itoa(n)
+		if _, ok := k.seen[renamed]; !ok {
+			k.seen[renamed] = path
+			if k.opts.OnDuplicate != nil {
+				k.opts.OnDuplicate(key, renamed, path)
+			}
+			return renamed, nil
+		}
+	}
+}
+
+// take counts a clip about to be read, reporting false, without counting
+// it, if MaxClips clips have already been read or reading was stopped
+func (k *keySet) take() bool {
+	if k.full() {
+		return false
+	}
+	k.clips++
+	return true
+}
+
+// full reports whether MaxClips clips have been read or reading was stopped
+func (k *keySet) full() bool {
+	return k.opts.MaxClips > 0 && k.clips >= k.opts.MaxClips || k.opts.stopped()
+}
@@ -1,48 +1,142 @@
 package tar_reader
 
 import (
-	"archive/tar"
-	"bytes"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/melody-ding/go-vidprep/internal/types"
 )
 
+// ExtractClipsFromTar reads every video entry of a tar archive with one of the
+// default extensions as a clip keyed by its base name. gzip- and
+// zstd-compressed archives are decompressed on the fly.
 func ExtractClipsFromTar(tarPath string) ([]types.Clip, error) {
-	f, err := os.Open(tarPath)
+	return ExtractClipsFromTarWithOptions(tarPath, Options{})
+}
+
+// ExtractClipsFromTarWithOptions reads the video entries of a tar archive
+// selected by opts as clips
+func ExtractClipsFromTarWithOptions(tarPath string, opts Options) ([]types.Clip, error) {
+	return ExtractClipsFromTars([]string{tarPath}, opts)
+}
+
+// StreamClipsFromTar reads the clips of a tar archive like
+// ExtractClipsFromTarWithOptions, but sends each one on clips as soon as it is read
+// instead of collecting them, so only the clips the receiver holds are in
+// memory. clips is closed when the archive has been read or an error occurs.
+func StreamClipsFromTar(tarPath string, opts Options, clips chan<- types.Clip) error {
+	return StreamClipsFromTars([]string{tarPath}, opts, clips)
+}
+
+// walkTar calls fn with each video entry of a tar archive selected by opts in
+// archive order, keyed by prefix plus its clip key. Entries are filtered and
+// their keys recorded in keys before their data is read. Sidecar entries
+// adjacent to a video with the same path but a sidecar extension, before or
+// after it as in WebDataset archives, are attached to its clip, which is
+// therefore passed to fn once the next entry with another path is reached.
+func walkTar(tarPath string, opts Options, prefix string, keys *keySet, fn func(types.Clip)) (err error) {
+	entries, closeEntries, err := openEntries(tarPath, opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
+	defer func() {
+		if closeErr := closeEntries(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
 
-	tr := tar.NewReader(f)
-	var clips []types.Clip
+	// The entries sharing the current path without extension: sidecars
+	// seen before its first video, and the clip awaiting later sidecars
+	var stem string
+	var early map[string][]byte
+	var sawVideo bool
+	var pending *types.Clip
+	flush := func() {
+		if pending != nil {
+			fn(*pending)
+			pending = nil
+		}
+	}
 
 	for {
-		hdr, err := tr.Next()
+		entry, err := entries.next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		// Skip macOS hidden files and files that are neither videos nor
+		// sidecars
+		key, video := opts.clipKey(entry.Name)
+		ext, sidecar := sidecarExt(entry.Name)
+		if !video && !sidecar {
+			continue
 		}
+		if entryStem := strings.TrimSuffix(entry.Name, filepath.Ext(entry.Name)); entryStem != stem {
+			flush()
+			stem, early, sawVideo = entryStem, nil, false
+		}
+
+		if sidecar {
+			var target map[string][]byte
+			switch {
+			case !sawVideo:
+				if early == nil {
+					early = make(map[string][]byte)
+				}
+				target = early
+			case pending != nil:
+				if pending.Sidecars == nil {
+					pending.Sidecars = make(map[string][]byte)
+				}
+				target = pending.Sidecars
+			default:
+				continue // the video was filtered out
+			}
+			data, err := entry.read()
+			if err != nil {
+				return err
+			}
+			target[ext] = data
+			continue
+		}
+
+		flush()
+		sawVideo = true
 
-		// Skip macOS hidden files and non-mp4 files
-		if strings.HasPrefix(filepath.Base(hdr.Name), "._") || !strings.HasSuffix(hdr.Name, ".mp4") {
+		// Skip filtered or skipped keys
+		if !opts.selected(prefix + key) {
+			continue
+		}
+		key, err = keys.add(prefix+key, tarPath+":"+entry.Name)
+		if err != nil {
+			return err
+		}
+		if opts.skipped(key) {
 			continue
 		}
+		if !keys.take() {
+			return nil
+		}
 
-		key := strings.TrimSuffix(filepath.Base(hdr.Name), ".mp4")
-		buf := new(bytes.Buffer)
-		if _, err := io.Copy(buf, tr); err != nil {
-			return nil, err
+		data, err := entry.read()
+		if err != nil {
+			return err
 		}
 
-		clips = append(clips, types.Clip{Key: key, RawData: buf.Bytes()})
+		clip := types.Clip{Key: key, RawData: data}
+		if len(early) > 0 {
+			clip.Sidecars = make(map[string][]byte, len(early))
+			for ext, data := range early {
+				clip.Sidecars[ext] = data
+			}
+		}
+		pending = &clip
 	}
+	flush()
 
-	return clips, nil
+	return nil
 }
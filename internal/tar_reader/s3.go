@@ -0,0 +1,138 @@
+package tar_reader
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// defaultS3Region is the region used to locate buckets when none is configured
+const defaultS3Region = "us-east-1"
+
+var (
+	s3Mu      sync.Mutex
+	s3Clients = make(map[string]s3iface.S3API)
+	// newS3Client creates the client for a bucket; replaced in tests
+	newS3Client = defaultS3Client
+)
+
+// parseS3URI splits an s3://bucket/key URI
+func parseS3URI(uri string) (bucket, key string, err error) {
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid s3 URI %s", uri)
+	}
+	return bucket, key, nil
+}
+
+// s3Client returns the cached client for a bucket, creating it on first use
+func s3Client(bucket string) (s3iface.S3API, error) {
+	s3Mu.Lock()
+	defer s3Mu.Unlock()
+	if client, ok := s3Clients[bucket]; ok {
+		return client, nil
+	}
+	client, err := newS3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	s3Clients[bucket] = client
+	return client, nil
+}
+
+// defaultS3Client creates a client from the standard AWS credential chain
+// and shared config, in the bucket's own region
+func defaultS3Client(bucket string) (s3iface.S3API, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, fmt.Errorf("error creating AWS session: %v", err)
+	}
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		region = defaultS3Region
+	}
+	if bucketRegion, err := s3manager.GetBucketRegion(aws.BackgroundContext(), sess, bucket, region); err == nil {
+		region = bucketRegion
+	}
+	return s3.New(sess, aws.NewConfig().WithRegion(region)), nil
+}
+
+// openS3 opens an S3 object for a streaming read
+func openS3(uri string) (io.ReadCloser, error) {
+	return openS3Range(uri, "")
+}
+
+// openS3Range opens an S3 object for a streaming read of the bytes selected
+// by a Range header value, or all of it if byteRange is empty
+func openS3Range(uri, byteRange string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+	in := &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}
+	if byteRange != "" {
+		in.Range = aws.String(byteRange)
+	}
+	out, err := client.GetObject(in)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %v", uri, err)
+	}
+	return out.Body, nil
+}
+
+// expandS3 lists the objects selected by an S3 URI: those matching a glob
+// pattern in the key, or, for a key ending in "/", every archive and video
+// object under that prefix
+func expandS3(pattern string, opts Options) ([]string, error) {
+	bucket, keyPattern, err := parseS3URI(pattern)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s3Client(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, match := listPattern(keyPattern, opts)
+
+	var matches []string
+	var matchErr error
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	err = client.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, obj := range page.Contents {
+			key := aws.StringValue(obj.Key)
+			ok, err := match(key)
+			if err != nil {
+				matchErr = err
+				return false
+			}
+			if ok {
+				matches = append(matches, "s3://"+bucket+"/"+key)
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = matchErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing %s: %v", pattern, err)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no objects match %s", pattern)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
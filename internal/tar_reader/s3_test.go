@@ -0,0 +1,112 @@
+package tar_reader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// fakeS3 serves objects of a single bucket from memory
+type fakeS3 struct {
+	s3iface.S3API
+	objects map[string][]byte
+}
+
+func (f *fakeS3) GetObject(in *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.StringValue(in.Key)]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", aws.StringValue(in.Key))
+	}
+	if byteRange := aws.StringValue(in.Range); byteRange != "" {
+		var start, end int
+		if _, err := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, fmt.Errorf("InvalidRange: %s", byteRange)
+		}
+		data = data[start:min(end+1, len(data))]
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2Pages(in *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.StringValue(in.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	page := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(page, true)
+	return nil
+}
+
+// useFakeS3 routes S3 access of the test to an in-memory bucket
+func useFakeS3(t *testing.T, objects map[string][]byte) {
+	saved := newS3Client
+	newS3Client = func(bucket string) (s3iface.S3API, error) {
+		return &fakeS3{objects: objects}, nil
+	}
+	s3Clients = make(map[string]s3iface.S3API)
+	t.Cleanup(func() {
+		newS3Client = saved
+		s3Clients = make(map[string]s3iface.S3API)
+	})
+}
+
+func TestS3Sources(t *testing.T) {
+	tarData := createTestTar(t).Bytes()
+	useFakeS3(t, map[string][]byte{
+		"data/part-0.tar":     tarData,
+		"data/part-1.tar":     tarData,
+		"data/raw/clip.mkv":   []byte("raw video"),
+		"data/raw/readme.txt": []byte("not a video"),
+	})
+
+	tests := []struct {
+		name     string
+		patterns []string
+		wantKeys []string
+	}{
+		{"single archive", []string{"s3://bucket/data/part-0.tar"}, []string{"test_video"}},
+		{"glob", []string{"s3://bucket/data/part-*.tar"}, []string{"part-0/test_video", "part-1/test_video"}},
+		{"prefix", []string{"s3://bucket/data/raw/"}, []string{"clip"}},
+		{"archive and video", []string{"s3://bucket/data/part-1.tar", "s3://bucket/data/raw/clip.mkv"}, []string{"test_video", "clip"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := ExpandTarPaths(tt.patterns, Options{})
+			if err != nil {
+				t.Fatalf("ExpandTarPaths() error = %v", err)
+			}
+			clips, err := ExtractClipsFromTars(paths, Options{})
+			if err != nil {
+				t.Fatalf("ExtractClipsFromTars() error = %v", err)
+			}
+			var keys []string
+			for _, clip := range clips {
+				keys = append(keys, clip.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+
+	if _, err := ExpandTarPaths([]string{"s3://bucket/missing/*.tar"}, Options{}); err == nil {
+		t.Error("ExpandTarPaths() with unmatched pattern succeeded, want error")
+	}
+	if _, err := ExtractClipsFromTar("s3://bucket/data/missing.tar"); err == nil {
+		t.Error("ExtractClipsFromTar() of missing object succeeded, want error")
+	}
+}
@@ -0,0 +1,120 @@
+package tar_reader
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Stdin is the source path that reads a tar stream from standard input
+const Stdin = "-"
+
+// stdinArchiveName namespaces the keys of a tar stream read from stdin
+const stdinArchiveName = "stdin"
+
+// IsRemote reports whether path is a URI of a remote object, such as
+// s3://bucket/key, gs://bucket/object or an http(s) URL, rather than a local
+// file
+func IsRemote(path string) bool {
+	return isBucketURI(path) || isHTTPURL(path)
+}
+
+// isBucketURI reports whether path names an object in an S3 or GCS bucket,
+// which can be listed to expand patterns
+func isBucketURI(path string) bool {
+	return strings.HasPrefix(path, "s3://") || strings.HasPrefix(path, "gs://")
+}
+
+// isHTTPURL reports whether path is an http or https URL
+func isHTTPURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// sourceName returns the part of a source path that names the file: the path
+// of an http(s) URL without its query string, or the path itself
+func sourceName(source string) string {
+	if !isHTTPURL(source) {
+		return source
+	}
+	u, err := url.Parse(source)
+	if err != nil {
+		return source
+	}
+	return u.Path
+}
+
+// openSource opens standard input, a local file or a remote object for a
+// sequential read
+func openSource(path string) (io.ReadCloser, error) {
+	switch {
+	case path == Stdin:
+		return io.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(path, "s3://"):
+		return openS3(path)
+	case strings.HasPrefix(path, "gs://"):
+		return openGCS(path)
+	case isHTTPURL(path):
+		return openHTTP(path)
+	default:
+		return os.Open(path)
+	}
+}
+
+// openRange opens length bytes from offset of a local file or remote
+// object, reading only that byte range
+func openRange(path string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := httpRange(offset, offset+length)
+	switch {
+	case strings.HasPrefix(path, "s3://"):
+		return openS3Range(path, byteRange)
+	case strings.HasPrefix(path, "gs://"):
+		return openGCSRange(path, byteRange)
+	case isHTTPURL(path):
+		return openHTTPRange(path, offset, length)
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, offset, length), f}, nil
+	}
+}
+
+// expandRemote lists the objects selected by a remote URI pattern
+func expandRemote(pattern string, opts Options) ([]string, error) {
+	if strings.HasPrefix(pattern, "gs://") {
+		return expandGCS(pattern, opts)
+	}
+	return expandS3(pattern, opts)
+}
+
+// listPattern splits an object key pattern into the prefix to list and a
+// function selecting listed keys: those matching the pattern if it contains
+// glob metacharacters, otherwise every archive and video (per opts)
+func listPattern(keyPattern string, opts Options) (string, func(key string) (bool, error)) {
+	i := strings.IndexAny(keyPattern, "*?[")
+	if i < 0 {
+		return keyPattern, func(key string) (bool, error) {
+			_, video := opts.clipKey(key)
+			return video || isArchive(key), nil
+		}
+	}
+	return keyPattern[:i], func(key string) (bool, error) {
+		return path.Match(keyPattern, key)
+	}
+}
+
+// isArchive reports whether name has a tar archive extension
+func isArchive(name string) bool {
+	for _, ext := range archiveExtensions {
+		if len(name) > len(ext) && strings.EqualFold(name[len(name)-len(ext):], ext) {
+			return true
+		}
+	}
+	return false
+}
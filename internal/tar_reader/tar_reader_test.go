@@ -3,8 +3,17 @@ package tar_reader
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
 )
 
 func createTestTar(t *testing.T) *bytes.Buffer {
@@ -84,3 +93,590 @@ func TestExtractClipsFromTar(t *testing.T) {
 		t.Errorf("ExtractClipsFromTar() got data %s, want dummy video data", string(clips[0].RawData))
 	}
 }
+
+func TestExtractClipsFromDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"b.mp4":            "video b",
+		"sub/a.mp4":        "video a",
+		"sub/._a.mp4":      "hidden file data",
+		"sub/notes.txt":    "not a video",
+		"sub/deeper/c.mp4": "video c",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clips, err := ExtractClipsFromDir(dir, Options{})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromDir() error = %v", err)
+	}
+
+	want := []struct{ key, data string }{{"b", "video b"}, {"a", "video a"}, {"c", "video c"}}
+	if len(clips) != len(want) {
+		t.Fatalf("ExtractClipsFromDir() got %d clips, want %d", len(clips), len(want))
+	}
+	for i, w := range want {
+		if clips[i].Key != w.key || string(clips[i].RawData) != w.data {
+			t.Errorf("clip %d = %s (%s), want %s (%s)", i, clips[i].Key, clips[i].RawData, w.key, w.data)
+		}
+	}
+
+	// A second file with the same base name is rejected
+	if err := os.WriteFile(filepath.Join(dir, "sub", "b.mp4"), []byte("other b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractClipsFromDir(dir, Options{}); err == nil {
+		t.Error("ExtractClipsFromDir() with duplicate keys succeeded, want error")
+	}
+
+	// Path keys keep them apart
+	clips, err = ExtractClipsFromDir(dir, Options{PathKeys: true})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromDir() with path keys error = %v", err)
+	}
+	var keys []string
+	for _, clip := range clips {
+		keys = append(keys, clip.Key)
+	}
+	if got := strings.Join(keys, ","); got != "b,sub/a,sub/b,sub/deeper/c" {
+		t.Errorf("ExtractClipsFromDir() with path keys = %s, want b,sub/a,sub/b,sub/deeper/c", got)
+	}
+}
+
+func TestExtractClipsFromCompressedTar(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress func(t *testing.T, data []byte) []byte
+	}{
+		{"gzip", func(t *testing.T, data []byte) []byte {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(data)
+			gz.Close()
+			return buf.Bytes()
+		}},
+		{"zstd", func(t *testing.T, data []byte) []byte {
+			if _, err := exec.LookPath("zstd"); err != nil {
+				t.Skip("zstd not installed")
+			}
+			cmd := exec.Command("zstd", "-c")
+			cmd.Stdin = bytes.NewReader(data)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return out
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.tar."+tt.name)
+			if err := os.WriteFile(path, tt.compress(t, createTestTar(t).Bytes()), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			clips, err := ExtractClipsFromTar(path)
+			if err != nil {
+				t.Fatalf("ExtractClipsFromTar() error = %v", err)
+			}
+			if len(clips) != 1 || clips[0].Key != "test_video" || string(clips[0].RawData) != "dummy video data" {
+				t.Errorf("ExtractClipsFromTar() = %+v, want test_video with dummy video data", clips)
+			}
+		})
+	}
+}
+
+func TestStreamClipsFromTar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.tar")
+	if err := os.WriteFile(path, createTestTar(t).Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clips := make(chan types.Clip)
+	errCh := make(chan error, 1)
+	go func() { errCh <- StreamClipsFromTar(path, Options{}, clips) }()
+
+	var keys []string
+	for clip := range clips {
+		keys = append(keys, clip.Key)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("StreamClipsFromTar() error = %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "test_video" {
+		t.Errorf("StreamClipsFromTar() sent %v, want [test_video]", keys)
+	}
+}
+
+func TestClipKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		extensions []string
+		wantKey    string
+		wantOK     bool
+	}{
+		{"videos/clip.mp4", nil, "clip", true},
+		{"clip.MKV", nil, "clip", true},
+		{"clip.webm", nil, "clip", true},
+		{"clip.tar.mov", nil, "clip.tar", true},
+		{"._clip.mp4", nil, "", false},
+		{"clip.txt", nil, "", false},
+		{"clip", nil, "", false},
+		{"clip.mkv", []string{"mp4"}, "", false},
+		{"clip.ts", []string{"mp4", ".ts"}, "clip", true},
+	}
+
+	for _, tt := range tests {
+		key, ok := Options{Extensions: tt.extensions}.clipKey(tt.name)
+		if key != tt.wantKey || ok != tt.wantOK {
+			t.Errorf("clipKey(%q) with %v = %q, %v, want %q, %v", tt.name, tt.extensions, key, ok, tt.wantKey, tt.wantOK)
+		}
+	}
+}
+
+func TestSanitizeKey(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"a/clip", "a/clip"},
+		{"./a//b/clip.v2", "a/b/clip.v2"},
+		{"/abs/../clip", "abs/clip"},
+		{"my videos/clip (1)", "my_videos/clip__1_"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeKey(tt.name); got != tt.want {
+			t.Errorf("sanitizeKey(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a/clip.mp4", "b/clip.mp4", "clip_2.mp4"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ExtractClipsFromTarWithOptions(tarPath, Options{}); err == nil {
+		t.Error("ExtractClipsFromTarWithOptions() with duplicate keys succeeded, want error")
+	}
+
+	var renames []string
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"path keys", Options{PathKeys: true}, []string{"a/clip", "b/clip", "clip_2"}},
+		{"suffix", Options{Duplicates: DuplicateSuffix, OnDuplicate: func(key, renamed, path string) {
+			renames = append(renames, key+"->"+renamed)
+		}}, []string{"clip", "clip_2", "clip_2_2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clips, err := ExtractClipsFromTarWithOptions(tarPath, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractClipsFromTarWithOptions() error = %v", err)
+			}
+			var keys []string
+			for _, clip := range clips {
+				keys = append(keys, clip.Key)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+	if strings.Join(renames, ",") != "clip->clip_2,clip_2->clip_2_2" {
+		t.Errorf("OnDuplicate calls = %v, want clip->clip_2, clip_2->clip_2_2", renames)
+	}
+
+	// Skipped clips keep their place, so renamed keys don't shift
+	clips, err := ExtractClipsFromTarWithOptions(tarPath, Options{
+		Duplicates: DuplicateSuffix,
+		Skip:       func(key string) bool { return key == "clip_2" },
+	})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromTarWithOptions() with skip error = %v", err)
+	}
+	if len(clips) != 2 || clips[0].Key != "clip" || clips[1].Key != "clip_2_2" {
+		t.Errorf("ExtractClipsFromTarWithOptions() with skip = %+v, want clip and clip_2_2", clips)
+	}
+
+	// Filtered clips don't count as duplicates
+	if _, err := ExtractClipsFromTarWithOptions(tarPath, Options{Exclude: regexp.MustCompile("^clip$")}); err != nil {
+		t.Errorf("ExtractClipsFromTarWithOptions() with duplicates excluded error = %v", err)
+	}
+
+	// Videos differing only in extension share a key within one archive,
+	// whether it is read alone or with others
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	for _, name := range []string{"clip.mp4", "clip.mkv"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	extPath := filepath.Join(t.TempDir(), "extensions.tar")
+	if err := os.WriteFile(extPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractClipsFromTarWithOptions(extPath, Options{}); err == nil {
+		t.Error("ExtractClipsFromTarWithOptions() with a key repeated by extension succeeded, want error")
+	}
+	if _, err := ExtractClipsFromTars([]string{tarPath, extPath}, Options{PathKeys: true}); err == nil {
+		t.Error("ExtractClipsFromTars() with a key repeated within one archive succeeded, want error")
+	}
+
+	if err := (Options{Duplicates: "skip"}).Validate(); err == nil {
+		t.Error("Validate() with unknown duplicate policy succeeded, want error")
+	}
+}
+
+func TestKeyFilters(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"kinetics/train/a.mp4", "kinetics/val/b.mp4", "kinetics/train/c_test.mp4", "ssv2/train/d.mp4"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		include, exclude string
+		want             string
+	}{
+		{"none", "", "", "kinetics/train/a,kinetics/val/b,kinetics/train/c_test,ssv2/train/d"},
+		{"include", "^kinetics/train/", "", "kinetics/train/a,kinetics/train/c_test"},
+		{"exclude", "", "_test$", "kinetics/train/a,kinetics/val/b,ssv2/train/d"},
+		{"both", "/train/", "_test$", "kinetics/train/a,ssv2/train/d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{PathKeys: true}
+			if tt.include != "" {
+				opts.Include = regexp.MustCompile(tt.include)
+			}
+			if tt.exclude != "" {
+				opts.Exclude = regexp.MustCompile(tt.exclude)
+			}
+			clips, err := ExtractClipsFromTarWithOptions(tarPath, opts)
+			if err != nil {
+				t.Fatalf("ExtractClipsFromTarWithOptions() error = %v", err)
+			}
+			var keys []string
+			for _, clip := range clips {
+				keys = append(keys, clip.Key)
+			}
+			if got := strings.Join(keys, ","); got != tt.want {
+				t.Errorf("keys = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractClipsFromTars(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"part-0.tar", "part-1.tar.gz"} {
+		data := createTestTar(t).Bytes()
+		if strings.HasSuffix(name, ".gz") {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(data)
+			gz.Close()
+			data = buf.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := ExpandTarPaths([]string{filepath.Join(dir, "part-*")}, Options{})
+	if err != nil {
+		t.Fatalf("ExpandTarPaths() error = %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("ExpandTarPaths() = %v, want 2 archives", paths)
+	}
+	if _, err := ExpandTarPaths([]string{filepath.Join(dir, "missing-*.tar")}, Options{}); err == nil {
+		t.Error("ExpandTarPaths() with unmatched pattern succeeded, want error")
+	}
+
+	clips, err := ExtractClipsFromTars(paths, Options{})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromTars() error = %v", err)
+	}
+	want := []string{"part-0/test_video", "part-1/test_video"}
+	if len(clips) != len(want) {
+		t.Fatalf("ExtractClipsFromTars() got %d clips, want %d", len(clips), len(want))
+	}
+	for i, key := range want {
+		if clips[i].Key != key {
+			t.Errorf("clips[%d].Key = %s, want %s", i, clips[i].Key, key)
+		}
+	}
+
+	// A single archive keeps plain keys
+	clips, err = ExtractClipsFromTars(paths[:1], Options{})
+	if err != nil || len(clips) != 1 || clips[0].Key != "test_video" {
+		t.Errorf("ExtractClipsFromTars() with one archive = %+v, %v, want test_video", clips, err)
+	}
+
+	// Archives with the same name would collide
+	if _, err := ExtractClipsFromTars([]string{paths[0], filepath.Join(dir, "other", "part-0.tar")}, Options{}); err == nil {
+		t.Error("ExtractClipsFromTars() with duplicate archive names succeeded, want error")
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	tests := map[string]string{
+		"archives/part-0001.tar": "part-0001",
+		"part-0001.tar.gz":       "part-0001",
+		"part-0001.TAR.ZST":      "part-0001",
+		"part-0001.tgz":          "part-0001",
+		"videos":                 "videos",
+		"/data/shard.v2.tar":     "shard.v2",
+	}
+	for path, want := range tests {
+		if got := ArchiveName(path); got != want {
+			t.Errorf("ArchiveName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestStdinSource(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() { os.Stdin = savedStdin })
+	data := createTestTar(t).Bytes()
+	go func() {
+		w.Write(data)
+		w.Close()
+	}()
+
+	path := filepath.Join(t.TempDir(), "other.tar")
+	if err := os.WriteFile(path, createTestTar(t).Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clips, err := ExtractClipsFromTars([]string{Stdin, path}, Options{})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromTars() error = %v", err)
+	}
+	if len(clips) != 2 || clips[0].Key != "stdin/test_video" || clips[1].Key != "other/test_video" {
+		t.Errorf("ExtractClipsFromTars() = %+v, want stdin/test_video and other/test_video", clips)
+	}
+
+	if _, err := ExtractClipsFromTars([]string{Stdin, Stdin}, Options{}); err == nil {
+		t.Error("ExtractClipsFromTars() reading stdin twice succeeded, want error")
+	}
+}
+
+func TestSidecars(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	// Sidecars may come before or after their video; c.txt has no video and
+	// skip.mp4 is filtered out
+	for _, name := range []string{"a.txt", "a.mp4", "a.json", "b.mp4", "c.txt", "skip.mp4", "skip.txt", "d/e.mp4", "d/e.TXT", "._d.txt"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	clips, err := ExtractClipsFromTarWithOptions(tarPath, Options{Exclude: regexp.MustCompile("^skip$")})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromTarWithOptions() error = %v", err)
+	}
+	want := map[string]map[string][]byte{
+		"a": {"txt": []byte("a.txt"), "json": []byte("a.json")},
+		"b": nil,
+		"e": {"txt": []byte("d/e.TXT")},
+	}
+	if len(clips) != len(want) {
+		t.Fatalf("ExtractClipsFromTarWithOptions() got %d clips, want %d", len(clips), len(want))
+	}
+	for _, clip := range clips {
+		if !reflect.DeepEqual(clip.Sidecars, want[clip.Key]) {
+			t.Errorf("clip %s sidecars = %q, want %q", clip.Key, clip.Sidecars, want[clip.Key])
+		}
+	}
+
+	// Directories pair sidecars by name
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "a.txt", "b.mp4", "b.json.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clips, err = ExtractClipsFromDir(dir, Options{})
+	if err != nil {
+		t.Fatalf("ExtractClipsFromDir() error = %v", err)
+	}
+	if len(clips) != 2 || string(clips[0].Sidecars["txt"]) != "a.txt" || clips[1].Sidecars != nil {
+		t.Errorf("ExtractClipsFromDir() sidecars = %q, %q, want a.txt and none", clips[0].Sidecars, clips[1].Sidecars)
+	}
+}
+
+func TestClipLimits(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < 400; i++ {
+		name := fmt.Sprintf("video%03d.mp4", i)
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarPath := filepath.Join(t.TempDir(), "videos.tar")
+	if err := os.WriteFile(tarPath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	extract := func(opts Options) []string {
+		t.Helper()
+		clips, err := ExtractClipsFromTarWithOptions(tarPath, opts)
+		if err != nil {
+			t.Fatalf("ExtractClipsFromTarWithOptions() error = %v", err)
+		}
+		var keys []string
+		for _, clip := range clips {
+			keys = append(keys, clip.Key)
+		}
+		return keys
+	}
+
+	if got := extract(Options{MaxClips: 3}); strings.Join(got, ",") != "video000,video001,video002" {
+		t.Errorf("MaxClips 3 = %v, want the first 3 clips", got)
+	}
+
+	// A sample is stable for a seed and differs between seeds
+	sample := extract(Options{SampleFraction: 0.25, Seed: 1})
+	if len(sample) < 70 || len(sample) > 130 {
+		t.Errorf("SampleFraction 0.25 kept %d of 400 clips, want about 100", len(sample))
+	}
+	if again := extract(Options{SampleFraction: 0.25, Seed: 1}); strings.Join(again, ",") != strings.Join(sample, ",") {
+		t.Error("SampleFraction with the same seed picked different clips")
+	}
+	if other := extract(Options{SampleFraction: 0.25, Seed: 2}); strings.Join(other, ",") == strings.Join(sample, ",") {
+		t.Error("SampleFraction with another seed picked the same clips")
+	}
+
+	// The limit applies after sampling
+	if got := extract(Options{SampleFraction: 0.25, Seed: 1, MaxClips: 5}); strings.Join(got, ",") != strings.Join(sample[:5], ",") {
+		t.Errorf("SampleFraction with MaxClips 5 = %v, want %v", got, sample[:5])
+	}
+
+	for _, opts := range []Options{{MaxClips: -1}, {SampleFraction: 1.5}} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestDirSymlinks(t *testing.T) {
+	// A symlink farm pointing into a separate archive volume, with a link
+	// cycle and a nested directory
+	volume := t.TempDir()
+	root := t.TempDir()
+	for path, data := range map[string]string{
+		filepath.Join(volume, "x", "v2.mp4"):              "video two",
+		filepath.Join(root, "a", "v1.mp4"):                "video one",
+		filepath.Join(root, "deep", "d1", "d2", "v3.mp4"): "video three",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(volume, "x"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "a", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"links not followed", Options{PathKeys: true}, "a/v1,deep/d1/d2/v3"},
+		{"links followed", Options{PathKeys: true, FollowSymlinks: true}, "a/v1,deep/d1/d2/v3,link/v2"},
+		{"max depth", Options{PathKeys: true, FollowSymlinks: true, MaxDepth: 2}, "a/v1,link/v2"},
+		{"top level only", Options{PathKeys: true, MaxDepth: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clips, err := ExtractClipsFromDir(root, tt.opts)
+			if err != nil {
+				t.Fatalf("ExtractClipsFromDir() error = %v", err)
+			}
+			var keys []string
+			for _, clip := range clips {
+				keys = append(keys, clip.Key)
+			}
+			if got := strings.Join(keys, ","); got != tt.want {
+				t.Errorf("keys = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := (Options{MaxDepth: -1}).Validate(); err == nil {
+		t.Error("Validate() with negative MaxDepth succeeded, want error")
+	}
+}
@@ -0,0 +1,273 @@
+package tar_reader
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// URLEntry is one video of a URL list, with an optional checksum its
+// download must match
+type URLEntry struct {
+	URL string
+	// Checksum is "sha256:<hex>" or "md5:<hex>", or empty to skip
+	// verification
+	Checksum string
+}
+
+// LoadURLList reads a URL list: one video URL (http(s), s3:// or gs://) per
+// line, optionally followed by whitespace and a checksum, either prefixed
+// with its algorithm (sha256:, md5:) or as bare hex whose length picks the
+// algorithm. Blank lines and lines starting with # are skipped.
+func LoadURLList(path string) ([]URLEntry, error) {
+	r, err := openSource(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening URL list: %v", err)
+	}
+	defer r.Close()
+
+	var entries []URLEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("URL list line %d: expected a URL and an optional checksum", line)
+		}
+		if !IsRemote(fields[0]) {
+			return nil, fmt.Errorf("URL list line %d: not a URL: %s", line, fields[0])
+		}
+		entry := URLEntry{URL: fields[0]}
+		if len(fields) == 2 {
+			if entry.Checksum, err = normalizeChecksum(fields[1]); err != nil {
+				return nil, fmt.Errorf("URL list line %d: %v", line, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading URL list: %v", err)
+	}
+	return entries, nil
+}
+
+// normalizeChecksum returns checksum as "<algorithm>:<lowercase hex>"
+func normalizeChecksum(checksum string) (string, error) {
+	algorithm, digest, ok := strings.Cut(strings.ToLower(checksum), ":")
+	if !ok {
+		digest = algorithm
+		switch len(digest) {
+		case 2 * sha256.Size:
+			algorithm = "sha256"
+		case 2 * md5.Size:
+			algorithm = "md5"
+		}
+	}
+	h := newHash(algorithm)
+	if h == nil {
+		return "", fmt.Errorf("unsupported checksum: %s", checksum)
+	}
+	if raw, err := hex.DecodeString(digest); err != nil || len(raw) != h.Size() {
+		return "", fmt.Errorf("invalid %s checksum: %s", algorithm, digest)
+	}
+	return algorithm + ":" + digest, nil
+}
+
+// newHash returns a hash for a checksum algorithm, or nil if unsupported
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha256":
+		return sha256.New()
+	case "md5":
+		return md5.New()
+	}
+	return nil
+}
+
+// URLFailure is a URL whose download failed
+type URLFailure struct {
+	// URL is the failed URL, or the list entry for yt-dlp downloads
+	URL string
+	Err error
+}
+
+// DownloadError reports the URLs that could not be downloaded; the clips of
+// all other URLs were still delivered
+type DownloadError struct {
+	Failures []URLFailure
+	Total    int
+}
+
+func (e *DownloadError) Error() string {
+	first := e.Failures[0]
+	return fmt.Sprintf("%d of %d downloads failed (first: %s: %v)", len(e.Failures), e.Total, first.URL, first.Err)
+}
+
+// ExtractClipsFromURLs downloads the videos of a URL list with up to
+// workers concurrent downloads and returns them as clips in list order,
+// keyed by file name with duplicates handled by opts.Duplicates. If
+// some downloads fail after retries, the other clips are returned along with
+// a *DownloadError.
+func ExtractClipsFromURLs(entries []URLEntry, workers int, opts Options) ([]types.Clip, error) {
+	downloaded := make([]*types.Clip, len(entries))
+	err := downloadURLs(entries, workers, opts, func(i int, clip types.Clip) {
+		downloaded[i] = &clip
+	})
+	if err != nil && !isDownloadError(err) {
+		return nil, err
+	}
+	var clips []types.Clip
+	for _, clip := range downloaded {
+		if clip != nil {
+			clips = append(clips, *clip)
+		}
+	}
+	return clips, err
+}
+
+// StreamClipsFromURLs downloads the videos of a URL list like
+// ExtractClipsFromURLs, but sends each clip on clips as soon as its download
+// completes. clips is closed when all downloads have finished.
+func StreamClipsFromURLs(entries []URLEntry, workers int, opts Options, clips chan<- types.Clip) error {
+	defer close(clips)
+	return downloadURLs(entries, workers, opts, func(i int, clip types.Clip) {
+		clips <- clip
+	})
+}
+
+// isDownloadError reports whether err is a *DownloadError
+func isDownloadError(err error) bool {
+	_, ok := err.(*DownloadError)
+	return ok
+}
+
+// downloadURLs downloads entries concurrently, calling fn with the index and
+// clip of each successful download
+func downloadURLs(entries []URLEntry, workers int, opts Options, fn func(int, types.Clip)) error {
+	sources := make([]string, len(entries))
+	for i, e := range entries {
+		sources[i] = e.URL
+	}
+	urlKey := func(url string) string {
+		base := filepath.Base(sourceName(url))
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return fetchAll(sources, urlKey, workers, opts, func(i int, key string) (types.Clip, error) {
+		return download(entries[i], key)
+	}, fn)
+}
+
+// fetchAll keys sources with keyOf up front, applying the filters, duplicate
+// policy and limits of opts, then fetches the selected ones with up to
+// workers concurrent calls to fetch, calling fn with the index and clip of
+// each success. Failed fetches are reported together in a *DownloadError.
+func fetchAll(sources []string, keyOf func(string) string, workers int, opts Options,
+	fetch func(i int, key string) (types.Clip, error), fn func(int, types.Clip)) error {
+	// Key the sources up front, leaving filtered ones unkeyed
+	keys := make([]string, len(sources))
+	seen := newKeySet(opts)
+	selected := 0
+	for i, source := range sources {
+		key := keyOf(source)
+		if !opts.selected(key) {
+			continue
+		}
+		key, err := seen.add(key, source)
+		if err != nil {
+			return err
+		}
+		if opts.skipped(key) {
+			continue
+		}
+		if !seen.take() {
+			break
+		}
+		keys[i] = key
+		selected++
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var mu sync.Mutex
+	var failures []URLFailure
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				clip, err := fetch(i, keys[i])
+				if err != nil {
+					mu.Lock()
+					failures = append(failures, URLFailure{URL: sources[i], Err: err})
+					mu.Unlock()
+					continue
+				}
+				fn(i, clip)
+			}
+		}()
+	}
+	for i := range sources {
+		if opts.stopped() {
+			break
+		}
+		if keys[i] != "" {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failures) > 0 {
+		return &DownloadError{Failures: failures, Total: selected}
+	}
+	return nil
+}
+
+// download fetches one video, verifying its checksum. A corrupt download,
+// or a transient failure reading a gs:// object, is fetched again with
+// exponential backoff; other sources retry and resume transient network
+// failures themselves.
+func download(e URLEntry, key string) (types.Clip, error) {
+	for failures := 0; ; failures++ {
+		clip, err := readVideo(e.URL, key)
+		if err != nil {
+			if !strings.HasPrefix(e.URL, "gs://") || !transientHTTPError(err) || failures >= maxHTTPRetries {
+				return types.Clip{}, err
+			}
+		} else if err = verifyChecksum(clip.RawData, e.Checksum); err == nil {
+			return clip, nil
+		}
+		if failures >= maxHTTPRetries {
+			return types.Clip{}, err
+		}
+		time.Sleep(httpRetryDelay << failures)
+	}
+}
+
+// verifyChecksum checks data against a normalized checksum, if any
+func verifyChecksum(data []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	algorithm, want, _ := strings.Cut(checksum, ":")
+	h := newHash(algorithm)
+	h.Write(data)
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("%s checksum mismatch: got %s, want %s", algorithm, got, want)
+	}
+	return nil
+}
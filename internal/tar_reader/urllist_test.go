@@ -0,0 +1,169 @@
+package tar_reader
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoadURLList(t *testing.T) {
+	sum := sha256.Sum256([]byte("video a"))
+	digest := hex.EncodeToString(sum[:])
+	md5Sum := md5.Sum([]byte("video b"))
+	md5Digest := hex.EncodeToString(md5Sum[:])
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []URLEntry
+		wantErr bool
+	}{
+		{
+			name: "checksums",
+			data: "# videos\n\nhttps://example.com/a.mp4 sha256:" + digest + "\n" +
+				"s3://bucket/b.mp4 " + md5Digest + "\n" +
+				"gs://bucket/c.mp4\n",
+			want: []URLEntry{
+				{URL: "https://example.com/a.mp4", Checksum: "sha256:" + digest},
+				{URL: "s3://bucket/b.mp4", Checksum: "md5:" + md5Digest},
+				{URL: "gs://bucket/c.mp4"},
+			},
+		},
+		{name: "local path", data: "videos/a.mp4\n", wantErr: true},
+		{name: "unknown algorithm", data: "https://example.com/a.mp4 crc32:1234abcd\n", wantErr: true},
+		{name: "short digest", data: "https://example.com/a.mp4 sha256:abcd\n", wantErr: true},
+		{name: "extra fields", data: "https://example.com/a.mp4 " + digest + " a.mp4\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urls.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadURLList(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadURLList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadURLList() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractClipsFromURLs(t *testing.T) {
+	videos := map[string]string{"/a.mp4": "video a", "/b.mp4": "video b", "/c.mp4": "video c"}
+	// b.mp4 is corrupted on its first download
+	var bRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := videos[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/b.mp4" && bRequests.Add(1) == 1 {
+			data = "corrupt"
+		}
+		w.Write([]byte(data))
+	}))
+	defer server.Close()
+
+	savedDelay := httpRetryDelay
+	httpRetryDelay = 0
+	t.Cleanup(func() { httpRetryDelay = savedDelay })
+
+	checksum := func(data string) string {
+		sum := sha256.Sum256([]byte(data))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	entries := []URLEntry{
+		{URL: server.URL + "/a.mp4", Checksum: checksum("video a")},
+		{URL: server.URL + "/missing.mp4"},
+		{URL: server.URL + "/b.mp4", Checksum: checksum("video b")},
+		{URL: server.URL + "/c.mp4", Checksum: checksum("something else")},
+	}
+
+	clips, err := ExtractClipsFromURLs(entries, 2, Options{})
+	downloadErr, ok := err.(*DownloadError)
+	if !ok {
+		t.Fatalf("ExtractClipsFromURLs() error = %v, want a *DownloadError", err)
+	}
+	if len(downloadErr.Failures) != 2 || downloadErr.Total != 4 {
+		t.Errorf("DownloadError = %v, want 2 of 4 failures", downloadErr)
+	}
+
+	want := []struct{ key, data string }{{"a", "video a"}, {"b", "video b"}}
+	if len(clips) != len(want) {
+		t.Fatalf("ExtractClipsFromURLs() got %d clips, want %d", len(clips), len(want))
+	}
+	for i, w := range want {
+		if clips[i].Key != w.key || string(clips[i].RawData) != w.data {
+			t.Errorf("clip %d = %s (%s), want %s (%s)", i, clips[i].Key, clips[i].RawData, w.key, w.data)
+		}
+	}
+	if got := bRequests.Load(); got != 2 {
+		t.Errorf("b.mp4 downloaded %d times, want 2", got)
+	}
+
+	// Two URLs with the same file name are rejected before downloading
+	dup := []URLEntry{{URL: server.URL + "/a.mp4"}, {URL: server.URL + "/other/a.mp4"}}
+	if _, err := ExtractClipsFromURLs(dup, 2, Options{}); err == nil || isDownloadError(err) {
+		t.Errorf("ExtractClipsFromURLs() with duplicate keys error = %v, want duplicate key error", err)
+	}
+}
+
+func TestDownloadRetriesGCS(t *testing.T) {
+	// clip.mp4 fails with a server error on its first request
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case !strings.HasSuffix(r.URL.Path, "/clip.mp4"):
+			http.NotFound(w, r)
+		case requests.Load() == 1:
+			http.Error(w, "backend error", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("video"))
+		}
+	}))
+	defer server.Close()
+
+	savedEndpoint, savedResolved, savedTokens := gcsEndpoint, gcsResolved, gcsTokens
+	gcsEndpoint, gcsResolved, gcsTokens = server.URL, true, nil
+	t.Cleanup(func() { gcsEndpoint, gcsResolved, gcsTokens = savedEndpoint, savedResolved, savedTokens })
+	savedDelay := httpRetryDelay
+	httpRetryDelay = 0
+	t.Cleanup(func() { httpRetryDelay = savedDelay })
+
+	clip, err := download(URLEntry{URL: "gs://bucket/clip.mp4"}, "clip")
+	if err != nil || string(clip.RawData) != "video" {
+		t.Fatalf("download() = %q, %v, want video", clip.RawData, err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("clip.mp4 requested %d times, want 2", got)
+	}
+
+	// A missing object is not retried
+	requests.Store(0)
+	if _, err := download(URLEntry{URL: "gs://bucket/missing.mp4"}, "missing"); err == nil {
+		t.Error("download() of a missing object succeeded, want error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("missing.mp4 requested %d times, want 1", got)
+	}
+}
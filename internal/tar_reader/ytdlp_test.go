@@ -0,0 +1,82 @@
+package tar_reader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeYTDLP writes a yt-dlp stand-in that saves its format selector and
+// target as the video, failing for targets containing "missing"
+func fakeYTDLP(t *testing.T) string {
+	t.Helper()
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--format) format="$2"; shift ;;
+	--output) output="$2"; shift ;;
+	--) target="$2"; shift ;;
+	esac
+	shift
+done
+case "$target" in
+*missing*) echo "ERROR: [youtube] missing: Video unavailable" >&2; exit 1 ;;
+esac
+printf '%s %s' "$format" "$target" > "$(echo "$output" | sed 's/%(ext)s/mp4/')"
+`
+	binary := filepath.Join(t.TempDir(), "yt-dlp")
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func TestExtractClipsWithYTDLP(t *testing.T) {
+	listPath := filepath.Join(t.TempDir(), "ids.txt")
+	list := "# kinetics\nabc123\n\nhttps://www.youtube.com/watch?v=def456&t=10\nmissing1\n"
+	if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := LoadVideoIDs(listPath)
+	if err != nil {
+		t.Fatalf("LoadVideoIDs() error = %v", err)
+	}
+	if strings.Join(ids, ",") != "abc123,https://www.youtube.com/watch?v=def456&t=10,missing1" {
+		t.Fatalf("LoadVideoIDs() = %v", ids)
+	}
+
+	dl := YTDLP{Binary: fakeYTDLP(t), MaxHeight: 360, Workers: 2}
+	clips, err := ExtractClipsWithYTDLP(ids, dl, Options{})
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || len(downloadErr.Failures) != 1 || downloadErr.Total != 3 {
+		t.Fatalf("ExtractClipsWithYTDLP() error = %v, want one failed download of 3", err)
+	}
+	if !strings.Contains(downloadErr.Error(), "Video unavailable") {
+		t.Errorf("DownloadError = %v, want yt-dlp's message", downloadErr)
+	}
+
+	want := []struct{ key, data string }{
+		{"abc123", "bv*[height<=360]+ba/b[height<=360] https://www.youtube.com/watch?v=abc123"},
+		{"def456", "bv*[height<=360]+ba/b[height<=360] https://www.youtube.com/watch?v=def456&t=10"},
+	}
+	if len(clips) != len(want) {
+		t.Fatalf("ExtractClipsWithYTDLP() returned %d clips, want %d", len(clips), len(want))
+	}
+	for i, w := range want {
+		if clips[i].Key != w.key || string(clips[i].RawData) != w.data {
+			t.Errorf("clip %d = %s %q, want %s %q", i, clips[i].Key, clips[i].RawData, w.key, w.data)
+		}
+	}
+
+	// Filters apply before downloading
+	clips, err = ExtractClipsWithYTDLP(ids, dl, Options{MaxClips: 1})
+	if err != nil || len(clips) != 1 || clips[0].Key != "abc123" {
+		t.Errorf("ExtractClipsWithYTDLP() with MaxClips 1 = %d clips, %v", len(clips), err)
+	}
+
+	if _, err := ExtractClipsWithYTDLP(ids, YTDLP{Binary: filepath.Join(t.TempDir(), "none")}, Options{}); err == nil {
+		t.Error("ExtractClipsWithYTDLP() without yt-dlp succeeded, want error")
+	}
+}
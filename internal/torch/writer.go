@@ -0,0 +1,221 @@
+// Package torch writes tensors in the zip-based file format of torch.save,
+// so chunks can be read with torch.load without a conversion step.
+package torch
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// DType is the legacy storage class of a tensor's element type, as named
+// in pickled tensors
+type DType string
+
+const (
+	Uint8   DType = "ByteStorage"
+	Int32   DType = "IntStorage"
+	Float32 DType = "FloatStorage"
+)
+
+// itemSize returns the size in bytes of one element of the dtype
+func (d DType) itemSize() int {
+	if d == Uint8 {
+		return 1
+	}
+	return 4
+}
+
+// recordAlignment is the alignment of records in the archive, matching
+// torch.save so tensors can be memory-mapped
+const recordAlignment = 64
+
+// archiveName is the directory holding the records of the archive
+const archiveName = "archive"
+
+// WriteTensor writes data, little-endian elements of dtype, as a single
+// contiguous CPU tensor of the given shape to a .pt file loadable with
+// torch.load, including with weights_only=True
+func WriteTensor(path string, data []byte, shape []int, dtype DType) error {
+	numel := 1
+	for _, dim := range shape {
+		numel *= dim
+	}
+	if numel*dtype.itemSize() != len(data) {
+		return fmt.Errorf("tensor of shape %v needs %d bytes, got %d", shape, numel*dtype.itemSize(), len(data))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating pt file: %v", err)
+	}
+	defer file.Close()
+
+	w := &archiveWriter{counter: &countingWriter{w: file}}
+	w.zip = zip.NewWriter(w.counter)
+	records := []struct {
+		name string
+		data []byte
+	}{
+		{"data.pkl", tensorPickle(shape, dtype, numel)},
+		{"byteorder", []byte("little")},
+		{"data/0", data},
+		{"version", []byte("3\n")},
+	}
+	for _, r := range records {
+		if err := w.writeRecord(archiveName+"/"+r.name, r.data); err != nil {
+			return fmt.Errorf("error writing pt record %s: %v", r.name, err)
+		}
+	}
+	if err := w.zip.Close(); err != nil {
+		return fmt.Errorf("error writing pt file: %v", err)
+	}
+	return file.Close()
+}
+
+// archiveWriter writes uncompressed records aligned to recordAlignment
+type archiveWriter struct {
+	zip     *zip.Writer
+	counter *countingWriter
+}
+
+// writeRecord stores data under name, padding the local header's extra
+// field so the data starts at an aligned offset
+func (w *archiveWriter) writeRecord(name string, data []byte) error {
+	if err := w.zip.Flush(); err != nil {
+		return err
+	}
+	// A local file header is 30 bytes plus the name and extra field; the
+	// extra field needs a 4-byte header of its own
+	offset := w.counter.n + 30 + int64(len(name)) + 4
+	padding := (recordAlignment - offset%recordAlignment) % recordAlignment
+	extra := make([]byte, 4+padding)
+	copy(extra, "FB")
+	binary.LittleEndian.PutUint16(extra[2:], uint16(padding))
+
+	rw, err := w.zip.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(data)),
+		UncompressedSize64: uint64(len(data)),
+		Extra:              extra,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = rw.Write(data)
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Pickle opcodes of protocol 2
+const (
+	opProto      = 0x80
+	opGlobal     = 'c'
+	opMark       = '('
+	opTuple      = 't'
+	opEmptyTuple = ')'
+	opBinPersID  = 'Q'
+	opBinInt     = 'J'
+	opLong1      = 0x8a
+	opBinUnicode = 'X'
+	opNewFalse   = 0x89
+	opReduce     = 'R'
+	opStop       = '.'
+)
+
+// tensorPickle returns the data.pkl record of a tensor stored as record
+// data/0: a call to torch._utils._rebuild_tensor_v2 with the storage as a
+// persistent ID, as torch.save writes it
+func tensorPickle(shape []int, dtype DType, numel int) []byte {
+	p := &pickler{}
+	p.op(opProto, 2)
+	p.global("torch._utils", "_rebuild_tensor_v2")
+	p.op(opMark)
+
+	// The storage, as ('storage', torch.<dtype>, key, location, numel)
+	p.op(opMark)
+	p.str("storage")
+	p.global("torch", string(dtype))
+	p.str("0")
+	p.str("cpu")
+	p.int(numel)
+	p.op(opTuple, opBinPersID)
+
+	p.int(0) // storage offset
+	p.ints(shape)
+	p.ints(contiguousStrides(shape))
+	p.op(opNewFalse) // requires_grad
+	p.global("collections", "OrderedDict")
+	p.op(opEmptyTuple, opReduce) // backward hooks
+
+	p.op(opTuple, opReduce, opStop)
+	return p.buf.Bytes()
+}
+
+// contiguousStrides returns the element strides of a C-contiguous tensor
+func contiguousStrides(shape []int) []int {
+	strides := make([]int, len(shape))
+	stride := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= shape[i]
+	}
+	return strides
+}
+
+// pickler writes protocol 2 pickle opcodes
+type pickler struct {
+	buf bytes.Buffer
+}
+
+func (p *pickler) op(ops ...byte) {
+	p.buf.Write(ops)
+}
+
+func (p *pickler) global(module, name string) {
+	p.op(opGlobal)
+	p.buf.WriteString(module + "\n" + name + "\n")
+}
+
+func (p *pickler) str(s string) {
+	p.op(opBinUnicode)
+	p.buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+	p.buf.WriteString(s)
+}
+
+// int writes n as a 4-byte int, or as an 8-byte long if it doesn't fit
+func (p *pickler) int(n int) {
+	if n == int(int32(n)) {
+		p.op(opBinInt)
+		p.buf.Write(binary.LittleEndian.AppendUint32(nil, uint32(int32(n))))
+		return
+	}
+	p.op(opLong1, 8)
+	p.buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(n)))
+}
+
+// ints writes a tuple of ints
+func (p *pickler) ints(values []int) {
+	p.op(opMark)
+	for _, v := range values {
+		p.int(v)
+	}
+	p.op(opTuple)
+}
@@ -0,0 +1,87 @@
+package torch
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteTensor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunk.pt")
+	data := []byte{1, 2, 3, 4, 5, 6}
+	if err := WriteTensor(path, data, []int{1, 2, 3}, Uint8); err != nil {
+		t.Fatalf("WriteTensor() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var names []string
+	records := map[string][]byte{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Method != zip.Store {
+			t.Errorf("record %s is compressed", f.Name)
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset%recordAlignment != 0 {
+			t.Errorf("record %s starts at offset %d, want a multiple of %d", f.Name, offset, recordAlignment)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[f.Name], err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"archive/data.pkl", "archive/byteorder", "archive/data/0", "archive/version"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("records = %v, want %v", names, want)
+	}
+	if !bytes.Equal(records["archive/data/0"], data) {
+		t.Errorf("storage = %v, want %v", records["archive/data/0"], data)
+	}
+	if !bytes.Equal(records["archive/data.pkl"], tensorPickle([]int{1, 2, 3}, Uint8, 6)) {
+		t.Error("data.pkl does not hold the tensor pickle")
+	}
+	if string(records["archive/version"]) != "3\n" {
+		t.Errorf("version = %q, want 3", records["archive/version"])
+	}
+
+	if err := WriteTensor(path, data, []int{2, 2}, Uint8); err == nil {
+		t.Error("WriteTensor() with a mismatched shape succeeded")
+	}
+}
+
+func TestTensorPickle(t *testing.T) {
+	got := tensorPickle([]int{2, 3}, Float32, 6)
+	// Protocol 2 header, the rebuild function, the storage's persistent ID
+	// and the shape and strides, ending with STOP
+	for _, part := range [][]byte{
+		{opProto, 2},
+		[]byte("ctorch._utils\n_rebuild_tensor_v2\n"),
+		[]byte("ctorch\nFloatStorage\n"),
+		{opMark, opBinInt, 2, 0, 0, 0, opBinInt, 3, 0, 0, 0, opTuple},
+		{opMark, opBinInt, 3, 0, 0, 0, opBinInt, 1, 0, 0, 0, opTuple},
+	} {
+		if !bytes.Contains(got, part) {
+			t.Errorf("tensorPickle() = %q, missing %q", got, part)
+		}
+	}
+	if got[len(got)-1] != opStop {
+		t.Error("tensorPickle() does not end with STOP")
+	}
+}
@@ -0,0 +1,42 @@
+package types
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// IsChunkFile reports whether path names a chunk file with one of exts,
+// such as ".npy", rather than a chunk's embedding
+func IsChunkFile(path string, exts ...string) bool {
+	if strings.HasSuffix(path, EmbeddingSuffix) {
+		return false
+	}
+	for _, ext := range exts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindChunkFiles returns the chunk files with one of exts under dir, in
+// lexical order
+func FindChunkFiles(dir string, exts ...string) ([]string, error) {
+	var chunks []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && IsChunkFile(path, exts...) {
+			chunks = append(chunks, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(chunks)
+	return chunks, nil
+}
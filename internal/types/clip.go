@@ -4,4 +4,89 @@ package types
 type Clip struct {
 	Key     string
 	RawData []byte
+	// Label and Caption are clip-level annotations, e.g. from an input
+	// manifest, recorded in the metadata of every chunk
+	Label   string
+	Caption string
+	// Spans restricts processing to these annotated time spans; if empty
+	// the whole clip is processed
+	Spans []Span
+	// DenseLabels are per-second or per-frame labels mapped onto each chunk
+	DenseLabels *DenseLabels
+	// Boxes are per-frame bounding boxes the clip is cropped to before scaling
+	Boxes []Box
+	// Timestamps, if set, are the times in seconds of the frames extracted
+	// as the clip's single sample, instead of chunking it
+	Timestamps []float64
+	// Sidecars are files paired with the video by name (e.g. clip0001.txt
+	// next to clip0001.mp4), keyed by extension without the dot, and
+	// copied verbatim alongside every chunk
+	Sidecars map[string][]byte
+	// Overrides replace run-wide processing options for this clip, e.g.
+	// from an input manifest
+	Overrides *ClipOverrides
+}
+
+// ClipOverrides are per-clip replacements of run-wide processing options.
+// Zero values keep the run's options.
+type ClipOverrides struct {
+	FPS          int
+	Size         string
+	TargetFrames int
+	// Transforms are transform specs, like those of the -transform flag,
+	// replacing the run's transforms if non-empty
+	Transforms []string
+}
+
+// SidecarExtensions are the extensions, without the dot, of files read as
+// sidecars of the video with the same name
+var SidecarExtensions = []string{"txt", "json"}
+
+// EmbeddingSuffix ends the name of the file holding a chunk's embedding
+// vector, written next to the chunk as <chunk>.emb.npy
+const EmbeddingSuffix = ".emb.npy"
+
+// Span is an annotated time span of a clip, in seconds. An End of 0 means
+// the end of the clip.
+type Span struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Label string  `json:"label,omitempty"`
+}
+
+// Shot is a shot of a clip between two scene changes, in seconds, and its
+// index among the clip's shots
+type Shot struct {
+	Index int     `json:"index"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// DenseLabels is a label sequence sampled at a fixed rate over a clip
+type DenseLabels struct {
+	// FPS is the number of labels per second of video
+	FPS    float64  `json:"fps"`
+	Labels []string `json:"labels"`
+}
+
+// At returns the label covering time t in seconds, or "" if t is out of range
+func (d *DenseLabels) At(t float64) string {
+	if d == nil || t < 0 {
+		return ""
+	}
+	idx := int(t * d.FPS)
+	if idx >= len(d.Labels) {
+		return ""
+	}
+	return d.Labels[idx]
+}
+
+// Box is an annotated bounding box in source pixel coordinates at time T
+// seconds into the clip
+type Box struct {
+	T float64 `json:"t"`
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
 }
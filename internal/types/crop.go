@@ -0,0 +1,9 @@
+package types
+
+// CropRegion represents a crop applied to source frames before scaling
+type CropRegion struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	X      int `json:"x"`
+	Y      int `json:"y"`
+}
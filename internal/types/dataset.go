@@ -0,0 +1,18 @@
+package types
+
+// ChannelStats holds per-channel normalization statistics of a dataset, with
+// pixel values scaled to [0, 1]
+type ChannelStats struct {
+	Mean []float64 `json:"mean"`
+	Std  []float64 `json:"std"`
+	// Chunks and Pixels are the number of chunks and pixels sampled
+	Chunks int   `json:"chunks"`
+	Pixels int64 `json:"pixels"`
+}
+
+// Normalization is a per-channel mean/std applied to pixel values scaled to
+// [0, 1], as (value - mean) / std
+type Normalization struct {
+	Mean []float64 `json:"mean"`
+	Std  []float64 `json:"std"`
+}
@@ -2,11 +2,122 @@ package types
 
 // ClipMetadata represents metadata for a processed video clip
 type ClipMetadata struct {
-	Key         string `json:"key"`
-	FPS         int    `json:"fps"`
-	FrameCount  int    `json:"frame_count"`
-	Size        []int  `json:"size"`
-	IsPadded    bool   `json:"is_padded,omitempty"`
-	IsTrimmed   bool   `json:"is_trimmed,omitempty"`
-	OriginalFPS int    `json:"original_fps,omitempty"`
+	Key        string `json:"key"`
+	FPS        int    `json:"fps"`
+	FrameCount int    `json:"frame_count"`
+	Size       []int  `json:"size,omitempty"`
+	IsPadded   bool   `json:"is_padded,omitempty"`
+	IsTrimmed  bool   `json:"is_trimmed,omitempty"`
+	// OriginalFPS, SourceFrames and SourceDuration are the average frame
+	// rate, frame count and length in seconds of the source video, if known
+	OriginalFPS    float64 `json:"original_fps,omitempty"`
+	SourceFrames   int     `json:"source_frames,omitempty"`
+	SourceDuration float64 `json:"source_duration,omitempty"`
+	BitDepth       int     `json:"bit_depth,omitempty"`
+	DType          string  `json:"dtype,omitempty"`
+	// PixelFormat is the sample layout of NPY chunks, e.g. rgb24
+	PixelFormat string `json:"pix_fmt,omitempty"`
+	// Layout is the axis order of NPY chunks, thwc or tchw
+	Layout    string      `json:"layout,omitempty"`
+	PSNR      float64     `json:"psnr,omitempty"`
+	SSIM      float64     `json:"ssim,omitempty"`
+	VMAF      float64     `json:"vmaf,omitempty"`
+	Crop      *CropRegion `json:"crop,omitempty"`
+	Decimated bool        `json:"decimated,omitempty"`
+	// Deinterlaced reports whether the clip was deinterlaced
+	Deinterlaced bool `json:"deinterlaced,omitempty"`
+	// ColorMatrix and ColorRange are the YUV matrix and range forced when
+	// converting the source, if any
+	ColorMatrix string `json:"color_matrix,omitempty"`
+	ColorRange  string `json:"color_range,omitempty"`
+	Silent      bool   `json:"silent,omitempty"`
+	Span        *Span  `json:"span,omitempty"`
+	// Shot is the shot the chunk was taken from, when splitting at scene
+	// changes
+	Shot        *Shot    `json:"shot,omitempty"`
+	Label       string   `json:"label,omitempty"`
+	FrameLabels []string `json:"frame_labels,omitempty"`
+	// Caption is the clip's caption, e.g. from an input manifest
+	Caption string `json:"caption,omitempty"`
+	// Normalization is the mean/std already applied to float NPY chunks
+	Normalization *Normalization `json:"normalization,omitempty"`
+	// BaseKey and CropView identify a multi-crop evaluation view or an
+	// augmented copy (aug0, aug1, ...) and the chunk it was taken from
+	BaseKey  string `json:"base_key,omitempty"`
+	CropView string `json:"crop_view,omitempty"`
+	// Timestamps are the source times of the sample's frames, for samples
+	// extracted at explicit timestamps
+	Timestamps []float64 `json:"timestamps,omitempty"`
+	// Augmentation records the randomized transforms applied to the chunk
+	Augmentation *Augmentation `json:"augmentation,omitempty"`
+	// Preview is the file name of the chunk's animated preview, relative to
+	// its metadata file
+	Preview string `json:"preview,omitempty"`
+	// Audio is the file name of the chunk's audio track, relative to its
+	// metadata file
+	Audio string `json:"audio,omitempty"`
+	// VideoStream is the index of the chunk's video stream among the
+	// source's video streams, recorded for sources with several
+	VideoStream *int `json:"video_stream,omitempty"`
+	// SampleRate is the sample rate in Hz of the waveform of an audio-only
+	// chunk
+	SampleRate int `json:"sample_rate,omitempty"`
+	// Motion summarizes how much the chunk's frames change
+	Motion *Motion `json:"motion,omitempty"`
+}
+
+// Motion summarizes the change between consecutive frames of a chunk, so
+// low-motion chunks can be filtered out
+type Motion struct {
+	// MeanAbsDiff is the mean absolute difference between consecutive
+	// frames, averaged over samples and frame pairs, on a 0-1 scale
+	MeanAbsDiff float64 `json:"mean_abs_diff"`
+	// StaticPercent is the percentage of frames, after the first, whose
+	// mean absolute difference from the previous frame is below the static
+	// threshold
+	StaticPercent float64 `json:"static_percent"`
+}
+
+// Augmentation records the random choices made for a chunk, so it can be
+// regenerated or audited
+type Augmentation struct {
+	// Seed is the run seed the choices were derived from
+	Seed int64 `json:"seed"`
+	// ChunkOffset is the chunk jitter offset, in frames, at which the
+	// first chunk of the chunk's span started
+	ChunkOffset int `json:"chunk_offset"`
+	// ChunkStart is the source time in seconds at which a chunk extracted
+	// at a random offset starts
+	ChunkStart *float64 `json:"chunk_start,omitempty"`
+	// Copy holds the parameters of an augmented copy
+	Copy *AugmentedCopy `json:"copy,omitempty"`
+	// RandomCrop holds the offsets of the clip's random crop
+	RandomCrop *RandomCrop `json:"random_crop,omitempty"`
+}
+
+// RandomCrop holds the exact offsets of a clip's random crop
+type RandomCrop struct {
+	// Seed is the crop's own seed, derived from the run seed and clip key
+	Seed int64 `json:"seed"`
+	// CropX and CropY place the crop as a fraction of the slack left after
+	// scaling (0 = left/top, 1 = right/bottom)
+	CropX float64 `json:"crop_x"`
+	CropY float64 `json:"crop_y"`
+}
+
+// AugmentedCopy holds the exact parameters of one augmented copy of a chunk
+type AugmentedCopy struct {
+	// Seed is the copy's own seed, derived from the run seed, key and span
+	Seed int64 `json:"seed"`
+	// Zoom is the scale beyond cover size applied before cropping
+	Zoom float64 `json:"zoom"`
+	// CropX and CropY place the crop as a fraction of the slack left after
+	// scaling (0 = left/top, 1 = right/bottom)
+	CropX float64 `json:"crop_x"`
+	CropY float64 `json:"crop_y"`
+	Flip  bool    `json:"flip"`
+	// Brightness, Contrast and Saturation are the eq filter's color jitter
+	Brightness float64 `json:"brightness"`
+	Contrast   float64 `json:"contrast"`
+	Saturation float64 `json:"saturation"`
 }
@@ -0,0 +1,154 @@
+// Package zarr writes processed chunks into a single Zarr v3 array, so a
+// dataset can be read lazily, e.g. from object storage with zarr-python,
+// without unpacking shards. Each processed chunk is one chunk of the array.
+package zarr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+	"github.com/melody-ding/go-vidprep/internal/types"
+)
+
+// Options configures how processed chunks are written to a Zarr store
+type Options struct {
+	// Format is the format of the processed chunks, npy or npz
+	Format processor.OutputFormat
+}
+
+// dataTypes maps NumPy dtypes of chunks to Zarr v3 data types
+var dataTypes = map[numpy.DType]string{
+	numpy.Uint8:   "uint8",
+	numpy.Uint16:  "uint16",
+	numpy.Int32:   "int32",
+	numpy.Float32: "float32",
+}
+
+// arrayMetadata is the zarr.json document of an array
+type arrayMetadata struct {
+	ZarrFormat       int            `json:"zarr_format"`
+	NodeType         string         `json:"node_type"`
+	Shape            []int          `json:"shape"`
+	DataType         string         `json:"data_type"`
+	ChunkGrid        extension      `json:"chunk_grid"`
+	ChunkKeyEncoding extension      `json:"chunk_key_encoding"`
+	FillValue        int            `json:"fill_value"`
+	Codecs           []extension    `json:"codecs"`
+	Attributes       map[string]any `json:"attributes"`
+}
+
+// extension is a named Zarr extension point with its configuration
+type extension struct {
+	Name          string         `json:"name"`
+	Configuration map[string]any `json:"configuration"`
+}
+
+// WriteChunks writes the npy or npz chunks under inputDir, in key order, to
+// a Zarr v3 array in outputDir of shape (chunks, ...chunk shape). The i-th
+// chunk of the array holds the i-th chunk's frames, and the array's "keys"
+// attribute lists the chunk keys in the same order. All chunks must have
+// the same shape and dtype.
+func WriteChunks(inputDir, outputDir string, opts Options) error {
+	if opts.Format != processor.FormatNPY && opts.Format != processor.FormatNPZ {
+		return fmt.Errorf("%w: zarr output needs npy or npz chunks, got %s", processor.ErrUnsupportedFormat, opts.Format)
+	}
+
+	ext := "." + string(opts.Format)
+	chunks, err := types.FindChunkFiles(inputDir, ext)
+	if err != nil {
+		return fmt.Errorf("error finding chunks: %v", err)
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("no %s chunks found in %s", opts.Format, inputDir)
+	}
+
+	var header numpy.Header
+	keys := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		h, err := writeChunk(chunk, outputDir, i)
+		if err != nil {
+			return fmt.Errorf("error writing chunk %s: %v", chunk, err)
+		}
+		if i == 0 {
+			header = h
+		} else if h.DType != header.DType || !slices.Equal(h.Shape, header.Shape) {
+			return fmt.Errorf("chunk %s has dtype %s and shape %v, want %s and %v like the first chunk",
+				chunk, h.DType, h.Shape, header.DType, header.Shape)
+		}
+
+		rel, err := filepath.Rel(inputDir, chunk)
+		if err != nil {
+			rel = chunk
+		}
+		keys[i] = strings.TrimSuffix(filepath.ToSlash(rel), ext)
+	}
+
+	dataType, ok := dataTypes[header.DType]
+	if !ok {
+		return fmt.Errorf("unsupported chunk dtype %s", header.DType)
+	}
+	metadata := arrayMetadata{
+		ZarrFormat: 3,
+		NodeType:   "array",
+		Shape:      append([]int{len(chunks)}, header.Shape...),
+		DataType:   dataType,
+		ChunkGrid: extension{"regular", map[string]any{
+			"chunk_shape": append([]int{1}, header.Shape...),
+		}},
+		ChunkKeyEncoding: extension{"default", map[string]any{"separator": "/"}},
+		Codecs:           []extension{{"bytes", map[string]any{"endian": "little"}}},
+		Attributes:       map[string]any{"keys": keys},
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding zarr metadata: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outputDir, "zarr.json"), data, 0644); err != nil {
+		return fmt.Errorf("error writing zarr metadata: %v", err)
+	}
+	return nil
+}
+
+// writeChunk copies the frames of an npy or npz chunk to chunk index of the
+// array and returns their header
+func writeChunk(chunk, outputDir string, index int) (numpy.Header, error) {
+	reader, err := numpy.OpenFrames(chunk)
+	if err != nil {
+		return numpy.Header{}, err
+	}
+	defer reader.Close()
+	if reader.Header.FortranOrder {
+		return numpy.Header{}, fmt.Errorf("fortran-ordered arrays are not supported")
+	}
+
+	path := filepath.Join(outputDir, chunkKey(index, len(reader.Header.Shape)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return numpy.Header{}, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return numpy.Header{}, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, reader); err != nil {
+		return numpy.Header{}, err
+	}
+	return reader.Header, file.Close()
+}
+
+// chunkKey returns the path of chunk index of an array whose chunks have
+// dims dimensions, under the default chunk key encoding
+func chunkKey(index, dims int) string {
+	parts := []string{"c", fmt.Sprint(index)}
+	for range dims {
+		parts = append(parts, "0")
+	}
+	return filepath.Join(parts...)
+}
@@ -0,0 +1,107 @@
+package zarr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/melody-ding/go-vidprep/internal/numpy"
+	"github.com/melody-ding/go-vidprep/internal/processor"
+)
+
+// createChunk writes an npy chunk of the given shape filled with value
+func createChunk(t *testing.T, path string, shape []int, value byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	w, err := numpy.NewWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	n := 1
+	for _, dim := range shape {
+		n *= dim
+	}
+	if err := w.Write(bytes.Repeat([]byte{value}, n), shape); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteChunks(t *testing.T) {
+	inputDir, outputDir := t.TempDir(), t.TempDir()
+	shape := []int{2, 2, 2, 3}
+	for i := 0; i < 3; i++ {
+		createChunk(t, filepath.Join(inputDir, "video1", fmt.Sprintf("chunk_%05d.npy", i)), shape, byte(i))
+	}
+
+	if err := WriteChunks(inputDir, outputDir, Options{Format: processor.FormatNPY}); err != nil {
+		t.Fatalf("WriteChunks() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "zarr.json"))
+	if err != nil {
+		t.Fatalf("error reading zarr.json: %v", err)
+	}
+	var metadata struct {
+		ZarrFormat int    `json:"zarr_format"`
+		Shape      []int  `json:"shape"`
+		DataType   string `json:"data_type"`
+		ChunkGrid  struct {
+			Configuration struct {
+				ChunkShape []int `json:"chunk_shape"`
+			} `json:"configuration"`
+		} `json:"chunk_grid"`
+		Attributes struct {
+			Keys []string `json:"keys"`
+		} `json:"attributes"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		t.Fatalf("error decoding zarr.json: %v", err)
+	}
+	if metadata.ZarrFormat != 3 || metadata.DataType != "uint8" {
+		t.Errorf("zarr_format = %d, data_type = %s, want 3, uint8", metadata.ZarrFormat, metadata.DataType)
+	}
+	if want := []int{3, 2, 2, 2, 3}; !slices.Equal(metadata.Shape, want) {
+		t.Errorf("shape = %v, want %v", metadata.Shape, want)
+	}
+	if want := []int{1, 2, 2, 2, 3}; !slices.Equal(metadata.ChunkGrid.Configuration.ChunkShape, want) {
+		t.Errorf("chunk_shape = %v, want %v", metadata.ChunkGrid.Configuration.ChunkShape, want)
+	}
+	wantKeys := []string{"video1/chunk_00000", "video1/chunk_00001", "video1/chunk_00002"}
+	if !slices.Equal(metadata.Attributes.Keys, wantKeys) {
+		t.Errorf("keys = %v, want %v", metadata.Attributes.Keys, wantKeys)
+	}
+
+	for i := 0; i < 3; i++ {
+		chunk, err := os.ReadFile(filepath.Join(outputDir, "c", fmt.Sprint(i), "0", "0", "0", "0"))
+		if err != nil {
+			t.Fatalf("error reading chunk %d: %v", i, err)
+		}
+		if want := bytes.Repeat([]byte{byte(i)}, 24); !bytes.Equal(chunk, want) {
+			t.Errorf("chunk %d = %v, want %v", i, chunk, want)
+		}
+	}
+}
+
+func TestWriteChunksShapeMismatch(t *testing.T) {
+	inputDir := t.TempDir()
+	createChunk(t, filepath.Join(inputDir, "video1", "chunk_00000.npy"), []int{2, 2, 2, 3}, 0)
+	createChunk(t, filepath.Join(inputDir, "video2", "chunk_00000.npy"), []int{2, 4, 4, 3}, 0)
+
+	if err := WriteChunks(inputDir, t.TempDir(), Options{Format: processor.FormatNPY}); err == nil {
+		t.Error("WriteChunks() with mismatched shapes succeeded, want error")
+	}
+}
+
+func TestWriteChunksUnsupportedFormat(t *testing.T) {
+	err := WriteChunks(t.TempDir(), t.TempDir(), Options{Format: processor.FormatPNG})
+	if !errors.Is(err, processor.ErrUnsupportedFormat) {
+		t.Errorf("WriteChunks() error = %v, want %v", err, processor.ErrUnsupportedFormat)
+	}
+}